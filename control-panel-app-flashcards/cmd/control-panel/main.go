@@ -33,6 +33,7 @@ func main() {
 		"run-migrations-up":   handleRunMigrationsUp,
 		"exec-sql":            handleExecSQL, // use the custom handler so we can inject SQL input
 		"assign-all-cards":    handleAssignAll,
+		"add-tutor":           handleAddTutor,
 		"backup-supabase":     handleBackupSupabase,
 	}
 
@@ -147,6 +148,36 @@ func handleAssignAll(args []string) error {
 	return commands.AssignAllCards(studentID, isProd)
 }
 
+func handleAddTutor(args []string) error {
+	var isProd bool
+	if len(args) >= 1 {
+		if args[0] == "--dev" || args[0] == "-d" {
+			isProd = false
+		} else if args[0] == "--prod" || args[0] == "-p" {
+			isProd = true
+		} else {
+			return fmt.Errorf("must provide argument --dev or --prod")
+		}
+	} else {
+		return fmt.Errorf("must provide argument --dev or --prod")
+	}
+
+	// skip optional "--" separator if present
+	pos := 1
+	if pos < len(args) && args[pos] == "--" {
+		pos++
+	}
+
+	if pos >= len(args) {
+		return fmt.Errorf("no email provided; pass the tutor's email as a positional argument after the env flag")
+	}
+
+	email := args[pos]
+	// anything after the email is the display name
+	displayName := strings.Join(args[pos+1:], " ")
+	return commands.AddTutor(email, displayName, isProd)
+}
+
 func handleBackupSupabase(args []string) error {
 	var isProd bool
 	if len(args) >= 1 {
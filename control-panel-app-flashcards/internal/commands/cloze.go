@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Cloze deletions are read as the web app's services.ClozeOrds reads them,
+// so the ords synced to the cards table are the cards it will show: braces
+// in an answer are matched, as in {{c1::\frac{1}{2}}}, a backslash escapes
+// the next character, and deletions can be nested in other deletions'
+// answers. Keep the two in step.
+
+var clozeOpening = regexp.MustCompile(`^\{\{c([0-9]+)::`)
+
+// clozeOrds returns the deletion numbers used in content, in order.
+func clozeOrds(content string) []int {
+	seen := map[int]bool{}
+	var ords []int
+	var collect func(content string)
+	collect = func(content string) {
+		for i := 0; i < len(content); {
+			if ord, answer, end, ok := parseDeletion(content, i); ok {
+				if !seen[ord] {
+					seen[ord] = true
+					ords = append(ords, ord)
+				}
+				collect(answer)
+				i = end
+				continue
+			}
+			if content[i] == '\\' {
+				i += 2 // an escaped character, such as \{
+				continue
+			}
+			i++
+		}
+	}
+	collect(content)
+	sort.Ints(ords)
+	return ords
+}
+
+// parseDeletion reads the deletion starting at content[start], if there is
+// one, returning its number, its answer and where it ends. The answer runs
+// to the first "}}" outside any braces it opens, less any "::hint".
+func parseDeletion(content string, start int) (ord int, answer string, end int, ok bool) {
+	m := clozeOpening.FindStringSubmatch(content[start:])
+	if m == nil {
+		return 0, "", 0, false
+	}
+	ord, err := strconv.Atoi(m[1])
+	if err != nil || ord < 1 {
+		return 0, "", 0, false
+	}
+
+	body := start + len(m[0])
+	depth, hintAt := 0, -1
+	for i := body; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++ // escaped, so never a brace or separator
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if !strings.HasPrefix(content[i:], "}}") {
+				continue
+			}
+			answer = content[body:i]
+			if hintAt >= 0 {
+				answer = content[body:hintAt]
+			}
+			return ord, answer, i + 2, true
+		case ':':
+			if depth == 0 && hintAt < 0 && strings.HasPrefix(content[i:], "::") {
+				hintAt = i
+				i++
+			}
+		}
+	}
+	return 0, "", 0, false
+}
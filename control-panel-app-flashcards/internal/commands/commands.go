@@ -173,6 +173,9 @@ func SyncOfficialCards(isProd bool) error {
 		if err := upsertCard(conn, ctx, card); err != nil {
 			return fmt.Errorf("upsert card %s: %w", card.ID, err)
 		}
+		if err := syncCardOrds(conn, ctx, card); err != nil {
+			return fmt.Errorf("sync ords for card %s: %w", card.ID, err)
+		}
 
 		desiredLower := make([]string, 0, len(card.Tags))
 		for _, t := range card.Tags {
@@ -293,9 +296,9 @@ func AssignAllCards(studentID string, isProd bool) error {
 
 	// assign all cards to the specified student
 	cmdTag, err := conn.Exec(ctx, `
-        INSERT INTO students_cards (student_id, card_id)
-        SELECT $1, id FROM cards
-        ON CONFLICT (student_id, card_id) DO NOTHING
+        INSERT INTO students_cards (student_id, card_id, ord)
+        SELECT $1, id, ord FROM cards, unnest(ords) AS ord
+        ON CONFLICT (student_id, card_id, ord) DO NOTHING
     `, studentID)
 	if err != nil {
 		return fmt.Errorf("assign cards to '%s': %w", studentID, err)
@@ -306,6 +309,51 @@ func AssignAllCards(studentID string, isProd bool) error {
 	return nil
 }
 
+// AddTutor gives the user with the given email the tutor role.
+func AddTutor(email, displayName string, isProd bool) error {
+	var dbURL string
+	var ok bool
+
+	if isProd {
+		dbURL, ok = os.LookupEnv("PROD_SUPABASE_URL")
+		if !ok || dbURL == "" {
+			return fmt.Errorf("PROD_SUPABASE_URL not set")
+		}
+	} else {
+		dbURL, ok = os.LookupEnv("DEV_SUPABASE_URL")
+		if !ok || dbURL == "" {
+			return fmt.Errorf("DEV_SUPABASE_URL not set")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	conn, err := connectDB(ctx, dbURL)
+	if err != nil {
+		return fmt.Errorf("connect db: %w", err)
+	}
+	defer func() {
+		if cerr := conn.Close(ctx); cerr != nil {
+			log.Printf("warning: failed to close db connection: %v", cerr)
+		}
+	}()
+
+	cmdTag, err := conn.Exec(ctx, `
+        INSERT INTO tutors (user_id, display_name)
+        SELECT id, $2 FROM auth.users WHERE email = $1
+        ON CONFLICT (user_id) DO UPDATE SET display_name = EXCLUDED.display_name
+    `, email, displayName)
+	if err != nil {
+		return fmt.Errorf("add tutor '%s': %w", email, err)
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return fmt.Errorf("no user with email '%s'", email)
+	}
+	fmt.Printf("User '%s' is now a tutor\n", email)
+
+	return nil
+}
+
 func BackupSupabase(isProd bool) error {
 	var dbURL string
 	var ok bool
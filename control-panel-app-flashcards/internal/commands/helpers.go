@@ -34,9 +34,99 @@ func loadCards(path string) ([]Flashcard, error) {
 	if err := json.Unmarshal(raw, &cards); err != nil {
 		return nil, fmt.Errorf("invalid cards json: %w", err)
 	}
+	for _, card := range cards {
+		// The app reads "id#ord" as the card for one ord of a note
+		if card.ID == "" || strings.Contains(card.ID, "#") {
+			return nil, fmt.Errorf("card ID %q must be set and can't contain #", card.ID)
+		}
+		if card.Front.Type == "image_occlusion" {
+			if err := validateOcclusion(card); err != nil {
+				return nil, fmt.Errorf("image_occlusion card %s: %w", card.ID, err)
+			}
+		}
+		if len(card.Ords()) == 0 {
+			return nil, fmt.Errorf("cloze card %s has no {{c1::...}} deletions", card.ID)
+		}
+		if card.Reversible && card.Front.Type == "cloze" {
+			return nil, fmt.Errorf("cloze card %s can't be reversible", card.ID)
+		}
+		if card.Front.Type == "type_answer" && strings.TrimSpace(card.Back.Content) == "" {
+			return nil, fmt.Errorf("type_answer card %s has no answer on the back", card.ID)
+		}
+		if card.Front.Type == "multiple_choice" {
+			if err := validateChoices(card); err != nil {
+				return nil, fmt.Errorf("multiple_choice card %s: %w", card.ID, err)
+			}
+		}
+	}
 	return cards, nil
 }
 
+// validateChoices checks a multiple choice card has a correct option on the
+// back, at least one distractor, and no option given twice.
+func validateChoices(card Flashcard) error {
+	if card.Back.Type != "multiple_choice" {
+		return fmt.Errorf("back type must also be multiple_choice")
+	}
+	if card.Reversible {
+		return fmt.Errorf("can't be reversible")
+	}
+	if strings.TrimSpace(card.Back.Content) == "" {
+		return fmt.Errorf("no correct option on the back")
+	}
+	if len(card.Back.Distractors) == 0 {
+		return fmt.Errorf("no distractors")
+	}
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(card.Back.Content)): true}
+	for _, d := range card.Back.Distractors {
+		key := strings.ToLower(strings.TrimSpace(d))
+		if key == "" {
+			return fmt.Errorf("blank distractor")
+		}
+		if seen[key] {
+			return fmt.Errorf("option %q given twice", strings.TrimSpace(d))
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// validateOcclusion checks an image occlusion card covers one of its image
+// assets with masks that lie on the image and have different IDs from 1.
+func validateOcclusion(card Flashcard) error {
+	o := card.Front.Occlusion
+	if o == nil || o.Image == "" {
+		return fmt.Errorf("no occlusion image on the front")
+	}
+	if card.Reversible {
+		return fmt.Errorf("can't be reversible")
+	}
+	found := false
+	for _, a := range card.Assets {
+		if a.ID == o.Image && a.Type == "image" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("image %q is not in the card's assets", o.Image)
+	}
+	if len(o.Masks) == 0 {
+		return fmt.Errorf("no masks")
+	}
+	seen := map[int]bool{}
+	for _, m := range o.Masks {
+		if m.ID < 1 || seen[m.ID] {
+			return fmt.Errorf("mask IDs must be different numbers from 1")
+		}
+		seen[m.ID] = true
+		if m.X < 0 || m.Y < 0 || m.W <= 0 || m.H <= 0 || m.X+m.W > 100 || m.Y+m.H > 100 {
+			return fmt.Errorf("mask %d is not on the image", m.ID)
+		}
+	}
+	return nil
+}
+
 func getOrCreateTagIDs(conn *pgx.Conn, ctx context.Context, cards []Flashcard) (map[string]int, error) {
 	tagIDs := make(map[string]int)
 	rows, err := conn.Query(ctx, `SELECT id, name FROM tags`)
@@ -182,9 +272,10 @@ func assignDefaultCardsToAllStudents(conn *pgx.Conn, ctx context.Context, cards
 	for _, studentID := range studentIDs {
 		for _, cardID := range defaultCardIDs {
 			if _, err := conn.Exec(ctx, `
-                INSERT INTO students_cards (student_id, card_id, due, status)
-                VALUES ($1, $2, $3, 0)
-                ON CONFLICT (student_id, card_id) DO NOTHING
+                INSERT INTO students_cards (student_id, card_id, ord, due, status)
+                SELECT $1, id, ord, $3, 0 FROM cards, unnest(ords) AS ord
+                WHERE id = $2
+                ON CONFLICT (student_id, card_id, ord) DO NOTHING
             `, studentID, cardID, now); err != nil {
 				// log and continue assigning others
 				log.Printf("Failed to assign card %s to student %s: %v", cardID, studentID, err)
@@ -234,9 +325,9 @@ func insertCards(conn *pgx.Conn, ctx context.Context, cards []Flashcard, tagIDs
 		}
 
 		if _, err := conn.Exec(ctx,
-			`INSERT INTO cards (id, front, back, assets, created_by)
-             VALUES ($1, $2, $3, $4, NULL)`,
-			card.ID, card.Front, card.Back, assetsJSON,
+			`INSERT INTO cards (id, front, back, assets, created_by, is_default, ords)
+             VALUES ($1, $2, $3, $4, NULL, $5, $6)`,
+			card.ID, card.Front, card.Back, assetsJSON, card.Default, card.Ords(),
 		); err != nil {
 			return fmt.Errorf("failed to insert card %s: %w", card.ID, err)
 		}
@@ -256,10 +347,10 @@ func insertCards(conn *pgx.Conn, ctx context.Context, cards []Flashcard, tagIDs
 		}
 
 		if _, err := conn.Exec(ctx,
-			`INSERT INTO students_cards (student_id, card_id, due, status)
-             VALUES ($1, $2, extract(epoch from now()), 0)
+			`INSERT INTO students_cards (student_id, card_id, ord, due, status)
+             SELECT $1, $2, ord, extract(epoch from now()), 0 FROM unnest($3::integer[]) AS ord
              ON CONFLICT DO NOTHING`,
-			user, card.ID,
+			user, card.ID, card.Ords(),
 		); err != nil {
 			return fmt.Errorf("failed to add card %s to user '%s': %w", card.ID, user, err)
 		}
@@ -284,20 +375,44 @@ func upsertCard(conn *pgx.Conn, ctx context.Context, card Flashcard) error {
 		return fmt.Errorf("marshal assets: %w", err)
 	}
 	_, err = conn.Exec(ctx, `
-        INSERT INTO cards (id, front, back, assets, created_by)
-        VALUES ($1, $2, $3, $4, NULL)
+        INSERT INTO cards (id, front, back, assets, created_by, is_default, ords)
+        VALUES ($1, $2, $3, $4, NULL, $5, $6)
         ON CONFLICT (id) DO UPDATE
         SET front = EXCLUDED.front,
             back = EXCLUDED.back,
             assets = EXCLUDED.assets,
-            created_by = NULL
-    `, card.ID, card.Front, card.Back, assetsJSON)
+            created_by = NULL,
+            is_default = EXCLUDED.is_default,
+            ords = EXCLUDED.ords
+    `, card.ID, card.Front, card.Back, assetsJSON, card.Default, card.Ords())
 	if err != nil {
 		return fmt.Errorf("exec upsert: %w", err)
 	}
 	return nil
 }
 
+// syncCardOrds gives every student who has the card any cloze cards it has
+// gained, and removes the ones it no longer makes. The rest keep their
+// progress.
+func syncCardOrds(conn *pgx.Conn, ctx context.Context, card Flashcard) error {
+	if _, err := conn.Exec(ctx, `
+        INSERT INTO students_cards (student_id, card_id, ord)
+        SELECT DISTINCT sc.student_id, sc.card_id, n.ord
+        FROM students_cards sc, unnest($2::integer[]) AS n(ord)
+        WHERE sc.card_id = $1
+        ON CONFLICT (student_id, card_id, ord) DO NOTHING
+    `, card.ID, card.Ords()); err != nil {
+		return fmt.Errorf("link new ords: %w", err)
+	}
+	if _, err := conn.Exec(ctx, `
+        DELETE FROM students_cards
+        WHERE card_id = $1 AND NOT (ord = ANY($2::integer[]))
+    `, card.ID, card.Ords()); err != nil {
+		return fmt.Errorf("unlink removed ords: %w", err)
+	}
+	return nil
+}
+
 // pruneTagsForCard deletes cards_tags links for a card that are not in desiredLower.
 func pruneTagsForCard(conn *pgx.Conn, ctx context.Context, cardID string, desiredLower []string) error {
 	_, err := conn.Exec(ctx, `
@@ -1,9 +1,32 @@
 package commands
 
+import "sort"
+
 type FlashcardSide struct {
 	Type    string `json:"type"`
 	Content string `json:"content"`
 	Caption string `json:"caption,omitempty"`
+	// Distractors are the wrong options on the back of a multiple choice card
+	Distractors []string `json:"distractors,omitempty"`
+	// Occlusion is the image and masks on the front of an image occlusion card
+	Occlusion *Occlusion `json:"occlusion,omitempty"`
+}
+
+// Occlusion masks are rectangles in percent of the image's width and height.
+// Each mask's ID numbers the card that tests it.
+type Occlusion struct {
+	Image      string `json:"image"`
+	Masks      []Mask `json:"masks"`
+	HideOthers bool   `json:"hide_others,omitempty"`
+}
+
+type Mask struct {
+	ID    int     `json:"id"`
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	W     float64 `json:"w"`
+	H     float64 `json:"h"`
+	Label string  `json:"label,omitempty"`
 }
 
 type Asset struct {
@@ -13,10 +36,37 @@ type Asset struct {
 }
 
 type Flashcard struct {
-	ID      string        `json:"id"`
-	Default bool          `json:"default,omitempty"`
-	Front   FlashcardSide `json:"front"`
-	Back    FlashcardSide `json:"back"`
-	Assets  []Asset       `json:"assets"`
-	Tags    []string      `json:"tags"`
+	ID      string `json:"id"`
+	Default bool   `json:"default,omitempty"`
+	// Reversible cards are also studied back to front
+	Reversible bool          `json:"reversible,omitempty"`
+	Front      FlashcardSide `json:"front"`
+	Back       FlashcardSide `json:"back"`
+	Assets     []Asset       `json:"assets"`
+	Tags       []string      `json:"tags"`
+}
+
+// Ords lists the cards to study the flashcard makes: one per cloze number
+// for "cloze" cards and one per mask for "image_occlusion" cards, otherwise
+// ord 0 and, for reversible cards, ord 1 back to front. The web app reads
+// them from the cards table.
+func (f Flashcard) Ords() []int {
+	if f.Front.Type == "image_occlusion" {
+		if f.Front.Occlusion == nil {
+			return nil
+		}
+		var ords []int
+		for _, m := range f.Front.Occlusion.Masks {
+			ords = append(ords, m.ID)
+		}
+		sort.Ints(ords)
+		return ords
+	}
+	if f.Front.Type != "cloze" {
+		if f.Reversible {
+			return []int{0, 1}
+		}
+		return []int{0}
+	}
+	return clozeOrds(f.Front.Content)
 }
@@ -0,0 +1,4 @@
+ALTER TABLE students_cards
+ADD COLUMN stability DOUBLE PRECISION NOT NULL DEFAULT 0,
+ADD COLUMN difficulty DOUBLE PRECISION NOT NULL DEFAULT 0,
+ADD COLUMN last_review BIGINT NOT NULL DEFAULT 0;
\ No newline at end of file
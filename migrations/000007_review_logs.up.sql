@@ -0,0 +1,50 @@
+-- ==============================================
+-- Table: review_logs
+-- ==============================================
+create table if not exists review_logs (
+  id uuid primary key default gen_random_uuid(),
+  student_id text not null references users_students(student_id) on delete cascade,
+  card_id text not null references cards(id) on delete cascade,
+  rating integer not null check (rating >= 1 and rating <= 4),
+  prev_status integer not null,
+  new_status integer not null,
+  prev_due bigint not null,
+  new_due bigint not null,
+  time_taken_ms integer not null default 0 check (time_taken_ms >= 0),
+  reviewed_at bigint not null default (extract(epoch from now())),
+  created_at bigint not null,
+  updated_at bigint not null
+);
+
+create trigger trigger_set_timestamps_review_logs
+before insert or update on review_logs
+for each row execute function set_timestamps();
+
+create index if not exists idx_review_logs_student_reviewed_at on review_logs(student_id, reviewed_at);
+create index if not exists idx_review_logs_card_id on review_logs(card_id);
+
+alter table review_logs enable row level security;
+
+-- Students can read their own history
+create policy "Students can read their own review logs"
+on review_logs for select
+using (
+  student_id in (
+    select student_id from users_students where user_id = auth.uid()
+  )
+);
+
+-- Students can only log answers for cards assigned to them
+create policy "Students can log answers for their own cards"
+on review_logs for insert
+with check (
+  student_id in (
+    select student_id from users_students where user_id = auth.uid()
+  )
+  and card_id in (
+    select card_id from students_cards where students_cards.student_id = review_logs.student_id
+  )
+);
+
+-- History is append-only for students
+grant select, insert on review_logs to authenticated;
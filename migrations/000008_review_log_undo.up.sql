@@ -0,0 +1,25 @@
+-- State needed to undo an answer
+alter table review_logs
+  add column prev_stability double precision not null default 0,
+  add column prev_difficulty double precision not null default 0,
+  add column prev_last_review bigint not null default 0,
+  add column counted_new_card boolean not null default false,
+  add column prev_streak_start_time bigint not null default 0,
+  add column prev_streak_end_time bigint not null default 0;
+
+-- Undoing an answer marks it rather than removing it, so the history stays
+-- append-only; undone answers are left out of stats and can't be undone twice
+alter table review_logs
+  add column undone_at bigint;
+
+create policy "Students can undo their own answers"
+on review_logs for update
+using (
+  undone_at is null
+  and student_id in (
+    select student_id from users_students where user_id = auth.uid()
+  )
+)
+with check (undone_at is not null);
+
+grant update (undone_at) on review_logs to authenticated;
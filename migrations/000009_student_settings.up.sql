@@ -0,0 +1,49 @@
+-- ==============================================
+-- Table: student_settings
+-- ==============================================
+create table if not exists student_settings (
+  student_id text primary key references users_students(student_id) on delete cascade,
+  new_cards_per_day integer not null default 20 check (new_cards_per_day >= 0),
+  max_in_progress integer not null default 5 check (max_in_progress >= 0),
+  default_tag_filter text not null default '',
+  day_rollover_hour integer not null default 0 check (day_rollover_hour >= 0 and day_rollover_hour <= 23),
+  created_at bigint not null,
+  updated_at bigint not null
+);
+
+create trigger trigger_set_timestamps_student_settings
+before insert or update on student_settings
+for each row execute function set_timestamps();
+
+alter table student_settings enable row level security;
+
+create policy "Students can read their own settings"
+on student_settings for select
+using (
+  student_id in (
+    select student_id from users_students where user_id = auth.uid()
+  )
+);
+
+create policy "Students can create their own settings"
+on student_settings for insert
+with check (
+  student_id in (
+    select student_id from users_students where user_id = auth.uid()
+  )
+);
+
+create policy "Students can update their own settings"
+on student_settings for update
+using (
+  student_id in (
+    select student_id from users_students where user_id = auth.uid()
+  )
+)
+with check (
+  student_id in (
+    select student_id from users_students where user_id = auth.uid()
+  )
+);
+
+grant select, insert, update on student_settings to authenticated;
@@ -0,0 +1,7 @@
+-- Statuses are generated from the student's scheduling profile, so the
+-- number of learning steps and review levels is no longer fixed at 3 + 3
+alter table students_cards drop constraint if exists students_cards_status_check;
+alter table students_cards add constraint students_cards_status_check check (status >= 0);
+
+alter table student_settings
+  add column if not exists scheduling_profile text not null default 'default';
@@ -0,0 +1,15 @@
+-- Lapse counting and leech handling
+alter table students_cards
+  add column if not exists lapses integer not null default 0 check (lapses >= 0),
+  add column if not exists suspended boolean not null default false,
+  add column if not exists leech boolean not null default false;
+
+alter table student_settings
+  add column if not exists leech_threshold integer not null default 8 check (leech_threshold >= 1),
+  add column if not exists leech_action text not null default 'suspend' check (leech_action in ('suspend', 'tag'));
+
+-- Keep the previous values so an answer that made a card a leech can be undone
+alter table review_logs
+  add column if not exists prev_lapses integer not null default 0,
+  add column if not exists prev_suspended boolean not null default false,
+  add column if not exists prev_leech boolean not null default false;
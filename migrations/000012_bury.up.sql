@@ -0,0 +1,3 @@
+-- Buried cards are hidden from study until the next study day
+alter table students_cards
+  add column if not exists buried_until bigint not null default 0;
@@ -0,0 +1,119 @@
+-- ==============================================
+-- Table: tutors
+-- ==============================================
+-- Rows are added by the control panel (add-tutor); users cannot make
+-- themselves tutors.
+create table if not exists tutors (
+  user_id uuid primary key references auth.users(id) on delete cascade,
+  display_name text not null default '',
+  created_at bigint not null,
+  updated_at bigint not null
+);
+
+create trigger trigger_set_timestamps_tutors
+before insert or update on tutors
+for each row execute function set_timestamps();
+
+alter table tutors enable row level security;
+
+create policy "Tutors can read their own row"
+on tutors for select
+using (user_id = auth.uid());
+
+grant select on tutors to authenticated;
+
+-- ==============================================
+-- Table: classes
+-- ==============================================
+create table if not exists classes (
+  id uuid primary key default gen_random_uuid(),
+  tutor_id uuid not null references tutors(user_id) on delete cascade,
+  name text not null check (length(trim(name)) > 0),
+  created_at bigint not null,
+  updated_at bigint not null
+);
+
+create trigger trigger_set_timestamps_classes
+before insert or update on classes
+for each row execute function set_timestamps();
+
+create index if not exists idx_classes_tutor_id on classes(tutor_id);
+
+alter table classes enable row level security;
+
+create policy "Tutors manage their own classes"
+on classes for all
+using (tutor_id = auth.uid())
+with check (tutor_id = auth.uid());
+
+grant select, insert, update, delete on classes to authenticated;
+
+-- ==============================================
+-- Table: class_members
+-- ==============================================
+create table if not exists class_members (
+  class_id uuid not null references classes(id) on delete cascade,
+  student_id text not null references users_students(student_id) on delete cascade,
+  created_at bigint not null,
+  updated_at bigint not null,
+  primary key (class_id, student_id)
+);
+
+create trigger trigger_set_timestamps_class_members
+before insert or update on class_members
+for each row execute function set_timestamps();
+
+create index if not exists idx_class_members_student_id on class_members(student_id);
+
+alter table class_members enable row level security;
+
+create policy "Tutors manage members of their own classes"
+on class_members for all
+using (
+  class_id in (select id from classes where tutor_id = auth.uid())
+)
+with check (
+  class_id in (select id from classes where tutor_id = auth.uid())
+);
+
+create policy "Students can see their own class memberships"
+on class_members for select
+using (
+  student_id in (
+    select student_id from users_students where user_id = auth.uid()
+  )
+);
+
+grant select, insert, delete on class_members to authenticated;
+
+-- ==============================================
+-- Tutor read access to their students' progress
+-- ==============================================
+-- security definer so the check does not go back through class_members' RLS
+create or replace function is_tutor_of(target_student_id text)
+returns boolean
+language sql
+security definer
+set search_path = public
+stable
+as $$
+  select exists (
+    select 1
+    from class_members m
+    join classes c on c.id = m.class_id
+    where m.student_id = target_student_id
+      and c.tutor_id = auth.uid()
+  );
+$$;
+
+create policy "Tutors can read their students' cards"
+on students_cards for select
+using (is_tutor_of(student_id));
+
+create policy "Tutors can read their students' review logs"
+on review_logs for select
+using (is_tutor_of(student_id));
+
+create policy "Tutors can read their students' settings"
+on student_settings for select
+using (is_tutor_of(student_id));
@@ -0,0 +1,70 @@
+-- ==============================================
+-- Table: assignments
+-- ==============================================
+-- A deck a tutor has assigned to a whole class or to one student. The cards
+-- are resolved (from tags or an explicit list) when the deck is assigned.
+create table if not exists assignments (
+  id uuid primary key default gen_random_uuid(),
+  tutor_id uuid not null references tutors(user_id) on delete cascade,
+  class_id uuid references classes(id) on delete cascade,
+  student_id text references users_students(student_id) on delete cascade,
+  title text not null check (length(trim(title)) > 0),
+  tags text[] not null default '{}',
+  card_ids text[] not null default '{}',
+  learn_by date, -- every card should be introduced by the end of this study day
+  created_at bigint not null,
+  updated_at bigint not null,
+  check ((class_id is null) <> (student_id is null))
+);
+
+create trigger trigger_set_timestamps_assignments
+before insert or update on assignments
+for each row execute function set_timestamps();
+
+create index if not exists idx_assignments_class_id on assignments(class_id);
+create index if not exists idx_assignments_student_id on assignments(student_id);
+
+alter table assignments enable row level security;
+
+create policy "Tutors manage their own assignments"
+on assignments for all
+using (tutor_id = auth.uid())
+with check (
+  tutor_id = auth.uid()
+  and (student_id is null or is_tutor_of(student_id))
+  and (class_id is null or class_id in (select id from classes where tutor_id = auth.uid()))
+);
+
+create policy "Students can read their assignments"
+on assignments for select
+using (
+  student_id in (
+    select student_id from users_students where user_id = auth.uid()
+  )
+  or class_id in (
+    select m.class_id
+    from class_members m
+    join users_students us on us.student_id = m.student_id
+    where us.user_id = auth.uid()
+  )
+);
+
+grant select, insert, delete on assignments to authenticated;
+
+-- ==============================================
+-- Tutors assigning cards
+-- ==============================================
+create policy "Tutors can assign official cards to their students"
+on students_cards for insert
+with check (
+  is_tutor_of(student_id)
+  and card_id in (select id from cards where created_by is null)
+);
+
+-- Tutors need the tags on official cards to assign decks by tag
+create policy "Tutors can read tags on official cards"
+on cards_tags for select
+using (
+  exists (select 1 from tutors where user_id = auth.uid())
+  and card_id in (select id from cards where created_by is null)
+);
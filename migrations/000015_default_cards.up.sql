@@ -0,0 +1,4 @@
+-- Official cards marked "default": true in cards.json are given to every
+-- student when they sign up
+alter table cards
+  add column if not exists is_default boolean not null default false;
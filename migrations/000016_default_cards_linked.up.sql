@@ -0,0 +1,5 @@
+-- Students created at sign up are marked once they have the default cards,
+-- so a failed link can be retried when they sign in. Existing students, and
+-- those the control panel adds, already have theirs.
+alter table users_students
+  add column if not exists default_cards_linked boolean not null default true;
@@ -0,0 +1,16 @@
+-- A note (a cards row) can make several cards to study, one per cloze
+-- deletion. ords lists them; plain cards have just ord 0. Each student has a
+-- students_cards row per ord, and answers are logged against it.
+alter table cards
+  add column if not exists ords integer[] not null default '{0}';
+
+alter table students_cards
+  add column if not exists ord integer not null default 0;
+
+alter table students_cards drop constraint if exists students_cards_student_id_card_id_key;
+alter table students_cards drop constraint if exists students_cards_student_id_card_id_ord_key;
+alter table students_cards
+  add constraint students_cards_student_id_card_id_ord_key unique (student_id, card_id, ord);
+
+alter table review_logs
+  add column if not exists ord integer not null default 0;
@@ -0,0 +1,5 @@
+-- Card keys are "id#ord", so an id with # in it would be read as a key.
+-- Existing rows are left unchecked; new and changed ones are checked.
+alter table cards drop constraint if exists cards_id_no_hash;
+alter table cards
+  add constraint cards_id_no_hash check (position('#' in id) = 0) not valid;
@@ -0,0 +1,4 @@
+-- The siblings an answer buried, with when each was buried until before,
+-- so undoing the answer can bring them back
+alter table review_logs
+  add column if not exists buried_siblings jsonb not null default '[]'::jsonb;
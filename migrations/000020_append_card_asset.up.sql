@@ -0,0 +1,15 @@
+-- Adds an asset to a card in one statement, so two uploads to the same card
+-- at once both keep their image. It runs as the caller, so the cards policies
+-- still decide which cards they can change.
+create or replace function append_card_asset(card_id text, asset jsonb)
+returns void
+language sql
+security invoker
+set search_path = public
+as $$
+  update cards
+  set assets = coalesce(assets, '[]'::jsonb) || jsonb_build_array(asset)
+  where id = card_id;
+$$;
+
+grant execute on function append_card_asset(text, jsonb) to authenticated;
@@ -0,0 +1,120 @@
+-- A tutor adding a student to a class only invites them. The tutor can see
+-- the student's cards and answers, and assign them decks, once the student
+-- has accepted. Existing memberships were made without asking the student,
+-- so they wait for the student to accept too.
+alter table class_members
+  add column if not exists accepted_at bigint;
+
+-- Tutors could change any column of their classes' members; now the
+-- acceptance is the student's alone
+drop policy if exists "Tutors manage members of their own classes" on class_members;
+
+create policy "Tutors can read members of their own classes"
+on class_members for select
+using (
+  class_id in (select id from classes where tutor_id = auth.uid())
+);
+
+create policy "Tutors can invite students to their own classes"
+on class_members for insert
+with check (
+  class_id in (select id from classes where tutor_id = auth.uid())
+  and accepted_at is null
+);
+
+create policy "Tutors can remove members of their own classes"
+on class_members for delete
+using (
+  class_id in (select id from classes where tutor_id = auth.uid())
+);
+
+create policy "Students can accept invitations to classes"
+on class_members for update
+using (
+  accepted_at is null
+  and student_id in (
+    select student_id from users_students where user_id = auth.uid()
+  )
+)
+with check (
+  accepted_at is not null
+  and student_id in (
+    select student_id from users_students where user_id = auth.uid()
+  )
+);
+
+create policy "Students can decline or leave classes"
+on class_members for delete
+using (
+  student_id in (
+    select student_id from users_students where user_id = auth.uid()
+  )
+);
+
+grant update (accepted_at) on class_members to authenticated;
+
+create or replace function is_tutor_of(target_student_id text)
+returns boolean
+language sql
+security definer
+set search_path = public
+stable
+as $$
+  select exists (
+    select 1
+    from class_members m
+    join classes c on c.id = m.class_id
+    where m.student_id = target_student_id
+      and m.accepted_at is not null
+      and c.tutor_id = auth.uid()
+  );
+$$;
+
+-- Class decks reach students once they have joined
+drop policy if exists "Students can read their assignments" on assignments;
+
+create policy "Students can read their assignments"
+on assignments for select
+using (
+  student_id in (
+    select student_id from users_students where user_id = auth.uid()
+  )
+  or class_id in (
+    select m.class_id
+    from class_members m
+    join users_students us on us.student_id = m.student_id
+    where us.user_id = auth.uid()
+      and m.accepted_at is not null
+  )
+);
+
+-- ==============================================
+-- Students reading the classes they are invited to
+-- ==============================================
+-- security definer so the check does not go back through class_members' RLS,
+-- whose tutor policies read classes
+create or replace function is_invited_to(target_class_id uuid)
+returns boolean
+language sql
+security definer
+set search_path = public
+stable
+as $$
+  select exists (
+    select 1
+    from class_members m
+    join users_students us on us.student_id = m.student_id
+    where m.class_id = target_class_id
+      and us.user_id = auth.uid()
+  );
+$$;
+
+create policy "Students can read the classes they are invited to"
+on classes for select
+using (is_invited_to(id));
+
+create policy "Students can read the tutors of their classes"
+on tutors for select
+using (
+  user_id in (select tutor_id from classes where is_invited_to(id))
+);
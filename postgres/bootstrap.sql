@@ -0,0 +1,68 @@
+-- ==============================================
+-- Plain Postgres bootstrap
+-- ==============================================
+-- The migrations are written for Supabase and refer to its auth schema and
+-- roles. Run this once on a plain Postgres database, before the migrations,
+-- so they apply unchanged. With DATA_BACKEND=postgres the web app connects as
+-- the owner, which RLS does not apply to; the app checks access itself.
+create schema if not exists auth;
+
+create table if not exists auth.users (
+  id uuid primary key default gen_random_uuid(),
+  email text unique
+);
+
+-- The policies call auth.uid(); it reads the same setting PostgREST sets.
+create or replace function auth.uid()
+returns uuid
+language sql
+stable
+as $$
+  select nullif(current_setting('request.jwt.claim.sub', true), '')::uuid;
+$$;
+
+do $$
+begin
+  if not exists (select 1 from pg_roles where rolname = 'anon') then
+    create role anon nologin;
+  end if;
+  if not exists (select 1 from pg_roles where rolname = 'authenticated') then
+    create role authenticated nologin;
+  end if;
+end
+$$;
+
+-- ==============================================
+-- Local auth (AUTH_PROVIDER=local)
+-- ==============================================
+-- Passwords are bcrypt hashes in the column Supabase uses for them.
+alter table auth.users
+  add column if not exists encrypted_password text,
+  add column if not exists email_confirmed_at timestamptz,
+  add column if not exists created_at timestamptz not null default now();
+
+-- Emails are looked up case-insensitively, so they must be unique that way
+-- too, or "Ada@x.com" and "ada@x.com" could be two accounts.
+alter table auth.users drop constraint if exists users_email_key;
+create unique index if not exists users_email_lower_key on auth.users (lower(email));
+
+-- Tokens are stored as sha256 hashes, never as issued.
+create table if not exists auth.local_refresh_tokens (
+  token_hash text primary key,
+  user_id uuid not null references auth.users(id) on delete cascade,
+  created_at timestamptz not null default now()
+);
+
+create index if not exists idx_local_refresh_tokens_user_id on auth.local_refresh_tokens(user_id);
+
+-- One-time tokens from emailed links, by link type (recovery, signup, email)
+create table if not exists auth.local_link_tokens (
+  token_hash text primary key,
+  user_id uuid not null references auth.users(id) on delete cascade,
+  type text not null,
+  created_at timestamptz not null default now()
+);
+
+-- For creating users by hand: crypt(password, gen_salt('bf')) makes a hash
+-- the app accepts.
+create extension if not exists pgcrypto;
@@ -0,0 +1,73 @@
+// Package auth signs users in. Provider is implemented by NewSupabase, which
+// uses Supabase Auth, and NewLocal, which keeps password hashes in the app's
+// own Postgres database so the app can run without Supabase.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+
+	// ErrInvalidLink means an emailed confirmation or reset link is unknown,
+	// already used or expired.
+	ErrInvalidLink = errors.New("invalid or expired link")
+
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+	// ErrNoAccount means no user with a confirmed email has the address.
+	ErrNoAccount = errors.New("no account with that email")
+)
+
+// Error is a failure reported by the provider, with a message fit to show
+// the user. Code and ErrorCode are Supabase's, where it gives them.
+type Error struct {
+	Status    int
+	Code      int
+	ErrorCode string
+	Message   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("auth: status %d: %s", e.Status, e.Message)
+}
+
+// Session is what signing in gives: the tokens to keep in cookies and the
+// user they belong to.
+type Session struct {
+	AccessToken  string
+	RefreshToken string
+	UserID       string
+}
+
+type Provider interface {
+	SignIn(ctx context.Context, email, password string) (Session, error)
+	// SignUp creates a user who can sign in once they follow the link to
+	// /api/auth/confirm, of type signup, that they are emailed. It does not
+	// say whether the email already has an account.
+	SignUp(ctx context.Context, email, password string) error
+	// User checks the access token and returns the ID of the user it was
+	// issued to. It returns ErrInvalidToken if the token is forged, expired
+	// or otherwise not accepted.
+	User(ctx context.Context, accessToken string) (string, error)
+	// Refresh exchanges a refresh token for a new session. The old refresh
+	// token should not be used again.
+	Refresh(ctx context.Context, refreshToken string) (Session, error)
+	// SendPasswordReset emails the user a link to /api/auth/confirm that
+	// signs them in to set a new password.
+	SendPasswordReset(ctx context.Context, email string) error
+	// UpdatePassword sets the password of the user the access token is for
+	// and revokes all their refresh tokens, so they sign in again everywhere.
+	UpdatePassword(ctx context.Context, accessToken, password string) error
+	// SignInVerifiedEmail signs in the user with the email without a
+	// password, for when an identity provider has verified the address. It
+	// returns ErrNoAccount unless the user has already confirmed the email
+	// with us, so an unconfirmed sign up can't be taken over.
+	SignInVerifiedEmail(ctx context.Context, email string) (Session, error)
+	// Verify checks the token from an emailed link; typ is the link's type,
+	// e.g. signup or recovery. The user is signed in.
+	Verify(ctx context.Context, typ, tokenHash string) (Session, error)
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/abstract-tutoring/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = "30 days"
+	linkTokenTTL    = "1 hour"
+
+	minPasswordLength = 6
+)
+
+// local keeps users in auth.users (see postgres/bootstrap.sql) with bcrypt
+// password hashes, the same format Supabase uses, so existing users can be
+// moved across. Access tokens are HS256 JWTs signed with jwtSecret, which
+// the Postgres store checks. Refresh and link tokens are random and stored
+// hashed.
+type local struct {
+	pool      *pgxpool.Pool
+	jwtSecret []byte
+	siteURL   string
+	mailer    Mailer
+}
+
+// NewLocal signs users in against the database in pool. Sign up and
+// password reset links are sent with mailer, pointing at siteURL; with no
+// mailer they are not sent at all.
+func NewLocal(pool *pgxpool.Pool, jwtSecret, siteURL string, mailer Mailer) Provider {
+	return &local{pool: pool, jwtSecret: []byte(jwtSecret), siteURL: strings.TrimRight(siteURL, "/"), mailer: mailer}
+}
+
+func (l *local) SignIn(ctx context.Context, email, password string) (Session, error) {
+	var userID, hash string
+	err := l.pool.QueryRow(ctx, `
+		select id::text, coalesce(encrypted_password, '') from auth.users
+		where lower(email) = lower($1) and email_confirmed_at is not null`, email).Scan(&userID, &hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Session{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return Session{}, ErrInvalidCredentials
+	}
+	return l.newSession(ctx, userID)
+}
+
+func (l *local) SignUp(ctx context.Context, email, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	var userID string
+	err = l.pool.QueryRow(ctx, `
+		insert into auth.users (email, encrypted_password) values ($1, $2)
+		on conflict (lower(email)) do nothing
+		returning id::text`, email, hash).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("auth: sign up attempted for existing email %s", utils.MaskEmail(email))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return l.sendLink(ctx, userID, email, "signup")
+}
+
+func (l *local) SignInVerifiedEmail(ctx context.Context, email string) (Session, error) {
+	var userID string
+	err := l.pool.QueryRow(ctx, `
+		select id::text from auth.users
+		where lower(email) = lower($1) and email_confirmed_at is not null`, email).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Session{}, ErrNoAccount
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	return l.newSession(ctx, userID)
+}
+
+func (l *local) User(ctx context.Context, accessToken string) (string, error) {
+	return ParseAccessToken(l.jwtSecret, accessToken, time.Now())
+}
+
+// Refresh tokens are single use; each refresh issues a new one.
+func (l *local) Refresh(ctx context.Context, refreshToken string) (Session, error) {
+	var userID string
+	err := l.pool.QueryRow(ctx, `
+		delete from auth.local_refresh_tokens
+		where token_hash = $1 and created_at > now() - interval '`+refreshTokenTTL+`'
+		returning user_id::text`, hashToken(refreshToken)).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Session{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	return l.newSession(ctx, userID)
+}
+
+func (l *local) newSession(ctx context.Context, userID string) (Session, error) {
+	accessToken, err := SignAccessToken(l.jwtSecret, userID, time.Now(), accessTokenTTL)
+	if err != nil {
+		return Session{}, err
+	}
+	refreshToken, hash, err := newOpaqueToken()
+	if err != nil {
+		return Session{}, err
+	}
+
+	_, err = l.pool.Exec(ctx, `insert into auth.local_refresh_tokens (token_hash, user_id) values ($1, $2)`, hash, userID)
+	if err != nil {
+		return Session{}, err
+	}
+	return Session{AccessToken: accessToken, RefreshToken: refreshToken, UserID: userID}, nil
+}
+
+// SendPasswordReset does not say whether the email has an account.
+func (l *local) SendPasswordReset(ctx context.Context, email string) error {
+	var userID string
+	err := l.pool.QueryRow(ctx, `select id::text from auth.users where lower(email) = lower($1)`, email).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("auth: password reset requested for unknown email %s", utils.MaskEmail(email))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return l.sendLink(ctx, userID, email, "recovery")
+}
+
+// sendLink emails the user a link to /api/auth/confirm of type typ. The log
+// only says a link was sent, as the link itself signs the user in.
+func (l *local) sendLink(ctx context.Context, userID, email, typ string) error {
+	if l.mailer == nil {
+		log.Printf("auth: %s link for %s not sent, no mailer is set up", typ, utils.MaskEmail(email))
+		return nil
+	}
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	_, err = l.pool.Exec(ctx, `insert into auth.local_link_tokens (token_hash, user_id, type) values ($1, $2, $3)`,
+		hash, userID, typ)
+	if err != nil {
+		return err
+	}
+
+	q := url.Values{"token_hash": {token}, "type": {typ}}
+	if err := l.mailer.SendLink(ctx, email, typ, l.siteURL+"/api/auth/confirm?"+q.Encode()); err != nil {
+		return fmt.Errorf("sending %s link: %w", typ, err)
+	}
+	log.Printf("auth: sent %s link to %s", typ, utils.MaskEmail(email))
+	return nil
+}
+
+func (l *local) UpdatePassword(ctx context.Context, accessToken, password string) error {
+	userID, err := ParseAccessToken(l.jwtSecret, accessToken, time.Now())
+	if err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// One statement, so a session can't outlive the password it was made with
+	_, err = l.pool.Exec(ctx, `
+		with revoked as (delete from auth.local_refresh_tokens where user_id = $1)
+		update auth.users set encrypted_password = $2 where id = $1`, userID, hash)
+	return err
+}
+
+// hashPassword returns an *Error for passwords bcrypt or Supabase would
+// refuse.
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", &Error{Status: http.StatusUnprocessableEntity, Message: "Password should be at least 6 characters."}
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", &Error{Status: http.StatusUnprocessableEntity, Message: "Password should be at most 72 characters."}
+	}
+	return string(hash), err
+}
+
+// Verify accepts recovery links and email confirmation (signup or email)
+// links. Each link works once.
+func (l *local) Verify(ctx context.Context, typ, tokenHash string) (Session, error) {
+	var userID string
+	err := l.pool.QueryRow(ctx, `
+		delete from auth.local_link_tokens
+		where token_hash = $1 and type = $2 and created_at > now() - interval '`+linkTokenTTL+`'
+		returning user_id::text`, hashToken(tokenHash), typ).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Session{}, ErrInvalidLink
+	}
+	if err != nil {
+		return Session{}, err
+	}
+
+	if typ == "signup" || typ == "email" {
+		_, err := l.pool.Exec(ctx, `
+			update auth.users set email_confirmed_at = coalesce(email_confirmed_at, now())
+			where id = $1`, userID)
+		if err != nil {
+			return Session{}, err
+		}
+	}
+	return l.newSession(ctx, userID)
+}
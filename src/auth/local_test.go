@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const localTestSecret = "local-test-secret"
+
+// newTestLocal runs the bootstrap on the database in TEST_DATABASE_URL and
+// empties auth.users. The tests are skipped without one. Links are kept by
+// the returned mailer rather than sent.
+func newTestLocal(t *testing.T) (*local, *testMailer) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	bootstrap, err := os.ReadFile("../../postgres/bootstrap.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, string(bootstrap)); err != nil {
+		t.Fatalf("bootstrap: %v", err)
+	}
+	if _, err := pool.Exec(ctx, `truncate auth.users cascade`); err != nil {
+		t.Fatal(err)
+	}
+
+	mailer := &testMailer{}
+	return NewLocal(pool, localTestSecret, "http://localhost", mailer).(*local), mailer
+}
+
+// testMailer keeps the links it is given.
+type testMailer struct {
+	links []string
+}
+
+func (m *testMailer) SendLink(ctx context.Context, email, typ, link string) error {
+	m.links = append(m.links, link)
+	return nil
+}
+
+func (m *testMailer) Reset() {
+	m.links = nil
+}
+
+// lastLink is the token of the latest link of type typ sent, or "".
+func lastLink(m *testMailer, typ string) string {
+	token := ""
+	for _, link := range m.links {
+		u, err := url.Parse(link)
+		if err == nil && u.Query().Get("type") == typ {
+			token = u.Query().Get("token_hash")
+		}
+	}
+	return token
+}
+
+// signedUp signs email up and confirms it.
+func signedUp(t *testing.T, l *local, mailer *testMailer, email, password string) Session {
+	t.Helper()
+	ctx := context.Background()
+	if err := l.SignUp(ctx, email, password); err != nil {
+		t.Fatal(err)
+	}
+	session, err := l.Verify(ctx, "signup", lastLink(mailer, "signup"))
+	if err != nil {
+		t.Fatalf("confirming %s: %v", email, err)
+	}
+	return session
+}
+
+func TestLocalSignUp(t *testing.T) {
+	ctx := context.Background()
+	l, mailer := newTestLocal(t)
+
+	if err := l.SignUp(ctx, "Ada@example.com", "secret1"); err != nil {
+		t.Fatal(err)
+	}
+	token := lastLink(mailer, "signup")
+	if token == "" {
+		t.Fatalf("no signup link in %q", mailer.links)
+	}
+	if _, err := l.SignIn(ctx, "Ada@example.com", "secret1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("SignIn before confirming = %v, want ErrInvalidCredentials", err)
+	}
+
+	// The same address in another case is the same account
+	mailer.Reset()
+	if err := l.SignUp(ctx, "ada@EXAMPLE.com", "other-password"); err != nil {
+		t.Errorf("SignUp again = %v, want nil so as not to say the email is taken", err)
+	}
+	if lastLink(mailer, "signup") != "" {
+		t.Error("signing up again sent another link")
+	}
+	var users int
+	if err := l.pool.QueryRow(ctx, `select count(*) from auth.users`).Scan(&users); err != nil || users != 1 {
+		t.Errorf("users = %d, %v; want 1", users, err)
+	}
+
+	confirmed, err := l.Verify(ctx, "signup", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := l.SignIn(ctx, "ADA@example.com", "secret1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.UserID != confirmed.UserID {
+		t.Errorf("signed in as %s, want %s", session.UserID, confirmed.UserID)
+	}
+	if userID, err := ParseAccessToken([]byte(localTestSecret), session.AccessToken, time.Now()); err != nil || userID != session.UserID {
+		t.Errorf("access token is for %q, %v; want %s", userID, err, session.UserID)
+	}
+	if _, err := l.SignIn(ctx, "ada@example.com", "other-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("SignIn with the second sign up's password = %v, want ErrInvalidCredentials", err)
+	}
+
+	var e *Error
+	if err := l.SignUp(ctx, "bob@example.com", "short"); !errors.As(err, &e) {
+		t.Errorf("SignUp with a short password = %v, want an *Error", err)
+	}
+}
+
+func TestLocalRefresh(t *testing.T) {
+	ctx := context.Background()
+	l, mailer := newTestLocal(t)
+	session := signedUp(t, l, mailer, "ada@example.com", "secret1")
+
+	next, err := l.Refresh(ctx, session.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.UserID != session.UserID || next.RefreshToken == session.RefreshToken {
+		t.Errorf("refreshed session = %+v, want a new refresh token for %s", next, session.UserID)
+	}
+	if userID, err := l.User(ctx, next.AccessToken); err != nil || userID != session.UserID {
+		t.Errorf("User for the refreshed access token = %q, %v; want %s", userID, err, session.UserID)
+	}
+	// Each refresh token works once
+	if _, err := l.Refresh(ctx, session.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("reusing a refresh token = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := l.Refresh(ctx, next.RefreshToken); err != nil {
+		t.Errorf("refreshing with the new token: %v", err)
+	}
+	if _, err := l.Refresh(ctx, "made-up"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("made up refresh token = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestLocalUpdatePassword(t *testing.T) {
+	ctx := context.Background()
+	l, mailer := newTestLocal(t)
+	session := signedUp(t, l, mailer, "ada@example.com", "secret1")
+	other, err := l.SignIn(ctx, "ada@example.com", "secret1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := signedUp(t, l, mailer, "bob@example.com", "secret2")
+
+	if err := l.UpdatePassword(ctx, session.AccessToken, "new-secret"); err != nil {
+		t.Fatal(err)
+	}
+	// Every session made with the old password is signed out
+	for _, s := range []Session{session, other} {
+		if _, err := l.Refresh(ctx, s.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("refresh after the password changed = %v, want ErrInvalidRefreshToken", err)
+		}
+	}
+	if _, err := l.Refresh(ctx, bob.RefreshToken); err != nil {
+		t.Errorf("another user's session: %v", err)
+	}
+
+	if _, err := l.SignIn(ctx, "ada@example.com", "secret1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("SignIn with the old password = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := l.SignIn(ctx, "ada@example.com", "new-secret"); err != nil {
+		t.Errorf("SignIn with the new password: %v", err)
+	}
+	if err := l.UpdatePassword(ctx, "not-a-token", "new-secret"); err == nil {
+		t.Error("UpdatePassword with a bad access token succeeded")
+	}
+}
+
+func TestLocalLinks(t *testing.T) {
+	ctx := context.Background()
+	l, mailer := newTestLocal(t)
+	session := signedUp(t, l, mailer, "ada@example.com", "secret1")
+
+	mailer.Reset()
+	if err := l.SendPasswordReset(ctx, "nobody@example.com"); err != nil {
+		t.Errorf("reset for an unknown email = %v, want nil", err)
+	}
+	if lastLink(mailer, "recovery") != "" {
+		t.Error("sent a reset link for an unknown email")
+	}
+
+	if err := l.SendPasswordReset(ctx, "ADA@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := lastLink(mailer, "recovery")
+	if _, err := l.Verify(ctx, "signup", token); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("recovery link used as a signup link = %v, want ErrInvalidLink", err)
+	}
+	recovered, err := l.Verify(ctx, "recovery", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered.UserID != session.UserID {
+		t.Errorf("reset signed in as %s, want %s", recovered.UserID, session.UserID)
+	}
+	if _, err := l.Verify(ctx, "recovery", token); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("reusing a link = %v, want ErrInvalidLink", err)
+	}
+}
+
+// Without a mailer the links go nowhere; the log never has them.
+func TestLocalWithoutMailer(t *testing.T) {
+	ctx := context.Background()
+	l, _ := newTestLocal(t)
+	l.mailer = nil
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	if err := l.SignUp(ctx, "ada@example.com", "secret1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SendPasswordReset(ctx, "ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(logs.String(), "token_hash") || strings.Contains(logs.String(), "ada@") {
+		t.Errorf("log has a link or the address: %s", logs.String())
+	}
+}
+
+func TestLocalSignInVerifiedEmail(t *testing.T) {
+	ctx := context.Background()
+	l, mailer := newTestLocal(t)
+
+	if err := l.SignUp(ctx, "bob@example.com", "secret2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.SignInVerifiedEmail(ctx, "bob@example.com"); !errors.Is(err, ErrNoAccount) {
+		t.Errorf("unconfirmed email = %v, want ErrNoAccount", err)
+	}
+
+	session := signedUp(t, l, mailer, "Ada@example.com", "secret1")
+	got, err := l.SignInVerifiedEmail(ctx, "ada@example.COM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != session.UserID {
+		t.Errorf("signed in as %s, want %s", got.UserID, session.UserID)
+	}
+}
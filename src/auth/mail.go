@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer sends the local provider's emails: links to /api/auth/confirm of
+// type "signup" or "recovery". Whoever has a link can sign in as the user,
+// so it must only reach their inbox.
+type Mailer interface {
+	SendLink(ctx context.Context, email, typ, link string) error
+}
+
+// LogMailer writes links to the log instead of sending them. It is for
+// development only: anyone who can read the log can confirm accounts and
+// reset passwords with them.
+type LogMailer struct{}
+
+func (LogMailer) SendLink(ctx context.Context, email, typ, link string) error {
+	log.Printf("auth: %s link for %s: %s", typ, email, link)
+	return nil
+}
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer sends mail through the server at addr ("host:port") from the
+// address from. With a username it signs in with PLAIN auth, which net/smtp
+// only does over TLS or to localhost.
+func NewSMTPMailer(addr, username, password, from string) Mailer {
+	m := &smtpMailer{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *smtpMailer) SendLink(ctx context.Context, email, typ, link string) error {
+	msg, err := linkEmail(m.from, email, typ, link)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{email}, msg)
+}
+
+// linkEmail is the message sent for a link of type typ.
+func linkEmail(from, to, typ, link string) ([]byte, error) {
+	var subject, body string
+	switch typ {
+	case "signup":
+		subject = "Confirm your email"
+		body = "Follow this link to confirm your email and finish signing up:"
+	case "recovery":
+		subject = "Reset your password"
+		body = "Follow this link to choose a new password:"
+	default:
+		return nil, fmt.Errorf("no email for %s links", typ)
+	}
+	// The addresses come from sign up forms, so a line break in one could
+	// add headers
+	if strings.ContainsAny(from+to, "\r\n") {
+		return nil, fmt.Errorf("invalid email address")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	fmt.Fprintf(&b, "%s\r\n\r\n%s\r\n\r\nIf you didn't ask for this, you can ignore this email.\r\n", body, link)
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLinkEmail(t *testing.T) {
+	msg, err := linkEmail("app@example.com", "ada@example.com", "recovery", "https://example.com/api/auth/confirm?token_hash=t&type=recovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"From: app@example.com\r\n",
+		"To: ada@example.com\r\n",
+		"Subject: Reset your password\r\n",
+		"\r\n\r\nFollow this link to choose a new password:\r\n\r\nhttps://example.com/api/auth/confirm?token_hash=t&type=recovery\r\n",
+	} {
+		if !strings.Contains(string(msg), want) {
+			t.Errorf("message doesn't have %q:\n%s", want, msg)
+		}
+	}
+
+	if _, err := linkEmail("app@example.com", "ada@example.com\r\nBcc: eve@example.com", "signup", "link"); err == nil {
+		t.Error("an address with a line break was accepted")
+	}
+	if _, err := linkEmail("app@example.com", "ada@example.com", "invite", "link"); err == nil {
+		t.Error("a link type with no email was accepted")
+	}
+}
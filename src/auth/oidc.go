@@ -0,0 +1,418 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidIDToken means an ID token failed validation: bad signature,
+// wrong issuer or audience, expired or a nonce mismatch.
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// clockSkew is how far the identity provider's clock may be from ours.
+const clockSkew = time.Minute
+
+// OIDCConfig is one identity provider from the OIDC_PROVIDERS file.
+type OIDCConfig struct {
+	ID           string `json:"id"`   // used in URLs, e.g. "google"
+	Name         string `json:"name"` // shown on the login button
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// TrustEmail accepts the email claim as verified when the provider does
+	// not send email_verified, as Microsoft Entra ID doesn't. Only set it for
+	// a single-tenant issuer whose addresses the school controls.
+	TrustEmail bool `json:"trust_email,omitempty"`
+}
+
+// LoadOIDCConfigs reads the providers in a JSON file (an array of configs).
+// An empty path loads nothing.
+func LoadOIDCConfigs(path string) ([]OIDCConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OIDC providers: %w", err)
+	}
+
+	var configs []OIDCConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse OIDC providers: %w", err)
+	}
+	seen := map[string]bool{}
+	for i, c := range configs {
+		if c.ID == "" || c.Issuer == "" || c.ClientID == "" {
+			return nil, fmt.Errorf("OIDC provider %q needs an id, issuer and client_id", c.ID)
+		}
+		if strings.Trim(c.ID, "abcdefghijklmnopqrstuvwxyz0123456789-_") != "" {
+			return nil, fmt.Errorf("OIDC provider id %q may only use lowercase letters, digits, - and _", c.ID)
+		}
+		if seen[c.ID] {
+			return nil, fmt.Errorf("duplicate OIDC provider %q", c.ID)
+		}
+		seen[c.ID] = true
+		if c.Name == "" {
+			configs[i].Name = c.ID
+		}
+	}
+	return configs, nil
+}
+
+// Identity is who an ID token says signed in.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// OIDC signs users in with an OpenID Connect provider using the
+// authorisation code flow with PKCE. The provider's discovery document and
+// keys are fetched when first needed and cached.
+type OIDC struct {
+	OIDCConfig
+	redirectURL string
+	client      *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]crypto.PublicKey // by kid
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDC returns a client for the provider that sends users back to
+// redirectURL after they sign in.
+func NewOIDC(config OIDCConfig, redirectURL string) *OIDC {
+	config.Issuer = strings.TrimRight(config.Issuer, "/")
+	return &OIDC{OIDCConfig: config, redirectURL: redirectURL, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// RandomToken returns a random URL-safe string, for the OIDC state, nonce
+// and PKCE code verifier.
+func RandomToken() (string, error) {
+	token, _, err := newOpaqueToken()
+	return token, err
+}
+
+// AuthCodeURL is where to send the user to sign in. state and nonce are
+// checked on the way back; verifier is the PKCE code verifier, of which
+// only the S256 challenge is sent now.
+func (o *OIDC) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := o.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.ClientID},
+		"redirect_uri":          {o.redirectURL},
+		"scope":                 {"openid email profile"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange swaps the code from the redirect for an ID token, validates it
+// and returns who it is for.
+func (o *OIDC) Exchange(ctx context.Context, code, verifier, nonce string) (Identity, error) {
+	d, err := o.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.redirectURL},
+		"client_id":     {o.ClientID},
+		"code_verifier": {verifier},
+	}
+	if o.ClientSecret != "" {
+		form.Set("client_secret", o.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var result struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := o.getJSON(req, &result)
+	if err != nil {
+		return Identity{}, fmt.Errorf("oidc %s: token request failed: %w", o.ID, err)
+	}
+	if status != http.StatusOK || result.IDToken == "" {
+		return Identity{}, fmt.Errorf("oidc %s: token request: status %d: %s %s", o.ID, status, result.Error, result.ErrorDescription)
+	}
+
+	return o.VerifyIDToken(ctx, result.IDToken, nonce, time.Now())
+}
+
+// VerifyIDToken checks the token's signature against the provider's keys,
+// its issuer, audience, expiry and nonce.
+func (o *OIDC) VerifyIDToken(ctx context.Context, token, nonce string, now time.Time) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return Identity{}, ErrInvalidIDToken
+	}
+	var h struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if json.Unmarshal(header, &h) != nil {
+		return Identity{}, ErrInvalidIDToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	key, err := o.key(ctx, h.Kid)
+	if err != nil {
+		return Identity{}, err
+	}
+	if !verifySignature(h.Alg, key, parts[0]+"."+parts[1], sig) {
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Identity{}, ErrInvalidIDToken
+	}
+	var c struct {
+		Iss           string          `json:"iss"`
+		Sub           string          `json:"sub"`
+		Aud           json.RawMessage `json:"aud"`
+		Azp           string          `json:"azp"`
+		Exp           int64           `json:"exp"`
+		Iat           int64           `json:"iat"`
+		Nonce         string          `json:"nonce"`
+		Email         string          `json:"email"`
+		EmailVerified interface{}     `json:"email_verified"`
+	}
+	if json.Unmarshal(payload, &c) != nil {
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	// aud is a string or a list of strings
+	var audience []string
+	if json.Unmarshal(c.Aud, &audience) != nil {
+		var single string
+		if json.Unmarshal(c.Aud, &single) != nil {
+			return Identity{}, ErrInvalidIDToken
+		}
+		audience = []string{single}
+	}
+	audienceOK := false
+	for _, aud := range audience {
+		audienceOK = audienceOK || aud == o.ClientID
+	}
+
+	switch {
+	case strings.TrimRight(c.Iss, "/") != o.Issuer,
+		!audienceOK,
+		len(audience) > 1 && c.Azp != o.ClientID,
+		c.Sub == "",
+		c.Exp == 0 || now.Add(-clockSkew).Unix() >= c.Exp,
+		c.Iat > now.Add(clockSkew).Unix(),
+		c.Nonce != nonce:
+		return Identity{}, ErrInvalidIDToken
+	}
+
+	// Some providers send email_verified as a string
+	verified := c.EmailVerified == true || c.EmailVerified == "true"
+	if c.EmailVerified == nil && o.TrustEmail {
+		verified = true
+	}
+	return Identity{Issuer: o.Issuer, Subject: c.Sub, Email: c.Email, EmailVerified: verified && c.Email != ""}, nil
+}
+
+func (o *OIDC) discover(ctx context.Context) (*oidcDiscovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.discovery != nil {
+		return o.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", o.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var d oidcDiscovery
+	status, err := o.getJSON(req, &d)
+	if err != nil || status != http.StatusOK {
+		return nil, fmt.Errorf("oidc %s: discovery failed: status %d: %v", o.ID, status, err)
+	}
+	if strings.TrimRight(d.Issuer, "/") != o.Issuer || d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc %s: discovery document for issuer %q is incomplete or for another issuer", o.ID, d.Issuer)
+	}
+	o.discovery = &d
+	return o.discovery, nil
+}
+
+// key returns the provider's signing key with the kid. The keys are fetched
+// again when the kid is unknown, as providers rotate them.
+func (o *OIDC) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	key, ok := o.keys[kid]
+	o.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	d, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", d.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	status, err := o.getJSON(req, &set)
+	if err != nil || status != http.StatusOK {
+		return nil, fmt.Errorf("oidc %s: fetching keys failed: status %d: %v", o.ID, status, err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if pub, err := k.publicKey(); err == nil && (k.Use == "" || k.Use == "sig") {
+			keys[k.Kid] = pub
+		}
+	}
+
+	o.mu.Lock()
+	o.keys = keys
+	o.mu.Unlock()
+
+	// A token with no kid is fine if the provider has only one key
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrInvalidIDToken
+}
+
+// getJSON sends the request and decodes the response body into out whatever
+// the status.
+func (o *OIDC) getJSON(req *http.Request, out interface{}) (int, error) {
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// jwk is a JSON Web Key; only RSA and P-256 EC keys are used.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) > 4 {
+			return nil, errors.New("bad RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("EC point not on curve")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// verifySignature supports RS256, the algorithm OIDC requires, and ES256.
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) bool {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(pub, digest[:], r, s)
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abstract-tutoring/auth"
+	"github.com/abstract-tutoring/auth/oidctest"
+)
+
+const redirectURL = "http://app.test/api/auth/oidc/callback"
+
+func newOIDC(issuer *oidctest.Issuer) *auth.OIDC {
+	return auth.NewOIDC(auth.OIDCConfig{ID: "test", Issuer: issuer.URL, ClientID: issuer.ClientID}, redirectURL)
+}
+
+// authorize follows the auth code URL to the issuer and returns the code
+// and state it redirects back with.
+func authorize(t *testing.T, o *auth.OIDC, state, nonce, verifier string) (code, gotState string) {
+	t.Helper()
+	authURL, err := o.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d", resp.StatusCode)
+	}
+
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(back.String(), redirectURL+"?") {
+		t.Fatalf("authorize redirected to %q", resp.Header.Get("Location"))
+	}
+	return back.Query().Get("code"), back.Query().Get("state")
+}
+
+func TestOIDCExchange(t *testing.T) {
+	issuer := oidctest.NewIssuer("client")
+	defer issuer.Close()
+	issuer.Email = "ada@example.com"
+	o := newOIDC(issuer)
+	ctx := context.Background()
+
+	t.Run("signs in", func(t *testing.T) {
+		code, state := authorize(t, o, "state", "nonce", "verifier")
+		if state != "state" {
+			t.Errorf("state = %q, want state", state)
+		}
+		identity, err := o.Exchange(ctx, code, "verifier", "nonce")
+		if err != nil {
+			t.Fatalf("Exchange: %v", err)
+		}
+		want := auth.Identity{Issuer: issuer.URL, Subject: "user-1", Email: "ada@example.com", EmailVerified: true}
+		if identity != want {
+			t.Errorf("identity = %+v, want %+v", identity, want)
+		}
+
+		// Codes work once
+		if _, err := o.Exchange(ctx, code, "verifier", "nonce"); err == nil {
+			t.Error("code worked twice")
+		}
+	})
+
+	t.Run("wrong PKCE verifier", func(t *testing.T) {
+		code, _ := authorize(t, o, "state", "nonce", "verifier")
+		if _, err := o.Exchange(ctx, code, "other-verifier", "nonce"); err == nil {
+			t.Error("exchanged a code with the wrong verifier")
+		}
+	})
+
+	t.Run("wrong nonce", func(t *testing.T) {
+		code, _ := authorize(t, o, "state", "nonce", "verifier")
+		if _, err := o.Exchange(ctx, code, "verifier", "other-nonce"); !errors.Is(err, auth.ErrInvalidIDToken) {
+			t.Errorf("err = %v, want ErrInvalidIDToken", err)
+		}
+	})
+
+	t.Run("unverified email", func(t *testing.T) {
+		issuer.EmailVerified = false
+		defer func() { issuer.EmailVerified = true }()
+		code, _ := authorize(t, o, "state", "nonce", "verifier")
+		identity, err := o.Exchange(ctx, code, "verifier", "nonce")
+		if err != nil {
+			t.Fatalf("Exchange: %v", err)
+		}
+		if identity.EmailVerified {
+			t.Error("email is verified")
+		}
+	})
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	issuer := oidctest.NewIssuer("client")
+	defer issuer.Close()
+
+	authURL, err := newOIDC(issuer).AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, _ := url.Parse(authURL)
+	// The S256 challenge of "verifier", from RFC 7636's definition
+	want := "iMnq5o6zALKXGivsnlom_0F5_WYda32GHkxlV7mq7hQ"
+	if got := q.Query().Get("code_challenge"); got != want {
+		t.Errorf("code_challenge = %q, want %q", got, want)
+	}
+	if q.Query().Get("code_verifier") != "" {
+		t.Error("the verifier was sent")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	issuer := oidctest.NewIssuer("client")
+	defer issuer.Close()
+	issuer.Email = "ada@example.com"
+	o := newOIDC(issuer)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+
+	with := func(changes map[string]interface{}) string {
+		claims := issuer.Claims("nonce", now)
+		for k, v := range changes {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		return issuer.Sign(claims)
+	}
+	tampered := func(token string) string {
+		parts := strings.Split(token, ".")
+		claims := issuer.Claims("nonce", now)
+		claims["email"] = "mallory@example.com"
+		other := strings.Split(issuer.Sign(claims), ".")
+		return parts[0] + "." + other[1] + "." + parts[2]
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"valid", with(nil), true},
+		{"audience list", with(map[string]interface{}{"aud": []string{"client"}}), true},
+		{"audience list with azp", with(map[string]interface{}{"aud": []string{"client", "other"}, "azp": "client"}), true},
+		{"audience list without azp", with(map[string]interface{}{"aud": []string{"client", "other"}}), false},
+		{"wrong audience", with(map[string]interface{}{"aud": "other"}), false},
+		{"wrong issuer", with(map[string]interface{}{"iss": "https://evil.example.com"}), false},
+		{"expired", with(map[string]interface{}{"exp": now.Add(-2 * time.Minute).Unix()}), false},
+		{"expired within skew", with(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()}), true},
+		{"no expiry", with(map[string]interface{}{"exp": nil}), false},
+		{"issued in the future", with(map[string]interface{}{"iat": now.Add(time.Hour).Unix()}), false},
+		{"wrong nonce", with(map[string]interface{}{"nonce": "other"}), false},
+		{"no subject", with(map[string]interface{}{"sub": ""}), false},
+		{"signed by another key", oidctest.SignWith(otherKey, oidctest.KeyID, issuer.Claims("nonce", now)), false},
+		{"unknown kid", oidctest.SignWith(issuer.Key, "other-key", issuer.Claims("nonce", now)), false},
+		{"tampered claims", tampered(with(nil)), false},
+		{"unsigned", strings.Join(strings.Split(with(nil), ".")[:2], ".") + ".", false},
+		{"alg none", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"test-key"}`)) +
+			"." + strings.Split(with(nil), ".")[1] + ".", false},
+		{"not a JWT", "nonsense", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := o.VerifyIDToken(context.Background(), tt.token, "nonce", now)
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("err = %v, want valid", err)
+				}
+				if identity.Email != "ada@example.com" || !identity.EmailVerified {
+					t.Errorf("identity = %+v", identity)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("accepted, identity %+v", identity)
+			}
+		})
+	}
+}
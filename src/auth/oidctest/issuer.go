@@ -0,0 +1,172 @@
+// Package oidctest is an OpenID Connect issuer for tests. It serves
+// discovery, keys, an authorisation endpoint that signs in a fixed user
+// without asking, and a token endpoint that checks the PKCE verifier.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// KeyID is the kid of the issuer's signing key.
+const KeyID = "test-key"
+
+// Issuer is a running mock issuer. Set Email and EmailVerified to choose
+// who signs in.
+type Issuer struct {
+	*httptest.Server
+	ClientID      string
+	Key           *rsa.PrivateKey
+	Email         string
+	EmailVerified bool
+
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+// grant is what an authorisation code was issued for.
+type grant struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+}
+
+// NewIssuer starts an issuer for the client. Close it when done.
+func NewIssuer(clientID string) *Issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	i := &Issuer{ClientID: clientID, Key: key, EmailVerified: true, codes: map[string]grant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("/jwks", i.jwks)
+	mux.HandleFunc("/authorize", i.authorize)
+	mux.HandleFunc("/token", i.token)
+	i.Server = httptest.NewServer(mux)
+	return i
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 i.URL,
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"jwks_uri":               i.URL + "/jwks",
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := i.Key.PublicKey
+	writeJSON(w, http.StatusOK, map[string][]map[string]string{"keys": {{
+		"kty": "RSA",
+		"kid": KeyID,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+// authorize signs the user in at once and redirects back with a code.
+func (i *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != i.ClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "bad authorisation request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	i.mu.Lock()
+	i.codes[code] = grant{redirectURI: q.Get("redirect_uri"), challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	i.mu.Unlock()
+
+	back := url.Values{"code": {code}, "state": {q.Get("state")}}
+	http.Redirect(w, r, q.Get("redirect_uri")+"?"+back.Encode(), http.StatusFound)
+}
+
+// token swaps a code for an ID token. Each code works once, and only with
+// the verifier its challenge was made from.
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	code := r.PostForm.Get("code")
+	i.mu.Lock()
+	g, ok := i.codes[code]
+	delete(i.codes, code)
+	i.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok, r.PostForm.Get("grant_type") != "authorization_code",
+		r.PostForm.Get("client_id") != i.ClientID,
+		r.PostForm.Get("redirect_uri") != g.redirectURI:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	case base64.RawURLEncoding.EncodeToString(challenge[:]) != g.challenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"id_token":     i.Sign(i.Claims(g.nonce, time.Now())),
+	})
+}
+
+// Claims are those of an ID token for the issuer's user, issued at now.
+func (i *Issuer) Claims(nonce string, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":            i.URL,
+		"sub":            "user-1",
+		"aud":            i.ClientID,
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          i.Email,
+		"email_verified": i.EmailVerified,
+	}
+}
+
+// Sign makes an RS256 ID token with the issuer's key.
+func (i *Issuer) Sign(claims map[string]interface{}) string {
+	return SignWith(i.Key, KeyID, claims)
+}
+
+// SignWith makes an RS256 token with any key, for tokens the issuer didn't
+// sign.
+func SignWith(key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,299 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abstract-tutoring/models"
+)
+
+// supabase is Supabase Auth (GoTrue) under /auth/v1.
+type supabase struct {
+	baseURL        string
+	apiKey         string
+	serviceRoleKey string
+	client         *http.Client
+
+	mu sync.Mutex
+	// users caches the user of each access token GoTrue has accepted for
+	// userCacheFor, so a session isn't checked on every request
+	users map[string]verifiedToken
+}
+
+// userCacheFor is how long an accepted access token is taken on trust. It is
+// short because GoTrue can end a session before its token expires, e.g. when
+// the password is changed on another server, and does not tell us.
+const userCacheFor = 5 * time.Second
+
+type verifiedToken struct {
+	userID string
+	expiry time.Time
+}
+
+// NewSupabase uses the Supabase project at baseURL with its anon key.
+// serviceRoleKey is only needed to sign in through an identity provider
+// (SignInVerifiedEmail) and may be "".
+func NewSupabase(baseURL, apiKey, serviceRoleKey string) Provider {
+	return &supabase{
+		baseURL:        strings.TrimRight(baseURL, "/"),
+		apiKey:         apiKey,
+		serviceRoleKey: serviceRoleKey,
+		client:         http.DefaultClient,
+		users:          map[string]verifiedToken{},
+	}
+}
+
+// do sends payload as JSON to the endpoint and decodes the response into out
+// if not nil. Error responses come back as *Error.
+func (s *supabase) do(ctx context.Context, method, endpoint, accessToken string, payload, out interface{}) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+"/auth/v1/"+endpoint, bytes.NewReader(payloadBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("apikey", s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		log.Printf("auth: %s %s: status %d, body: %s", method, endpoint, resp.StatusCode, string(body))
+
+		var apiErr struct {
+			Code      int    `json:"code"`
+			ErrorCode string `json:"error_code"`
+			Message   string `json:"msg"`
+			Error     string `json:"error"`
+		}
+		json.Unmarshal(body, &apiErr)
+
+		// Prefer msg, fallback to error
+		msg := apiErr.Message
+		if msg == "" {
+			msg = apiErr.Error
+		}
+		return &Error{Status: resp.StatusCode, Code: apiErr.Code, ErrorCode: apiErr.ErrorCode, Message: msg}
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode %s response: %w", endpoint, err)
+		}
+	}
+	return nil
+}
+
+func (s *supabase) session(ctx context.Context, endpoint string, payload interface{}) (Session, error) {
+	var result models.LoginResponse
+	if err := s.do(ctx, "POST", endpoint, "", payload, &result); err != nil {
+		return Session{}, err
+	}
+	return Session{AccessToken: result.AccessToken, RefreshToken: result.RefreshToken, UserID: result.User.ID}, nil
+}
+
+func (s *supabase) SignIn(ctx context.Context, email, password string) (Session, error) {
+	session, err := s.session(ctx, "token?grant_type=password", map[string]string{
+		"email":    email,
+		"password": password,
+	})
+	if _, ok := err.(*Error); ok {
+		return Session{}, ErrInvalidCredentials
+	}
+	return session, err
+}
+
+func (s *supabase) SignUp(ctx context.Context, email, password string) error {
+	return s.do(ctx, "POST", "signup", "", map[string]string{
+		"email":    email,
+		"password": password,
+	}, nil)
+}
+
+// adminUser is the part of a user from the admin API that we use.
+type adminUser struct {
+	ID               string     `json:"id"`
+	Email            string     `json:"email"`
+	EmailConfirmedAt *time.Time `json:"email_confirmed_at"`
+}
+
+// SignInVerifiedEmail looks the user up with the admin API, then has it
+// generate a recovery link for them and follows it at once, which gives an
+// ordinary Supabase session. A magic link isn't used, as GoTrue signs up
+// emails it hasn't seen when asked for one.
+func (s *supabase) SignInVerifiedEmail(ctx context.Context, email string) (Session, error) {
+	if s.serviceRoleKey == "" {
+		return Session{}, errors.New("auth: signing in by verified email needs the Supabase service role key")
+	}
+
+	user, err := s.confirmedUser(ctx, email)
+	if err != nil {
+		return Session{}, err
+	}
+
+	var link struct {
+		adminUser
+		HashedToken      string `json:"hashed_token"`
+		VerificationType string `json:"verification_type"`
+	}
+	err = s.do(ctx, "POST", "admin/generate_link", s.serviceRoleKey, map[string]string{
+		"type":  "recovery",
+		"email": user.Email,
+	}, &link)
+	if apiErr, ok := err.(*Error); ok && apiErr.Status == http.StatusNotFound {
+		return Session{}, ErrNoAccount
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	if link.ID != user.ID {
+		return Session{}, fmt.Errorf("auth: link generated for user %s, not %s", link.ID, user.ID)
+	}
+
+	return s.session(ctx, "verify", map[string]string{
+		"type":       link.VerificationType,
+		"token_hash": link.HashedToken,
+	})
+}
+
+// confirmedUser finds the user with the email through the admin API. It
+// returns ErrNoAccount if there is none or they haven't confirmed the email,
+// as signing them in would confirm it for them.
+func (s *supabase) confirmedUser(ctx context.Context, email string) (adminUser, error) {
+	var result struct {
+		Users []adminUser `json:"users"`
+	}
+	// The filter matches part of the email, so look for the exact one
+	query := url.Values{"filter": {email}, "per_page": {"50"}}
+	if err := s.do(ctx, "GET", "admin/users?"+query.Encode(), s.serviceRoleKey, nil, &result); err != nil {
+		return adminUser{}, err
+	}
+	for _, user := range result.Users {
+		if strings.EqualFold(user.Email, email) {
+			if user.EmailConfirmedAt == nil {
+				break
+			}
+			return user, nil
+		}
+	}
+	return adminUser{}, ErrNoAccount
+}
+
+// User asks GoTrue for the token's user, which checks the signature.
+func (s *supabase) User(ctx context.Context, accessToken string) (string, error) {
+	expiry, ok := TokenExpiry(accessToken)
+	if !ok || !time.Now().Before(expiry) {
+		return "", ErrInvalidToken
+	}
+
+	s.mu.Lock()
+	cached, ok := s.users[accessToken]
+	s.mu.Unlock()
+	if ok {
+		return cached.userID, nil
+	}
+
+	var user struct {
+		ID string `json:"id"`
+	}
+	err := s.do(ctx, "GET", "user", accessToken, nil, &user)
+	if apiErr, ok := err.(*Error); ok && (apiErr.Status == http.StatusUnauthorized || apiErr.Status == http.StatusForbidden) {
+		return "", ErrInvalidToken
+	}
+	if err != nil {
+		return "", err
+	}
+	if user.ID == "" {
+		return "", errors.New("auth: no user ID for the access token")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for token, v := range s.users {
+		if !now.Before(v.expiry) {
+			delete(s.users, token)
+		}
+	}
+	s.users[accessToken] = verifiedToken{userID: user.ID, expiry: minTime(expiry, now.Add(userCacheFor))}
+	return user.ID, nil
+}
+
+// forgetUser drops the cached access tokens of the user, once their sessions
+// have ended.
+func (s *supabase) forgetUser(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token, v := range s.users {
+		if v.userID == userID {
+			delete(s.users, token)
+		}
+	}
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func (s *supabase) Refresh(ctx context.Context, refreshToken string) (Session, error) {
+	session, err := s.session(ctx, "token?grant_type=refresh_token", map[string]string{
+		"refresh_token": refreshToken,
+	})
+	if _, ok := err.(*Error); ok {
+		return Session{}, ErrInvalidRefreshToken
+	}
+	return session, err
+}
+
+func (s *supabase) SendPasswordReset(ctx context.Context, email string) error {
+	return s.do(ctx, "POST", "recover", "", map[string]string{"email": email}, nil)
+}
+
+func (s *supabase) UpdatePassword(ctx context.Context, accessToken, password string) error {
+	userID, err := s.User(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	if err := s.do(ctx, "PUT", "user", accessToken, map[string]interface{}{"password": password}, nil); err != nil {
+		return err
+	}
+	// GoTrue keeps the user's other sessions, so end them all, and stop
+	// taking their access tokens from the cache
+	defer s.forgetUser(userID)
+	return s.do(ctx, "POST", "logout?scope=global", accessToken, nil, nil)
+}
+
+func (s *supabase) Verify(ctx context.Context, typ, tokenHash string) (Session, error) {
+	session, err := s.session(ctx, "verify", map[string]string{
+		"type":       typ,
+		"token_hash": tokenHash,
+	})
+	if apiErr, ok := err.(*Error); ok && apiErr.Status == http.StatusForbidden {
+		return Session{}, ErrInvalidLink
+	}
+	return session, err
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeGoTrue serves the admin and verify endpoints SignInVerifiedEmail uses.
+// It fails the test if a link is asked for a user it doesn't have, as GoTrue
+// would sign them up.
+func fakeGoTrue(t *testing.T, users []map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/auth/v1/verify" && r.Header.Get("Authorization") != "Bearer service-role" {
+			http.Error(w, `{"msg":"not admin"}`, http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/auth/v1/admin/users":
+			filter := strings.ToLower(r.URL.Query().Get("filter"))
+			var matched []map[string]interface{}
+			for _, u := range users {
+				if strings.Contains(strings.ToLower(u["email"].(string)), filter) {
+					matched = append(matched, u)
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"users": matched})
+
+		case "/auth/v1/admin/generate_link":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["type"] != "recovery" {
+				t.Errorf("generate_link type = %q, want recovery", body["type"])
+			}
+			for _, u := range users {
+				if u["email"] == body["email"] {
+					json.NewEncoder(w).Encode(map[string]interface{}{
+						"id": u["id"], "email": u["email"], "hashed_token": "hash-" + u["id"].(string), "verification_type": "recovery",
+					})
+					return
+				}
+			}
+			t.Errorf("generate_link asked for unknown email %q", body["email"])
+			http.Error(w, `{"msg":"User not found"}`, http.StatusNotFound)
+
+		case "/auth/v1/verify":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "access", "refresh_token": "refresh",
+				"user": map[string]string{"id": strings.TrimPrefix(body["token_hash"], "hash-")},
+			})
+
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestSupabaseSignInVerifiedEmail(t *testing.T) {
+	server := fakeGoTrue(t, []map[string]interface{}{
+		{"id": "confirmed", "email": "ada@example.com", "email_confirmed_at": "2024-01-01T00:00:00Z"},
+		{"id": "unconfirmed", "email": "bob@example.com", "email_confirmed_at": nil},
+		{"id": "similar", "email": "xada@example.com", "email_confirmed_at": "2024-01-01T00:00:00Z"},
+	})
+	defer server.Close()
+	provider := NewSupabase(server.URL, "anon", "service-role")
+
+	tests := []struct {
+		email   string
+		wantID  string
+		wantErr error
+	}{
+		{"ada@example.com", "confirmed", nil},
+		{"ADA@example.com", "confirmed", nil},
+		{"bob@example.com", "", ErrNoAccount},
+		{"new@example.com", "", ErrNoAccount},
+		// Matches part of xada@example.com only
+		{"da@example.com", "", ErrNoAccount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			session, err := provider.SignInVerifiedEmail(context.Background(), tt.email)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if session.UserID != tt.wantID {
+				t.Errorf("UserID = %q, want %q", session.UserID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestSupabaseSignInVerifiedEmailNeedsServiceRole(t *testing.T) {
+	provider := NewSupabase("http://localhost", "anon", "")
+	if _, err := provider.SignInVerifiedEmail(context.Background(), "ada@example.com"); err == nil {
+		t.Fatal("signed in without the service role key")
+	}
+}
+
+func TestSupabaseUser(t *testing.T) {
+	good, err := SignAccessToken([]byte("project-secret"), "ada", time.Now(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, _ := SignAccessToken([]byte("forged"), "bob", time.Now(), time.Hour)
+	expired, _ := SignAccessToken([]byte("project-secret"), "ada", time.Now().Add(-2*time.Hour), time.Hour)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/auth/v1/user" || r.Header.Get("Authorization") != "Bearer "+good {
+			http.Error(w, `{"msg":"invalid JWT"}`, http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id": "ada"})
+	}))
+	defer server.Close()
+	s := NewSupabase(server.URL, "anon", "")
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if userID, err := s.User(ctx, good); err != nil || userID != "ada" {
+			t.Errorf("User = %q, %v; want ada", userID, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("%d requests to GoTrue, want the user kept after the first", requests)
+	}
+	for name, token := range map[string]string{"forged": forged, "expired": expired, "not a JWT": "made-up"} {
+		if _, err := s.User(ctx, token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("User with a %s token = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestSupabaseUpdatePasswordEndsSessions(t *testing.T) {
+	first, _ := SignAccessToken([]byte("project-secret"), "ada", time.Now(), time.Hour)
+	second, _ := SignAccessToken([]byte("project-secret"), "ada", time.Now().Add(time.Second), time.Hour)
+
+	signedOut := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case signedOut:
+			http.Error(w, `{"msg":"session not found"}`, http.StatusForbidden)
+		case r.URL.Path == "/auth/v1/logout":
+			signedOut = true
+		case r.URL.Path == "/auth/v1/user":
+			json.NewEncoder(w).Encode(map[string]string{"id": "ada"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	s := NewSupabase(server.URL, "anon", "").(*supabase)
+	ctx := context.Background()
+
+	for _, token := range []string{first, second} {
+		if _, err := s.User(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Tokens are only taken on trust for a few seconds
+	if v := s.users[first]; v.expiry.After(time.Now().Add(userCacheFor)) {
+		t.Errorf("token cached until %v, want at most %v", v.expiry, userCacheFor)
+	}
+
+	if err := s.UpdatePassword(ctx, first, "new-secret"); err != nil {
+		t.Fatal(err)
+	}
+	// The user's other session ended with the password change
+	if _, err := s.User(ctx, second); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("User with the other session's token = %v, want ErrInvalidToken", err)
+	}
+}
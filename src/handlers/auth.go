@@ -1,31 +1,43 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
-	"html/template"
-	"io"
 	"log"
 	"net/http"
 	"time"
 
-	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/auth"
 	"github.com/abstract-tutoring/utils"
 )
 
-func LoginPage(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles("./frontend/templates/login.html", "./frontend/templates/partials/backend-error.html")
+// authProvider signs users in. main sets it with UseAuth before serving.
+var authProvider auth.Provider
+
+func UseAuth(p auth.Provider) {
+	authProvider = p
+}
+
+type loginData struct {
+	Error     string
+	Code      int
+	Message   string
+	Providers []*auth.OIDC
+}
+
+// renderLogin shows the login page with a button for each OIDC provider.
+func renderLogin(w http.ResponseWriter, r *http.Request, data loginData) {
+	tmpl, err := parseTemplates(r, "./frontend/templates/login.html", "./frontend/templates/partials/backend-error.html")
 	if err != nil {
-		log.Printf("LoginPage: Template parse error: %v", err)
+		log.Printf("renderLogin: Template parse error: %v", err)
 		http.Error(w, "Template error", http.StatusInternalServerError)
 		return
 	}
-	tmpl.Execute(w, struct {
-		Error   string
-		Code    int
-		Message string
-	}{
+	data.Providers = oidcProviders
+	tmpl.Execute(w, data)
+}
+
+func LoginPage(w http.ResponseWriter, r *http.Request) {
+	renderLogin(w, r, loginData{
 		Error:   r.URL.Query().Get("error"),
 		Code:    0,
 		Message: r.URL.Query().Get("message"),
@@ -41,27 +53,27 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	email := r.FormValue("email")
 	password := r.FormValue("password")
 
-	log.Printf("LoginHandler: Login attempt for email: %s", email)
+	if wait := loginLimits.attempt(r.Context(), r, email); wait > 0 {
+		log.Printf("LoginHandler: Rate limited %s from %s for %s", utils.MaskEmail(email), utils.ClientIP(r), wait.Round(time.Second))
+		w.WriteHeader(http.StatusTooManyRequests)
+		renderLogin(w, r, loginData{
+			Error: tooManyAttempts(wait),
+			Code:  http.StatusTooManyRequests,
+		})
+		return
+	}
 
-	accessToken, refreshToken, userId, err := AuthenticateWithSupabase(email, password)
+	log.Printf("LoginHandler: Login attempt for email: %s", utils.MaskEmail(email))
+
+	session, err := authProvider.SignIn(r.Context(), email, password)
 	if err != nil {
-		log.Printf("LoginHandler: Authentication failed for email: %s", email)
-		tmpl, tmplErr := template.ParseFiles(
-			"./frontend/templates/login.html",
-			"./frontend/templates/partials/backend-error.html",
-		)
-		if tmplErr != nil {
-			log.Printf("LoginHandler: Template parse error: %v", tmplErr)
-			http.Error(w, "Template error", http.StatusInternalServerError)
-			return
+		log.Printf("LoginHandler: Authentication failed for email: %s", utils.MaskEmail(email))
+		// Only wrong passwords count; the attempt was counted up front so
+		// that ones made at the same time can't all get through
+		if !errors.Is(err, auth.ErrInvalidCredentials) {
+			loginLimits.refund(r.Context(), r, email)
 		}
-
-		// General error struct for alert partial
-		tmpl.Execute(w, struct {
-			Error   string
-			Code    int
-			Message string
-		}{
+		renderLogin(w, r, loginData{
 			Error:   "Invalid credentials",
 			Code:    0,
 			Message: "Invalid credentials",
@@ -69,139 +81,48 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	loginLimits.reset(r.Context(), r, email)
+	finishProvisioning(r.Context(), dataStore.For(session.AccessToken), session.UserID)
+
 	// Set cookies (secure defaults via utils.SetCookie)
-	utils.SetCookie(w, r, "access_token", accessToken, time.Now().Add(15*time.Minute))
-	utils.SetCookie(w, r, "refresh_token", refreshToken, time.Now().Add(30*24*time.Hour))
-	utils.SetCookie(w, r, "user_id", userId, time.Now().Add(30*24*time.Hour))
+	setSessionCookies(w, r, session)
+	setCSRFToken(w, r)
 	// session cookies for UI state/preferences
 	utils.SetCookie(w, r, "review_ahead_days", "0", time.Time{})
-	utils.SetCookie(w, r, "max_new_cards_per_day", models.MaxNewCardsPerDay, time.Time{})
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-func AuthenticateWithSupabase(email, password string) (string, string, string, error) {
-	supabaseUrl := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL")
-	apiKey := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY")
-
-	loginPayload := map[string]string{
-		"email":    email,
-		"password": password,
-	}
-	payloadBytes, _ := json.Marshal(loginPayload)
-
-	req, err := http.NewRequest("POST", supabaseUrl+"/auth/v1/token?grant_type=password", bytes.NewReader(payloadBytes))
-	if err != nil {
-		return "", "", "", err
-	}
-	req.Header.Set("apikey", apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", "", "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("AuthenticateWithSupabase: Non-200 status: %d, body: %s", resp.StatusCode, string(body))
-		return "", "", "", errors.New("invalid credentials")
-	}
-
-	var result models.LoginResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", "", "", err
-	}
-
-	return result.AccessToken, result.RefreshToken, result.User.ID, nil
-}
-
-func refreshAccessToken(r *http.Request) (string, string, error) {
-	refreshCookie, err := r.Cookie("refresh_token")
-	if err != nil {
-		return "", "", errors.New("refresh token missing")
-	}
-	refreshToken := refreshCookie.Value
-
-	supabaseUrl := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL")
-	apiKey := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY")
-
-	payload := map[string]string{
-		"refresh_token": refreshToken,
-	}
-	payloadBytes, _ := json.Marshal(payload)
-
-	req, _ := http.NewRequest("POST", supabaseUrl+"/auth/v1/token?grant_type=refresh_token", bytes.NewReader(payloadBytes))
-	req.Header.Set("apikey", apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		return "", "", errors.New("failed to refresh access token")
-	}
-	defer resp.Body.Close()
-
-	var result models.LoginResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", "", errors.New("failed to decode refreshed token")
-	}
-
-	return result.AccessToken, result.RefreshToken, nil
-}
-
 func forceLogout(w http.ResponseWriter, r *http.Request) {
 	// Delete all auth-related cookies using utils.ClearCookie
-	cookiesToClear := []string{"access_token", "refresh_token", "user_id", "current_card_id"}
+	cookiesToClear := []string{"access_token", "refresh_token", "user_id", "current_card_id", "undo_stack"}
 
 	for _, name := range cookiesToClear {
 		utils.ClearCookie(w, r, name)
 	}
 
+	// HTMX would swap the login page into the partial it asked for, so it is
+	// told to redirect the whole page instead
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Redirect", "/login")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
 	// Redirect to login page
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
 
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	// Clear cookies using utils.ClearCookie
-	for _, name := range []string{"access_token", "refresh_token", "user_id", "current_card_id", "review_ahead_days", "max_new_cards_per_day"} {
+	for _, name := range []string{"access_token", "refresh_token", "user_id", "current_card_id", "review_ahead_days", "max_new_cards_per_day", "undo_stack", csrfCookie} {
 		utils.ClearCookie(w, r, name)
 	}
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
 
-func fetchStudentIdByUserId(userId, accessToken string) (string, error) {
-	supabaseUrl := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL")
-	apiKey := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY")
-
-	req, _ := http.NewRequest("GET", supabaseUrl+"/rest/v1/users_students?select=student_id&user_id=eq."+userId, nil)
-
-	req.Header.Set("apikey", apiKey)
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil || resp.StatusCode != 200 {
-		return "", errors.New("failed to fetch student ID")
-	}
-	defer resp.Body.Close()
-
-	var result []struct {
-		StudentID string `json:"student_id"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || len(result) == 0 {
-		return "", errors.New("student ID not found")
-	}
-	return result[0].StudentID, nil
-}
-
-func clearSessionCookies(w http.ResponseWriter, r *http.Request) {
-	// Clear session cookies (use utils.ClearCookie to match security flags)
-	utils.ClearCookie(w, r, "user_id")
-	utils.ClearCookie(w, r, "access_token")
-}
-
 func ForgotPasswordPage(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles("./frontend/templates/forgot-password.html", "./frontend/templates/partials/backend-error.html")
+	tmpl, err := parseTemplates(r, "./frontend/templates/forgot-password.html", "./frontend/templates/partials/backend-error.html")
 	if err != nil {
 		log.Printf("ForgotPasswordPage: Failed to parse template: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -217,7 +138,7 @@ func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	email := r.FormValue("email")
 	if email == "" {
-		tmpl, err := template.ParseFiles("./frontend/templates/forgot-password.html", "./frontend/templates/partials/backend-error.html")
+		tmpl, err := parseTemplates(r, "./frontend/templates/forgot-password.html", "./frontend/templates/partials/backend-error.html")
 		if err != nil {
 			log.Printf("ForgotPasswordHandler: Template parse error: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -235,70 +156,51 @@ func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	supabaseUrl := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL")
-	apiKey := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY")
-
-	payload := map[string]string{
-		"email": email,
-	}
-	payloadBytes, _ := json.Marshal(payload)
-
-	req, err := http.NewRequest("POST", supabaseUrl+"/auth/v1/recover", bytes.NewReader(payloadBytes))
-	if err != nil {
-		log.Printf("ForgotPasswordHandler: Failed to create request: %v", err)
-		tmpl, _ := template.ParseFiles("./frontend/templates/forgot-password.html", "./frontend/templates/partials/backend-error.html")
-		tmpl.Execute(w, struct{ Error string }{Error: "Failed to send reset email"})
-		return
-	}
-	req.Header.Set("apikey", apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Printf("ForgotPasswordHandler: HTTP error: %v", err)
-		tmpl, _ := template.ParseFiles("./frontend/templates/forgot-password.html", "./frontend/templates/partials/backend-error.html")
-		tmpl.Execute(w, struct{ Error string }{Error: "Failed to send reset email"})
+	if wait := passwordResetLimits.attempt(r.Context(), r, email); wait > 0 {
+		log.Printf("ForgotPasswordHandler: Rate limited %s from %s for %s", utils.MaskEmail(email), utils.ClientIP(r), wait.Round(time.Second))
+		tmpl, err := parseTemplates(r, "./frontend/templates/forgot-password.html", "./frontend/templates/partials/backend-error.html")
+		if err != nil {
+			log.Printf("ForgotPasswordHandler: Template parse error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+		tmpl.Execute(w, struct {
+			Error string
+			Code  int
+		}{
+			Error: tooManyAttempts(wait),
+			Code:  http.StatusTooManyRequests,
+		})
 		return
 	}
-	defer resp.Body.Close()
-
-	log.Printf("ForgotPasswordHandler: Response status code: %d", resp.StatusCode)
 
-	if resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("ForgotPasswordHandler: Non-200 status code: %d, body: %s", resp.StatusCode, string(body))
+	if err := authProvider.SendPasswordReset(r.Context(), email); err != nil {
+		log.Printf("ForgotPasswordHandler: %v", err)
 
-		var apiErr struct {
-			Code      int    `json:"code"`
-			ErrorCode string `json:"error_code"`
-			Message   string `json:"msg"`
-			Error     string `json:"error"`
-		}
-		json.Unmarshal(body, &apiErr)
-
-		// Prefer msg, fallback to error, fallback to generic
-		errMsg := apiErr.Message
-		if errMsg == "" {
-			errMsg = apiErr.Error
-		}
-		if errMsg == "" {
-			errMsg = "Failed to send reset email"
+		errMsg, code, errorCode := "Failed to send reset email", 0, ""
+		var authErr *auth.Error
+		if errors.As(err, &authErr) {
+			if authErr.Message != "" {
+				errMsg = authErr.Message
+			}
+			code, errorCode = authErr.Code, authErr.ErrorCode
 		}
 
-		tmpl, _ := template.ParseFiles("./frontend/templates/forgot-password.html", "./frontend/templates/partials/backend-error.html")
+		tmpl, _ := parseTemplates(r, "./frontend/templates/forgot-password.html", "./frontend/templates/partials/backend-error.html")
 		tmpl.Execute(w, struct {
 			Error     string
 			Code      int
 			ErrorCode string
 		}{
 			Error:     errMsg,
-			Code:      apiErr.Code,
-			ErrorCode: apiErr.ErrorCode,
+			Code:      code,
+			ErrorCode: errorCode,
 		})
 		return
 	}
 
-	tmpl, _ := template.ParseFiles("./frontend/templates/forgot-password.html", "./frontend/templates/partials/backend-error.html")
+	tmpl, _ := parseTemplates(r, "./frontend/templates/forgot-password.html", "./frontend/templates/partials/backend-error.html")
 	tmpl.Execute(w, struct {
 		Error   string
 		Code    int
@@ -312,7 +214,7 @@ func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
 
 func PasswordResetPage(w http.ResponseWriter, r *http.Request) {
 	accessToken := r.URL.Query().Get("access_token")
-	tmpl, err := template.ParseFiles("./frontend/templates/password-reset.html", "./frontend/templates/partials/backend-error.html")
+	tmpl, err := parseTemplates(r, "./frontend/templates/password-reset.html", "./frontend/templates/partials/backend-error.html")
 	if err != nil {
 		log.Printf("PasswordResetPage: Failed to parse template: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -327,15 +229,11 @@ func PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken := ""
-	cookie, err := r.Cookie("access_token")
-	if err == nil {
-		accessToken = cookie.Value
-	}
+	accessToken := sessionFrom(r).AccessToken
 
 	newPassword := r.FormValue("password")
 	if accessToken == "" || newPassword == "" {
-		tmpl, _ := template.ParseFiles("./frontend/templates/password-reset.html", "./frontend/templates/partials/backend-error.html")
+		tmpl, _ := parseTemplates(r, "./frontend/templates/password-reset.html", "./frontend/templates/partials/backend-error.html")
 		tmpl.Execute(w, struct {
 			Error       string
 			Code        int
@@ -350,74 +248,16 @@ func PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	supabaseUrl := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL")
-	apiKey := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY")
-
-	payload := map[string]interface{}{
-		"password": newPassword,
-	}
-	payloadBytes, _ := json.Marshal(payload)
+	if err := authProvider.UpdatePassword(r.Context(), accessToken, newPassword); err != nil {
+		log.Printf("PasswordResetHandler: %v", err)
 
-	req, err := http.NewRequest("PUT", supabaseUrl+"/auth/v1/user", bytes.NewReader(payloadBytes))
-	if err != nil {
-		log.Printf("PasswordResetHandler: Failed to create request: %v", err)
-		tmpl, _ := template.ParseFiles("./frontend/templates/password-reset.html", "./frontend/templates/partials/backend-error.html")
-		tmpl.Execute(w, struct {
-			Error       string
-			Code        int
-			Message     string
-			AccessToken string
-		}{
-			Error:       "Failed to create request",
-			Code:        0,
-			Message:     "",
-			AccessToken: accessToken,
-		})
-		return
-	}
-	req.Header.Set("apikey", apiKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Printf("PasswordResetHandler: Failed to send request: %v", err)
-		tmpl, _ := template.ParseFiles("./frontend/templates/password-reset.html", "./frontend/templates/partials/backend-error.html")
-		tmpl.Execute(w, struct {
-			Error       string
-			Code        int
-			Message     string
-			AccessToken string
-		}{
-			Error:       "Failed to send request",
-			Code:        0,
-			Message:     "",
-			AccessToken: accessToken,
-		})
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("PasswordResetHandler: Non-200 status code: %d, body: %s", resp.StatusCode, string(body))
-
-		var apiErr struct {
-			Code    int    `json:"code"`
-			Message string `json:"msg"`
-			Error   string `json:"error"`
+		errMsg, code, message := "Failed to reset password", 0, ""
+		var authErr *auth.Error
+		if errors.As(err, &authErr) && authErr.Message != "" {
+			errMsg, code, message = authErr.Message, authErr.Code, authErr.Message
 		}
-		json.Unmarshal(body, &apiErr)
 
-		errMsg := apiErr.Message
-		if errMsg == "" {
-			errMsg = apiErr.Error
-		}
-		if errMsg == "" {
-			errMsg = "Failed to reset password"
-		}
-
-		tmpl, _ := template.ParseFiles("./frontend/templates/password-reset.html", "./frontend/templates/partials/backend-error.html")
+		tmpl, _ := parseTemplates(r, "./frontend/templates/password-reset.html", "./frontend/templates/partials/backend-error.html")
 		tmpl.Execute(w, struct {
 			Error       string
 			Code        int
@@ -425,8 +265,8 @@ func PasswordResetHandler(w http.ResponseWriter, r *http.Request) {
 			AccessToken string
 		}{
 			Error:       errMsg,
-			Code:        apiErr.Code,
-			Message:     apiErr.Message,
+			Code:        code,
+			Message:     message,
 			AccessToken: accessToken,
 		})
 		return
@@ -444,69 +284,34 @@ func ConfirmHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	supabaseUrl := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL")
-	apiKey := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY")
-
-	payload := map[string]string{
-		"type":       typ,
-		"token_hash": tokenHash,
-	}
-	payloadBytes, _ := json.Marshal(payload)
-
-	req, err := http.NewRequest("POST", supabaseUrl+"/auth/v1/verify", bytes.NewReader(payloadBytes))
-	if err != nil {
-		log.Printf("ConfirmHandler: Failed to create request: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	session, err := authProvider.Verify(r.Context(), typ, tokenHash)
+	if errors.Is(err, auth.ErrInvalidLink) {
+		log.Printf("ConfirmHandler: %v", err)
+		renderLogin(w, r, loginData{Error: "Error 403: Invalid reset link"})
 		return
 	}
-	req.Header.Set("apikey", apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Printf("ConfirmHandler: HTTP error: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Printf("ConfirmHandler: %v", err)
+		http.Error(w, "Verification failed", http.StatusUnauthorized)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == 403 {
-		log.Printf("ConfirmHandler: Supabase response status: %d", resp.StatusCode)
-		tmpl, err := template.ParseFiles("./frontend/templates/login.html", "./frontend/templates/partials/backend-error.html")
-		if err != nil {
-			http.Redirect(w, r, "/login?error=Error+403%3A+Invalid+reset+link", http.StatusSeeOther)
+	// Set cookies with secure defaults and expiries
+	setSessionCookies(w, r, session)
+	setCSRFToken(w, r)
+
+	// First confirmation of a new account: set up their student
+	if typ == "signup" {
+		if _, err := provisionStudent(r.Context(), dataStore.For(session.AccessToken), session.UserID); err != nil {
+			log.Printf("ConfirmHandler: %v", err)
+			http.Error(w, "Your email is confirmed but your account could not be set up", http.StatusInternalServerError)
 			return
 		}
-		tmpl.Execute(w, struct{ Error string }{Error: "Error 403: Invalid reset link"})
-		return
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("ConfirmHandler: Supabase response status: %d", resp.StatusCode)
-		http.Error(w, "Verification failed", http.StatusUnauthorized)
-		return
-	}
-
-	var result struct {
-		AccessToken  string `json:"access_token"`
-		RefreshToken string `json:"refresh_token"`
-		User         struct {
-			ID string `json:"id"`
-		} `json:"user"`
-	}
-
-	body, _ := io.ReadAll(resp.Body)
-	if err := json.Unmarshal(body, &result); err != nil {
-		log.Printf("ConfirmHandler: Failed to decode Supabase response: %v", err)
-		http.Error(w, "Failed to decode Supabase response", http.StatusInternalServerError)
-		return
+		if redirectUrl == "" {
+			redirectUrl = "/"
+		}
 	}
 
-	// Set cookies with secure defaults and expiries
-	utils.SetCookie(w, r, "access_token", result.AccessToken, time.Now().Add(15*time.Minute))
-	utils.SetCookie(w, r, "refresh_token", result.RefreshToken, time.Now().Add(30*24*time.Hour))
-	utils.SetCookie(w, r, "user_id", result.User.ID, time.Now().Add(30*24*time.Hour))
-
 	if redirectUrl == "" {
 		redirectUrl = "/password-reset"
 	}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abstract-tutoring/auth"
+	"github.com/abstract-tutoring/ratelimit"
+)
+
+// wrongPasswordAuth turns down every sign in, slowly enough for others to
+// start meanwhile, and counts them.
+type wrongPasswordAuth struct {
+	auth.Provider
+	signIns *atomic.Int32
+}
+
+func (a wrongPasswordAuth) SignIn(ctx context.Context, email, password string) (auth.Session, error) {
+	a.signIns.Add(1)
+	time.Sleep(10 * time.Millisecond)
+	return auth.Session{}, auth.ErrInvalidCredentials
+}
+
+func TestLoginConcurrentFailures(t *testing.T) {
+	var signIns atomic.Int32
+	UseAuth(wrongPasswordAuth{signIns: &signIns})
+	defer UseAuth(nil)
+	UseRateLimitStore(ratelimit.NewMemory())
+	defer UseRateLimitStore(ratelimit.NewMemory())
+
+	const tries = 50
+	var limited atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < tries; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			form := url.Values{"email": {"Ada@example.com"}, "password": {"guess"}}
+			r := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if w := serve(LoginHandler, r); w.Code == http.StatusTooManyRequests {
+				limited.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Only the email's five free attempts get through; the rest are held
+	// back while those are still going
+	if got := int(signIns.Load()); got != 5 {
+		t.Errorf("%d sign ins reached the provider, want 5", got)
+	}
+	if got := int(limited.Load()); got != tries-5 {
+		t.Errorf("%d attempts were rate limited, want %d", got, tries-5)
+	}
+}
@@ -1,51 +1,37 @@
 package handlers
 
 import (
-	"html/template"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/abstract-tutoring/models"
 	"github.com/abstract-tutoring/services"
-	"github.com/abstract-tutoring/utils"
 )
 
 func ServeBrowsePage(w http.ResponseWriter, r *http.Request) {
-	userCookie, err := r.Cookie("user_id")
-	if err != nil || userCookie.Value == "" {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
-	userId := userCookie.Value
-
-	accessTokenCookie, err := r.Cookie("access_token")
-	if err != nil || accessTokenCookie.Value == "" {
-		http.Error(w, "Not authenticated", http.StatusUnauthorized)
-		return
-	}
-	accessToken := accessTokenCookie.Value
-
-	supabaseUrl := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL")
-	apiKey := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY")
-
-	studentId, err := fetchStudentId(r, userId, supabaseUrl, apiKey)
-	if err != nil || studentId == "" {
+	session := sessionFrom(r)
+	userId, studentId := session.UserID, session.StudentID
+	if studentId == "" {
 		// No mapping: show browse page with empty cards, but keep search bar etc.
 		data := struct {
 			StudentID  string
 			Flashcards []interface{}
 			Query      string
+			View       string
 			HasMore    bool
 			NextOffset int
 		}{
 			StudentID:  "",
 			Flashcards: []interface{}{},
 			Query:      "",
+			View:       "",
 			HasMore:    false,
 			NextOffset: 0,
 		}
 
-		tmpl, err := template.ParseFiles(
+		tmpl, err := parseTemplates(r,
 			"./frontend/templates/browse.html",
 			"./frontend/templates/partials/flashcard-item.html",
 		)
@@ -57,19 +43,23 @@ func ServeBrowsePage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	studentCards, err := fetchStudentCards(w, r, studentId, supabaseUrl, apiKey)
+	studentCards, err := fetchStudentCards(r, studentId)
 	if err != nil {
 		http.Error(w, "Could not load student cards", http.StatusInternalServerError)
 		return
 	}
 
-	allCards, err := services.LoadCardsJSON(accessToken)
+	allCards, err := storesFor(r).Cards.All(r.Context())
 	if err != nil {
 		http.Error(w, "Could not load card content", http.StatusInternalServerError)
 		return
 	}
 
+	profile := studentScheduler(loadStudentSettings(r, studentId)).Profile()
+
 	query := strings.ToLower(r.URL.Query().Get("query"))
+	view := r.URL.Query().Get("view") // "" for all cards, "leeches" for leeches only
+	now := time.Now().Unix()
 	offsetStr := r.URL.Query().Get("offset")
 	offset, _ := strconv.Atoi(offsetStr)
 	pageSize := 25
@@ -82,14 +72,21 @@ func ServeBrowsePage(w http.ResponseWriter, r *http.Request) {
 		Tags       []string
 		Status     int
 		StatusText string // ← added
+		Lapses     int
+		Suspended  bool
+		Leech      bool
+		Buried     bool
 	}
 
 	var filtered []FlashcardPreview
 	for _, c := range studentCards {
-		content, ok := allCards[c.CardID]
+		content, ok := allCards[models.NoteID(c.CardID)]
 		if !ok {
 			continue
 		}
+		if view == "leeches" && !c.Leech {
+			continue
+		}
 
 		preview := FlashcardPreview{
 			ID:         c.CardID,
@@ -97,7 +94,11 @@ func ServeBrowsePage(w http.ResponseWriter, r *http.Request) {
 			Back:       content.Back.Content,
 			IsOwner:    content.CreatedBy == userId,
 			Status:     c.Status,
-			StatusText: statusToText(c.Status), // ← added
+			StatusText: statusToText(c.Status, profile), // ← added
+			Lapses:     c.Lapses,
+			Suspended:  c.Suspended,
+			Leech:      c.Leech,
+			Buried:     c.BuriedUntil > now,
 		}
 
 		var tags []string
@@ -127,18 +128,20 @@ func ServeBrowsePage(w http.ResponseWriter, r *http.Request) {
 		StudentID  string
 		Flashcards []FlashcardPreview
 		Query      string
+		View       string
 		HasMore    bool
 		NextOffset int
 	}{
 		StudentID:  studentId,
 		Flashcards: filtered[offset:end],
 		Query:      query,
+		View:       view,
 		HasMore:    hasMore,
 		NextOffset: end,
 	}
 
 	if r.Header.Get("HX-Request") != "" {
-		tmpl, err := template.ParseFiles(
+		tmpl, err := parseTemplates(r,
 			"./frontend/templates/partials/browse-more.html",
 			"./frontend/templates/partials/flashcard-item.html",
 		)
@@ -150,7 +153,7 @@ func ServeBrowsePage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmpl, err := template.ParseFiles(
+	tmpl, err := parseTemplates(r,
 		"./frontend/templates/browse.html",
 		"./frontend/templates/partials/flashcard-item.html",
 	)
@@ -174,34 +177,28 @@ func UnlinkCardHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userId, err := getCookieValue(r, "user_id")
-	if err != nil {
-		http.Error(w, "Not logged in", http.StatusUnauthorized)
+	studentId := sessionFrom(r).StudentID
+	if studentId == "" {
+		http.Error(w, "Failed to resolve student ID", http.StatusInternalServerError)
 		return
 	}
 
-	accessToken, err := r.Cookie("access_token")
+	studentCards, err := fetchStudentCards(r, studentId)
 	if err != nil {
-		http.Error(w, "No access token", http.StatusUnauthorized)
-		return
-	}
-
-	studentId, err := fetchStudentId(r, userId, utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL"), utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY"))
-	if err != nil || studentId == "" {
-		http.Error(w, "Failed to resolve student ID", http.StatusInternalServerError)
+		http.Error(w, "Could not load student cards", http.StatusInternalServerError)
 		return
 	}
 
-	req, _ := http.NewRequest("DELETE",
-		utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL")+"/rest/v1/students_cards?student_id=eq."+studentId+"&card_id=eq."+cardID,
-		nil)
-	req.Header.Set("apikey", utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY"))
-	req.Header.Set("Authorization", "Bearer "+accessToken.Value)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil || resp.StatusCode >= 300 {
-		http.Error(w, "Failed to unlink card", http.StatusInternalServerError)
-		return
+	// Deleting removes every card the note makes, such as all its clozes
+	noteID := models.NoteID(cardID)
+	for _, c := range studentCards {
+		if models.NoteID(c.CardID) != noteID {
+			continue
+		}
+		if err := storesFor(r).StudentCards.Unlink(r.Context(), studentId, c.CardID); err != nil {
+			http.Error(w, "Failed to unlink card", http.StatusInternalServerError)
+			return
+		}
 	}
 
 	http.Redirect(w, r, "/browse", http.StatusSeeOther)
@@ -214,7 +211,7 @@ func ServeConfirmDeleteButton(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmpl, err := template.ParseFiles("./frontend/templates/partials/confirm-delete-button-compact.html")
+	tmpl, err := parseTemplates(r, "./frontend/templates/partials/confirm-delete-button-compact.html")
 	if err != nil {
 		http.Error(w, "Template error", http.StatusInternalServerError)
 		return
@@ -239,13 +236,13 @@ func tagMatch(tags []string, query string) bool {
 	return false
 }
 
-func statusToText(status int) string {
-	switch status {
-	case 0:
+func statusToText(status int, profile *services.SchedulingProfile) string {
+	switch {
+	case profile.IsNew(status):
 		return "new"
-	case 1, 2, 3:
+	case profile.IsLearning(status):
 		return "in progress"
-	case 4, 5, 6:
+	case profile.IsReview(status):
 		return "consolidating"
 	default:
 		return "unknown"
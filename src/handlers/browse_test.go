@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestUnlinkCard(t *testing.T) {
+	backend := newStudyBackend(t)
+
+	// Either of the note's cards unlinks both
+	w := serve(UnlinkCardHandler, postAs(ada, "/unlink-card", url.Values{"card_id": {"capital#1"}}))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/browse" {
+		t.Fatalf("status = %d, location %q; want a redirect to /browse", w.Code, w.Header().Get("Location"))
+	}
+
+	cards, err := backend.For("").StudentCards.List(context.Background(), ada.StudentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, c := range cards {
+		left = append(left, c.CardID)
+	}
+	if len(left) != 2 || left[0] != "mine" || left[1] != "sum" {
+		t.Errorf("ada's cards = %v, want [mine sum]", left)
+	}
+	studentCard(t, backend, bob.StudentID, "capital")
+	studentCard(t, backend, bob.StudentID, "capital#1")
+}
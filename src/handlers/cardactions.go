@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/utils"
+)
+
+// SuspendCardHandler keeps the card's progress but takes it out of study.
+func SuspendCardHandler(w http.ResponseWriter, r *http.Request) {
+	studentId, card, ok := cardActionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := patchStudentCard(r, studentId, card.CardID, map[string]interface{}{"suspended": true}); err != nil {
+		http.Error(w, "Failed to suspend card", http.StatusInternalServerError)
+		return
+	}
+
+	finishCardAction(w, r)
+}
+
+// UnsuspendCardHandler puts a suspended card back into study. A leech also
+// loses its leech flag and lapse count, so it gets a fresh run before it can
+// be suspended again.
+func UnsuspendCardHandler(w http.ResponseWriter, r *http.Request) {
+	studentId, card, ok := cardActionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	body := map[string]interface{}{"suspended": false}
+	if card.Leech {
+		body["leech"] = false
+		body["lapses"] = 0
+	}
+
+	if err := patchStudentCard(r, studentId, card.CardID, body); err != nil {
+		http.Error(w, "Failed to unsuspend card", http.StatusInternalServerError)
+		return
+	}
+
+	finishCardAction(w, r)
+}
+
+// BuryCardHandler hides the card until the student's next study day starts.
+func BuryCardHandler(w http.ResponseWriter, r *http.Request) {
+	studentId, card, ok := cardActionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	settings := loadStudentSettings(r, studentId)
+	buriedUntil := utils.NextStudyDayStart(time.Now().Unix(), settings.DayRolloverHour)
+
+	if err := patchStudentCard(r, studentId, card.CardID, map[string]interface{}{"buried_until": buriedUntil}); err != nil {
+		http.Error(w, "Failed to bury card", http.StatusInternalServerError)
+		return
+	}
+
+	finishCardAction(w, r)
+}
+
+// RescheduleCardHandler either makes the card due at the start of a chosen
+// day (mode "due", with due_date as YYYY-MM-DD) or resets it to a new card
+// (mode "reset"). Either way the card is unburied.
+func RescheduleCardHandler(w http.ResponseWriter, r *http.Request) {
+	studentId, card, ok := cardActionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var body map[string]interface{}
+	switch r.FormValue("mode") {
+	case "reset":
+		body = map[string]interface{}{
+			"status":       0,
+			"due":          time.Now().Unix(),
+			"stability":    0,
+			"difficulty":   0,
+			"last_review":  0,
+			"lapses":       0,
+			"leech":        false,
+			"buried_until": 0,
+		}
+	case "due":
+		settings := loadStudentSettings(r, studentId)
+		due, err := utils.StudyDayStart(r.FormValue("due_date"), settings.DayRolloverHour)
+		if err != nil {
+			http.Error(w, "Invalid due date", http.StatusBadRequest)
+			return
+		}
+		body = map[string]interface{}{
+			"due":          due,
+			"buried_until": 0,
+		}
+	default:
+		http.Error(w, "Unknown reschedule mode", http.StatusBadRequest)
+		return
+	}
+
+	if err := patchStudentCard(r, studentId, card.CardID, body); err != nil {
+		http.Error(w, "Failed to reschedule card", http.StatusInternalServerError)
+		return
+	}
+
+	finishCardAction(w, r)
+}
+
+func ServeRescheduleForm(w http.ResponseWriter, r *http.Request) {
+	cardID := r.URL.Query().Get("card_id")
+	if cardID == "" {
+		http.Error(w, "Missing card_id", http.StatusBadRequest)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "./frontend/templates/partials/reschedule-form.html")
+	if err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		CardID string
+		Today  string
+	}{
+		CardID: cardID,
+		Today:  utils.UnixToUKTime(time.Now().Unix()).Format("2006-01-02"),
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	tmpl.Execute(w, data)
+}
+
+// cardActionTarget checks the method and resolves the student and card for a
+// per-card action; cards the student doesn't have are not found. It writes
+// the error response itself when ok is false.
+func cardActionTarget(w http.ResponseWriter, r *http.Request) (studentId string, card models.StudentCard, ok bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return "", models.StudentCard{}, false
+	}
+
+	cardID := r.FormValue("card_id")
+	if cardID == "" {
+		http.Error(w, "Missing card ID", http.StatusBadRequest)
+		return "", models.StudentCard{}, false
+	}
+
+	studentId = sessionFrom(r).StudentID
+	if studentId == "" {
+		http.Error(w, "Failed to resolve student ID", http.StatusInternalServerError)
+		return "", models.StudentCard{}, false
+	}
+
+	card, err := fetchStudentCard(r, studentId, cardID)
+	if err != nil {
+		http.Error(w, "Card not found", http.StatusNotFound)
+		return "", models.StudentCard{}, false
+	}
+
+	return studentId, card, true
+}
+
+// finishCardAction moves on to the next card when the action came from the
+// study screen; browse reloads the page itself.
+func finishCardAction(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("from") == "study" {
+		utils.ClearCookie(w, r, "current_card_id")
+		renderFlashcardPartial(w, r, "")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/utils"
+)
+
+func TestCardActions(t *testing.T) {
+	dueDate := "2030-01-01"
+	due, err := utils.StudyDayStart(dueDate, models.DefaultStudentSettings(ada.StudentID).DayRolloverHour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		form    url.Values
+		before  models.StudentCard // fields set on ada's capital beforehand
+		check   func(card models.StudentCard) bool
+	}{
+		{
+			name:    "suspend",
+			handler: SuspendCardHandler,
+			form:    url.Values{"card_id": {"capital"}},
+			check:   func(c models.StudentCard) bool { return c.Suspended },
+		},
+		{
+			name:    "unsuspend",
+			handler: UnsuspendCardHandler,
+			form:    url.Values{"card_id": {"capital"}},
+			before:  models.StudentCard{Suspended: true, Lapses: 3},
+			check:   func(c models.StudentCard) bool { return !c.Suspended && c.Lapses == 3 },
+		},
+		{
+			name:    "unsuspend a leech",
+			handler: UnsuspendCardHandler,
+			form:    url.Values{"card_id": {"capital"}},
+			before:  models.StudentCard{Suspended: true, Leech: true, Lapses: 8},
+			check:   func(c models.StudentCard) bool { return !c.Suspended && !c.Leech && c.Lapses == 0 },
+		},
+		{
+			name:    "bury",
+			handler: BuryCardHandler,
+			form:    url.Values{"card_id": {"capital"}},
+			check:   func(c models.StudentCard) bool { return c.BuriedUntil > time.Now().Unix() },
+		},
+		{
+			name:    "reschedule to a day",
+			handler: RescheduleCardHandler,
+			form:    url.Values{"card_id": {"capital"}, "mode": {"due"}, "due_date": {dueDate}},
+			before:  models.StudentCard{Status: 5, BuriedUntil: time.Now().Unix() + 3600},
+			check:   func(c models.StudentCard) bool { return c.Due == due && c.Status == 5 && c.BuriedUntil == 0 },
+		},
+		{
+			name:    "reset",
+			handler: RescheduleCardHandler,
+			form:    url.Values{"card_id": {"capital"}, "mode": {"reset"}},
+			before:  models.StudentCard{Status: 5, Stability: 20, Difficulty: 6, LastReview: 1, Lapses: 8, Leech: true},
+			check: func(c models.StudentCard) bool {
+				return c.Status == 0 && c.Stability == 0 && c.Difficulty == 0 && c.LastReview == 0 && c.Lapses == 0 && !c.Leech
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newStudyBackend(t)
+			err := backend.For("").StudentCards.Update(context.Background(), ada.StudentID, "capital", map[string]interface{}{
+				"status":       tt.before.Status,
+				"stability":    tt.before.Stability,
+				"difficulty":   tt.before.Difficulty,
+				"last_review":  tt.before.LastReview,
+				"lapses":       tt.before.Lapses,
+				"suspended":    tt.before.Suspended,
+				"leech":        tt.before.Leech,
+				"buried_until": tt.before.BuriedUntil,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			untouched := studentCard(t, backend, bob.StudentID, "capital")
+
+			w := serve(tt.handler, postAs(ada, "/card-action", tt.form))
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusNoContent, w.Body)
+			}
+			if card := studentCard(t, backend, ada.StudentID, "capital"); !tt.check(card) {
+				t.Errorf("card = %+v", card)
+			}
+			// The reversed card and other students' copies are left alone
+			if sibling := studentCard(t, backend, ada.StudentID, "capital#1"); sibling.Suspended || sibling.BuriedUntil != 0 {
+				t.Errorf("sibling = %+v, want it untouched", sibling)
+			}
+			if card := studentCard(t, backend, bob.StudentID, "capital"); card != untouched {
+				t.Errorf("bob's card = %+v, want %+v", card, untouched)
+			}
+		})
+	}
+}
+
+func TestCardActionFromStudy(t *testing.T) {
+	backend := newStudyBackend(t)
+
+	w := serve(BuryCardHandler, postAs(ada, "/bury-card", url.Values{"card_id": {"capital"}, "from": {"study"}}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want the next card: %s", w.Code, w.Body)
+	}
+	if card := studentCard(t, backend, ada.StudentID, "capital"); card.BuriedUntil == 0 {
+		t.Errorf("card = %+v, want it buried", card)
+	}
+}
+
+func TestCardActionRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		r       *http.Request
+		want    int
+	}{
+		{"GET", SuspendCardHandler, getAs(ada, "/suspend-card?card_id=capital"), http.StatusMethodNotAllowed},
+		{"no card", SuspendCardHandler, postAs(ada, "/suspend-card", nil), http.StatusBadRequest},
+		{"no student", SuspendCardHandler, postAs(Session{UserID: "tutor-user"}, "/suspend-card", url.Values{"card_id": {"capital"}}),
+			http.StatusInternalServerError},
+		{"unknown mode", RescheduleCardHandler, postAs(ada, "/reschedule-card", url.Values{"card_id": {"capital"}, "mode": {"later"}}),
+			http.StatusBadRequest},
+		{"bad date", RescheduleCardHandler, postAs(ada, "/reschedule-card", url.Values{"card_id": {"capital"}, "mode": {"due"}, "due_date": {"tomorrow"}}),
+			http.StatusBadRequest},
+		{"suspend a card not in the deck", SuspendCardHandler, postAs(ada, "/suspend-card", url.Values{"card_id": {"missing"}}),
+			http.StatusNotFound},
+		{"unsuspend a card not in the deck", UnsuspendCardHandler, postAs(ada, "/unsuspend-card", url.Values{"card_id": {"missing"}}),
+			http.StatusNotFound},
+		{"bury a card not in the deck", BuryCardHandler, postAs(ada, "/bury-card", url.Values{"card_id": {"missing"}, "from": {"study"}}),
+			http.StatusNotFound},
+		{"reschedule a card not in the deck", RescheduleCardHandler, postAs(ada, "/reschedule-card", url.Values{"card_id": {"missing"}, "mode": {"reset"}}),
+			http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newStudyBackend(t)
+			before := studentCard(t, backend, ada.StudentID, "capital")
+			if w := serve(tt.handler, tt.r); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if card := studentCard(t, backend, ada.StudentID, "capital"); card != before {
+				t.Errorf("card = %+v, want it untouched", card)
+			}
+		})
+	}
+}
+
+// Card actions work on the signed-in student's deck, so naming a card only
+// another student has changes nothing.
+func TestCardActionsOnOtherStudentsCard(t *testing.T) {
+	form := url.Values{"card_id": {"mine"}, "mode": {"reset"}}
+	for _, tt := range []struct {
+		name    string
+		handler http.HandlerFunc
+		want    int
+	}{
+		{"suspend", SuspendCardHandler, http.StatusNotFound},
+		{"unsuspend", UnsuspendCardHandler, http.StatusNotFound},
+		{"bury", BuryCardHandler, http.StatusNotFound},
+		{"reschedule", RescheduleCardHandler, http.StatusNotFound},
+		{"unlink", UnlinkCardHandler, http.StatusSeeOther},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newStudyBackend(t)
+			err := backend.For("").StudentCards.Update(context.Background(), ada.StudentID, "mine", map[string]interface{}{
+				"status": 5, "suspended": true, "lapses": 2,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := studentCard(t, backend, ada.StudentID, "mine")
+
+			if w := serve(tt.handler, postAs(bob, "/card-action", form)); w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if card := studentCard(t, backend, ada.StudentID, "mine"); card != before {
+				t.Errorf("ada's card = %+v, want %+v", card, before)
+			}
+			if _, err := backend.For("").StudentCards.Get(context.Background(), bob.StudentID, "mine"); err == nil {
+				t.Error("bob gained ada's card")
+			}
+		})
+	}
+}
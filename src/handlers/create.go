@@ -1,18 +1,16 @@
 package handlers
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"html/template"
-	"io"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/abstract-tutoring/models"
 	"github.com/abstract-tutoring/services"
-	"github.com/abstract-tutoring/utils"
+	"github.com/abstract-tutoring/store"
 )
 
 // CreateCardPage renders the form for creating a new flashcard
@@ -22,7 +20,7 @@ func CreateCardPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmpl, err := template.ParseFiles("./frontend/templates/create.html")
+	tmpl, err := parseTemplates(r, "./frontend/templates/create.html", "./frontend/templates/partials/image-upload.html")
 	if err != nil {
 		log.Println("Template parse error:", err)
 		http.Error(w, "Template error", http.StatusInternalServerError)
@@ -31,11 +29,10 @@ func CreateCardPage(w http.ResponseWriter, r *http.Request) {
 
 	// Always provide empty values for consistency
 	tmpl.Execute(w, struct {
-		Front        string
-		Back         string
+		cardForm
 		ErrorMessage string
 		Success      bool
-	}{})
+	}{cardForm: cardForm{Type: models.ContentRichText}})
 }
 
 func CreateCardHandler(w http.ResponseWriter, r *http.Request) {
@@ -44,19 +41,14 @@ func CreateCardHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rawFront := r.FormValue("front")
-	rawBack := r.FormValue("back")
+	form := readCardForm(r)
 	rawTags := r.FormValue("tags")
 
-	front, err := services.SanitiseAndValidate(rawFront)
-	if err != nil {
-		renderCreateFormWithError(w, "No HTML Allowed (Front)", rawFront, rawBack)
-		return
-	}
-
-	back, err := services.SanitiseAndValidate(rawBack)
-	if err != nil {
-		renderCreateFormWithError(w, "No HTML Allowed (Back)", rawFront, rawBack)
+	// Images uploaded while writing the card come with it
+	assets := uploadedAssets(r)
+	front, back, ords, errMsg := cardContent(form, assets)
+	if errMsg != "" {
+		renderCreateFormWithError(w, r, errMsg, form)
 		return
 	}
 
@@ -70,70 +62,50 @@ func CreateCardHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	userCookie, err := r.Cookie("user_id")
-	if err != nil || userCookie.Value == "" {
-		http.Error(w, "User not logged in", http.StatusUnauthorized)
-		return
-	}
-	userId := userCookie.Value
-
-	accessCookie, err := r.Cookie("access_token")
-	if err != nil || accessCookie.Value == "" {
-		http.Error(w, "Missing access token", http.StatusUnauthorized)
+	session := sessionFrom(r)
+	userId, studentId := session.UserID, session.StudentID
+	if studentId == "" {
+		http.Error(w, "You need a student account to create cards", http.StatusForbidden)
 		return
 	}
-	accessToken := accessCookie.Value
 
-	studentId, err := fetchStudentIdByUserId(userId, accessToken)
-	if err != nil || studentId == "" {
-		log.Println("Error fetching student ID:", err)
-		clearSessionCookies(w, r)
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
+	stores := storesFor(r)
 
-	cardID, err := generateSequentialCardID(userId, studentId, accessToken)
+	cardID, err := generateSequentialCardID(r, stores.Cards, userId, studentId)
 	if err != nil {
 		log.Println("Card ID generation failed:", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
 
-	newCard := map[string]interface{}{
-		"id":         cardID,
-		"front":      map[string]string{"type": "rich_text", "content": front},
-		"back":       map[string]string{"type": "rich_text", "content": back},
-		"assets":     []interface{}{},
-		"created_by": userId,
+	newCard := models.Flashcard{
+		ID:        cardID,
+		Front:     front,
+		Back:      back,
+		Assets:    assets,
+		CreatedBy: userId,
+		Ords:      ords,
 	}
 
-	if err := insertFlashcard(accessToken, newCard); err != nil {
+	if err := stores.Cards.Insert(r.Context(), newCard); err != nil {
 		log.Println("Flashcard insert failed:", err)
 		http.Error(w, "Failed to create flashcard", http.StatusInternalServerError)
 		return
 	}
 
-	if err := assignCardToStudent(studentId, cardID, accessToken); err != nil {
+	if err := stores.StudentCards.Link(r.Context(), studentId, []string{cardID}); err != nil {
 		log.Println("Card assignment failed:", err)
 		http.Error(w, "Failed to assign card to student", http.StatusInternalServerError)
 		return
 	}
 
 	// 🔗 Insert tag rows into Supabase
-	for _, tag := range tags {
-		tagID, err := services.UpsertTag(accessToken, tag)
-		if err != nil {
-			log.Println("Tag insert failed:", err)
-			continue
-		}
-		err = services.LinkTagToCard(accessToken, cardID, tagID)
-		if err != nil {
-			log.Println("Failed to link tag to card:", err)
-		}
+	if err := stores.Cards.SetTags(r.Context(), cardID, tags); err != nil {
+		log.Println("Failed to tag card:", err)
 	}
 
 	// Success
-	tmpl, err := template.ParseFiles("./frontend/templates/create.html")
+	tmpl, err := parseTemplates(r, "./frontend/templates/create.html", "./frontend/templates/partials/image-upload.html")
 	if err != nil {
 		log.Println("Template parse error:", err)
 		http.Error(w, "Template error", http.StatusInternalServerError)
@@ -141,130 +113,139 @@ func CreateCardHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	tmpl.Execute(w, struct {
-		Front        string
-		Back         string
+		cardForm
 		ErrorMessage string
 		Success      bool
 	}{
-		Front:        "",
-		Back:         "",
+		cardForm:     cardForm{Type: front.Type},
 		ErrorMessage: "",
 		Success:      true,
 	})
 }
 
-// generateSequentialCardID produces a unique card ID like "card_harvey_000001"
-func generateSequentialCardID(userId, studentId, accessToken string) (string, error) {
-	url := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL") +
-		"/rest/v1/cards?select=id&created_by=eq." + userId
+// cardForm is a card as the create and edit forms submit it.
+type cardForm struct {
+	Type        string
+	Front       string
+	Back        string
+	Distractors string // multiple choice wrong options, one per line
+	Occlusion   string // image occlusion image and masks, as JSON from the editor
+	Assets      string // images uploaded on the create form, as JSON
+	Reversible  bool
+}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", fmt.Errorf("request creation failed: %w", err)
+func readCardForm(r *http.Request) cardForm {
+	return cardForm{
+		Type:        r.FormValue("type"),
+		Front:       r.FormValue("front"),
+		Back:        r.FormValue("back"),
+		Distractors: r.FormValue("distractors"),
+		Occlusion:   r.FormValue("occlusion"),
+		Assets:      r.FormValue("assets"),
+		Reversible:  r.FormValue("reversible") != "",
 	}
-	req.Header.Set("apikey", utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY"))
-	req.Header.Set("Authorization", "Bearer "+accessToken)
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
+// cardContent sanitises the submitted front and back for the card type and
+// works out the cards the note makes. errMsg is set if they can't be saved.
+// Only rich text and type answer notes can be reversible; the flag is
+// ignored for the others. An image occlusion image must be one of assets.
+func cardContent(form cardForm, assets []models.Asset) (front, back models.Content, ords []int, errMsg string) {
+	cardType := form.Type
+	switch cardType {
+	case models.ContentCloze, models.ContentTypeAnswer, models.ContentMultipleChoice, models.ContentImageOcclusion:
+	default:
+		cardType = models.ContentRichText
 	}
-	defer resp.Body.Close()
+	front.Type, back.Type = cardType, cardType
 
-	if resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed to fetch IDs: %s", string(body))
+	// The front of an image occlusion card is optional text above the image
+	var err error
+	if cardType != models.ContentImageOcclusion || strings.TrimSpace(form.Front) != "" {
+		if front.Content, err = services.SanitiseAndValidate(form.Front); err != nil {
+			return front, back, nil, "No HTML Allowed (Front)"
+		}
 	}
 
-	var result []struct {
-		ID string `json:"id"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("decode failed: %w", err)
+	// The back of a cloze or image occlusion card is optional extra text
+	optionalBack := cardType == models.ContentCloze || cardType == models.ContentImageOcclusion
+	if !optionalBack || strings.TrimSpace(form.Back) != "" {
+		if back.Content, err = services.SanitiseAndValidate(form.Back); err != nil {
+			return front, back, nil, "No HTML Allowed (Back)"
+		}
 	}
 
-	prefix := "card_" + studentId + "_"
-	maxNum := 0
-
-	for _, r := range result {
-		if strings.HasPrefix(r.ID, prefix) {
-			suffix := strings.TrimPrefix(r.ID, prefix)
-			if n, err := strconv.Atoi(suffix); err == nil && n > maxNum {
-				maxNum = n
+	switch cardType {
+	case models.ContentMultipleChoice:
+		for _, line := range strings.Split(form.Distractors, "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
 			}
+			d, err := services.SanitiseAndValidate(line)
+			if err != nil {
+				return front, back, nil, "No HTML Allowed (Wrong options)"
+			}
+			back.Distractors = append(back.Distractors, d)
 		}
-	}
-
-	newID := fmt.Sprintf("card_%s_%06d", studentId, maxNum+1)
-	// newID := fmt.Sprintf("aveeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeerylongwordthatwouldntpossiblyfitononeline")
-	return newID, nil
-}
-
-// insertFlashcard sends a new flashcard to Supabase
-func insertFlashcard(accessToken string, card map[string]interface{}) error {
-	url := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL") + "/rest/v1/cards"
-	body, err := json.Marshal(card)
-	if err != nil {
-		return fmt.Errorf("failed to marshal card: %w", err)
-	}
+		if err := services.ValidateChoices(back); err != nil {
+			return front, back, nil, "Multiple choice card: " + err.Error()
+		}
+		return front, back, []int{0}, ""
 
-	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
-	if err != nil {
-		return fmt.Errorf("failed to create insert request: %w", err)
-	}
-	req.Header.Set("apikey", utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY"))
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
+	case models.ContentImageOcclusion:
+		var o models.Occlusion
+		if err := json.Unmarshal([]byte(form.Occlusion), &o); err != nil {
+			return front, back, nil, "Image occlusion card: choose an image and draw masks over it"
+		}
+		if err := services.ValidateOcclusion(&o, assets); err != nil {
+			return front, back, nil, "Image occlusion card: " + err.Error()
+		}
+		front.Occlusion = &o
+		return front, back, services.OcclusionOrds(&o), ""
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("flashcard insert request failed: %w", err)
+	case models.ContentCloze:
+		ords = services.ClozeOrds(front.Content)
+		if len(ords) == 0 {
+			return front, back, nil, "Cloze cards need at least one deletion, like {{c1::answer}}"
+		}
+		return front, back, ords, ""
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 300 {
-		msg, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("flashcard insert failed: %s", string(msg))
+	if form.Reversible {
+		return front, back, []int{0, models.OrdReversed}, ""
 	}
-
-	return nil
+	return front, back, []int{0}, ""
 }
 
-// assignCardToStudent links a flashcard to a student
-func assignCardToStudent(studentId, cardId, accessToken string) error {
-	url := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL") + "/rest/v1/students_cards"
-	body, err := json.Marshal(map[string]interface{}{
-		"student_id": studentId,
-		"card_id":    cardId,
-	})
+// generateSequentialCardID produces a unique card ID like "card_harvey_000001"
+func generateSequentialCardID(r *http.Request, cards store.CardStore, userId, studentId string) (string, error) {
+	ids, err := cards.IDsCreatedBy(r.Context(), userId)
 	if err != nil {
-		return fmt.Errorf("failed to marshal assignment: %w", err)
+		return "", fmt.Errorf("failed to fetch IDs: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
-	if err != nil {
-		return fmt.Errorf("failed to create assignment request: %w", err)
-	}
-	req.Header.Set("apikey", utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY"))
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Content-Type", "application/json")
+	prefix := "card_" + studentId + "_"
+	maxNum := 0
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("assignment request failed: %w", err)
+	for _, id := range ids {
+		if strings.HasPrefix(id, prefix) {
+			suffix := strings.TrimPrefix(id, prefix)
+			if n, err := strconv.Atoi(suffix); err == nil && n > maxNum {
+				maxNum = n
+			}
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 300 {
-		msg, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("assignment failed: %s", string(msg))
+	newID := fmt.Sprintf("card_%s_%06d", studentId, maxNum+1)
+	// newID := fmt.Sprintf("aveeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeerylongwordthatwouldntpossiblyfitononeline")
+	if !models.ValidNoteID(newID) {
+		return "", fmt.Errorf("student ID %q makes an invalid card ID", studentId)
 	}
-
-	return nil
+	return newID, nil
 }
 
-func renderCreateFormWithError(w http.ResponseWriter, msg, front, back string) {
-	tmpl, err := template.ParseFiles("./frontend/templates/create.html")
+func renderCreateFormWithError(w http.ResponseWriter, r *http.Request, msg string, form cardForm) {
+	tmpl, err := parseTemplates(r, "./frontend/templates/create.html", "./frontend/templates/partials/image-upload.html")
 	if err != nil {
 		log.Println("Template parse error:", err)
 		http.Error(w, "Template error", http.StatusInternalServerError)
@@ -272,13 +253,11 @@ func renderCreateFormWithError(w http.ResponseWriter, msg, front, back string) {
 	}
 
 	tmpl.Execute(w, struct {
-		Front        string
-		Back         string
+		cardForm
 		ErrorMessage string
 		Success      bool
 	}{
-		Front:        front,
-		Back:         back,
+		cardForm:     form,
 		ErrorMessage: msg,
 		Success:      false,
 	})
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/abstract-tutoring/utils"
+)
+
+const (
+	csrfCookie = "csrf_token"
+	csrfHeader = "X-CSRF-Token" // sent by HTMX, from hx-headers on <body>
+	csrfField  = "csrf_token"   // sent by plain forms
+)
+
+// maxFormBytes limits the plain form bodies CSRFProtect reads to find the
+// token field.
+const maxFormBytes = 1 << 20
+
+type csrfKey struct{}
+
+// CSRFProtect rejects POSTs and other unsafe requests whose token does not
+// match the csrf_token cookie. The cookie lasts the browser session and is
+// issued on the first request without one, so even the login form has a
+// token to send. Only URL-encoded forms may send the token as a field.
+func CSRFProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := getCookieValue(r, csrfCookie)
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if token == "" {
+				token = setCSRFToken(w, r)
+			}
+		default:
+			sent := r.Header.Get(csrfHeader)
+			if sent == "" && isURLEncodedForm(r) {
+				// Other bodies, such as multipart uploads, must send the
+				// header, so they are left unread for the handler to limit
+				r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+				sent = r.PostFormValue(csrfField)
+			}
+			if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				reason := "token mismatch"
+				if token == "" {
+					reason = "no csrf cookie"
+				} else if sent == "" {
+					reason = "no token sent"
+				}
+				log.Printf("CSRFProtect: rejected %s %s from %s: %s", r.Method, r.URL.Path, r.RemoteAddr, reason)
+				http.Error(w, "Invalid or missing CSRF token. Reload the page and try again.", http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfKey{}, token)))
+	})
+}
+
+// isURLEncodedForm reports whether the request body is a plain form post.
+func isURLEncodedForm(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+// setCSRFToken issues a new token, replacing any the browser has. Signing in
+// calls it so a token planted before sign-in can't be used after.
+func setCSRFToken(w http.ResponseWriter, r *http.Request) string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	utils.SetCookie(w, r, csrfCookie, token, time.Time{})
+	return token
+}
+
+// csrfToken returns the token CSRFProtect checked or issued for the request.
+func csrfToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfKey{}).(string)
+	return token
+}
+
+// csrfFuncs gives templates {{ csrfToken }}, for hx-headers, and
+// {{ csrfField }}, a hidden input to put in every POST form.
+func csrfFuncs(r *http.Request) template.FuncMap {
+	token := csrfToken(r)
+	return template.FuncMap{
+		"csrfToken": func() string { return token },
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + csrfField + `" value="` + template.HTMLEscapeString(token) + `">`)
+		},
+	}
+}
+
+// parseTemplates is template.ParseFiles with the CSRF functions for r.
+func parseTemplates(r *http.Request, filenames ...string) (*template.Template, error) {
+	return template.New(filepath.Base(filenames[0])).Funcs(csrfFuncs(r)).ParseFiles(filenames...)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRFProtect(t *testing.T) {
+	const token = "token"
+
+	var multipartBody bytes.Buffer
+	mw := multipart.NewWriter(&multipartBody)
+	mw.WriteField(csrfField, token)
+	mw.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		header      string
+		want        int
+	}{
+		{"form field", "application/x-www-form-urlencoded", url.Values{csrfField: {token}}.Encode(), "", http.StatusOK},
+		{"header", "application/x-www-form-urlencoded", "", token, http.StatusOK},
+		{"wrong field", "application/x-www-form-urlencoded", url.Values{csrfField: {"other"}}.Encode(), "", http.StatusForbidden},
+		{"no token", "application/x-www-form-urlencoded", "", "", http.StatusForbidden},
+		{"multipart with header", mw.FormDataContentType(), multipartBody.String(), token, http.StatusOK},
+		// Multipart bodies aren't parsed to look for the field
+		{"multipart field only", mw.FormDataContentType(), multipartBody.String(), "", http.StatusForbidden},
+		{"form too large", "application/x-www-form-urlencoded",
+			"pad=" + strings.Repeat("a", maxFormBytes) + "&" + csrfField + "=" + token, "", http.StatusForbidden},
+	}
+
+	handler := CSRFProtect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := csrfToken(r); got != token {
+			t.Errorf("csrfToken = %q, want %q", got, token)
+		}
+	}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			if tt.header != "" {
+				r.Header.Set(csrfHeader, tt.header)
+			}
+			r.AddCookie(&http.Cookie{Name: csrfCookie, Value: token})
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
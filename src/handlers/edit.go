@@ -1,10 +1,13 @@
 package handlers
 
 import (
-	"html/template"
+	"encoding/json"
+	"log"
 	"net/http"
+	"slices"
 	"strings"
 
+	"github.com/abstract-tutoring/models"
 	"github.com/abstract-tutoring/services"
 )
 
@@ -14,51 +17,54 @@ func EditCardHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cardID := r.FormValue("card_id")
-	rawFront := r.FormValue("front")
-	rawBack := r.FormValue("back")
+	cardID := models.NoteID(r.FormValue("card_id"))
+	form := readCardForm(r)
 	rawTags := r.FormValue("tags")
 
-	userID, err := getCookieValue(r, "user_id")
-	if err != nil {
-		http.Error(w, "Not logged in", http.StatusUnauthorized)
-		return
-	}
-	accessToken, err := r.Cookie("access_token")
-	if err != nil {
-		http.Error(w, "No access token", http.StatusUnauthorized)
-		return
-	}
+	session := sessionFrom(r)
+	stores := storesFor(r)
+	cards := stores.Cards
 
-	card, err := services.FetchFlashcard(cardID, accessToken.Value)
+	card, err := cards.Get(r.Context(), cardID)
 	if err != nil || card.ID == "" {
 		http.Error(w, "Card not found", http.StatusNotFound)
 		return
 	}
-	if card.CreatedBy != userID {
+	if card.CreatedBy != session.UserID {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	// Sanitize front/back
-	sanitisedFront, err := services.SanitiseAndValidate(rawFront)
-	if err != nil {
-		renderEditFormWithError(w, cardID, rawFront, rawBack, "No HTML Allowed (Front)")
-		return
-	}
-	sanitisedBack, err := services.SanitiseAndValidate(rawBack)
-	if err != nil {
-		renderEditFormWithError(w, cardID, rawFront, rawBack, "No HTML Allowed (Back)")
+	front, back, ords, errMsg := cardContent(form, card.Assets)
+	if errMsg != "" {
+		renderEditFormWithError(w, r, card, form, errMsg)
 		return
 	}
 
 	// Update card content
-	err = services.UpdateFlashcard(cardID, sanitisedFront, sanitisedBack, accessToken.Value)
+	err = cards.UpdateContent(r.Context(), cardID, front, back, ords)
 	if err != nil {
 		http.Error(w, "Failed to update", http.StatusInternalServerError)
 		return
 	}
 
+	// Match the student's cards to the ones the note now makes. Cards that
+	// are still there, such as both directions of a reversible card, keep
+	// their progress.
+	if session.StudentID != "" {
+		if err := stores.StudentCards.Link(r.Context(), session.StudentID, []string{cardID}); err != nil {
+			log.Println("Failed to link edited card:", err)
+		}
+		for _, ord := range card.Ords {
+			if slices.Contains(ords, ord) {
+				continue
+			}
+			if err := stores.StudentCards.Unlink(r.Context(), session.StudentID, models.CardKey(cardID, ord)); err != nil {
+				log.Println("Failed to unlink removed card:", err)
+			}
+		}
+	}
+
 	// Parse and sanitise tags
 	tags := []string{}
 	if rawTags != "" {
@@ -70,51 +76,27 @@ func EditCardHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Remove old tag links
-	err = services.ClearTagsForCard(cardID, accessToken.Value)
-	if err != nil {
-		http.Error(w, "Failed to clear old tags", http.StatusInternalServerError)
+	// Replace the old tag links
+	if err := cards.SetTags(r.Context(), cardID, tags); err != nil {
+		http.Error(w, "Failed to update tags", http.StatusInternalServerError)
 		return
 	}
 
-	// Re-link new tags
-	for _, tag := range tags {
-		tagID, err := services.UpsertTag(accessToken.Value, tag)
-		if err != nil {
-			http.Error(w, "Tag upsert failed", http.StatusInternalServerError)
-			return
-		}
-		err = services.LinkTagToCard(accessToken.Value, cardID, tagID)
-		if err != nil {
-			http.Error(w, "Tag link failed", http.StatusInternalServerError)
-			return
-		}
-	}
-
 	http.Redirect(w, r, "/edit?card_id="+cardID, http.StatusSeeOther)
 }
 
 func EditCardPage(w http.ResponseWriter, r *http.Request) {
-	cardID := r.URL.Query().Get("card_id")
+	cardID := models.NoteID(r.URL.Query().Get("card_id"))
 	if cardID == "" {
 		http.Error(w, "Missing card_id", http.StatusBadRequest)
 		return
 	}
 
-	userID, err := getCookieValue(r, "user_id")
-	if err != nil {
-		http.Error(w, "Not logged in", http.StatusUnauthorized)
-		return
-	}
-
-	accessToken, err := r.Cookie("access_token")
-	if err != nil {
-		http.Error(w, "No access token", http.StatusUnauthorized)
-		return
-	}
+	userID := sessionFrom(r).UserID
+	cards := storesFor(r).Cards
 
 	// Fetch card content from Supabase
-	card, err := services.FetchFlashcard(cardID, accessToken.Value)
+	card, err := cards.Get(r.Context(), cardID)
 	if err != nil || card.ID == "" {
 		http.Error(w, "Card not found", http.StatusNotFound)
 		return
@@ -127,7 +109,7 @@ func EditCardPage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fetch associated tags
-	tags, err := services.FetchTagsForCard(cardID, accessToken.Value)
+	tags, err := cards.Tags(r.Context(), cardID)
 	if err != nil {
 		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
 		return
@@ -140,23 +122,35 @@ func EditCardPage(w http.ResponseWriter, r *http.Request) {
 	}
 	tagString := strings.Join(tagNames, ", ")
 
-	tmpl, err := template.ParseFiles("./frontend/templates/edit.html")
+	tmpl, err := parseTemplates(r, "./frontend/templates/edit.html", "./frontend/templates/partials/image-upload.html")
 	if err != nil {
 		http.Error(w, "Template error", http.StatusInternalServerError)
 		return
 	}
 
+	form := cardForm{
+		Type:        card.Front.Type,
+		Front:       card.Front.Content,
+		Back:        card.Back.Content,
+		Distractors: strings.Join(card.Back.Distractors, "\n"),
+		Reversible:  card.Reversible(),
+	}
+	if card.Front.Occlusion != nil {
+		occlusion, _ := json.Marshal(card.Front.Occlusion)
+		form.Occlusion = string(occlusion)
+	}
+
 	data := struct {
+		cardForm
 		CardID       string
-		Front        string
-		Back         string
+		Images       []editImage
 		Tags         string
 		IsOwner      bool
 		ErrorMessage string
 	}{
+		cardForm:     form,
 		CardID:       card.ID,
-		Front:        card.Front.Content,
-		Back:         card.Back.Content,
+		Images:       editImages(r, card),
 		Tags:         tagString,
 		IsOwner:      card.CreatedBy == userID,
 		ErrorMessage: "",
@@ -165,22 +159,47 @@ func EditCardPage(w http.ResponseWriter, r *http.Request) {
 	tmpl.Execute(w, data)
 }
 
-func renderEditFormWithError(w http.ResponseWriter, cardID, front, back, message string) {
-	tmpl, err := template.ParseFiles("./frontend/templates/edit.html")
+// editImage is one of a card's images, which the image occlusion editor can
+// draw masks over.
+type editImage struct {
+	ID  string
+	Alt string
+	URL string
+}
+
+func editImages(r *http.Request, card models.Flashcard) []editImage {
+	var images []editImage
+	urlFor := assetURLs(r)
+	for _, a := range card.Assets {
+		if a.Type != "image" {
+			continue
+		}
+		// Without a URL the masks can still be kept, just not seen
+		url, err := urlFor(a.ID)
+		if err != nil {
+			log.Println("Failed to sign image for the occlusion editor:", err)
+		}
+		images = append(images, editImage{ID: a.ID, Alt: a.Alt, URL: url})
+	}
+	return images
+}
+
+func renderEditFormWithError(w http.ResponseWriter, r *http.Request, card models.Flashcard, form cardForm, message string) {
+	tmpl, err := parseTemplates(r, "./frontend/templates/edit.html", "./frontend/templates/partials/image-upload.html")
 	if err != nil {
 		http.Error(w, "Template error", http.StatusInternalServerError)
 		return
 	}
 
 	data := struct {
+		cardForm
 		CardID       string
-		Front        string
-		Back         string
+		Images       []editImage
 		ErrorMessage string
 	}{
-		CardID:       cardID,
-		Front:        front,
-		Back:         back,
+		cardForm:     form,
+		CardID:       card.ID,
+		Images:       editImages(r, card),
 		ErrorMessage: message,
 	}
 
@@ -194,7 +213,7 @@ func ServeConfirmDeleteButtonEdit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmpl, err := template.ParseFiles("./frontend/templates/partials/confirm-delete-button.html")
+	tmpl, err := parseTemplates(r, "./frontend/templates/partials/confirm-delete-button.html")
 	if err != nil {
 		http.Error(w, "Template error", http.StatusInternalServerError)
 		return
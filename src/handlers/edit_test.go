@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abstract-tutoring/models"
+)
+
+func TestEditCardToImageOcclusion(t *testing.T) {
+	backend := newStudyBackend(t)
+	stores := backend.For("")
+	ctx := context.Background()
+	err := stores.Cards.Insert(ctx, models.Flashcard{
+		ID:        "map",
+		Front:     models.Content{Type: models.ContentRichText, Content: "Where is Heathrow?"},
+		Back:      models.Content{Type: models.ContentRichText, Content: "Inland"},
+		Assets:    []models.Asset{{ID: "map.jpg", Type: "image", Alt: "Map"}},
+		CreatedBy: ada.UserID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.StudentCards.Link(ctx, ada.StudentID, []string{"map"}); err != nil {
+		t.Fatal(err)
+	}
+
+	edit := func(occlusion string) int {
+		t.Helper()
+		w := serve(EditCardHandler, postAs(ada, "/edit-card", url.Values{
+			"card_id":   {"map"},
+			"type":      {models.ContentImageOcclusion},
+			"occlusion": {occlusion},
+		}))
+		return w.Code
+	}
+
+	// Only the card's own images can be covered
+	if code := edit(`{"image": "other.jpg", "masks": [{"id": 1, "x": 0, "y": 0, "w": 10, "h": 10}]}`); code != http.StatusOK {
+		t.Errorf("status = %d, want the form again", code)
+	}
+	if card, _ := stores.Cards.Get(ctx, "map"); card.Front.Type != models.ContentRichText {
+		t.Errorf("card type = %q, want it unchanged", card.Front.Type)
+	}
+
+	code := edit(`{"image": "map.jpg", "masks": [{"id": 1, "x": 0, "y": 0, "w": 10, "h": 10},
+		{"id": 3, "x": 50, "y": 50, "w": 10, "h": 10, "label": "Heathrow"}]}`)
+	if code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want a redirect", code)
+	}
+	card, err := stores.Cards.Get(ctx, "map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := card.Ords, []int{1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ords = %v, want %v", got, want)
+	}
+	// Each mask is a card to study, and the old card is gone
+	studentCard(t, backend, ada.StudentID, "map#1")
+	studentCard(t, backend, ada.StudentID, "map#3")
+	if _, err := stores.StudentCards.Get(ctx, ada.StudentID, "map"); err == nil {
+		t.Error("the rich text card is still linked")
+	}
+
+	w := serve(EditCardPage, getAs(ada, "/edit?card_id=map"))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Heathrow") {
+		t.Errorf("edit page: status = %d, want the masks in the form", w.Code)
+	}
+}
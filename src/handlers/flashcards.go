@@ -1,31 +1,26 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/abstract-tutoring/models"
 	"github.com/abstract-tutoring/services"
+	"github.com/abstract-tutoring/store"
 	"github.com/abstract-tutoring/utils"
 )
 
-func ServeHome(w http.ResponseWriter, r *http.Request) {
-	_, err := r.Cookie("access_token")
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
+// Answers slower than this were most likely left open in a tab.
+const maxAnswerTimeMs = 10 * 60 * 1000
 
-	tmpl, err := template.ParseFiles(
+func ServeHome(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := parseTemplates(r,
 		"./frontend/templates/base.html",
 		"./frontend/templates/flashcards.html",
 	)
@@ -53,41 +48,35 @@ func ServeFirstFlashcardFront(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	session := sessionFrom(r)
+
 	// check/update streak on normal card render
-	if userCookie, err1 := r.Cookie("user_id"); err1 == nil && userCookie.Value != "" {
-		if accessTokenCookie, err2 := r.Cookie("access_token"); err2 == nil && accessTokenCookie.Value != "" {
-			supabaseUrl := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL")
-			apiKey := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY")
-			if studentId, ferr := fetchStudentId(r, userCookie.Value, supabaseUrl, apiKey); ferr == nil && studentId != "" {
-				// log.Println("[DEBUG] Student ID found:", studentId)
-				if serr := checkAndUpdateStreak(r, userCookie.Value, studentId, supabaseUrl, apiKey); serr != nil {
-					log.Println("Failed to update streak:", serr)
-				}
-			}
+	if session.StudentID != "" {
+		if serr := checkAndUpdateStreak(r, session.UserID, session.StudentID); serr != nil {
+			log.Println("Failed to update streak:", serr)
 		}
 	}
 
 	// Check if user has any cards at all, and show empty state if not
-	userCookie, err := r.Cookie("user_id")
-	accessTokenCookie, err2 := r.Cookie("access_token")
-	if err == nil && err2 == nil && userCookie.Value != "" && accessTokenCookie.Value != "" {
-		supabaseUrl := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL")
-		apiKey := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY")
-		studentId, err := fetchStudentId(r, userCookie.Value, supabaseUrl, apiKey)
-		if err != nil || studentId == "" { // ← also check for empty studentId
-			renderNoCardsAvailable(w, r)
-			return
-		}
-		studentCards, err := fetchStudentCards(nil, r, studentId, supabaseUrl, apiKey)
-		if err == nil && len(studentCards) == 0 {
-			renderNoCardsAvailable(w, r)
-			return
-		}
+	if session.StudentID == "" {
+		renderNoCardsAvailable(w, r)
+		return
+	}
+	studentCards, err := fetchStudentCards(r, session.StudentID)
+	if err == nil && len(studentCards) == 0 {
+		renderNoCardsAvailable(w, r)
+		return
 	}
 	renderFlashcardPartial(w, r, "")
 }
 
 func renderFlashcardPartial(w http.ResponseWriter, r *http.Request, optionalCardID string) {
+	renderFlashcardPartialWith(w, r, optionalCardID, nil)
+}
+
+// renderFlashcardPartialWith renders the card with extra template data, such
+// as how the last card went.
+func renderFlashcardPartialWith(w http.ResponseWriter, r *http.Request, optionalCardID string, extra map[string]interface{}) {
 	// log.Println("[DEBUG] renderFlashcardPartial called with optionalCardID:", optionalCardID)
 	defer func() {
 		if r := recover(); r != nil {
@@ -105,7 +94,14 @@ func renderFlashcardPartial(w http.ResponseWriter, r *http.Request, optionalCard
 		}
 		return
 	}
+	for k, v := range extra {
+		data[k] = v
+	}
 
+	renderCardTemplate(w, data)
+}
+
+func renderCardTemplate(w http.ResponseWriter, data map[string]interface{}) {
 	tmpl, err := template.New("card").Funcs(template.FuncMap{
 		"safeHTML": func(s string) template.HTML { return template.HTML(s) },
 	}).ParseFiles("./frontend/templates/partials/card.html")
@@ -125,11 +121,8 @@ func renderFlashcardPartial(w http.ResponseWriter, r *http.Request, optionalCard
 
 func SubmitAnswer(w http.ResponseWriter, r *http.Request) {
 	// log.Println("SubmitAnswer called")
-	userId, err := getCookieValue(r, "user_id")
-	if err != nil {
-		http.Error(w, "Not logged in", http.StatusUnauthorized)
-		return
-	}
+	session := sessionFrom(r)
+	userId, studentId := session.UserID, session.StudentID
 
 	cardId := r.FormValue("card_id")
 	if cardId == "" {
@@ -137,352 +130,363 @@ func SubmitAnswer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rating := r.FormValue("rating")
-	if rating == "" {
-		http.Error(w, "Missing rating", http.StatusBadRequest)
+	// A typed answer without a rating is checked first, so the student can
+	// see how they did and pick a rating
+	if r.FormValue("rating") == "" && r.Form.Has("typed_answer") {
+		checkTypedAnswer(w, r, cardId)
 		return
 	}
 
-	supabaseUrl := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL")
-	apiKey := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY")
-
-	studentId, err := fetchStudentId(r, userId, supabaseUrl, apiKey)
+	note, err := storesFor(r).Cards.Get(r.Context(), models.NoteID(cardId))
 	if err != nil {
+		http.Error(w, "Error fetching card", http.StatusInternalServerError)
+		return
+	}
+
+	var rating int
+	var lastChoice *choiceResult
+	if note.Front.Type == models.ContentMultipleChoice {
+		// A multiple choice pick grades itself, and the next card says how
+		// it went. A rating can't be given instead.
+		result, err := gradeChoice(r, note)
+		if err != nil {
+			http.Error(w, "Invalid choice", http.StatusBadRequest)
+			return
+		}
+		rating, lastChoice = result.Rating, &result
+	} else if r.Form.Has("choice") {
+		http.Error(w, "Invalid choice", http.StatusBadRequest)
+		return
+	} else {
+		if rating, err = strconv.Atoi(r.FormValue("rating")); err != nil {
+			http.Error(w, "Missing rating", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if studentId == "" {
 		http.Error(w, "Error fetching student ID", http.StatusInternalServerError)
 		return
 	}
 
-	currentStatus, err := fetchCardStatus(w, r, studentId, cardId, supabaseUrl, apiKey)
+	current, err := fetchStudentCard(r, studentId, cardId)
 	if err != nil {
 		http.Error(w, "Error fetching card status", http.StatusInternalServerError)
 		return
 	}
 
-	newStatus, dueSeconds := services.LookupNext(currentStatus, rating)
-	if newStatus == -1 {
+	settings := loadStudentSettings(r, studentId)
+
+	answeredAt := time.Now()
+	now := answeredAt.Unix()
+	scheduler := studentScheduler(settings)
+	updated, err := scheduler.Next(current, rating, now)
+	if err != nil {
 		http.Error(w, "Invalid transition", http.StatusBadRequest)
 		return
 	}
+	updated = services.RecordLapse(current, updated, rating, settings, scheduler.Profile())
 
-	newDue := int(time.Now().Unix()) + dueSeconds
-	err = updateCardStatus(w, r, studentId, cardId, newStatus, newDue, supabaseUrl, apiKey)
+	err = updateCardStatus(r, studentId, cardId, updated)
 	if err != nil {
 		http.Error(w, "Failed to update card", http.StatusInternalServerError)
 		return
 	}
 
-	if currentStatus == 0 {
-		err := incrementNumNewCardsToday(r, userId, supabaseUrl, apiKey)
+	buriedSiblings := burySiblings(r, studentId, cardId, now, settings.DayRolloverHour)
+
+	countedNewCard := false
+	if current.Status == 0 {
+		err := incrementNumNewCardsToday(r, userId, settings.DayRolloverHour)
 		if err != nil {
 			log.Println("Failed to increment numNewCardsToday:", err)
+		} else {
+			countedNewCard = true
 		}
 	}
+
+	// Remember the streak as it was so the answer can be undone
+	prevStreakStart, prevStreakEnd, err := fetchStreakTimes(r, userId)
+	if err != nil {
+		log.Println("Failed to fetch streak before answer:", err)
+		prevStreakStart, prevStreakEnd = unknownStreakTime, unknownStreakTime
+	}
+
 	// Check and update streak
-	err = checkAndUpdateStreak(r, userId, studentId, supabaseUrl, apiKey)
+	err = checkAndUpdateStreak(r, userId, studentId)
 	if err != nil {
 		log.Println("Failed to update streak:", err)
 	}
 
-	renderFlashcardPartial(w, r, "")
-
-}
-
-func HandleSettingsPage(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles(
-		"./frontend/templates/base.html",
-		"./frontend/templates/settings.html",
-		"./frontend/templates/partials/review-ahead-form.html",
-	)
+	entry := models.ReviewLog{
+		StudentID:           studentId,
+		CardID:              cardId,
+		Rating:              rating,
+		PrevStatus:          current.Status,
+		NewStatus:           updated.Status,
+		PrevDue:             current.Due,
+		NewDue:              updated.Due,
+		TimeTakenMs:         answerTimeMs(r.FormValue("shown_at"), answeredAt),
+		ReviewedAt:          now,
+		PrevStability:       current.Stability,
+		PrevDifficulty:      current.Difficulty,
+		PrevLastReview:      current.LastReview,
+		CountedNewCard:      countedNewCard,
+		PrevStreakStartTime: prevStreakStart,
+		PrevStreakEndTime:   prevStreakEnd,
+		PrevLapses:          current.Lapses,
+		PrevSuspended:       current.Suspended,
+		PrevLeech:           current.Leech,
+		BuriedSiblings:      buriedSiblings,
+	}
+	logID, err := storesFor(r).ReviewLogs.Insert(r.Context(), entry)
 	if err != nil {
-		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		log.Println("Failed to write review log:", err)
+	} else {
+		r = pushUndo(w, r, logID)
+	}
+
+	if lastChoice != nil {
+		renderFlashcardPartialWith(w, r, "", map[string]interface{}{"LastChoice": lastChoice})
 		return
 	}
+	renderFlashcardPartial(w, r, "")
 
-	data := buildSettingsContext(r, true)
+}
 
-	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
-		http.Error(w, "Execution error: "+err.Error(), http.StatusInternalServerError)
-	}
+// choiceResult is how a multiple choice pick went.
+type choiceResult struct {
+	Rating  int
+	Correct bool
+	Answer  string // the correct option, shown if the pick was wrong
 }
 
-func getCookieValue(r *http.Request, name string) (string, error) {
-	cookie, err := r.Cookie(name)
+// gradeChoice rates the option picked on a multiple choice card, comparing
+// it with the card's own options.
+func gradeChoice(r *http.Request, card models.Flashcard) (choiceResult, error) {
+	if !r.Form.Has("choice") {
+		return choiceResult{}, fmt.Errorf("no option picked on card %s", card.ID)
+	}
+	rating, err := services.ChoiceRating(card, r.FormValue("choice"))
 	if err != nil {
-		return "", err
+		return choiceResult{}, err
 	}
-	return cookie.Value, nil
+	answer, _ := services.SanitiseAndValidate(card.Back.Content)
+	return choiceResult{
+		Rating:  rating,
+		Correct: rating == services.RatingGood,
+		Answer:  services.ResolveAssetsInContent(answer, card.Assets, assetURLs(r)),
+	}, nil
 }
 
-func fetchStudentId(r *http.Request, userId, supabaseUrl, apiKey string) (string, error) {
-	req, _ := http.NewRequest("GET", supabaseUrl+"/rest/v1/users_students?select=student_id&user_id=eq."+userId, nil)
-
-	accessCookie, err := r.Cookie("access_token")
+// checkTypedAnswer shows the card again with the back revealed, the typed
+// answer compared with it and a suggested rating.
+func checkTypedAnswer(w http.ResponseWriter, r *http.Request, cardId string) {
+	data, err := buildCardData(w, r, cardId)
 	if err != nil {
-		return "", errors.New("access token missing")
-	}
-	token := accessCookie.Value
-
-	req.Header.Set("apikey", apiKey)
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil || resp.StatusCode != 200 {
-		return "", errors.New("failed to fetch student ID")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	defer resp.Body.Close()
 
-	var result []struct {
-		StudentID string `json:"student_id"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", errors.New("failed to decode student ID")
+	noteID, ord := models.SplitCardKey(cardId)
+	card, err := storesFor(r).Cards.Get(r.Context(), noteID)
+	if err != nil {
+		log.Println("Failed to load card to check answer:", err)
+		http.Error(w, "Failed to load card", http.StatusInternalServerError)
+		return
 	}
 
-	if len(result) == 0 {
-		// No mapping exists — return sentinel
-		return "", nil
+	data["Check"] = services.CheckAnswer(r.FormValue("typed_answer"), services.ExpectedAnswer(card, ord))
+	// Time the answer from when the front was first shown
+	if shown, err := strconv.ParseInt(r.FormValue("shown_at"), 10, 64); err == nil && shown > 0 {
+		data["ShownAt"] = shown
 	}
-
-	return result[0].StudentID, nil
+	renderCardTemplate(w, data)
 }
 
-func fetchCardStatus(w http.ResponseWriter, r *http.Request, studentId, cardId, supabaseUrl, apiKey string) (int, error) {
-	tokenCookie, err := r.Cookie("access_token")
+// burySiblings hides the answered card's siblings until the next study day.
+// It returns the ones it buried, for the review log, so undo can bring them
+// back.
+func burySiblings(r *http.Request, studentId, cardId string, now int64, rolloverHour int) []models.BuriedSibling {
+	cards, err := fetchStudentCards(r, studentId)
 	if err != nil {
-		return 0, errors.New("access token missing")
+		log.Println("Failed to load cards to bury siblings:", err)
+		return nil
 	}
-	token := tokenCookie.Value
-
-	doRequest := func(token string) (*http.Response, error) {
-		req, _ := http.NewRequest("GET", supabaseUrl+"/rest/v1/students_cards?select=status&student_id=eq."+studentId+"&card_id=eq."+cardId, nil)
-		req.Header.Set("apikey", apiKey)
-		req.Header.Set("Authorization", "Bearer "+token)
-		return http.DefaultClient.Do(req)
+	prevBuriedUntil := make(map[string]int64, len(cards))
+	for _, c := range cards {
+		prevBuriedUntil[c.CardID] = c.BuriedUntil
 	}
 
-	resp, err := doRequest(token)
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == 401 {
-		newToken, newRefresh, refreshErr := refreshAccessToken(r)
-		if refreshErr != nil {
-			forceLogout(w, r)
-			return 0, refreshErr
-		}
-		utils.SetCookie(w, r, "access_token", newToken, time.Now().Add(15*time.Minute))
-		utils.SetCookie(w, r, "refresh_token", newRefresh, time.Now().Add(30*24*time.Hour))
-
-		resp, err = doRequest(newToken)
-		if err != nil {
-			return 0, err
+	var buried []models.BuriedSibling
+	buriedUntil := utils.NextStudyDayStart(now, rolloverHour)
+	for _, siblingID := range services.SiblingsToBury(cards, cardId, buriedUntil) {
+		if err := patchStudentCard(r, studentId, siblingID, map[string]interface{}{"buried_until": buriedUntil}); err != nil {
+			log.Printf("Failed to bury sibling %s: %v", siblingID, err)
+			continue
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != 200 {
-			return 0, errors.New("failed to fetch card status after refresh")
-		}
-	} else if resp.StatusCode != 200 {
-		return 0, errors.New("failed to fetch card status")
+		buried = append(buried, models.BuriedSibling{
+			CardID:          siblingID,
+			BuriedUntil:     buriedUntil,
+			PrevBuriedUntil: prevBuriedUntil[siblingID],
+		})
 	}
+	return buried
+}
 
-	var result []struct {
-		Status int `json:"status"`
+// answerTimeMs is how long the card was on screen, from the shown_at
+// timestamp (unix ms) rendered into the card partial.
+func answerTimeMs(shownAt string, answeredAt time.Time) int64 {
+	shown, err := strconv.ParseInt(shownAt, 10, 64)
+	if err != nil || shown <= 0 {
+		return 0
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || len(result) == 0 {
-		return 0, errors.New("invalid card")
+	elapsed := answeredAt.UnixMilli() - shown
+	if elapsed < 0 {
+		return 0
 	}
-
-	return result[0].Status, nil
+	if elapsed > maxAnswerTimeMs {
+		return maxAnswerTimeMs
+	}
+	return elapsed
 }
 
-func updateCardStatus(w http.ResponseWriter, r *http.Request, studentId, cardId string, status, due int, supabaseUrl, apiKey string) error {
-	tokenCookie, err := r.Cookie("access_token")
+func HandleSettingsPage(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := parseTemplates(r,
+		"./frontend/templates/base.html",
+		"./frontend/templates/settings.html",
+		"./frontend/templates/partials/review-ahead-form.html",
+	)
 	if err != nil {
-		return errors.New("access token missing")
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
-	token := tokenCookie.Value
 
-	body := map[string]interface{}{
-		"status": status,
-		"due":    due,
+	data := buildSettingsContext(r, true)
+	data["IsTutor"] = isTutor(r)
+	data["Error"] = r.URL.Query().Get("error")
+
+	classes, err := storesFor(r).Classes.StudentClasses(r.Context(), sessionFrom(r).StudentID)
+	if err != nil {
+		log.Println("Settings: failed to load classes:", err)
 	}
-	jsonBody, _ := json.Marshal(body)
+	data["Classes"] = classes
 
-	doRequest := func(token string) (*http.Response, error) {
-		req, _ := http.NewRequest("PATCH", supabaseUrl+"/rest/v1/students_cards?student_id=eq."+studentId+"&card_id=eq."+cardId, bytes.NewReader(jsonBody))
-		req.Header.Set("apikey", apiKey)
-		req.Header.Set("Authorization", "Bearer "+token)
-		req.Header.Set("Content-Type", "application/json")
-		return http.DefaultClient.Do(req)
+	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
+		http.Error(w, "Execution error: "+err.Error(), http.StatusInternalServerError)
 	}
+}
 
-	resp, err := doRequest(token)
+func getCookieValue(r *http.Request, name string) (string, error) {
+	cookie, err := r.Cookie(name)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == 401 {
-		newToken, newRefresh, refreshErr := refreshAccessToken(r)
-		if refreshErr != nil {
-			forceLogout(w, r)
-			return refreshErr
-		}
-		utils.SetCookie(w, r, "access_token", newToken, time.Now().Add(15*time.Minute))
-		utils.SetCookie(w, r, "refresh_token", newRefresh, time.Now().Add(30*24*time.Hour))
-
-		resp, err = doRequest(newToken)
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
+	return cookie.Value, nil
+}
 
-		if resp.StatusCode != 204 {
-			return fmt.Errorf("unexpected status code after refresh: %d", resp.StatusCode)
-		}
-	} else if resp.StatusCode != 204 {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+func fetchStudentCard(r *http.Request, studentId, cardId string) (models.StudentCard, error) {
+	card, err := storesFor(r).StudentCards.Get(r.Context(), studentId, cardId)
+	if errors.Is(err, store.ErrNotFound) {
+		return models.StudentCard{}, errors.New("invalid card")
 	}
+	return card, err
+}
 
-	return nil
+func updateCardStatus(r *http.Request, studentId, cardId string, card models.StudentCard) error {
+	return patchStudentCard(r, studentId, cardId, map[string]interface{}{
+		"status":      card.Status,
+		"due":         card.Due,
+		"stability":   card.Stability,
+		"difficulty":  card.Difficulty,
+		"last_review": card.LastReview,
+		"lapses":      card.Lapses,
+		"suspended":   card.Suspended,
+		"leech":       card.Leech,
+	})
 }
 
-func getNumNewCardsToday(r *http.Request, userId, supabaseUrl, apiKey string) (int, error) {
-	accessCookie, err := r.Cookie("access_token")
-	if err != nil {
-		return 0, errors.New("access token missing")
-	}
-	token := accessCookie.Value
+// patchStudentCard updates some columns of one students_cards row.
+func patchStudentCard(r *http.Request, studentId, cardId string, body map[string]interface{}) error {
+	return storesFor(r).StudentCards.Update(r.Context(), studentId, cardId, body)
+}
 
-	// Fetch both fields
-	url := fmt.Sprintf("%s/rest/v1/users_students?select=num_new_cards_today,num_new_cards_today_updated_at&user_id=eq.%s", supabaseUrl, userId)
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("apikey", apiKey)
-	req.Header.Set("Authorization", "Bearer "+token)
+func getNumNewCardsToday(r *http.Request, userId string, rolloverHour int) (int, error) {
+	students := storesFor(r).Students
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil || resp.StatusCode != 200 {
+	count, err := students.NewCardCount(r.Context(), userId)
+	if err != nil {
 		return 0, errors.New("failed to fetch num_new_cards_today")
 	}
-	defer resp.Body.Close()
-
-	var result []struct {
-		NumNewCardsToday          int   `json:"num_new_cards_today"`
-		NumNewCardsTodayUpdatedAt int64 `json:"num_new_cards_today_updated_at"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || len(result) == 0 {
-		return 0, errors.New("failed to decode num_new_cards_today")
-	}
 
 	nowUnix := time.Now().UTC().Unix()
-	ukDay := utils.UnixToUKTime(nowUnix).Format("2006-01-02")
-	lastUpdatedUnix := result[0].NumNewCardsTodayUpdatedAt
-	lastUpdatedDay := utils.UnixToUKTime(lastUpdatedUnix).Format("2006-01-02")
+	ukDay := utils.StudyDay(nowUnix, rolloverHour)
+	lastUpdatedDay := utils.StudyDay(count.UpdatedAt, rolloverHour)
 
 	// If last updated is before today, reset counter and timestamp
-	if lastUpdatedUnix == 0 || lastUpdatedDay != ukDay {
-		patchUrl := fmt.Sprintf("%s/rest/v1/users_students?user_id=eq.%s", supabaseUrl, userId)
-		body := map[string]interface{}{
-			"num_new_cards_today":            0,
-			"num_new_cards_today_updated_at": nowUnix,
-		}
-		jsonBody, _ := json.Marshal(body)
-		patchReq, _ := http.NewRequest("PATCH", patchUrl, bytes.NewReader(jsonBody))
-		patchReq.Header.Set("apikey", apiKey)
-		patchReq.Header.Set("Authorization", "Bearer "+token)
-		patchReq.Header.Set("Content-Type", "application/json")
-
-		patchResp, err := http.DefaultClient.Do(patchReq)
-		if err != nil || (patchResp.StatusCode != 200 && patchResp.StatusCode != 204) {
+	if count.UpdatedAt == 0 || lastUpdatedDay != ukDay {
+		if err := students.SetNewCardCount(r.Context(), userId, store.NewCardCount{Count: 0, UpdatedAt: nowUnix}); err != nil {
 			return 0, errors.New("failed to reset num_new_cards_today")
 		}
-		defer patchResp.Body.Close()
 		return 0, nil
 	}
 
-	return result[0].NumNewCardsToday, nil
+	return count.Count, nil
 }
 
-func incrementNumNewCardsToday(r *http.Request, userId, supabaseUrl, apiKey string) error {
-	accessCookie, err := r.Cookie("access_token")
-	if err != nil {
-		return errors.New("access token missing")
-	}
-	token := accessCookie.Value
+func incrementNumNewCardsToday(r *http.Request, userId string, rolloverHour int) error {
+	students := storesFor(r).Students
 
 	// Fetch last updated date and current count
-	url := fmt.Sprintf("%s/rest/v1/users_students?select=num_new_cards_today,num_new_cards_today_updated_at&user_id=eq.%s", supabaseUrl, userId)
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("apikey", apiKey)
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil || resp.StatusCode != 200 {
+	current, err := students.NewCardCount(r.Context(), userId)
+	if errors.Is(err, store.ErrNotFound) {
+		// No record, treat as first card of the day
+		current = store.NewCardCount{}
+	} else if err != nil {
 		return errors.New("failed to fetch num_new_cards_today_updated_at")
 	}
-	defer resp.Body.Close()
 
-	var result []struct {
-		NumNewCardsToday          int   `json:"num_new_cards_today"`
-		NumNewCardsTodayUpdatedAt int64 `json:"num_new_cards_today_updated_at"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		// If decode fails, treat as first card of the day
-		result = []struct {
-			NumNewCardsToday          int   `json:"num_new_cards_today"`
-			NumNewCardsTodayUpdatedAt int64 `json:"num_new_cards_today_updated_at"`
-		}{{0, 0}}
+	nowUnix := time.Now().UTC().Unix()
+	ukDay := utils.StudyDay(nowUnix, rolloverHour)
+
+	count := current.Count + 1
+	if current.UpdatedAt == 0 || utils.StudyDay(current.UpdatedAt, rolloverHour) != ukDay {
+		count = 1
 	}
 
-	now := time.Now().UTC()
-	nowUnix := now.Unix()
-	ukDay := utils.UnixToUKTime(nowUnix).Format("2006-01-02")
+	if err := students.SetNewCardCount(r.Context(), userId, store.NewCardCount{Count: count, UpdatedAt: nowUnix}); err != nil {
+		return errors.New("failed to update num_new_cards_today")
+	}
+	return nil
+}
 
-	var lastUpdatedUnix int64
-	var lastUpdatedDay string
-	var count int
+// decrementNumNewCardsToday takes back one new card from today's count. Counts
+// from a previous day have already been reset, so they are left alone.
+func decrementNumNewCardsToday(r *http.Request, userId string, rolloverHour int) error {
+	students := storesFor(r).Students
 
-	if len(result) > 0 {
-		lastUpdatedUnix = result[0].NumNewCardsTodayUpdatedAt
-		lastUpdatedDay = utils.UnixToUKTime(lastUpdatedUnix).Format("2006-01-02")
-		if lastUpdatedUnix == 0 || lastUpdatedDay != ukDay {
-			count = 1
-		} else {
-			count = result[0].NumNewCardsToday + 1
-		}
-	} else {
-		// No record, treat as first card of the day
-		count = 1
+	current, err := students.NewCardCount(r.Context(), userId)
+	if err != nil {
+		return errors.New("failed to fetch num_new_cards_today")
 	}
 
-	// Patch the value
-	patchUrl := fmt.Sprintf("%s/rest/v1/users_students?user_id=eq.%s", supabaseUrl, userId)
-	body := map[string]interface{}{
-		"num_new_cards_today":            count,
-		"num_new_cards_today_updated_at": nowUnix,
+	ukDay := utils.StudyDay(time.Now().UTC().Unix(), rolloverHour)
+	lastUpdatedDay := utils.StudyDay(current.UpdatedAt, rolloverHour)
+	if lastUpdatedDay != ukDay || current.Count <= 0 {
+		return nil
 	}
-	jsonBody, _ := json.Marshal(body)
-	patchReq, _ := http.NewRequest("PATCH", patchUrl, bytes.NewReader(jsonBody))
-	patchReq.Header.Set("apikey", apiKey)
-	patchReq.Header.Set("Authorization", "Bearer "+token)
-	patchReq.Header.Set("Content-Type", "application/json")
 
-	patchResp, err := http.DefaultClient.Do(patchReq)
-	if err != nil || (patchResp.StatusCode != 200 && patchResp.StatusCode != 204) {
+	current.Count--
+	if err := students.SetNewCardCount(r.Context(), userId, current); err != nil {
 		return errors.New("failed to update num_new_cards_today")
 	}
-	defer patchResp.Body.Close()
-
 	return nil
 }
 
 func renderNoCardsAvailable(w http.ResponseWriter, r *http.Request) {
 	utils.ClearCookie(w, r, "current_card_id")
 
-	tmpl, err := template.ParseFiles(
+	tmpl, err := parseTemplates(r,
 		"./frontend/templates/partials/empty.html",
 		"./frontend/templates/partials/review-ahead-form.html",
 	)
@@ -495,33 +499,20 @@ func renderNoCardsAvailable(w http.ResponseWriter, r *http.Request) {
 	data := buildSettingsContext(r, false)
 
 	// --- Add streak info to context ---
-	userCookie, err1 := r.Cookie("user_id")
-	accessTokenCookie, err2 := r.Cookie("access_token")
+	session := sessionFrom(r)
 	streakCount := 0
 	streakEmoji := ""
-	if err1 == nil && err2 == nil && userCookie.Value != "" && accessTokenCookie.Value != "" {
-		userId := userCookie.Value
-		accessToken := accessTokenCookie.Value
-		supabaseUrl := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL")
-		apiKey := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY")
-		req, _ := http.NewRequest("GET", supabaseUrl+"/rest/v1/users_students?select=streak_start_time,streak_end_time&user_id=eq."+userId, nil)
-		req.Header.Set("apikey", apiKey)
-		req.Header.Set("Authorization", "Bearer "+accessToken)
-		resp, err := http.DefaultClient.Do(req)
-		if err == nil && resp.StatusCode == 200 {
-			defer resp.Body.Close()
-			var streakResult []struct {
-				StreakStartTime int64 `json:"streak_start_time"`
-				StreakEndTime   int64 `json:"streak_end_time"`
-			}
-			if err := json.NewDecoder(resp.Body).Decode(&streakResult); err == nil && len(streakResult) > 0 {
-				streakCount, streakEmoji = services.GetCurrentStreak(streakResult[0].StreakStartTime, streakResult[0].StreakEndTime)
-			}
-		}
+	rolloverHour := 0
+	if session.StudentID != "" {
+		rolloverHour = loadStudentSettings(r, session.StudentID).DayRolloverHour
+	}
+	if start, end, err := fetchStreakTimes(r, session.UserID); err == nil {
+		streakCount, streakEmoji = services.GetCurrentStreak(start, end, rolloverHour)
 	}
 	data["StreakCount"] = streakCount
 	data["StreakEmoji"] = streakEmoji
 	// --- End streak info ---
+	data["CanUndo"] = len(readUndoStack(r)) > 0
 
 	if err := tmpl.Execute(w, data); err != nil {
 		http.Error(w, "Render error: "+err.Error(), http.StatusInternalServerError)
@@ -536,9 +527,11 @@ func HandleReviewAhead(w http.ResponseWriter, r *http.Request) {
 	tagFilter := r.FormValue("tag_filter")
 	daysStr := r.FormValue("days")
 	maxStr := r.FormValue("new_max") // Now interpreted as a direct value, not an increment
-
-	// session cookie for tag filter
-	utils.SetCookie(w, r, "tag_filter", tagFilter, time.Time{})
+	maxInProgressStr := r.FormValue("max_in_progress")
+	rolloverStr := r.FormValue("day_rollover_hour")
+	profileName := r.FormValue("scheduling_profile")
+	leechThresholdStr := r.FormValue("leech_threshold")
+	leechAction := r.FormValue("leech_action")
 
 	// Set 'review_ahead_days' only if present and valid
 	if daysStr != "" {
@@ -547,97 +540,132 @@ func HandleReviewAhead(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Set 'max_new_cards_per_day' only if present and valid
+	studentId := sessionFrom(r).StudentID
+	if studentId == "" {
+		http.Error(w, "Error fetching student ID", http.StatusInternalServerError)
+		return
+	}
+
+	students := storesFor(r).Students
+	settings, err := students.Settings(r.Context(), studentId)
+	if err != nil {
+		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
+		return
+	}
+
+	// Blank fields leave the saved value alone; the tag filter is always replaced
+	settings.DefaultTagFilter = strings.TrimSpace(tagFilter)
 	if maxStr != "" {
 		if maxNewCards, err := strconv.Atoi(maxStr); err == nil && maxNewCards >= 0 {
-			utils.SetCookie(w, r, "max_new_cards_per_day", strconv.Itoa(maxNewCards), time.Time{})
+			settings.NewCardsPerDay = maxNewCards
 		}
 	}
+	if maxInProgressStr != "" {
+		if maxInProgress, err := strconv.Atoi(maxInProgressStr); err == nil && maxInProgress >= 0 {
+			settings.MaxInProgress = maxInProgress
+		}
+	}
+	if rolloverStr != "" {
+		if hour, err := strconv.Atoi(rolloverStr); err == nil && hour >= 0 && hour <= 23 {
+			settings.DayRolloverHour = hour
+		}
+	}
+	// Under FSRS the profile isn't used, and statuses already follow FSRS's layout
+	if profileName != "" && profileName != settings.SchedulingProfile && services.SchedulingProfileExists(profileName) &&
+		!services.FSRSEnabled() {
+		if err := remapCardStatuses(r, studentId, settings.SchedulingProfile, profileName); err != nil {
+			log.Println("Failed to switch scheduling profile:", err)
+			http.Error(w, "Failed to switch scheduling profile", http.StatusInternalServerError)
+			return
+		}
+		settings.SchedulingProfile = profileName
+	}
+	if leechThresholdStr != "" {
+		if threshold, err := strconv.Atoi(leechThresholdStr); err == nil && threshold >= 1 {
+			settings.LeechThreshold = threshold
+		}
+	}
+	if leechAction == models.LeechActionSuspend || leechAction == models.LeechActionTag {
+		settings.LeechAction = leechAction
+	}
 
-	// No content returned; client will redirect
-	w.WriteHeader(http.StatusNoContent)
-}
-
-func ServeStatusPanel(w http.ResponseWriter, r *http.Request) {
-	userCookie, err := r.Cookie("user_id")
-	if err != nil || userCookie.Value == "" {
-		w.WriteHeader(http.StatusNoContent)
+	if err := students.SaveSettings(r.Context(), settings); err != nil {
+		log.Println("Failed to save settings:", err)
+		http.Error(w, "Failed to save settings", http.StatusInternalServerError)
 		return
 	}
-	userId := userCookie.Value
 
-	supabaseUrl := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL")
-	apiKey := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY")
+	// No content returned; client will redirect
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	studentId, err := fetchStudentId(r, userId, supabaseUrl, apiKey)
+// remapCardStatuses moves every card's status onto the new profile's layout,
+// since statuses only mean something relative to a profile's step and level counts.
+func remapCardStatuses(r *http.Request, studentId, fromName, toName string) error {
+	cards, err := fetchStudentCards(r, studentId)
 	if err != nil {
-		w.WriteHeader(http.StatusNoContent)
-		return
+		return err
 	}
-
-	cards, err := fetchStudentCards(w, r, studentId, supabaseUrl, apiKey)
-	if err != nil {
-		w.WriteHeader(http.StatusNoContent)
-		return
+	from := services.SchedulingProfileByName(fromName)
+	to := services.SchedulingProfileByName(toName)
+	for _, c := range cards {
+		status := services.RemapStatus(c.Status, from, to)
+		if status == c.Status {
+			continue
+		}
+		if err := patchStudentCard(r, studentId, c.CardID, map[string]interface{}{"status": status}); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	accessTokenCookie, err := r.Cookie("access_token")
-	if err != nil || accessTokenCookie.Value == "" {
+func ServeStatusPanel(w http.ResponseWriter, r *http.Request) {
+	session := sessionFrom(r)
+	userId, studentId := session.UserID, session.StudentID
+
+	cards, err := fetchStudentCards(r, studentId)
+	if err != nil {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
-	accessToken := accessTokenCookie.Value
 
-	allCards, err := services.LoadCardsJSON(accessToken)
+	allCards, err := storesFor(r).Cards.All(r.Context())
 	if err != nil {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	// Parse tag filter from cookie
-	tagFilter := map[string]bool{}
-	if cookie, err := r.Cookie("tag_filter"); err == nil && cookie.Value != "" {
-		parts := strings.Split(cookie.Value, ",")
-		for _, p := range parts {
-			clean := strings.ToLower(strings.TrimSpace(p))
-			if clean != "" {
-				tagFilter[clean] = true
-			}
-		}
-	}
+	settings := loadStudentSettings(r, studentId)
+	profile := studentScheduler(settings).Profile()
 
-	filteredCards := services.FilterStudentCardsByTags(cards, allCards, tagFilter)
+	filteredCards := services.FilterStudentCardsByTags(cards, allCards, services.TagFilterSet(settings.DefaultTagFilter))
 
 	reviewAheadOffset := GetReviewAheadSeconds(r)
 	now := time.Now().Unix() + reviewAheadOffset
 
 	var newCount, inProgCount, reviewCount int
 
-	numNewToday, err := getNumNewCardsToday(r, userId, supabaseUrl, apiKey)
+	numNewToday, err := getNumNewCardsToday(r, userId, settings.DayRolloverHour)
 	if err != nil {
 		log.Println("Error fetching num_new_cards_today:", err)
 		numNewToday = 0 // Fallback to 0 if there's an error
 	}
 
-	maxNewCardsPerDay := getMaxNewCardsPerDay(r)
-
-	i, err := strconv.Atoi(maxNewCardsPerDay)
-	if err != nil {
-		log.Println("Conversion error:", err)
-		return
-	}
-
-	maxNewAllowed := i - numNewToday
+	maxNewAllowed := settings.NewCardsPerDay - numNewToday
 
 	for _, c := range filteredCards {
-		switch c.Status {
-		case 0:
+		if services.IsExcludedFromStudy(c, time.Now().Unix()) {
+			continue
+		}
+		switch {
+		case profile.IsNew(c.Status):
 			if c.Due <= now && newCount < maxNewAllowed {
 				newCount++
 			}
-		case 1, 2, 3:
+		case profile.IsLearning(c.Status):
 			inProgCount++
-		case 4, 5, 6:
+		case profile.IsReview(c.Status):
 			if c.Due <= now {
 				reviewCount++
 			}
@@ -653,7 +681,7 @@ func ServeStatusPanel(w http.ResponseWriter, r *http.Request) {
 		"CardStatus": currentStatus,
 	}
 
-	tmpl, err := template.ParseFiles("./frontend/templates/partials/status-panel.html")
+	tmpl, err := parseTemplates(r, "./frontend/templates/partials/status-panel.html")
 	if err != nil {
 		log.Println("Failed to parse status-panel template:", err)
 		http.Error(w, "Template error", http.StatusInternalServerError)
@@ -678,12 +706,46 @@ func GetReviewAheadSeconds(r *http.Request) int64 {
 	return int64(days * 24 * 3600)
 }
 
-func getMaxNewCardsPerDay(r *http.Request) string {
-	cookie, err := r.Cookie("max_new_cards_per_day")
+// loadStudentSettings falls back to the defaults if the settings can't be read,
+// so a missing table or row never blocks studying.
+func loadStudentSettings(r *http.Request, studentId string) models.StudentSettings {
+	settings, err := storesFor(r).Students.Settings(r.Context(), studentId)
 	if err != nil {
-		return ""
+		log.Println("Failed to load student settings:", err)
 	}
-	return cookie.Value
+	return settings
+}
+
+// loadAssignmentPlan falls back to an empty plan if the assignments can't be
+// read, so studying carries on at the student's own pace.
+func loadAssignmentPlan(r *http.Request, studentId string, cards []models.StudentCard, settings models.StudentSettings, profile *services.SchedulingProfile) services.AssignmentPlan {
+	now := time.Now().Unix()
+	stores := storesFor(r)
+	assignments, err := stores.Classes.StudentAssignments(r.Context(), studentId)
+	if err != nil {
+		log.Println("Failed to load assignments:", err)
+		assignments = nil
+	}
+
+	var introduced map[string]bool
+	for _, a := range assignments {
+		if a.LearnBy == "" {
+			continue
+		}
+		dayStart, _ := utils.StudyDayStart(utils.StudyDay(now, settings.DayRolloverHour), settings.DayRolloverHour)
+		introduced, err = stores.ReviewLogs.IntroducedSince(r.Context(), studentId, dayStart)
+		if err != nil {
+			log.Println("Failed to load cards introduced today:", err)
+		}
+		break
+	}
+
+	return services.PlanAssignments(assignments, cards, introduced, now, settings.DayRolloverHour, profile)
+}
+
+// studentScheduler is the scheduler for the student's chosen profile.
+func studentScheduler(settings models.StudentSettings) services.Scheduler {
+	return services.SchedulerFor(services.SchedulingProfileByName(settings.SchedulingProfile))
 }
 
 func HandleGoToCard(w http.ResponseWriter, r *http.Request) {
@@ -720,67 +782,47 @@ func GoToCard(w http.ResponseWriter, r *http.Request, cardID string) {
 }
 
 func buildCardData(w http.ResponseWriter, r *http.Request, optionalCardID string) (map[string]interface{}, error) {
-	userCookie, err := r.Cookie("user_id")
-	if err != nil || userCookie.Value == "" {
-		return nil, fmt.Errorf("unauthenticated")
-	}
-	userId := userCookie.Value
-
-	accessTokenCookie, err := r.Cookie("access_token")
-	if err != nil || accessTokenCookie.Value == "" {
-		return nil, fmt.Errorf("unauthenticated")
-	}
-	accessToken := accessTokenCookie.Value
-
-	supabaseUrl := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL")
-	apiKey := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY")
-
-	studentId, err := fetchStudentId(r, userId, supabaseUrl, apiKey)
-	if err != nil || studentId == "" {
+	session := sessionFrom(r)
+	userId, studentId := session.UserID, session.StudentID
+	if studentId == "" {
 		return nil, fmt.Errorf("failed to fetch student ID")
 	}
 
-	allCards, err := services.LoadCardsJSON(accessToken)
+	allCards, err := storesFor(r).Cards.All(r.Context())
 	if err != nil {
 		return nil, fmt.Errorf("failed to load cards")
 	}
 
-	studentCards, err := fetchStudentCards(nil, r, studentId, supabaseUrl, apiKey)
+	studentCards, err := fetchStudentCards(r, studentId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load student cards")
 	}
 
+	settings := loadStudentSettings(r, studentId)
+	scheduler := studentScheduler(settings)
+	profile := scheduler.Profile()
+
 	var cardID string
 	if optionalCardID != "" {
 		cardID = optionalCardID
 	} else {
-		numNewToday, err := getNumNewCardsToday(r, userId, supabaseUrl, apiKey)
+		numNewToday, err := getNumNewCardsToday(r, userId, settings.DayRolloverHour)
 		if err != nil {
 			log.Println("Error fetching num_new_cards_today:", err)
 			numNewToday = 0 // Fallback to 0 if there's an error
 		}
 
 		reviewAheadOffset := GetReviewAheadSeconds(r)
-		maxNewCardsPerDay := getMaxNewCardsPerDay(r)
-
-		allowedTags := make(map[string]bool)
-		if tagCookie, err := r.Cookie("tag_filter"); err == nil {
-			raw := tagCookie.Value
-			for _, t := range strings.Split(raw, ",") {
-				trimmed := strings.TrimSpace(t)
-				if trimmed != "" {
-					allowedTags[trimmed] = true
-				}
-			}
-		}
 
 		pickedID, _, err := services.PickNextCard(
 			reviewAheadOffset,
 			studentCards,
 			numNewToday,
-			maxNewCardsPerDay,
+			settings,
+			profile,
 			allCards,
-			allowedTags,
+			services.TagFilterSet(settings.DefaultTagFilter),
+			loadAssignmentPlan(r, studentId, studentCards, settings, profile),
 		)
 
 		if err != nil {
@@ -796,11 +838,22 @@ func buildCardData(w http.ResponseWriter, r *http.Request, optionalCardID string
 			break
 		}
 	}
+	if pickedCard == nil {
+		// Going to a note, as from its edit page, shows its first card
+		for _, c := range studentCards {
+			if models.NoteID(c.CardID) == cardID {
+				pickedCard = &c
+				cardID = c.CardID
+				break
+			}
+		}
+	}
 	if pickedCard == nil {
 		return nil, fmt.Errorf("picked card is not in student cards")
 	}
 
-	card, ok := allCards[cardID]
+	noteID, ord := models.SplitCardKey(cardID)
+	card, ok := allCards[noteID]
 	if !ok {
 		return nil, fmt.Errorf("card not found")
 	}
@@ -811,23 +864,33 @@ func buildCardData(w http.ResponseWriter, r *http.Request, optionalCardID string
 	}
 	tagNames = services.SortTagsAlphabetically(tagNames)
 
-	cardStatus := services.MapStatusToLabel(pickedCard.Status)
+	cardStatus := services.MapStatusToLabel(pickedCard.Status, profile)
 
 	// session cookie for current card (no Expires => session)
 	utils.SetCookie(w, r, "current_card_id", cardID, time.Time{})
 
-	var front, back string
-	if card.CreatedBy == userId || card.CreatedBy == "" {
-		front = services.ResolveAssetsInContent(card.Front.Content, card.Assets, accessToken)
-		back = services.ResolveAssetsInContent(card.Back.Content, card.Assets, accessToken)
-	} else {
-		safeFront, _ := services.SanitiseAndValidate(card.Front.Content)
-		safeBack, _ := services.SanitiseAndValidate(card.Back.Content)
-		front = services.ResolveAssetsInContent(safeFront, card.Assets, accessToken)
-		back = services.ResolveAssetsInContent(safeBack, card.Assets, accessToken)
+	content := card
+	if card.CreatedBy != userId && card.CreatedBy != "" {
+		content.Front.Content, _ = services.SanitiseAndValidate(card.Front.Content)
+		content.Back.Content, _ = services.SanitiseAndValidate(card.Back.Content)
+	}
+	front, back := services.RenderCardSides(content, ord)
+	urlFor := assetURLs(r)
+	front = services.ResolveAssetsInContent(front, card.Assets, urlFor)
+	back = services.ResolveAssetsInContent(back, card.Assets, urlFor)
+
+	// Multiple choice options come in a new order each time they're shown
+	var choices []services.Choice
+	if card.Front.Type == models.ContentMultipleChoice {
+		for _, c := range services.ShuffleChoices(content) {
+			c.Content, _ = services.SanitiseAndValidate(c.Content)
+			c.Content = services.ResolveAssetsInContent(c.Content, card.Assets, urlFor)
+			choices = append(choices, c)
+		}
 	}
 
-	// After you have cardStatus and pickedCard.Status
+	// Preview where each rating would send the card
+	now := time.Now().Unix()
 	ratingTimes := []struct {
 		Label      string
 		Value      int
@@ -840,12 +903,12 @@ func buildCardData(w http.ResponseWriter, r *http.Request, optionalCardID string
 	}{
 		{1, "Bad"}, {2, "Okay"}, {3, "Good"}, {4, "Great"},
 	} {
-		nextStatus, dueSeconds := services.LookupNext(pickedCard.Status, fmt.Sprintf("%d", rating.Value))
 		var timeStr string
-		if nextStatus == -1 {
+		next, err := scheduler.Next(*pickedCard, rating.Value, now)
+		if err != nil {
 			timeStr = "?"
 		} else {
-			timeStr = services.FormatDueTime(dueSeconds, nextStatus)
+			timeStr = services.FormatDueTime(int(next.Due-now), next.Status, profile)
 		}
 		ratingTimes = append(ratingTimes, struct {
 			Label      string
@@ -855,22 +918,10 @@ func buildCardData(w http.ResponseWriter, r *http.Request, optionalCardID string
 	}
 
 	// Fetch streak times
-	req, _ := http.NewRequest("GET", supabaseUrl+"/rest/v1/users_students?select=streak_start_time,streak_end_time&user_id=eq."+userId, nil)
-	req.Header.Set("apikey", apiKey)
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	resp, err := http.DefaultClient.Do(req)
-
 	var streakCount int
 	var streakEmoji string
-	if err == nil && resp.StatusCode == 200 {
-		defer resp.Body.Close()
-		var streakResult []struct {
-			StreakStartTime int64 `json:"streak_start_time"`
-			StreakEndTime   int64 `json:"streak_end_time"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&streakResult); err == nil && len(streakResult) > 0 {
-			streakCount, streakEmoji = services.GetCurrentStreak(streakResult[0].StreakStartTime, streakResult[0].StreakEndTime)
-		}
+	if start, end, err := fetchStreakTimes(r, userId); err == nil {
+		streakCount, streakEmoji = services.GetCurrentStreak(start, end, settings.DayRolloverHour)
 	}
 
 	// Add to your context:
@@ -886,10 +937,15 @@ func buildCardData(w http.ResponseWriter, r *http.Request, optionalCardID string
 		"RatingTimes": ratingTimes,
 		"CardStatus":  cardStatus,
 		"CardID":      cardID,
+		"NoteID":      noteID,
+		"TypeAnswer":  card.Front.Type == models.ContentTypeAnswer,
+		"Choices":     choices,
 		"IsOwner":     card.CreatedBy == userId,
 		"Tags":        tagNames,
 		"StreakCount": streakCount,
 		"StreakEmoji": streakEmoji,
+		"ShownAt":     time.Now().UnixMilli(),
+		"CanUndo":     len(readUndoStack(r)) > 0,
 	}, nil
 }
 
@@ -899,191 +955,137 @@ func buildSettingsContext(r *http.Request, showCancel bool) map[string]interface
 		days = cookie.Value
 	}
 
-	max := "0"
-	if cookie, err := r.Cookie("max_new_cards_per_day"); err == nil {
-		max = cookie.Value
-	}
-
-	tagFilter := ""
-	if cookie, err := r.Cookie("tag_filter"); err == nil {
-		tagFilter = cookie.Value
-	}
+	settings := models.DefaultStudentSettings("")
 
 	tags := []string{}
 
-	userCookie, err := r.Cookie("user_id")
-	accessTokenCookie, err2 := r.Cookie("access_token")
-	if err == nil && err2 == nil {
-		userId := userCookie.Value
-		accessToken := accessTokenCookie.Value
-
-		supabaseUrl := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL")
-		apiKey := utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY")
+	session := sessionFrom(r)
+	if studentId := session.StudentID; studentId != "" {
+		settings = loadStudentSettings(r, studentId)
 
-		studentId, err := fetchStudentId(r, userId, supabaseUrl, apiKey)
-		if err == nil && studentId != "" {
-			allCards, err := services.LoadCardsJSON(accessToken)
+		allCards, err := storesFor(r).Cards.All(r.Context())
+		if err == nil {
+			studentCards, err := fetchStudentCards(r, studentId)
 			if err == nil {
-				studentCards, err := fetchStudentCards(nil, r, studentId, supabaseUrl, apiKey)
-				if err == nil {
-					tagSet := make(map[string]struct{})
-
-					for _, sc := range studentCards {
-						card, ok := allCards[sc.CardID]
-						if !ok || card.CreatedBy != userId {
-							continue
-						}
-						for _, tag := range card.Tags {
-							tagSet[tag.Name] = struct{}{}
-						}
-					}
+				tagSet := make(map[string]struct{})
 
-					for tag := range tagSet {
-						tags = append(tags, tag)
+				for _, sc := range studentCards {
+					card, ok := allCards[models.NoteID(sc.CardID)]
+					if !ok || card.CreatedBy != session.UserID {
+						continue
+					}
+					for _, tag := range card.Tags {
+						tagSet[tag.Name] = struct{}{}
 					}
-					tags = services.SortTagsAlphabetically(tags)
 				}
+
+				for tag := range tagSet {
+					tags = append(tags, tag)
+				}
+				tags = services.SortTagsAlphabetically(tags)
 			}
 		}
 	}
 
+	// FSRS picks its own intervals, so there is no profile to choose
+	var profiles []string
+	if !services.FSRSEnabled() {
+		profiles = services.SchedulingProfileNames()
+	}
+
 	return map[string]interface{}{
-		"CurrentDays":      days,
-		"CurrentMax":       max,
-		"ShowCancel":       showCancel,
-		"UserTags":         tags,
-		"CurrentTagFilter": tagFilter,
+		"CurrentDays":           days,
+		"CurrentMax":            settings.NewCardsPerDay,
+		"CurrentMaxInProgress":  settings.MaxInProgress,
+		"CurrentRolloverHour":   settings.DayRolloverHour,
+		"CurrentProfile":        settings.SchedulingProfile,
+		"Profiles":              profiles,
+		"CurrentLeechThreshold": settings.LeechThreshold,
+		"CurrentLeechAction":    settings.LeechAction,
+		"ShowCancel":            showCancel,
+		"UserTags":              tags,
+		"CurrentTagFilter":      settings.DefaultTagFilter,
 	}
 }
 
-func fetchStudentCards(w http.ResponseWriter, r *http.Request, studentId, supabaseUrl, apiKey string) ([]models.StudentCard, error) {
-	tokenCookie, err := r.Cookie("access_token")
+func fetchStudentCards(r *http.Request, studentId string) ([]models.StudentCard, error) {
+	cards, err := storesFor(r).StudentCards.List(r.Context(), studentId)
 	if err != nil {
-		return nil, errors.New("access token missing")
+		return nil, errors.New("failed to fetch cards")
 	}
-	token := tokenCookie.Value
+	return cards, nil
+}
 
-	doRequest := func(token string) (*http.Response, error) {
-		req, _ := http.NewRequest("GET", supabaseUrl+"/rest/v1/students_cards?select=card_id,status,due&student_id=eq."+studentId, nil)
-		req.Header.Set("apikey", apiKey)
-		req.Header.Set("Authorization", "Bearer "+token)
-		return http.DefaultClient.Do(req)
-	}
+// unknownStreakTime marks streak times that could not be read when an answer
+// was logged; undo leaves the streak alone in that case.
+const unknownStreakTime = -1
 
-	resp, err := doRequest(token)
+func fetchStreakTimes(r *http.Request, userId string) (int64, int64, error) {
+	streak, err := storesFor(r).Students.Streak(r.Context(), userId)
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == 401 {
-		// refresh
-		newToken, newRefresh, refreshErr := refreshAccessToken(r)
-		if refreshErr != nil {
-			forceLogout(w, r)
-			return nil, refreshErr
-		}
-		utils.SetCookie(w, r, "access_token", newToken, time.Now().Add(15*time.Minute))
-		utils.SetCookie(w, r, "refresh_token", newRefresh, time.Now().Add(30*24*time.Hour))
-
-		resp, err = doRequest(newToken)
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != 200 {
-			return nil, errors.New("failed to fetch cards after refresh")
-		}
-	} else if resp.StatusCode != 200 {
-		return nil, errors.New("failed to fetch cards")
+		return 0, 0, errors.New("failed to fetch streak times")
 	}
+	return streak.Start, streak.End, nil
+}
 
-	var cards []models.StudentCard
-	if err := json.NewDecoder(resp.Body).Decode(&cards); err != nil {
-		return nil, errors.New("failed to decode cards")
+func setStreakTimes(r *http.Request, userId string, start, end int64) error {
+	if err := storesFor(r).Students.SetStreak(r.Context(), userId, store.Streak{Start: start, End: end}); err != nil {
+		return errors.New("failed to update streak times")
 	}
-
-	sort.Slice(cards, func(i, j int) bool {
-		return utils.LexicalCardIDLess(cards[i].CardID, cards[j].CardID)
-	})
-	return cards, nil
+	return nil
 }
 
-func checkAndUpdateStreak(r *http.Request, userId, studentId, supabaseUrl, apiKey string) error {
+func checkAndUpdateStreak(r *http.Request, userId, studentId string) error {
 	// log.Println("checkAndUpdateStreak called for user:", userId, "student:", studentId)
 	// Fetch all student cards
-	cards, err := fetchStudentCards(nil, r, studentId, supabaseUrl, apiKey)
+	cards, err := fetchStudentCards(r, studentId)
 	if err != nil {
 		return err
 	}
 
+	settings := loadStudentSettings(r, studentId)
+
 	now := time.Now().Unix()
-	stats := services.CountDueCards(cards, now)
+	stats := services.CountDueCards(cards, now, studentScheduler(settings).Profile())
 
 	// log.Println("In Progress Due:", stats.InProgressDue)
 	// log.Println("Review Due:", stats.ReviewDue)
 	// log.Println("New Available:", stats.NewAvailable)
 
 	// Get today's new card count
-	numNewToday, err := getNumNewCardsToday(r, userId, supabaseUrl, apiKey)
+	numNewToday, err := getNumNewCardsToday(r, userId, settings.DayRolloverHour)
 	if err != nil {
 		return err
 	}
 
-	// Only count streak if all due cards are done and (>= 20 new cards completed OR no new cards left)
-	if stats.InProgressDue == 0 && stats.ReviewDue == 0 && (numNewToday >= 20 || stats.NewAvailable == 0) {
+	// Only count streak if all due cards are done and (the day's new cards are done OR no new cards left)
+	if stats.InProgressDue == 0 && stats.ReviewDue == 0 && (numNewToday >= settings.NewCardsPerDay || stats.NewAvailable == 0) {
 		nowUnix := time.Now().UTC().Unix()
 		// Fetch current streak times
-		url := fmt.Sprintf("%s/rest/v1/users_students?select=streak_start_time,streak_end_time&user_id=eq.%s", supabaseUrl, userId)
-		req, _ := http.NewRequest("GET", url, nil)
-		req.Header.Set("apikey", apiKey)
-		accessCookie, _ := r.Cookie("access_token")
-		req.Header.Set("Authorization", "Bearer "+accessCookie.Value)
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil || resp.StatusCode != 200 {
+		streak, err := storesFor(r).Students.Streak(r.Context(), userId)
+		if err != nil {
 			return errors.New("failed to fetch streak times")
 		}
-		defer resp.Body.Close()
-		var result []struct {
-			StreakStartTime int64 `json:"streak_start_time"`
-			StreakEndTime   int64 `json:"streak_end_time"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || len(result) == 0 {
-			return errors.New("failed to decode streak times")
-		}
 
 		// If streak_end_time is before today, start a new streak
-		ukDay := utils.UnixToUKTime(nowUnix).Format("2006-01-02")
+		ukDay := utils.StudyDay(nowUnix, settings.DayRolloverHour)
 		// Calculate yesterday's UK date string
 		yesterdayUnix := nowUnix - 24*3600
-		yesterdayUKDay := utils.UnixToUKTime(yesterdayUnix).Format("2006-01-02")
-		lastEndDay := utils.UnixToUKTime(result[0].StreakEndTime).Format("2006-01-02")
-		patchUrl := fmt.Sprintf("%s/rest/v1/users_students?user_id=eq.%s", supabaseUrl, userId)
-		body := map[string]interface{}{}
+		yesterdayUKDay := utils.StudyDay(yesterdayUnix, settings.DayRolloverHour)
+		lastEndDay := utils.StudyDay(streak.End, settings.DayRolloverHour)
 
 		// Reset streak if lastEndDay is before yesterday
 		if lastEndDay < yesterdayUKDay {
-			body["streak_start_time"] = nowUnix
+			streak.Start = nowUnix
 		} else if lastEndDay != ukDay {
 			// New streak (lastEndDay is yesterday)
-			body["streak_start_time"] = nowUnix
+			streak.Start = nowUnix
 		}
 		// Always update streak_end_time to now
-		body["streak_end_time"] = nowUnix
-
-		jsonBody, _ := json.Marshal(body)
-		patchReq, _ := http.NewRequest("PATCH", patchUrl, bytes.NewReader(jsonBody))
-		patchReq.Header.Set("apikey", apiKey)
-		patchReq.Header.Set("Authorization", "Bearer "+accessCookie.Value)
-		patchReq.Header.Set("Content-Type", "application/json")
-		patchResp, err := http.DefaultClient.Do(patchReq)
-		if err != nil {
-			return errors.New("failed to update streak times")
-		}
-		defer patchResp.Body.Close()
-		if patchResp.StatusCode != 200 && patchResp.StatusCode != 204 {
-			return errors.New("failed to update streak times")
+		streak.End = nowUnix
+
+		if err := setStreakTimes(r, userId, streak.Start, streak.End); err != nil {
+			return err
 		}
 	}
 
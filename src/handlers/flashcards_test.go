@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/services"
+	"github.com/abstract-tutoring/store"
+)
+
+func TestSubmitAnswerRating(t *testing.T) {
+	backend := newStudyBackend(t)
+
+	w := serve(SubmitAnswer, postAs(ada, "/flashcard/answer", url.Values{
+		"card_id": {"capital"},
+		"rating":  {strconv.Itoa(services.RatingGood)},
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	card := studentCard(t, backend, ada.StudentID, "capital")
+	if card.Status == 0 || card.LastReview == 0 {
+		t.Errorf("answered card = %+v, want it no longer new", card)
+	}
+	// The reversed card is a sibling, so it waits until tomorrow
+	if sibling := studentCard(t, backend, ada.StudentID, "capital#1"); sibling.BuriedUntil <= time.Now().Unix() {
+		t.Errorf("sibling buried until %d, want a time to come", sibling.BuriedUntil)
+	}
+	if other := studentCard(t, backend, bob.StudentID, "capital"); other.Status != 0 {
+		t.Errorf("bob's card = %+v, want it untouched", other)
+	}
+
+	logs := reviewLogs(t, backend, ada.StudentID)
+	if len(logs) != 1 || logs[0].CardID != "capital" || logs[0].Rating != services.RatingGood || len(logs[0].BuriedSiblings) != 1 {
+		t.Errorf("review logs = %+v, want one Good for capital burying its sibling", logs)
+	}
+}
+
+func TestSubmitAnswerOtherStudentsCard(t *testing.T) {
+	backend := newStudyBackend(t)
+
+	w := serve(SubmitAnswer, postAs(bob, "/flashcard/answer", url.Values{
+		"card_id": {"mine"},
+		"rating":  {strconv.Itoa(services.RatingEasy)},
+	}))
+	if w.Code < 400 {
+		t.Errorf("status = %d, want an error", w.Code)
+	}
+	if card := studentCard(t, backend, ada.StudentID, "mine"); card.Status != 0 || card.LastReview != 0 {
+		t.Errorf("ada's card = %+v, want it untouched", card)
+	}
+	if logs := reviewLogs(t, backend, bob.StudentID); len(logs) != 0 {
+		t.Errorf("bob's review logs = %+v, want none", logs)
+	}
+}
+
+func TestSubmitAnswerChoice(t *testing.T) {
+	backend := newStudyBackend(t)
+	stores := backend.For("")
+	ctx := context.Background()
+	err := stores.Cards.Insert(ctx, models.Flashcard{
+		ID:    "quiz",
+		Front: models.Content{Type: models.ContentMultipleChoice, Content: "Capital of Italy"},
+		Back: models.Content{Type: models.ContentMultipleChoice, Content: "Rome",
+			Distractors: []string{"Milan", "Naples"}},
+		CreatedBy: ada.UserID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.StudentCards.Link(ctx, ada.StudentID, []string{"quiz"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A distractor is graded Bad, and the next card shows the answer
+	w := serve(SubmitAnswer, postAs(ada, "/flashcard/answer", url.Values{
+		"card_id": {"quiz"},
+		"choice":  {"Naples"},
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "the answer was: Rome") {
+		t.Errorf("body doesn't give the answer: %s", w.Body)
+	}
+	logs := reviewLogs(t, backend, ada.StudentID)
+	if len(logs) != 1 || logs[0].CardID != "quiz" || logs[0].Rating != services.RatingAgain {
+		t.Errorf("review logs = %+v, want one Bad for quiz", logs)
+	}
+
+	w = serve(SubmitAnswer, postAs(ada, "/flashcard/answer", url.Values{
+		"card_id": {"quiz"},
+		"choice":  {" rome"},
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if logs := reviewLogs(t, backend, ada.StudentID); len(logs) != 2 || logs[1].Rating != services.RatingGood {
+		t.Errorf("review logs = %+v, want the correct option graded Good", logs)
+	}
+
+	// Options the card doesn't have, choices on other cards, and ratings
+	// instead of a pick are refused
+	for _, form := range []url.Values{
+		{"card_id": {"quiz"}, "choice": {"Turin"}},
+		{"card_id": {"quiz"}, "choice": {"0"}},
+		{"card_id": {"quiz"}, "rating": {"4"}},
+		{"card_id": {"mine"}, "choice": {"Rome"}},
+	} {
+		if w := serve(SubmitAnswer, postAs(ada, "/flashcard/answer", form)); w.Code != http.StatusBadRequest {
+			t.Errorf("%v: status = %d, want %d", form, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// The options of a multiple choice card don't say which is correct, and the
+// back and the rating buttons aren't sent until an option is picked.
+func TestMultipleChoiceFront(t *testing.T) {
+	backend := newStudyBackend(t)
+	ctx := context.Background()
+	err := backend.For("").Cards.Insert(ctx, models.Flashcard{
+		ID:    "quiz",
+		Front: models.Content{Type: models.ContentMultipleChoice, Content: "Capital of Italy"},
+		Back: models.Content{Type: models.ContentMultipleChoice, Content: "Rome",
+			Distractors: []string{"Milan", "Naples"}},
+		CreatedBy: ada.UserID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.For("").StudentCards.Link(ctx, ada.StudentID, []string{"quiz"}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	renderFlashcardPartial(w, getAs(ada, "/flashcard/front"), "quiz")
+	body := w.Body
+	for _, option := range []string{"Rome", "Milan", "Naples"} {
+		if !strings.Contains(body.String(), `name="choice" value="`+option+`"`) {
+			t.Errorf("option %s isn't posted as itself", option)
+		}
+	}
+	for _, leak := range []string{`id="back-of-card"`, `"rating"`} {
+		if strings.Contains(body.String(), leak) {
+			t.Errorf("front has %s before an option is picked", leak)
+		}
+	}
+}
+
+// The tag filter picks cards the way the status panel counts them, whatever
+// the case of the filter and the tags.
+func TestTagFilterIgnoresCase(t *testing.T) {
+	backend := newStudyBackend(t)
+	ctx := context.Background()
+	stores := backend.For("")
+	if err := stores.Cards.SetTags(ctx, "sum", []string{"Arithmetic"}); err != nil {
+		t.Fatal(err)
+	}
+	settings := models.DefaultStudentSettings(ada.StudentID)
+	settings.DefaultTagFilter = " ARITHMETIC, algebra"
+	if err := stores.Students.SaveSettings(ctx, settings); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := buildCardData(httptest.NewRecorder(), getAs(ada, "/"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["NoteID"] != "sum" {
+		t.Errorf("picked %v, want sum, the only card tagged arithmetic", data["NoteID"])
+	}
+
+	w := serve(ServeStatusPanel, getAs(ada, "/status"))
+	if panel := strings.Join(strings.Fields(w.Body.String()), " "); !strings.Contains(panel, `text-blue-600 "> 1 </span>`) {
+		t.Errorf("status panel = %s, want one new card", panel)
+	}
+}
+
+// Switching profile keeps each card's place on the new profile's ladder.
+func TestSwitchSchedulingProfile(t *testing.T) {
+	loadOneStepProfile(t)
+	backend := newStudyBackend(t)
+	ctx := context.Background()
+	// On the default profile: the last learning step and the top review level
+	for cardID, status := range map[string]int{"capital": 3, "capital#1": 6} {
+		if err := backend.For("").StudentCards.Update(ctx, ada.StudentID, cardID, map[string]interface{}{"status": status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	switchTo := func(name string) {
+		t.Helper()
+		w := serve(HandleReviewAhead, postAs(ada, "/review-ahead", url.Values{"scheduling_profile": {name}}))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		settings, err := backend.For("").Students.Settings(ctx, ada.StudentID)
+		if err != nil || settings.SchedulingProfile != name {
+			t.Fatalf("profile = %q, %v; want %q", settings.SchedulingProfile, err, name)
+		}
+	}
+	statuses := func() [3]int {
+		return [3]int{
+			studentCard(t, backend, ada.StudentID, "capital").Status,
+			studentCard(t, backend, ada.StudentID, "capital#1").Status,
+			studentCard(t, backend, ada.StudentID, "sum").Status,
+		}
+	}
+
+	switchTo("one-step")
+	if got, want := statuses(), [3]int{1, 3, 0}; got != want {
+		t.Errorf("statuses on one-step = %v, want %v", got, want)
+	}
+	if other := studentCard(t, backend, bob.StudentID, "capital"); other.Status != 0 {
+		t.Errorf("bob's card = %+v, want it untouched", other)
+	}
+
+	// Saving the same profile again changes nothing
+	switchTo("one-step")
+	switchTo(services.DefaultProfileName)
+	if got, want := statuses(), [3]int{1, 5, 0}; got != want {
+		t.Errorf("statuses back on the default = %v, want %v", got, want)
+	}
+}
+
+// Under FSRS there is no profile to pick, and one sent anyway is ignored.
+func TestSchedulingProfileUnderFSRS(t *testing.T) {
+	loadOneStepProfile(t)
+	backend := newStudyBackend(t)
+	ctx := context.Background()
+	if err := backend.For("").StudentCards.Update(ctx, ada.StudentID, "capital", map[string]interface{}{"status": 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	picker := `name="scheduling_profile"`
+	if w := serve(HandleSettingsPage, getAs(ada, "/settings")); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), picker) {
+		t.Fatalf("ladder settings page: status = %d, want the profile picker", w.Code)
+	}
+
+	t.Setenv("SCHEDULER", "fsrs")
+	w := serve(HandleSettingsPage, getAs(ada, "/settings"))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), picker) {
+		t.Errorf("FSRS settings page: status = %d, want no profile picker", w.Code)
+	}
+
+	w = serve(HandleReviewAhead, postAs(ada, "/review-ahead", url.Values{"scheduling_profile": {"one-step"}}))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if settings, _ := backend.For("").Students.Settings(ctx, ada.StudentID); settings.SchedulingProfile != services.DefaultProfileName {
+		t.Errorf("profile = %q, want it unchanged", settings.SchedulingProfile)
+	}
+	if card := studentCard(t, backend, ada.StudentID, "capital"); card.Status != 3 {
+		t.Errorf("card = %+v, want it left relearning", card)
+	}
+}
+
+// loadOneStepProfile adds "one-step", a profile with one learning step and
+// two review levels, unless an earlier test already has.
+func loadOneStepProfile(t *testing.T) {
+	t.Helper()
+	if services.SchedulingProfileExists("one-step") {
+		return
+	}
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	err := os.WriteFile(path, []byte(`[{"name": "one-step", "learning_steps": ["1m"], "graduating_interval": "1d",
+		"easy_interval": "2d", "review_levels": [{"good": "2d", "easy": "4d"}, {"good": "7d", "easy": "14d"}]}]`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := services.LoadSchedulingProfiles(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func reviewLogs(t *testing.T, backend *store.Memory, studentID string) []models.ReviewLog {
+	t.Helper()
+	logs, err := backend.For("").ReviewLogs.Since(context.Background(), studentID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logs
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/store"
+)
+
+func TestMain(m *testing.M) {
+	// Templates are read relative to src, where the server runs
+	if err := os.Chdir(".."); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
+var (
+	ada = Session{UserID: "ada-user", StudentID: "ada", AccessToken: "ada-token"}
+	bob = Session{UserID: "bob-user", StudentID: "bob", AccessToken: "bob-token"}
+)
+
+// newStudyBackend is a memory store where ada and bob both have a reversible
+// note, "capital", and another note, "sum". Only ada has "mine", a note ada
+// wrote.
+func newStudyBackend(t *testing.T) *store.Memory {
+	t.Helper()
+	backend := store.NewMemory()
+	UseStore(backend)
+	backend.AddStudent(ada.UserID, ada.StudentID)
+	backend.AddStudent(bob.UserID, bob.StudentID)
+	backend.AddOfficialCard(models.Flashcard{
+		ID:    "capital",
+		Front: models.Content{Type: models.ContentRichText, Content: "Capital of France"},
+		Back:  models.Content{Type: models.ContentRichText, Content: "Paris"},
+		Ords:  []int{0, models.OrdReversed},
+	}, true)
+	backend.AddOfficialCard(models.Flashcard{
+		ID:    "sum",
+		Front: models.Content{Type: models.ContentRichText, Content: "2 + 2"},
+		Back:  models.Content{Type: models.ContentRichText, Content: "4"},
+	}, true)
+
+	stores := backend.For("")
+	ctx := context.Background()
+	err := stores.Cards.Insert(ctx, models.Flashcard{
+		ID:        "mine",
+		Front:     models.Content{Type: models.ContentRichText, Content: "Ada's question"},
+		Back:      models.Content{Type: models.ContentRichText, Content: "Ada's answer"},
+		CreatedBy: ada.UserID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []struct {
+		studentID string
+		noteIDs   []string
+	}{
+		{ada.StudentID, []string{"capital", "sum", "mine"}},
+		{bob.StudentID, []string{"capital", "sum"}},
+	} {
+		if err := stores.StudentCards.Link(ctx, link.studentID, link.noteIDs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return backend
+}
+
+// postAs is a form POST by the signed-in session, past RequireSession and
+// CSRFProtect. Cookies from earlier responses can be passed on.
+func postAs(session Session, target string, form url.Values, cookies ...*http.Cookie) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	return withSession(r, session)
+}
+
+func getAs(session Session, target string) *http.Request {
+	return withSession(httptest.NewRequest(http.MethodGet, target, nil), session)
+}
+
+func withSession(r *http.Request, session Session) *http.Request {
+	ctx := context.WithValue(r.Context(), sessionKey{}, session)
+	ctx = context.WithValue(ctx, csrfKey{}, "csrf-token")
+	return r.WithContext(ctx)
+}
+
+func serve(handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// studentCard fails the test if the student doesn't have the card.
+func studentCard(t *testing.T, backend *store.Memory, studentID, cardID string) models.StudentCard {
+	t.Helper()
+	card, err := backend.For("").StudentCards.Get(context.Background(), studentID, cardID)
+	if err != nil {
+		t.Fatalf("student %s card %s: %v", studentID, cardID, err)
+	}
+	return card
+}
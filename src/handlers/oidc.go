@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/abstract-tutoring/auth"
+	"github.com/abstract-tutoring/utils"
+)
+
+// oidcProviders are the identity providers offered on the login page, in
+// the order main gives them to UseOIDC.
+var oidcProviders []*auth.OIDC
+
+func UseOIDC(providers ...*auth.OIDC) {
+	oidcProviders = providers
+}
+
+func oidcProvider(id string) *auth.OIDC {
+	for _, p := range oidcProviders {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// oidcStateCookie holds the provider, state, nonce and PKCE verifier between
+// sending the user to the provider and their coming back. All four are
+// URL-safe, so "." separates them.
+const oidcStateCookie = "oidc_state"
+
+// OIDCLoginHandler sends the user to the identity provider named by the
+// provider query parameter.
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider := oidcProvider(r.URL.Query().Get("provider"))
+	if provider == nil {
+		http.Redirect(w, r, "/login?error=Unknown+sign+in+provider", http.StatusSeeOther)
+		return
+	}
+
+	var values [3]string // state, nonce, verifier
+	for i := range values {
+		token, err := auth.RandomToken()
+		if err != nil {
+			log.Printf("OIDCLoginHandler: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		values[i] = token
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("OIDCLoginHandler: %v", err)
+		redirectLoginError(w, r, provider.Name+" sign in is not available right now")
+		return
+	}
+
+	utils.SetCookie(w, r, oidcStateCookie, strings.Join([]string{provider.ID, state, nonce, verifier}, "."), time.Now().Add(10*time.Minute))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler is where the identity provider sends the user back. The
+// ID token's verified email is matched to an existing account with a
+// student; there is no sign up this way.
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, _ := getCookieValue(r, oidcStateCookie)
+	utils.ClearCookie(w, r, oidcStateCookie)
+
+	parts := strings.Split(cookie, ".")
+	if len(parts) != 4 || parts[1] != r.URL.Query().Get("state") {
+		log.Printf("OIDCCallbackHandler: missing or mismatched state")
+		redirectLoginError(w, r, "Sign in expired, please try again")
+		return
+	}
+	provider := oidcProvider(parts[0])
+	if provider == nil {
+		redirectLoginError(w, r, "Unknown sign in provider")
+		return
+	}
+	nonce, verifier := parts[2], parts[3]
+
+	if errCode := r.URL.Query().Get("error"); errCode != "" {
+		log.Printf("OIDCCallbackHandler: %s: %s %s", provider.ID, errCode, r.URL.Query().Get("error_description"))
+		redirectLoginError(w, r, provider.Name+" sign in was cancelled or failed")
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), r.URL.Query().Get("code"), verifier, nonce)
+	if err != nil {
+		log.Printf("OIDCCallbackHandler: %v", err)
+		redirectLoginError(w, r, provider.Name+" sign in failed")
+		return
+	}
+	if !identity.EmailVerified {
+		log.Printf("OIDCCallbackHandler: %s user %s has no verified email", provider.ID, identity.Subject)
+		redirectLoginError(w, r, "Your "+provider.Name+" account has no verified email address")
+		return
+	}
+
+	session, err := authProvider.SignInVerifiedEmail(r.Context(), identity.Email)
+	if errors.Is(err, auth.ErrNoAccount) {
+		log.Printf("OIDCCallbackHandler: no account for %s from %s", utils.MaskEmail(identity.Email), provider.ID)
+		redirectLoginError(w, r, "There is no account for "+identity.Email+". Sign up first, then you can sign in with "+provider.Name+".")
+		return
+	}
+	if err != nil {
+		log.Printf("OIDCCallbackHandler: %v", err)
+		redirectLoginError(w, r, provider.Name+" sign in failed")
+		return
+	}
+
+	// Only accounts that are set up to study are linked
+	stores := dataStore.For(session.AccessToken)
+	studentId, err := stores.Students.StudentID(r.Context(), session.UserID)
+	if err != nil {
+		log.Printf("OIDCCallbackHandler: failed to fetch student ID: %v", err)
+		redirectLoginError(w, r, provider.Name+" sign in failed")
+		return
+	}
+	if studentId == "" {
+		log.Printf("OIDCCallbackHandler: user %s (%s) has no student", session.UserID, utils.MaskEmail(identity.Email))
+		redirectLoginError(w, r, "There is no student account for "+identity.Email)
+		return
+	}
+
+	finishProvisioning(r.Context(), stores, session.UserID)
+
+	log.Printf("OIDCCallbackHandler: %s signed in with %s", utils.MaskEmail(identity.Email), provider.ID)
+	setSessionCookies(w, r, session)
+	setCSRFToken(w, r)
+	utils.SetCookie(w, r, "review_ahead_days", "0", time.Time{})
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func redirectLoginError(w http.ResponseWriter, r *http.Request, msg string) {
+	http.Redirect(w, r, "/login?error="+url.QueryEscape(msg), http.StatusSeeOther)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/abstract-tutoring/auth"
+	"github.com/abstract-tutoring/auth/oidctest"
+	"github.com/abstract-tutoring/store"
+)
+
+const oidcCallbackURL = "http://app.test/auth/oidc/callback"
+
+// verifiedEmailAuth signs in the users it has by email, as Supabase or the
+// local provider would once the email is confirmed.
+type verifiedEmailAuth struct {
+	auth.Provider
+	users map[string]string // email to user ID
+}
+
+func (a verifiedEmailAuth) SignInVerifiedEmail(ctx context.Context, email string) (auth.Session, error) {
+	userID, ok := a.users[email]
+	if !ok {
+		return auth.Session{}, auth.ErrNoAccount
+	}
+	return auth.Session{AccessToken: "access-" + userID, RefreshToken: "refresh-" + userID, UserID: userID}, nil
+}
+
+// startOIDCLogin runs OIDCLoginHandler and follows its redirect to the
+// issuer. It returns the state cookie and the query the issuer sends back.
+func startOIDCLogin(t *testing.T) (cookie *http.Cookie, back url.Values) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	OIDCLoginHandler(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/login?provider=test", nil))
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcStateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatalf("no state cookie; status %d, location %q", w.Code, w.Header().Get("Location"))
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize redirected to %q", resp.Header.Get("Location"))
+	}
+	return cookie, location.Query()
+}
+
+func TestOIDCCallback(t *testing.T) {
+	issuer := oidctest.NewIssuer("client")
+	defer issuer.Close()
+	UseOIDC(auth.NewOIDC(auth.OIDCConfig{ID: "test", Name: "Test", Issuer: issuer.URL, ClientID: "client"}, oidcCallbackURL))
+	defer UseOIDC()
+
+	backend := store.NewMemory()
+	backend.AddStudent("student-user", "S1")
+	UseStore(backend)
+	UseAuth(verifiedEmailAuth{users: map[string]string{
+		"ada@example.com":   "student-user",
+		"tutor@example.com": "tutor-user",
+	}})
+
+	// Each case may change the cookie or the query sent to the callback
+	tests := []struct {
+		name     string
+		email    string
+		verified bool
+		change   func(cookie *http.Cookie, back url.Values)
+		signedIn bool
+	}{
+		{"signs in", "ada@example.com", true, nil, true},
+		{"state mismatch", "ada@example.com", true, func(_ *http.Cookie, back url.Values) {
+			back.Set("state", "other")
+		}, false},
+		{"no state cookie", "ada@example.com", true, func(cookie *http.Cookie, _ url.Values) {
+			cookie.Value = ""
+		}, false},
+		{"nonce mismatch", "ada@example.com", true, func(cookie *http.Cookie, _ url.Values) {
+			parts := strings.Split(cookie.Value, ".")
+			parts[2] = "other"
+			cookie.Value = strings.Join(parts, ".")
+		}, false},
+		{"verifier mismatch", "ada@example.com", true, func(cookie *http.Cookie, _ url.Values) {
+			parts := strings.Split(cookie.Value, ".")
+			parts[3] = "other"
+			cookie.Value = strings.Join(parts, ".")
+		}, false},
+		{"provider error", "ada@example.com", true, func(_ *http.Cookie, back url.Values) {
+			back.Set("error", "access_denied")
+		}, false},
+		{"unverified email", "ada@example.com", false, nil, false},
+		{"no account", "new@example.com", true, nil, false},
+		{"no student", "tutor@example.com", true, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer.Email, issuer.EmailVerified = tt.email, tt.verified
+			cookie, back := startOIDCLogin(t)
+			if tt.change != nil {
+				tt.change(cookie, back)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?"+back.Encode(), nil)
+			if cookie.Value != "" {
+				r.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+			}
+			w := httptest.NewRecorder()
+			OIDCCallbackHandler(w, r)
+
+			location := w.Header().Get("Location")
+			signedIn := false
+			for _, c := range w.Result().Cookies() {
+				signedIn = signedIn || (c.Name == "access_token" && c.Value != "")
+			}
+			if tt.signedIn {
+				if location != "/" || !signedIn {
+					t.Errorf("redirected to %q, signed in %v; want / and signed in", location, signedIn)
+				}
+				return
+			}
+			if !strings.HasPrefix(location, "/login?error=") || signedIn {
+				t.Errorf("redirected to %q, signed in %v; want a login error", location, signedIn)
+			}
+		})
+	}
+}
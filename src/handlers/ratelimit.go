@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abstract-tutoring/ratelimit"
+	"github.com/abstract-tutoring/utils"
+)
+
+// attemptLimits throttles one action by client IP and by email. The IP
+// limits are looser, as a whole school can share one address.
+type attemptLimits struct {
+	byIP    *ratelimit.Limiter
+	byEmail *ratelimit.Limiter
+}
+
+var loginLimits, passwordResetLimits attemptLimits
+
+func init() {
+	UseRateLimitStore(ratelimit.NewMemory())
+}
+
+// UseRateLimitStore keeps the sign in and password reset attempt counts in
+// store, e.g. one shared between servers. The default is in memory.
+func UseRateLimitStore(store ratelimit.Store) {
+	loginLimits = attemptLimits{
+		byIP: ratelimit.New(store, "login:ip:", ratelimit.Policy{
+			Free: 20, BaseDelay: time.Second, MaxDelay: time.Minute,
+			LockoutAfter: 100, Lockout: 15 * time.Minute, Window: time.Hour,
+		}),
+		byEmail: ratelimit.New(store, "login:email:", ratelimit.Policy{
+			Free: 5, BaseDelay: time.Second, MaxDelay: 5 * time.Minute,
+			LockoutAfter: 10, Lockout: 15 * time.Minute, Window: time.Hour,
+		}),
+	}
+	// Every reset request sends an email, so each one counts
+	passwordResetLimits = attemptLimits{
+		byIP: ratelimit.New(store, "reset:ip:", ratelimit.Policy{
+			Free: 10, BaseDelay: 10 * time.Second, MaxDelay: 5 * time.Minute,
+			LockoutAfter: 50, Lockout: time.Hour, Window: time.Hour,
+		}),
+		byEmail: ratelimit.New(store, "reset:email:", ratelimit.Policy{
+			Free: 3, BaseDelay: time.Minute, MaxDelay: 15 * time.Minute,
+			LockoutAfter: 6, Lockout: time.Hour, Window: time.Hour,
+		}),
+	}
+}
+
+// attempt counts an attempt by the client for email and returns 0, or
+// returns how long until they may try again without counting it. If the
+// store fails the attempt is allowed.
+func (l attemptLimits) attempt(ctx context.Context, r *http.Request, email string) time.Duration {
+	now := time.Now()
+	ip, email := utils.ClientIP(r), normaliseEmail(email)
+	wait, err := l.byIP.Attempt(ctx, ip, now)
+	if err != nil {
+		log.Printf("rate limit: %v", err)
+	}
+	if wait > 0 {
+		return wait
+	}
+	wait, err = l.byEmail.Attempt(ctx, email, now)
+	if err != nil {
+		log.Printf("rate limit: %v", err)
+	}
+	if wait > 0 {
+		// Blocked attempts aren't counted against the client either
+		if err := l.byIP.Refund(ctx, ip); err != nil {
+			log.Printf("rate limit: %v", err)
+		}
+	}
+	return wait
+}
+
+// refund takes back an attempt that did not fail, e.g. when the provider
+// could not be reached.
+func (l attemptLimits) refund(ctx context.Context, r *http.Request, email string) {
+	if err := l.byIP.Refund(ctx, utils.ClientIP(r)); err != nil {
+		log.Printf("rate limit: %v", err)
+	}
+	if err := l.byEmail.Refund(ctx, normaliseEmail(email)); err != nil {
+		log.Printf("rate limit: %v", err)
+	}
+}
+
+// reset forgets the attempts for email after a successful one. Only the
+// client's successful attempt is taken back, so one good password does not
+// unlock guessing at others.
+func (l attemptLimits) reset(ctx context.Context, r *http.Request, email string) {
+	if err := l.byIP.Refund(ctx, utils.ClientIP(r)); err != nil {
+		log.Printf("rate limit: %v", err)
+	}
+	if err := l.byEmail.Reset(ctx, normaliseEmail(email)); err != nil {
+		log.Printf("rate limit: %v", err)
+	}
+}
+
+func normaliseEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// tooManyAttempts is the message shown when an attempt is blocked.
+func tooManyAttempts(wait time.Duration) string {
+	if wait < time.Minute {
+		return fmt.Sprintf("Too many attempts. Please try again in %d seconds.", int(math.Ceil(wait.Seconds())))
+	}
+	minutes := int(math.Ceil(wait.Minutes()))
+	if minutes == 1 {
+		return "Too many attempts. Please try again in a minute."
+	}
+	return fmt.Sprintf("Too many attempts. Please try again in %d minutes.", minutes)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/abstract-tutoring/auth"
+	"github.com/abstract-tutoring/store"
+	"github.com/abstract-tutoring/utils"
+)
+
+// refreshMargin is how close to expiry an access token is refreshed, so it
+// does not run out partway through a request.
+const refreshMargin = time.Minute
+
+// Session is the signed-in user, as resolved by RequireSession.
+type Session struct {
+	UserID      string
+	StudentID   string // "" for users with no student, e.g. tutors who don't study
+	AccessToken string
+}
+
+type sessionKey struct{}
+
+// sessionFrom returns the session RequireSession put on the request.
+func sessionFrom(r *http.Request) Session {
+	session, _ := r.Context().Value(sessionKey{}).(Session)
+	return session
+}
+
+// errNoSession means the request has no usable access or refresh token.
+var errNoSession = errors.New("not signed in")
+
+// RequireSession resolves the signed-in user before calling next. An
+// expired access token is refreshed from the refresh_token cookie and the
+// cookies rewritten; if there is no way to sign the user in they are sent to
+// the login page.
+func RequireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := resolveSession(w, r)
+		if err != nil {
+			if !errors.Is(err, errNoSession) {
+				log.Printf("RequireSession: %s %s: %v", r.Method, r.URL.Path, err)
+			}
+			if errors.Is(err, errNoSession) || errors.Is(err, store.ErrUnauthorized) {
+				forceLogout(w, r)
+			} else {
+				http.Error(w, "Could not load session", http.StatusInternalServerError)
+			}
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), sessionKey{}, session)))
+	}
+}
+
+// resolveSession takes the user from the access token, once the auth
+// provider has checked it, and never from a cookie the client could set.
+func resolveSession(w http.ResponseWriter, r *http.Request) (Session, error) {
+	accessToken, _ := getCookieValue(r, "access_token")
+
+	userId := ""
+	if expiry, ok := auth.TokenExpiry(accessToken); ok && time.Until(expiry) >= refreshMargin {
+		id, err := authProvider.User(r.Context(), accessToken)
+		if err != nil && !errors.Is(err, auth.ErrInvalidToken) {
+			return Session{}, fmt.Errorf("failed to check access token: %w", err)
+		}
+		userId = id
+	}
+
+	if userId == "" {
+		refreshToken, err := getCookieValue(r, "refresh_token")
+		if err != nil || refreshToken == "" {
+			return Session{}, errNoSession
+		}
+		refreshed, err := authProvider.Refresh(r.Context(), refreshToken)
+		if errors.Is(err, auth.ErrInvalidRefreshToken) {
+			return Session{}, errNoSession
+		}
+		if err != nil {
+			return Session{}, fmt.Errorf("failed to refresh access token: %w", err)
+		}
+		setSessionCookies(w, r, refreshed)
+		userId, accessToken = refreshed.UserID, refreshed.AccessToken
+	}
+
+	// No mapping gives "" — the sentinel handlers check for
+	studentId, err := dataStore.For(accessToken).Students.StudentID(r.Context(), userId)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to fetch student ID: %w", err)
+	}
+	return Session{UserID: userId, StudentID: studentId, AccessToken: accessToken}, nil
+}
+
+// setSessionCookies keeps a signed-in session in cookies. The user ID is
+// not kept: it is read from the access token each time.
+func setSessionCookies(w http.ResponseWriter, r *http.Request, session auth.Session) {
+	utils.SetCookie(w, r, "access_token", session.AccessToken, time.Now().Add(15*time.Minute))
+	utils.SetCookie(w, r, "refresh_token", session.RefreshToken, time.Now().Add(30*24*time.Hour))
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abstract-tutoring/auth"
+)
+
+var sessionTestSecret = []byte("session-test-secret")
+
+// tokenAuth accepts access tokens signed with sessionTestSecret and swaps
+// refresh tokens of the form "refresh-<user ID>".
+type tokenAuth struct {
+	auth.Provider
+}
+
+func (tokenAuth) User(ctx context.Context, accessToken string) (string, error) {
+	return auth.ParseAccessToken(sessionTestSecret, accessToken, time.Now())
+}
+
+func (tokenAuth) Refresh(ctx context.Context, refreshToken string) (auth.Session, error) {
+	userID, ok := strings.CutPrefix(refreshToken, "refresh-")
+	if !ok {
+		return auth.Session{}, auth.ErrInvalidRefreshToken
+	}
+	accessToken, err := auth.SignAccessToken(sessionTestSecret, userID, time.Now(), time.Hour)
+	return auth.Session{AccessToken: accessToken, RefreshToken: "refresh-" + userID, UserID: userID}, err
+}
+
+func TestRequireSession(t *testing.T) {
+	newStudyBackend(t)
+	UseAuth(tokenAuth{})
+	defer UseAuth(nil)
+
+	token := func(secret []byte, userID string) string {
+		t.Helper()
+		token, err := auth.SignAccessToken(secret, userID, time.Now(), time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name    string
+		cookies map[string]string
+		want    string // user ID, "" for sent to log in
+	}{
+		{"access token", map[string]string{"access_token": token(sessionTestSecret, ada.UserID)}, ada.UserID},
+		{
+			"user_id cookie is ignored",
+			map[string]string{"access_token": token(sessionTestSecret, ada.UserID), "user_id": bob.UserID},
+			ada.UserID,
+		},
+		{
+			"forged access token is refreshed",
+			map[string]string{"access_token": token([]byte("forged"), bob.UserID), "refresh_token": "refresh-" + ada.UserID},
+			ada.UserID,
+		},
+		{"forged access token", map[string]string{"access_token": token([]byte("forged"), bob.UserID)}, ""},
+		{"only a user_id cookie", map[string]string{"user_id": ada.UserID}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, value := range tt.cookies {
+				r.AddCookie(&http.Cookie{Name: name, Value: value})
+			}
+			var got Session
+			w := serve(RequireSession(func(w http.ResponseWriter, r *http.Request) {
+				got = sessionFrom(r)
+			}), r)
+
+			if tt.want == "" {
+				if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login" {
+					t.Errorf("status = %d, location %q; want sent to log in", w.Code, w.Header().Get("Location"))
+				}
+				return
+			}
+			if got.UserID != tt.want || got.StudentID != ada.StudentID {
+				t.Errorf("session = %+v, want user %s, student %s", got, tt.want, ada.StudentID)
+			}
+		})
+	}
+}
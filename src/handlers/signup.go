@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/abstract-tutoring/auth"
+	"github.com/abstract-tutoring/store"
+	"github.com/abstract-tutoring/utils"
+)
+
+// studentIDAlphabet leaves out characters that are easy to misread, as
+// tutors type student IDs in to add them to classes.
+const studentIDAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+const studentIDLength = 8
+
+type signupData struct {
+	Email   string
+	Error   string
+	Code    int
+	Message string
+}
+
+func renderSignup(w http.ResponseWriter, r *http.Request, data signupData) {
+	tmpl, err := parseTemplates(r, "./frontend/templates/signup.html", "./frontend/templates/partials/backend-error.html")
+	if err != nil {
+		log.Printf("renderSignup: Template parse error: %v", err)
+		http.Error(w, "Template error", http.StatusInternalServerError)
+		return
+	}
+	tmpl.Execute(w, data)
+}
+
+func SignupPage(w http.ResponseWriter, r *http.Request) {
+	renderSignup(w, r, signupData{})
+}
+
+func SignupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/signup", http.StatusSeeOther)
+		return
+	}
+
+	email := r.FormValue("email")
+	password := r.FormValue("password")
+	if email == "" || password == "" {
+		renderSignup(w, r, signupData{Email: email, Error: "Email and password required"})
+		return
+	}
+	if password != r.FormValue("confirm_password") {
+		renderSignup(w, r, signupData{Email: email, Error: "Passwords do not match"})
+		return
+	}
+
+	log.Printf("SignupHandler: Sign up for email: %s", utils.MaskEmail(email))
+
+	if err := authProvider.SignUp(r.Context(), email, password); err != nil {
+		log.Printf("SignupHandler: %v", err)
+
+		data := signupData{Email: email, Error: "Failed to sign up"}
+		var authErr *auth.Error
+		if errors.As(err, &authErr) && authErr.Message != "" {
+			data.Error, data.Code = authErr.Message, authErr.Code
+		}
+		renderSignup(w, r, data)
+		return
+	}
+
+	renderSignup(w, r, signupData{Message: "Check your email for a link to confirm your account."})
+}
+
+// provisionStudent gives a user who has just confirmed their email a student
+// with a generated ID and the default official cards. A user who already has
+// a student only gets the default cards, if they don't have them yet.
+func provisionStudent(ctx context.Context, stores store.Stores, userID string) (string, error) {
+	studentId, err := stores.Students.StudentID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if studentId == "" {
+		// A clash is unlikely, so a few tries is plenty
+		for attempt := 0; attempt < 5; attempt++ {
+			if studentId, err = newStudentID(); err != nil {
+				return "", err
+			}
+			if err = stores.Students.Create(ctx, userID, studentId); !errors.Is(err, store.ErrStudentIDTaken) {
+				break
+			}
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to create student: %w", err)
+		}
+		log.Printf("provisionStudent: created student %s for user %s", studentId, userID)
+	}
+
+	if err := linkDefaultCards(ctx, stores, userID, studentId); err != nil {
+		return "", err
+	}
+	return studentId, nil
+}
+
+// linkDefaultCards gives the user's student the default official cards
+// unless it has been given them already. Linking keeps the progress on cards
+// the student has, so it can be retried after a failure.
+func linkDefaultCards(ctx context.Context, stores store.Stores, userID, studentId string) error {
+	linked, err := stores.Students.DefaultCardsLinked(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check default cards: %w", err)
+	}
+	if linked {
+		return nil
+	}
+
+	cardIDs, err := stores.Cards.DefaultIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch default cards: %w", err)
+	}
+	if len(cardIDs) > 0 {
+		if err := stores.StudentCards.Link(ctx, studentId, cardIDs); err != nil {
+			return fmt.Errorf("failed to assign default cards: %w", err)
+		}
+	}
+	if err := stores.Students.SetDefaultCardsLinked(ctx, userID); err != nil {
+		return fmt.Errorf("failed to mark default cards assigned: %w", err)
+	}
+
+	log.Printf("linkDefaultCards: gave student %s %d default cards", studentId, len(cardIDs))
+	return nil
+}
+
+// finishProvisioning retries linking the default cards when a user with a
+// student signs in, in case it failed when they signed up. Users with no
+// student, such as tutors who don't study, are left as they are.
+func finishProvisioning(ctx context.Context, stores store.Stores, userID string) {
+	studentId, err := stores.Students.StudentID(ctx, userID)
+	if err == nil && studentId != "" {
+		err = linkDefaultCards(ctx, stores, userID, studentId)
+	}
+	if err != nil {
+		log.Printf("finishProvisioning: user %s: %v", userID, err)
+	}
+}
+
+func newStudentID() (string, error) {
+	b := make([]byte, studentIDLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = studentIDAlphabet[int(b[i])%len(studentIDAlphabet)]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/services"
+	"github.com/abstract-tutoring/store"
+)
+
+const (
+	defaultForecastDays = 30
+	maxForecastDays     = 365
+	heatmapDays         = 26 * 7
+	retentionDays       = 14
+)
+
+// heatmapColors shades HeatmapDay.Level from no answers to the busiest days.
+var heatmapColors = [5]string{"#e5e7eb", "#bbf7d0", "#4ade80", "#16a34a", "#14532d"}
+
+type heatmapCell struct {
+	services.HeatmapDay
+	Color string
+}
+
+type statusRow struct {
+	services.StatusCount
+	Width int // percent of the largest status
+}
+
+type forecastRow struct {
+	services.ForecastDay
+	Label         string
+	ReviewWidth   int // percent of the busiest day
+	LearningWidth int
+}
+
+func ServeStatsPage(w http.ResponseWriter, r *http.Request) {
+	in, ok := loadStatsInputs(w, r)
+	if !ok {
+		return
+	}
+	now := time.Now().Unix()
+	rollover := in.settings.DayRolloverHour
+
+	forecast := services.Forecast(in.cards, now, defaultForecastDays, rollover, in.profile)
+	busiest := 0
+	for _, day := range forecast {
+		busiest = max(busiest, day.Total())
+	}
+	rows := make([]forecastRow, 0, len(forecast))
+	for i, day := range forecast {
+		row := forecastRow{ForecastDay: day, Label: day.Date}
+		if i == 0 {
+			row.Label = "Today"
+		} else if t, err := time.Parse("2006-01-02", day.Date); err == nil {
+			row.Label = t.Format("Mon 2 Jan")
+		}
+		if busiest > 0 {
+			row.ReviewWidth = day.Review * 100 / busiest
+			row.LearningWidth = day.Learning * 100 / busiest
+		}
+		rows = append(rows, row)
+	}
+
+	// History comes from the recorded answers
+	since := now - int64(heatmapDays+1)*86400
+	logs, err := in.stores.ReviewLogs.Since(r.Context(), in.studentId, since)
+	if err != nil {
+		log.Println("Stats: failed to load review logs:", err)
+		logs = nil
+	}
+
+	heatmap := services.ReviewHeatmap(logs, now, heatmapDays, rollover)
+	heatmapWeeks := make([][]heatmapCell, 0, len(heatmap))
+	totalAnswers := 0
+	for _, week := range heatmap {
+		cells := make([]heatmapCell, 0, len(week))
+		for _, day := range week {
+			cells = append(cells, heatmapCell{HeatmapDay: day, Color: heatmapColors[day.Level]})
+			totalAnswers += day.Count
+		}
+		heatmapWeeks = append(heatmapWeeks, cells)
+	}
+
+	distribution := services.StatusDistribution(in.cards, in.profile)
+	largest := 0
+	for _, c := range distribution {
+		largest = max(largest, c.Count)
+	}
+	statusRows := make([]statusRow, 0, len(distribution))
+	for _, c := range distribution {
+		row := statusRow{StatusCount: c}
+		if largest > 0 {
+			row.Width = c.Count * 100 / largest
+		}
+		statusRows = append(statusRows, row)
+	}
+
+	var mastery []services.TagMastery
+	if allCards, err := in.stores.Cards.All(r.Context()); err == nil {
+		mastery = services.TagMasteryStats(in.cards, allCards, in.profile)
+	} else {
+		log.Println("Stats: failed to load cards:", err)
+	}
+
+	tmpl, err := parseTemplates(r,
+		"./frontend/templates/base.html",
+		"./frontend/templates/stats.html",
+	)
+	if err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"ForecastDays":    len(forecast),
+		"Forecast":        rows,
+		"HeatmapWeeks":    heatmapWeeks,
+		"HeatmapTotal":    totalAnswers,
+		"RetentionDays":   retentionDays,
+		"RetentionByDay":  services.RetentionByDay(logs, now, retentionDays, rollover, in.profile),
+		"RetentionByBand": services.RetentionByBand(logs, in.profile),
+		"StatusCounts":    statusRows,
+		"TagMastery":      mastery,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
+		http.Error(w, "Execution error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ServeForecastJSON returns the forecast as JSON. ?days= sets how far ahead
+// to look (default 30, at most 365).
+func ServeForecastJSON(w http.ResponseWriter, r *http.Request) {
+	days := defaultForecastDays
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		n, err := strconv.Atoi(daysStr)
+		if err != nil || n < 1 || n > maxForecastDays {
+			http.Error(w, "days must be between 1 and 365", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	in, ok := loadStatsInputs(w, r)
+	if !ok {
+		return
+	}
+	forecast := services.Forecast(in.cards, time.Now().Unix(), days, in.settings.DayRolloverHour, in.profile)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"days":     len(forecast),
+		"forecast": forecast,
+	})
+}
+
+type statsInputs struct {
+	stores    store.Stores
+	studentId string
+	cards     []models.StudentCard
+	settings  models.StudentSettings
+	profile   *services.SchedulingProfile
+}
+
+// loadStatsInputs loads what every stats view needs for the logged-in
+// student. It writes the error response itself when ok is false.
+func loadStatsInputs(w http.ResponseWriter, r *http.Request) (statsInputs, bool) {
+	studentId := sessionFrom(r).StudentID
+	if studentId == "" {
+		http.Error(w, "Error fetching student ID", http.StatusInternalServerError)
+		return statsInputs{}, false
+	}
+
+	cards, err := fetchStudentCards(r, studentId)
+	if err != nil {
+		http.Error(w, "Could not load student cards", http.StatusInternalServerError)
+		return statsInputs{}, false
+	}
+
+	settings := loadStudentSettings(r, studentId)
+
+	return statsInputs{
+		stores:    storesFor(r),
+		studentId: studentId,
+		cards:     cards,
+		settings:  settings,
+		profile:   studentScheduler(settings).Profile(),
+	}, true
+}
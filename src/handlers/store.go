@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/abstract-tutoring/store"
+)
+
+// dataStore is where the handlers read and write everything. main sets it
+// with UseStore before serving.
+var dataStore store.Backend
+
+func UseStore(b store.Backend) {
+	dataStore = b
+}
+
+// storesFor opens the stores with the caller's access token.
+func storesFor(r *http.Request) store.Stores {
+	return dataStore.For(sessionFrom(r).AccessToken)
+}
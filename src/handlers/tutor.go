@@ -0,0 +1,527 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/services"
+	"github.com/abstract-tutoring/store"
+	"github.com/abstract-tutoring/utils"
+)
+
+// progressDays is how far back the class page looks at each student's answers.
+const progressDays = 7
+
+type progressRow struct {
+	services.StudentProgress
+	LastReviewedLabel string
+}
+
+func ServeTutorPage(w http.ResponseWriter, r *http.Request) {
+	stores, tutor, ok := tutorContext(w, r)
+	if !ok {
+		return
+	}
+
+	classes, err := stores.Classes.Classes(r.Context(), tutor.UserID)
+	if err != nil {
+		log.Println("Tutor: failed to load classes:", err)
+		http.Error(w, "Could not load classes", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := parseTemplates(r,
+		"./frontend/templates/base.html",
+		"./frontend/templates/tutor.html",
+	)
+	if err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Tutor":   tutor,
+		"Classes": classes,
+		"Error":   r.URL.Query().Get("error"),
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
+		http.Error(w, "Execution error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func ServeClassPage(w http.ResponseWriter, r *http.Request) {
+	stores, tutor, ok := tutorContext(w, r)
+	if !ok {
+		return
+	}
+	class, ok := tutorClass(w, r, stores, tutor, r.URL.Query().Get("id"))
+	if !ok {
+		return
+	}
+
+	members, err := stores.Classes.Members(r.Context(), class.ID)
+	if err != nil {
+		log.Println("Tutor: failed to load class members:", err)
+		http.Error(w, "Could not load class members", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().Unix()
+	since := now - progressDays*86400
+
+	// Tutors can read their students' rows through RLS, once the students
+	// have accepted
+	rows := make([]progressRow, 0, len(members))
+	var invited []string
+	for _, m := range members {
+		if m.AcceptedAt == 0 {
+			invited = append(invited, m.StudentID)
+			continue
+		}
+		cards, err := fetchStudentCards(r, m.StudentID)
+		if err != nil {
+			log.Println("Tutor: failed to load cards for", m.StudentID, err)
+			cards = nil
+		}
+		logs, err := stores.ReviewLogs.Since(r.Context(), m.StudentID, since)
+		if err != nil {
+			log.Println("Tutor: failed to load review logs for", m.StudentID, err)
+			logs = nil
+		}
+		settings := loadStudentSettings(r, m.StudentID)
+
+		row := progressRow{
+			StudentProgress: services.SummariseProgress(m.StudentID, cards, logs, now, studentScheduler(settings).Profile()),
+		}
+		if row.LastReviewed > 0 {
+			row.LastReviewedLabel = utils.UnixToUKTime(row.LastReviewed).Format("Mon 2 Jan 15:04")
+		}
+		rows = append(rows, row)
+	}
+
+	studentIDs := make([]string, 0, len(members))
+	for _, m := range members {
+		studentIDs = append(studentIDs, m.StudentID)
+	}
+	assignments, err := stores.Classes.ClassAssignments(r.Context(), class.ID, studentIDs)
+	if err != nil {
+		log.Println("Tutor: failed to load assignments:", err)
+		assignments = nil
+	}
+
+	tmpl, err := parseTemplates(r,
+		"./frontend/templates/base.html",
+		"./frontend/templates/tutor-class.html",
+	)
+	if err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Class":        class,
+		"Students":     rows,
+		"Invited":      invited,
+		"ProgressDays": progressDays,
+		"Assignments":  assignments,
+		"Today":        utils.UnixToUKTime(now).Format("2006-01-02"),
+		"Error":        r.URL.Query().Get("error"),
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
+		http.Error(w, "Execution error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func CreateClassHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stores, tutor, ok := tutorContext(w, r)
+	if !ok {
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		http.Redirect(w, r, "/tutor?error="+url.QueryEscape("Class name is required"), http.StatusSeeOther)
+		return
+	}
+
+	class, err := stores.Classes.CreateClass(r.Context(), tutor.UserID, name)
+	if err != nil {
+		log.Println("Tutor:", err)
+		http.Redirect(w, r, "/tutor?error="+url.QueryEscape("Failed to create class"), http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/tutor/class?id="+url.QueryEscape(class.ID), http.StatusSeeOther)
+}
+
+func DeleteClassHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stores, tutor, ok := tutorContext(w, r)
+	if !ok {
+		return
+	}
+	class, ok := tutorClass(w, r, stores, tutor, r.FormValue("class_id"))
+	if !ok {
+		return
+	}
+
+	if err := stores.Classes.DeleteClass(r.Context(), class.ID); err != nil {
+		log.Println("Tutor: failed to delete class:", err)
+		http.Redirect(w, r, "/tutor?error="+url.QueryEscape("Failed to delete class"), http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/tutor", http.StatusSeeOther)
+}
+
+func AddClassMemberHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stores, tutor, ok := tutorContext(w, r)
+	if !ok {
+		return
+	}
+	class, ok := tutorClass(w, r, stores, tutor, r.FormValue("class_id"))
+	if !ok {
+		return
+	}
+
+	classID := class.ID
+	classPage := "/tutor/class?id=" + url.QueryEscape(classID)
+	studentID := strings.TrimSpace(r.FormValue("student_id"))
+	if studentID == "" {
+		http.Redirect(w, r, classPage+"&error="+url.QueryEscape("Student ID is required"), http.StatusSeeOther)
+		return
+	}
+
+	if err := stores.Classes.AddMember(r.Context(), classID, studentID); err != nil {
+		msg := "Failed to add student"
+		if errors.Is(err, store.ErrStudentNotFound) {
+			msg = "No student with ID " + studentID
+		} else {
+			log.Println("Tutor: failed to add class member:", err)
+		}
+		http.Redirect(w, r, classPage+"&error="+url.QueryEscape(msg), http.StatusSeeOther)
+		return
+	}
+
+	// The student is only invited; they get the class's decks when they
+	// accept on their settings page
+	http.Redirect(w, r, classPage, http.StatusSeeOther)
+}
+
+func RemoveClassMemberHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stores, tutor, ok := tutorContext(w, r)
+	if !ok {
+		return
+	}
+	class, ok := tutorClass(w, r, stores, tutor, r.FormValue("class_id"))
+	if !ok {
+		return
+	}
+
+	classID := class.ID
+	classPage := "/tutor/class?id=" + url.QueryEscape(classID)
+	if err := stores.Classes.RemoveMember(r.Context(), classID, r.FormValue("student_id")); err != nil {
+		log.Println("Tutor: failed to remove class member:", err)
+		http.Redirect(w, r, classPage+"&error="+url.QueryEscape("Failed to remove student"), http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, classPage, http.StatusSeeOther)
+}
+
+// AcceptClassHandler is the signed-in student accepting a tutor's invitation
+// to a class. From then on the tutor can see their progress, and they get
+// the decks assigned to the class.
+func AcceptClassHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stores := storesFor(r)
+	studentID := sessionFrom(r).StudentID
+	classID := r.FormValue("class_id")
+
+	if err := stores.Classes.AcceptMember(r.Context(), classID, studentID, time.Now().Unix()); err != nil {
+		msg := "Failed to join class"
+		if errors.Is(err, store.ErrNotFound) {
+			msg = "No invitation to that class"
+		} else {
+			log.Println("Classes: failed to accept invitation:", err)
+		}
+		http.Redirect(w, r, "/settings?error="+url.QueryEscape(msg), http.StatusSeeOther)
+		return
+	}
+
+	assignments, err := stores.Classes.StudentAssignments(r.Context(), studentID)
+	if err != nil {
+		log.Println("Classes: failed to load class assignments:", err)
+	}
+	for _, a := range assignments {
+		if a.ClassID != classID {
+			continue
+		}
+		if err := stores.StudentCards.Link(r.Context(), studentID, a.CardIDs); err != nil {
+			log.Println("Classes: failed to assign class deck to new member:", err)
+		}
+	}
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+// LeaveClassHandler is the signed-in student declining an invitation or
+// leaving a class. They keep their cards and progress.
+func LeaveClassHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := storesFor(r).Classes.RemoveMember(r.Context(), r.FormValue("class_id"), sessionFrom(r).StudentID)
+	if err != nil {
+		log.Println("Classes: failed to leave class:", err)
+		http.Redirect(w, r, "/settings?error="+url.QueryEscape("Failed to leave class"), http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+// AssignDeckHandler assigns a deck, chosen by tags and/or card IDs, to the
+// whole class (target "class") or to one of its students, with an optional
+// learn-by date.
+func AssignDeckHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stores, tutor, ok := tutorContext(w, r)
+	if !ok {
+		return
+	}
+	class, ok := tutorClass(w, r, stores, tutor, r.FormValue("class_id"))
+	if !ok {
+		return
+	}
+
+	classID := class.ID
+	classPage := "/tutor/class?id=" + url.QueryEscape(classID)
+	fail := func(msg string) {
+		http.Redirect(w, r, classPage+"&error="+url.QueryEscape(msg), http.StatusSeeOther)
+	}
+
+	members, err := stores.Classes.Members(r.Context(), classID)
+	if err != nil {
+		log.Println("Tutor: failed to load class members:", err)
+		fail("Failed to load class")
+		return
+	}
+
+	assignment := models.Assignment{
+		TutorID: tutor.UserID,
+		Title:   strings.TrimSpace(r.FormValue("title")),
+		Tags:    splitTags(r.FormValue("tags")),
+		CardIDs: strings.FieldsFunc(r.FormValue("card_ids"), isListSeparator),
+		LearnBy: r.FormValue("learn_by"),
+	}
+	if assignment.Title == "" {
+		fail("Title is required")
+		return
+	}
+	if assignment.LearnBy != "" {
+		if _, err := time.Parse("2006-01-02", assignment.LearnBy); err != nil {
+			fail("Invalid learn-by date")
+			return
+		}
+	}
+
+	// Students yet to accept get the class's decks when they do
+	var studentIDs []string
+	if target := r.FormValue("target"); target == "class" {
+		assignment.ClassID = classID
+		for _, m := range members {
+			if m.AcceptedAt != 0 {
+				studentIDs = append(studentIDs, m.StudentID)
+			}
+		}
+	} else {
+		for _, m := range members {
+			if m.StudentID == target && m.AcceptedAt != 0 {
+				studentIDs = []string{target}
+			}
+		}
+		if len(studentIDs) == 0 {
+			fail("Student is not in this class")
+			return
+		}
+		assignment.StudentID = target
+	}
+
+	allCards, err := stores.Cards.All(r.Context())
+	if err != nil {
+		log.Println("Tutor: failed to load cards:", err)
+		fail("Failed to load cards")
+		return
+	}
+	cardIDs, err := services.ResolveAssignmentCards(allCards, assignment.Tags, assignment.CardIDs)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if len(cardIDs) == 0 {
+		fail("No cards match that deck")
+		return
+	}
+	assignment.CardIDs = cardIDs
+
+	if _, err := stores.Classes.CreateAssignment(r.Context(), assignment); err != nil {
+		log.Println("Tutor:", err)
+		fail("Failed to assign deck")
+		return
+	}
+	for _, studentID := range studentIDs {
+		if err := stores.StudentCards.Link(r.Context(), studentID, cardIDs); err != nil {
+			log.Println("Tutor:", err)
+			fail("Deck saved but some cards could not be assigned")
+			return
+		}
+	}
+
+	http.Redirect(w, r, classPage, http.StatusSeeOther)
+}
+
+// DeleteAssignmentHandler removes the assignment. Students keep the cards
+// and their progress; only the deadline goes.
+func DeleteAssignmentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stores, tutor, ok := tutorContext(w, r)
+	if !ok {
+		return
+	}
+	class, ok := tutorClass(w, r, stores, tutor, r.FormValue("class_id"))
+	if !ok {
+		return
+	}
+
+	classPage := "/tutor/class?id=" + url.QueryEscape(class.ID)
+	fail := func(msg string) {
+		http.Redirect(w, r, classPage+"&error="+url.QueryEscape(msg), http.StatusSeeOther)
+	}
+
+	// Only the class's own assignments, and those of its students, can go
+	members, err := stores.Classes.Members(r.Context(), class.ID)
+	if err != nil {
+		log.Println("Tutor: failed to load class members:", err)
+		fail("Failed to load class")
+		return
+	}
+	studentIDs := make([]string, 0, len(members))
+	for _, m := range members {
+		studentIDs = append(studentIDs, m.StudentID)
+	}
+	assignments, err := stores.Classes.ClassAssignments(r.Context(), class.ID, studentIDs)
+	if err != nil {
+		log.Println("Tutor: failed to load assignments:", err)
+		fail("Failed to load assignments")
+		return
+	}
+	assignmentID := r.FormValue("assignment_id")
+	found := false
+	for _, a := range assignments {
+		if a.ID == assignmentID && a.TutorID == tutor.UserID {
+			found = true
+		}
+	}
+	if !found {
+		fail("Assignment not found")
+		return
+	}
+
+	if err := stores.Classes.DeleteAssignment(r.Context(), assignmentID); err != nil {
+		log.Println("Tutor: failed to delete assignment:", err)
+		fail("Failed to delete assignment")
+		return
+	}
+
+	http.Redirect(w, r, classPage, http.StatusSeeOther)
+}
+
+// splitTags splits a comma separated list; tag names can contain spaces.
+func splitTags(value string) []string {
+	var tags []string
+	for _, t := range strings.Split(value, ",") {
+		if trimmed := strings.TrimSpace(t); trimmed != "" {
+			tags = append(tags, trimmed)
+		}
+	}
+	return tags
+}
+
+func isListSeparator(r rune) bool {
+	return r == ',' || unicode.IsSpace(r)
+}
+
+// tutorContext resolves the logged-in tutor. It writes the response itself
+// (500 or 403) when ok is false.
+func tutorContext(w http.ResponseWriter, r *http.Request) (stores store.Stores, tutor models.Tutor, ok bool) {
+	stores = storesFor(r)
+	tutor, isTutor, err := stores.Classes.Tutor(r.Context(), sessionFrom(r).UserID)
+	if err != nil {
+		log.Println("Tutor: failed to check tutor role:", err)
+		http.Error(w, "Could not check tutor role", http.StatusInternalServerError)
+		return store.Stores{}, models.Tutor{}, false
+	}
+	if !isTutor {
+		http.Error(w, "Tutors only", http.StatusForbidden)
+		return store.Stores{}, models.Tutor{}, false
+	}
+
+	return stores, tutor, true
+}
+
+// tutorClass loads one of the tutor's classes. Other tutors' classes are not
+// found, as under RLS, whichever backend is in use. It writes the response
+// itself when ok is false.
+func tutorClass(w http.ResponseWriter, r *http.Request, stores store.Stores, tutor models.Tutor, classID string) (class models.Class, ok bool) {
+	class, err := stores.Classes.Class(r.Context(), classID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Println("Tutor: failed to load class:", err)
+	}
+	if err != nil || class.TutorID != tutor.UserID {
+		http.Error(w, "Class not found", http.StatusNotFound)
+		return models.Class{}, false
+	}
+
+	return class, true
+}
+
+// isTutor is for showing the tutor link; errors count as not a tutor.
+func isTutor(r *http.Request) bool {
+	_, ok, _ := storesFor(r).Classes.Tutor(r.Context(), sessionFrom(r).UserID)
+	return ok
+}
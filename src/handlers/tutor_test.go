@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/store"
+)
+
+var (
+	tess = Session{UserID: "tess-user", AccessToken: "tess-token"}
+	tom  = Session{UserID: "tom-user", AccessToken: "tom-token"}
+	cy   = Session{UserID: "cy-user", StudentID: "cy", AccessToken: "cy-token"}
+)
+
+// classBackend adds two tutors to the study backend. Tess teaches ada in
+// one class and tom teaches bob in another, both of whom have accepted;
+// tess's class has been assigned "extra", a note nobody has studied yet. Cy
+// is a student in no class.
+type classBackend struct {
+	*store.Memory
+	tessClass, tomClass models.Class
+	assignment          models.Assignment
+}
+
+func newClassBackend(t *testing.T) classBackend {
+	t.Helper()
+	b := classBackend{Memory: newStudyBackend(t)}
+	b.AddTutor(models.Tutor{UserID: tess.UserID, DisplayName: "Tess"})
+	b.AddTutor(models.Tutor{UserID: tom.UserID, DisplayName: "Tom"})
+	b.AddStudent("cy-user", "cy")
+	b.AddOfficialCard(models.Flashcard{
+		ID:    "extra",
+		Front: models.Content{Type: models.ContentRichText, Content: "Extra question"},
+		Back:  models.Content{Type: models.ContentRichText, Content: "Extra answer"},
+	}, false)
+
+	ctx := context.Background()
+	classes := b.For("").Classes
+	var err error
+	if b.tessClass, err = classes.CreateClass(ctx, tess.UserID, "Tess's class"); err != nil {
+		t.Fatal(err)
+	}
+	if b.tomClass, err = classes.CreateClass(ctx, tom.UserID, "Tom's class"); err != nil {
+		t.Fatal(err)
+	}
+	if err := classes.AddMember(ctx, b.tessClass.ID, ada.StudentID); err != nil {
+		t.Fatal(err)
+	}
+	if err := classes.AddMember(ctx, b.tomClass.ID, bob.StudentID); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []models.ClassMember{{ClassID: b.tessClass.ID, StudentID: ada.StudentID}, {ClassID: b.tomClass.ID, StudentID: bob.StudentID}} {
+		if err := classes.AcceptMember(ctx, m.ClassID, m.StudentID, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.assignment, err = classes.CreateAssignment(ctx, models.Assignment{
+		TutorID: tess.UserID, ClassID: b.tessClass.ID, Title: "Extra", CardIDs: []string{"extra"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func (b classBackend) members(t *testing.T, classID string) []string {
+	t.Helper()
+	members, err := b.For("").Classes.Members(context.Background(), classID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, m := range members {
+		ids = append(ids, m.StudentID)
+	}
+	return ids
+}
+
+func (b classBackend) assignments(t *testing.T, classID string, studentIDs ...string) []models.Assignment {
+	t.Helper()
+	assignments, err := b.For("").Classes.ClassAssignments(context.Background(), classID, studentIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return assignments
+}
+
+func (b classBackend) hasCard(studentID, cardID string) bool {
+	_, err := b.For("").StudentCards.Get(context.Background(), studentID, cardID)
+	return err == nil
+}
+
+func TestTutorPagesAreForTutors(t *testing.T) {
+	b := newClassBackend(t)
+
+	for _, tt := range []struct {
+		name    string
+		handler http.HandlerFunc
+		r       *http.Request
+	}{
+		{"tutor page", ServeTutorPage, getAs(ada, "/tutor")},
+		{"class page", ServeClassPage, getAs(ada, "/tutor/class?id="+b.tessClass.ID)},
+		{"create class", CreateClassHandler, postAs(ada, "/tutor/create-class", url.Values{"name": {"Mine"}})},
+		{"add member", AddClassMemberHandler, postAs(ada, "/tutor/add-member", url.Values{"class_id": {b.tessClass.ID}, "student_id": {"ada"}})},
+	} {
+		if w := serve(tt.handler, tt.r); w.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, http.StatusForbidden)
+		}
+	}
+
+	if w := serve(ServeClassPage, getAs(tess, "/tutor/class?id="+b.tessClass.ID)); w.Code != http.StatusOK {
+		t.Errorf("tess's class page: status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+}
+
+// Tom can't see or change tess's class, whichever backend is in use.
+func TestOtherTutorsClass(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		r       func(b classBackend) *http.Request
+	}{
+		{"view", ServeClassPage, func(b classBackend) *http.Request {
+			return getAs(tom, "/tutor/class?id="+b.tessClass.ID)
+		}},
+		{"delete", DeleteClassHandler, func(b classBackend) *http.Request {
+			return postAs(tom, "/tutor/delete-class", url.Values{"class_id": {b.tessClass.ID}})
+		}},
+		{"add member", AddClassMemberHandler, func(b classBackend) *http.Request {
+			return postAs(tom, "/tutor/add-member", url.Values{"class_id": {b.tessClass.ID}, "student_id": {"cy"}})
+		}},
+		{"remove member", RemoveClassMemberHandler, func(b classBackend) *http.Request {
+			return postAs(tom, "/tutor/remove-member", url.Values{"class_id": {b.tessClass.ID}, "student_id": {"ada"}})
+		}},
+		{"assign to the class", AssignDeckHandler, func(b classBackend) *http.Request {
+			return postAs(tom, "/tutor/assign", url.Values{"class_id": {b.tessClass.ID}, "target": {"class"},
+				"title": {"Mine"}, "card_ids": {"capital"}})
+		}},
+		{"assign to a member", AssignDeckHandler, func(b classBackend) *http.Request {
+			return postAs(tom, "/tutor/assign", url.Values{"class_id": {b.tessClass.ID}, "target": {"ada"},
+				"title": {"Mine"}, "card_ids": {"capital"}})
+		}},
+		{"delete assignment", DeleteAssignmentHandler, func(b classBackend) *http.Request {
+			return postAs(tom, "/tutor/delete-assignment", url.Values{"class_id": {b.tessClass.ID}, "assignment_id": {b.assignment.ID}})
+		}},
+		{"made up class", ServeClassPage, func(b classBackend) *http.Request {
+			return getAs(tess, "/tutor/class?id=missing")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newClassBackend(t)
+			if w := serve(tt.handler, tt.r(b)); w.Code != http.StatusNotFound {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+			}
+
+			if _, err := b.For("").Classes.Class(context.Background(), b.tessClass.ID); err != nil {
+				t.Errorf("tess's class: %v", err)
+			}
+			if got := b.members(t, b.tessClass.ID); len(got) != 1 || got[0] != "ada" {
+				t.Errorf("members = %v, want [ada]", got)
+			}
+			if got := b.assignments(t, b.tessClass.ID, "ada"); len(got) != 1 || got[0].ID != b.assignment.ID {
+				t.Errorf("assignments = %+v, want only tess's", got)
+			}
+		})
+	}
+}
+
+// Going through tom's own class doesn't reach tess's assignment either.
+func TestDeleteAssignmentFromAnotherClass(t *testing.T) {
+	b := newClassBackend(t)
+
+	w := serve(DeleteAssignmentHandler, postAs(tom, "/tutor/delete-assignment", url.Values{
+		"class_id": {b.tomClass.ID}, "assignment_id": {b.assignment.ID},
+	}))
+	if w.Code != http.StatusSeeOther || !strings.Contains(w.Header().Get("Location"), "error=") {
+		t.Errorf("status = %d, location %q; want a redirect with an error", w.Code, w.Header().Get("Location"))
+	}
+	if got := b.assignments(t, b.tessClass.ID); len(got) != 1 {
+		t.Errorf("assignments = %+v, want tess's kept", got)
+	}
+
+	w = serve(DeleteAssignmentHandler, postAs(tess, "/tutor/delete-assignment", url.Values{
+		"class_id": {b.tessClass.ID}, "assignment_id": {b.assignment.ID},
+	}))
+	if w.Code != http.StatusSeeOther || strings.Contains(w.Header().Get("Location"), "error=") {
+		t.Errorf("status = %d, location %q; want a redirect to the class", w.Code, w.Header().Get("Location"))
+	}
+	if got := b.assignments(t, b.tessClass.ID); len(got) != 0 {
+		t.Errorf("assignments = %+v, want none", got)
+	}
+}
+
+func TestAssignDeck(t *testing.T) {
+	b := newClassBackend(t)
+	assign := func(target string) string {
+		t.Helper()
+		w := serve(AssignDeckHandler, postAs(tess, "/tutor/assign", url.Values{
+			"class_id": {b.tessClass.ID}, "target": {target}, "title": {"Capitals"}, "card_ids": {"capital"},
+		}))
+		if w.Code != http.StatusSeeOther {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		return w.Header().Get("Location")
+	}
+
+	// Only the class's own students can be given a deck
+	if location := assign("bob"); !strings.Contains(location, "error=") {
+		t.Errorf("assigning to bob redirected to %q, want an error", location)
+	}
+	if got := b.assignments(t, b.tomClass.ID, "bob"); len(got) != 0 {
+		t.Errorf("bob's assignments = %+v, want none", got)
+	}
+
+	if location := assign("ada"); strings.Contains(location, "error=") {
+		t.Fatalf("assigning to ada redirected to %q", location)
+	}
+	got := b.assignments(t, b.tessClass.ID, "ada")
+	if len(got) != 2 || got[0].StudentID != "ada" || got[0].TutorID != tess.UserID {
+		t.Errorf("assignments = %+v, want a new one for ada from tess", got)
+	}
+}
+
+func TestAddClassMember(t *testing.T) {
+	b := newClassBackend(t)
+
+	w := serve(AddClassMemberHandler, postAs(tess, "/tutor/add-member", url.Values{
+		"class_id": {b.tessClass.ID}, "student_id": {"cy"},
+	}))
+	if w.Code != http.StatusSeeOther || strings.Contains(w.Header().Get("Location"), "error=") {
+		t.Fatalf("status = %d, location %q", w.Code, w.Header().Get("Location"))
+	}
+	if got := b.members(t, b.tessClass.ID); len(got) != 2 {
+		t.Errorf("members = %v, want ada and cy", got)
+	}
+	// Cy is only invited, so tess can't see or assign to them yet
+	if b.hasCard("cy", "extra") {
+		t.Error("cy was given the class's deck before accepting")
+	}
+	w = serve(ServeClassPage, getAs(tess, "/tutor/class?id="+b.tessClass.ID))
+	if body := w.Body.String(); !strings.Contains(body, "Invited") || strings.Contains(body, `<option value="cy">`) {
+		t.Error("class page doesn't show cy as invited only")
+	}
+	w = serve(AssignDeckHandler, postAs(tess, "/tutor/assign", url.Values{
+		"class_id": {b.tessClass.ID}, "target": {"cy"}, "title": {"Capitals"}, "card_ids": {"capital"},
+	}))
+	if location := w.Header().Get("Location"); !strings.Contains(location, "error=") {
+		t.Errorf("assigning to cy before they accept redirected to %q, want an error", location)
+	}
+
+	w = serve(AddClassMemberHandler, postAs(tess, "/tutor/add-member", url.Values{
+		"class_id": {b.tessClass.ID}, "student_id": {"nobody"},
+	}))
+	if location := w.Header().Get("Location"); !strings.Contains(location, "error=") {
+		t.Errorf("adding an unknown student redirected to %q, want an error", location)
+	}
+}
+
+func TestRemoveAndDeleteOwnClass(t *testing.T) {
+	b := newClassBackend(t)
+
+	serve(RemoveClassMemberHandler, postAs(tess, "/tutor/remove-member", url.Values{
+		"class_id": {b.tessClass.ID}, "student_id": {"ada"},
+	}))
+	if got := b.members(t, b.tessClass.ID); len(got) != 0 {
+		t.Errorf("members = %v, want none", got)
+	}
+	// Leaving keeps the cards and progress
+	if !b.hasCard("ada", "capital") {
+		t.Error("ada lost the cards on leaving the class")
+	}
+
+	w := serve(DeleteClassHandler, postAs(tess, "/tutor/delete-class", url.Values{"class_id": {b.tessClass.ID}}))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/tutor" {
+		t.Errorf("status = %d, location %q; want a redirect to /tutor", w.Code, w.Header().Get("Location"))
+	}
+	if _, err := b.For("").Classes.Class(context.Background(), b.tessClass.ID); err == nil {
+		t.Error("class still exists")
+	}
+	if _, err := b.For("").Classes.Class(context.Background(), b.tomClass.ID); err != nil {
+		t.Errorf("tom's class: %v", err)
+	}
+}
+
+func TestAcceptAndLeaveClass(t *testing.T) {
+	b := newClassBackend(t)
+	if err := b.For("").Classes.AddMember(context.Background(), b.tessClass.ID, "cy"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(HandleSettingsPage, getAs(cy, "/settings"))
+	if body := w.Body.String(); !strings.Contains(body, "Tess has invited you to Tess&#39;s class") {
+		t.Errorf("settings page doesn't show the invitation: %s", body)
+	}
+
+	// Only cy can accept cy's invitation
+	w = serve(AcceptClassHandler, postAs(bob, "/classes/accept", url.Values{"class_id": {b.tessClass.ID}}))
+	if location := w.Header().Get("Location"); !strings.Contains(location, "error=") {
+		t.Errorf("bob accepting redirected to %q, want an error", location)
+	}
+
+	w = serve(AcceptClassHandler, postAs(cy, "/classes/accept", url.Values{"class_id": {b.tessClass.ID}}))
+	if location := w.Header().Get("Location"); w.Code != http.StatusSeeOther || location != "/settings" {
+		t.Fatalf("status = %d, location %q; want a redirect to settings", w.Code, location)
+	}
+	// Joining brings the class's decks
+	if !b.hasCard("cy", "extra") {
+		t.Error("cy wasn't given the class's assigned deck")
+	}
+	w = serve(ServeClassPage, getAs(tess, "/tutor/class?id="+b.tessClass.ID))
+	if !strings.Contains(w.Body.String(), `<option value="cy">`) {
+		t.Error("cy isn't listed as a student after accepting")
+	}
+
+	// Leaving keeps the cards
+	serve(LeaveClassHandler, postAs(cy, "/classes/leave", url.Values{"class_id": {b.tessClass.ID}}))
+	if got := b.members(t, b.tessClass.ID); len(got) != 1 || got[0] != "ada" {
+		t.Errorf("members = %v, want just ada", got)
+	}
+	if !b.hasCard("cy", "extra") {
+		t.Error("cy lost the class's deck on leaving")
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/utils"
+)
+
+// How many answers can be undone in one session.
+const maxUndoLevels = 10
+
+type undoStackKey struct{}
+
+// UndoAnswer reverts the most recent answer in this session and shows the
+// same card again.
+func UndoAnswer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session := sessionFrom(r)
+	userId, studentId := session.UserID, session.StudentID
+
+	logID, r := popUndo(w, r)
+	if logID == "" {
+		renderFlashcardPartial(w, r, "")
+		return
+	}
+
+	if studentId == "" {
+		http.Error(w, "Error fetching student ID", http.StatusInternalServerError)
+		return
+	}
+
+	reviewLogs := storesFor(r).ReviewLogs
+	entry, err := reviewLogs.Get(r.Context(), studentId, logID)
+	if err != nil {
+		log.Println("Undo: failed to fetch review log:", err)
+		renderFlashcardPartial(w, r, "")
+		return
+	}
+
+	current, err := fetchStudentCard(r, studentId, entry.CardID)
+	if err != nil {
+		http.Error(w, "Error fetching card status", http.StatusInternalServerError)
+		return
+	}
+
+	// Only roll back if nothing else has moved the card since; otherwise the
+	// answer stands, along with everything it counted towards
+	if current.Status != entry.NewStatus || current.Due != entry.NewDue {
+		log.Printf("Undo: card %s changed since answer %s, leaving it as is", entry.CardID, entry.ID)
+		renderFlashcardPartial(w, r, "")
+		return
+	}
+
+	previous := models.StudentCard{
+		CardID:     entry.CardID,
+		Status:     entry.PrevStatus,
+		Due:        entry.PrevDue,
+		Stability:  entry.PrevStability,
+		Difficulty: entry.PrevDifficulty,
+		LastReview: entry.PrevLastReview,
+		Lapses:     entry.PrevLapses,
+		Suspended:  entry.PrevSuspended,
+		Leech:      entry.PrevLeech,
+	}
+	if err := updateCardStatus(r, studentId, entry.CardID, previous); err != nil {
+		http.Error(w, "Failed to update card", http.StatusInternalServerError)
+		return
+	}
+
+	unburySiblings(r, studentId, entry)
+
+	if entry.CountedNewCard {
+		rolloverHour := loadStudentSettings(r, studentId).DayRolloverHour
+		if err := decrementNumNewCardsToday(r, userId, rolloverHour); err != nil {
+			log.Println("Undo: failed to decrement numNewCardsToday:", err)
+		}
+	}
+
+	if entry.PrevStreakStartTime != unknownStreakTime && entry.PrevStreakEndTime != unknownStreakTime {
+		if err := setStreakTimes(r, userId, entry.PrevStreakStartTime, entry.PrevStreakEndTime); err != nil {
+			log.Println("Undo: failed to restore streak:", err)
+		}
+	}
+
+	if err := reviewLogs.MarkUndone(r.Context(), studentId, entry.ID, time.Now().Unix()); err != nil {
+		log.Println("Undo: failed to mark review log undone:", err)
+	}
+
+	renderFlashcardPartial(w, r, entry.CardID)
+}
+
+// unburySiblings puts back the siblings the answer buried as they were,
+// unless something has buried them differently since.
+func unburySiblings(r *http.Request, studentId string, entry models.ReviewLog) {
+	for _, sibling := range entry.BuriedSiblings {
+		current, err := fetchStudentCard(r, studentId, sibling.CardID)
+		if err != nil {
+			log.Printf("Undo: failed to fetch sibling %s: %v", sibling.CardID, err)
+			continue
+		}
+		if current.BuriedUntil != sibling.BuriedUntil {
+			continue
+		}
+		if err := patchStudentCard(r, studentId, sibling.CardID, map[string]interface{}{"buried_until": sibling.PrevBuriedUntil}); err != nil {
+			log.Printf("Undo: failed to unbury sibling %s: %v", sibling.CardID, err)
+		}
+	}
+}
+
+// readUndoStack returns the review log IDs that can still be undone, oldest first.
+func readUndoStack(r *http.Request) []string {
+	if ids, ok := r.Context().Value(undoStackKey{}).([]string); ok {
+		return ids
+	}
+	cookie, err := r.Cookie("undo_stack")
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	var ids []string
+	for _, id := range strings.Split(cookie.Value, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// writeUndoStack stores the stack in a session cookie and returns a request
+// that sees the new stack, so the partial rendered next shows the right buttons.
+func writeUndoStack(w http.ResponseWriter, r *http.Request, ids []string) *http.Request {
+	if len(ids) > maxUndoLevels {
+		ids = ids[len(ids)-maxUndoLevels:]
+	}
+	if len(ids) == 0 {
+		utils.ClearCookie(w, r, "undo_stack")
+	} else {
+		utils.SetCookie(w, r, "undo_stack", strings.Join(ids, ","), time.Time{})
+	}
+	return r.WithContext(context.WithValue(r.Context(), undoStackKey{}, ids))
+}
+
+func pushUndo(w http.ResponseWriter, r *http.Request, logID string) *http.Request {
+	ids := append([]string{}, readUndoStack(r)...)
+	return writeUndoStack(w, r, append(ids, logID))
+}
+
+func popUndo(w http.ResponseWriter, r *http.Request) (string, *http.Request) {
+	ids := readUndoStack(r)
+	if len(ids) == 0 {
+		return "", r
+	}
+	last := ids[len(ids)-1]
+	return last, writeUndoStack(w, r, append([]string{}, ids[:len(ids)-1]...))
+}
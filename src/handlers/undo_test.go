@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/abstract-tutoring/services"
+)
+
+func TestUndoAnswer(t *testing.T) {
+	backend := newStudyBackend(t)
+	before := studentCard(t, backend, ada.StudentID, "capital")
+
+	w := serve(SubmitAnswer, postAs(ada, "/flashcard/answer", url.Values{
+		"card_id": {"capital"},
+		"rating":  {strconv.Itoa(services.RatingGood)},
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("answer status = %d: %s", w.Code, w.Body)
+	}
+
+	w = serve(UndoAnswer, postAs(ada, "/flashcard/undo", nil, w.Result().Cookies()...))
+	if w.Code != http.StatusOK {
+		t.Fatalf("undo status = %d: %s", w.Code, w.Body)
+	}
+
+	if card := studentCard(t, backend, ada.StudentID, "capital"); card != before {
+		t.Errorf("card after undo = %+v, want %+v", card, before)
+	}
+	if sibling := studentCard(t, backend, ada.StudentID, "capital#1"); sibling.BuriedUntil != 0 {
+		t.Errorf("sibling buried until %d after undo, want unburied", sibling.BuriedUntil)
+	}
+	if logs := reviewLogs(t, backend, ada.StudentID); len(logs) != 0 {
+		t.Errorf("review logs after undo = %+v, want none", logs)
+	}
+	if c := undoCookie(w); c == nil || c.Value != "" {
+		t.Errorf("undo_stack cookie = %v, want it cleared", c)
+	}
+}
+
+func TestUndoAnswerLeavesCardMovedSince(t *testing.T) {
+	backend := newStudyBackend(t)
+
+	w := serve(SubmitAnswer, postAs(ada, "/flashcard/answer", url.Values{
+		"card_id": {"capital"},
+		"rating":  {strconv.Itoa(services.RatingGood)},
+	}))
+	cookies := w.Result().Cookies()
+
+	// Rescheduled from browse after answering
+	moved := serve(RescheduleCardHandler, postAs(ada, "/reschedule-card", url.Values{
+		"card_id": {"capital"}, "mode": {"due"}, "due_date": {"2030-01-01"},
+	}))
+	if moved.Code != http.StatusNoContent {
+		t.Fatalf("reschedule status = %d: %s", moved.Code, moved.Body)
+	}
+	after := studentCard(t, backend, ada.StudentID, "capital")
+
+	w = serve(UndoAnswer, postAs(ada, "/flashcard/undo", nil, cookies...))
+	if w.Code != http.StatusOK {
+		t.Fatalf("undo status = %d: %s", w.Code, w.Body)
+	}
+	if card := studentCard(t, backend, ada.StudentID, "capital"); card != after {
+		t.Errorf("card after undo = %+v, want it left at %+v", card, after)
+	}
+	// The answer stands, so nothing else it did is rolled back either
+	if sibling := studentCard(t, backend, ada.StudentID, "capital#1"); sibling.BuriedUntil == 0 {
+		t.Error("sibling unburied by an undo that was refused")
+	}
+	count, err := backend.For("").Students.NewCardCount(context.Background(), ada.UserID)
+	if err != nil || count.Count != 1 {
+		t.Errorf("new card count = %+v, %v; want the answer still counted", count, err)
+	}
+	if logs := reviewLogs(t, backend, ada.StudentID); len(logs) != 1 {
+		t.Errorf("review logs after undo = %+v, want the answer kept", logs)
+	}
+}
+
+func TestUndoAnswerOtherStudentsLog(t *testing.T) {
+	backend := newStudyBackend(t)
+
+	w := serve(SubmitAnswer, postAs(ada, "/flashcard/answer", url.Values{
+		"card_id": {"capital"},
+		"rating":  {strconv.Itoa(services.RatingGood)},
+	}))
+	answered := studentCard(t, backend, ada.StudentID, "capital")
+
+	// Bob's undo stack can't name ada's answers
+	w = serve(UndoAnswer, postAs(bob, "/flashcard/undo", nil, w.Result().Cookies()...))
+	if w.Code != http.StatusOK {
+		t.Fatalf("undo status = %d: %s", w.Code, w.Body)
+	}
+	if card := studentCard(t, backend, ada.StudentID, "capital"); card != answered {
+		t.Errorf("ada's card = %+v, want it left at %+v", card, answered)
+	}
+	if logs := reviewLogs(t, backend, ada.StudentID); len(logs) != 1 {
+		t.Errorf("ada's review logs = %+v, want the answer kept", logs)
+	}
+}
+
+func TestUndoAnswerMethod(t *testing.T) {
+	newStudyBackend(t)
+	if w := serve(UndoAnswer, getAs(ada, "/flashcard/undo")); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func undoCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "undo_stack" {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/services"
+	"github.com/abstract-tutoring/storage"
+)
+
+// assetBucket keeps card images. main sets it with UseBucket before serving.
+var assetBucket storage.Bucket
+
+func UseBucket(b storage.Bucket) {
+	assetBucket = b
+}
+
+// assetURLs gives the links card images are loaded from, as the caller.
+func assetURLs(r *http.Request) func(path string) (string, error) {
+	accessToken := sessionFrom(r).AccessToken
+	return func(path string) (string, error) {
+		if assetBucket == nil {
+			return "", fmt.Errorf("no asset storage configured")
+		}
+		return assetBucket.URL(r.Context(), accessToken, path)
+	}
+}
+
+// uploadedImage is what UploadImageHandler answers with: the new asset and
+// the reference to put in the card's content.
+type uploadedImage struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Alt       string `json:"alt"`
+	Reference string `json:"reference"`
+	URL       string `json:"url"`
+}
+
+// UploadImageHandler stores an image from the create or edit form under the
+// user's own folder. With a card_id the image is added to that card's assets
+// straight away; without one, the create form sends the new asset along
+// with the card.
+func UploadImageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if assetBucket == nil {
+		http.Error(w, "Image uploads are not set up", http.StatusServiceUnavailable)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, services.MaxImageBytes+1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			http.Error(w, fmt.Sprintf("Images can be up to %d MB", services.MaxImageBytes>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		http.Error(w, "No image uploaded", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, services.MaxImageBytes+1))
+	if err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	image, contentType, ext, err := services.PrepareImage(data)
+	if err != nil {
+		status := http.StatusUnsupportedMediaType
+		if len(data) > services.MaxImageBytes {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	session := sessionFrom(r)
+	cards := storesFor(r).Cards
+	var card models.Flashcard
+	cardID := r.FormValue("card_id")
+	if cardID != "" {
+		card, err = cards.Get(r.Context(), cardID)
+		if err != nil {
+			http.Error(w, "Card not found", http.StatusNotFound)
+			return
+		}
+		if card.CreatedBy != session.UserID {
+			http.Error(w, "You can only add images to your own cards", http.StatusForbidden)
+			return
+		}
+	}
+
+	alt := r.FormValue("alt")
+	if strings.TrimSpace(alt) == "" {
+		alt = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	}
+
+	// Each user's images go in a folder named for them, which the bucket
+	// lets only that user write to. The session's user is the one its access
+	// token was checked for, not anything the browser says.
+	path := session.UserID + "/" + randomName() + ext
+	if !storage.ValidPath(path) {
+		http.Error(w, "Invalid user", http.StatusBadRequest)
+		return
+	}
+	if err := assetBucket.Put(r.Context(), session.AccessToken, path, contentType, image); err != nil {
+		log.Println("Image upload failed:", err)
+		http.Error(w, "Failed to store image", http.StatusInternalServerError)
+		return
+	}
+
+	asset := models.Asset{ID: path, Type: "image", Alt: imageAlt(alt)}
+	if cardID != "" {
+		if err := cards.AppendAsset(r.Context(), cardID, asset); err != nil {
+			log.Println("Failed to add image to card:", err)
+			http.Error(w, "Failed to add image to card", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	url, err := assetBucket.URL(r.Context(), session.AccessToken, path)
+	if err != nil {
+		// The image is stored; it just can't be previewed yet
+		log.Println("Failed to sign uploaded image:", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(uploadedImage{
+		ID:        asset.ID,
+		Type:      asset.Type,
+		Alt:       asset.Alt,
+		Reference: "asset://" + asset.ID,
+		URL:       url,
+	})
+}
+
+// uploadedAssets reads the images the create form uploaded before the card
+// existed. Only images in the user's own folder are kept, so a card can't
+// claim someone else's files.
+func uploadedAssets(r *http.Request) []models.Asset {
+	raw := r.FormValue("assets")
+	if raw == "" {
+		return nil
+	}
+	var submitted []models.Asset
+	if err := json.Unmarshal([]byte(raw), &submitted); err != nil {
+		return nil
+	}
+	prefix := sessionFrom(r).UserID + "/"
+	var assets []models.Asset
+	for _, a := range submitted {
+		if a.Type != "image" || !strings.HasPrefix(a.ID, prefix) || !storage.ValidPath(a.ID) {
+			continue
+		}
+		a.Alt = imageAlt(a.Alt)
+		assets = append(assets, a)
+	}
+	return assets
+}
+
+// imageAlt tidies an image's alt text. It's plain text, escaped when the
+// image is shown.
+func imageAlt(alt string) string {
+	alt = strings.Join(strings.Fields(alt), " ")
+	if r := []rune(alt); len(r) > 200 {
+		alt = string(r[:200])
+	}
+	return alt
+}
+
+func randomName() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abstract-tutoring/auth"
+	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/storage"
+)
+
+// uploadAs is a multipart POST of an image file by the signed-in session.
+func uploadAs(t *testing.T, session Session, filename string, data []byte, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	part, err := mw.CreateFormFile("image", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	mw.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/upload-image", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return withSession(r, session)
+}
+
+// useLocalBucket keeps uploads in a scratch directory for the test. The
+// bucket checks access tokens, so it returns ada and bob with real ones.
+func useLocalBucket(t *testing.T) (Session, Session) {
+	t.Helper()
+	UseBucket(storage.NewLocal(t.TempDir(), "/assets/", "secret"))
+	t.Cleanup(func() { UseBucket(nil) })
+	sign := func(s Session) Session {
+		token, err := auth.SignAccessToken([]byte("secret"), s.UserID, time.Now(), time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.AccessToken = token
+		return s
+	}
+	return sign(ada), sign(bob)
+}
+
+func pngImage(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploadImageToCard(t *testing.T) {
+	backend := newStudyBackend(t)
+	ada, bob := useLocalBucket(t)
+
+	w := serve(UploadImageHandler, uploadAs(t, ada, "Graph of y = x².png", pngImage(t), map[string]string{"card_id": "mine"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var uploaded uploadedImage
+	if err := json.NewDecoder(w.Body).Decode(&uploaded); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(uploaded.ID, ada.UserID+"/") || !strings.HasSuffix(uploaded.ID, ".png") {
+		t.Errorf("id = %q, want a PNG in ada's folder", uploaded.ID)
+	}
+	if uploaded.Reference != "asset://"+uploaded.ID || uploaded.URL != "/assets/"+uploaded.ID {
+		t.Errorf("reference = %q, url = %q", uploaded.Reference, uploaded.URL)
+	}
+
+	card, err := backend.For("").Cards.Get(context.Background(), "mine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.Asset{{ID: uploaded.ID, Type: "image", Alt: "Graph of y = x²"}}
+	if len(card.Assets) != 1 || card.Assets[0] != want[0] {
+		t.Errorf("assets = %+v, want %+v", card.Assets, want)
+	}
+
+	// Only the card's author can add to it
+	w = serve(UploadImageHandler, uploadAs(t, bob, "x.png", pngImage(t), map[string]string{"card_id": "mine"}))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("bob's upload: status = %d, want forbidden", w.Code)
+	}
+	w = serve(UploadImageHandler, uploadAs(t, ada, "notes.png", []byte("not an image"), nil))
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("text upload: status = %d, want unsupported", w.Code)
+	}
+}
+
+func TestCreateCardWithUploadedImage(t *testing.T) {
+	backend := newStudyBackend(t)
+	ada, bob := useLocalBucket(t)
+
+	w := serve(UploadImageHandler, uploadAs(t, ada, "graph.png", pngImage(t), map[string]string{"alt": "Graph"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var uploaded uploadedImage
+	json.NewDecoder(w.Body).Decode(&uploaded)
+
+	// bob's image can't be claimed by ada's card
+	assets, _ := json.Marshal([]models.Asset{
+		{ID: uploaded.ID, Type: "image", Alt: uploaded.Alt},
+		{ID: bob.UserID + "/theirs.png", Type: "image"},
+	})
+	w = serve(CreateCardHandler, postAs(ada, "/create-card", url.Values{
+		"type":   {models.ContentRichText},
+		"front":  {"Sketch this\n" + uploaded.Reference},
+		"back":   {"A parabola"},
+		"assets": {string(assets)},
+	}))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Flashcard Added!") {
+		t.Fatalf("status = %d, want the card created", w.Code)
+	}
+
+	cards, err := backend.For("").Cards.All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created models.Flashcard
+	for _, c := range cards {
+		if strings.Contains(c.Front.Content, "Sketch this") {
+			created = c
+		}
+	}
+	want := models.Asset{ID: uploaded.ID, Type: "image", Alt: "Graph"}
+	if len(created.Assets) != 1 || created.Assets[0] != want {
+		t.Errorf("assets = %+v, want just %+v", created.Assets, want)
+	}
+}
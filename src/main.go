@@ -1,10 +1,19 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 
+	"github.com/abstract-tutoring/auth"
 	"github.com/abstract-tutoring/handlers"
+	"github.com/abstract-tutoring/services"
+	"github.com/abstract-tutoring/storage"
+	"github.com/abstract-tutoring/store"
+	"github.com/abstract-tutoring/utils"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 )
 
@@ -14,35 +23,139 @@ func main() {
 		log.Println("No .env file found or error loading it:", err)
 	}
 
+	if err := services.LoadSchedulingProfiles(os.Getenv("SCHEDULING_PROFILES")); err != nil {
+		log.Fatal("Invalid scheduling profiles: ", err)
+	}
+
+	// Both the Postgres store and local auth use the database directly
+	var pool *pgxpool.Pool
+	if os.Getenv("DATA_BACKEND") == "postgres" || os.Getenv("AUTH_PROVIDER") == "local" {
+		pool, err = pgxpool.New(context.Background(), utils.MustGetEnv("DATABASE_URL"))
+		if err != nil {
+			log.Fatal("Invalid DATABASE_URL: ", err)
+		}
+		defer pool.Close()
+	}
+
+	switch backend := os.Getenv("DATA_BACKEND"); backend {
+	case "", "supabase":
+		handlers.UseStore(store.NewPostgREST(
+			utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL"),
+			utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY"),
+		))
+	case "postgres":
+		handlers.UseStore(store.NewPostgres(pool, utils.MustGetEnv("JWT_SECRET")))
+	default:
+		log.Fatalf("Unknown DATA_BACKEND %q, expected supabase or postgres", backend)
+	}
+
+	siteURL := os.Getenv("SITE_URL")
+	if siteURL == "" {
+		siteURL = "http://localhost:8080"
+	}
+
+	switch provider := os.Getenv("AUTH_PROVIDER"); provider {
+	case "", "supabase":
+		handlers.UseAuth(auth.NewSupabase(
+			utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL"),
+			utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY"),
+			os.Getenv("SUPABASE_SERVICE_ROLE_KEY"),
+		))
+	case "local":
+		var mailer auth.Mailer
+		if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+			mailer = auth.NewSMTPMailer(addr, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), utils.MustGetEnv("MAIL_FROM"))
+		}
+		if os.Getenv("AUTH_LOG_LINKS") == "1" {
+			log.Println("WARNING: AUTH_LOG_LINKS=1, so sign up and password reset links are written to the log." +
+				" Anyone who can read the log can take over accounts. Never set it outside development.")
+			mailer = auth.LogMailer{}
+		} else if mailer == nil {
+			log.Println("WARNING: no SMTP_ADDR, so sign up and password reset emails won't be sent")
+		}
+		handlers.UseAuth(auth.NewLocal(pool, utils.MustGetEnv("JWT_SECRET"), siteURL, mailer))
+	default:
+		log.Fatalf("Unknown AUTH_PROVIDER %q, expected supabase or local", provider)
+	}
+
+	switch bucket := os.Getenv("ASSET_STORAGE"); bucket {
+	case "", "supabase":
+		handlers.UseBucket(storage.NewSupabase(
+			utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_URL"),
+			utils.MustGetEnv("NEXT_PUBLIC_SUPABASE_ANON_KEY"),
+			"flashcard-assets",
+		))
+	case "local":
+		local := storage.NewLocal(utils.MustGetEnv("ASSET_DIR"), "/assets/", utils.MustGetEnv("JWT_SECRET"))
+		handlers.UseBucket(local)
+		http.HandleFunc("/assets/", handlers.RequireSession(local.ServeHTTP))
+	default:
+		log.Fatalf("Unknown ASSET_STORAGE %q, expected supabase or local", bucket)
+	}
+
+	oidcConfigs, err := auth.LoadOIDCConfigs(os.Getenv("OIDC_PROVIDERS"))
+	if err != nil {
+		log.Fatal("Invalid OIDC providers: ", err)
+	}
+	var oidcProviders []*auth.OIDC
+	for _, config := range oidcConfigs {
+		oidcProviders = append(oidcProviders, auth.NewOIDC(config, strings.TrimRight(siteURL, "/")+"/auth/oidc/callback"))
+	}
+	handlers.UseOIDC(oidcProviders...)
+
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./frontend/static"))))
 
-	http.HandleFunc("/", handlers.ServeHome)
+	http.HandleFunc("/", handlers.RequireSession(handlers.ServeHome))
 	http.HandleFunc("/login", handlers.LoginPage)
 	http.HandleFunc("/perform-login", handlers.LoginHandler)
-	http.HandleFunc("/flashcard/front", handlers.ServeFirstFlashcardFront)
-	http.HandleFunc("/flashcard/answer", handlers.SubmitAnswer)
-	http.HandleFunc("/flashcard/status", handlers.ServeStatusPanel)
-	http.HandleFunc("/flashcard/review-ahead", handlers.HandleReviewAhead)
+	http.HandleFunc("/flashcard/front", handlers.RequireSession(handlers.ServeFirstFlashcardFront))
+	http.HandleFunc("/flashcard/answer", handlers.RequireSession(handlers.SubmitAnswer))
+	http.HandleFunc("/flashcard/undo", handlers.RequireSession(handlers.UndoAnswer))
+	http.HandleFunc("/flashcard/status", handlers.RequireSession(handlers.ServeStatusPanel))
+	http.HandleFunc("/flashcard/review-ahead", handlers.RequireSession(handlers.HandleReviewAhead))
 	http.HandleFunc("/logout", handlers.LogoutHandler)
-	http.HandleFunc("/browse", handlers.ServeBrowsePage)
-	http.HandleFunc("/goto", handlers.HandleGoToCard)
-	http.HandleFunc("/create", handlers.CreateCardPage)
-	http.HandleFunc("/create-card", handlers.CreateCardHandler)
-	http.HandleFunc("/unlink-card", handlers.UnlinkCardHandler)
-	http.HandleFunc("/confirm-delete-button", handlers.ServeConfirmDeleteButton)
-	http.HandleFunc("/edit", handlers.EditCardPage)
-	http.HandleFunc("/edit-card", handlers.EditCardHandler)
-	http.HandleFunc("/settings", handlers.HandleSettingsPage)
-	http.HandleFunc("/confirm-delete-button-edit", handlers.ServeConfirmDeleteButtonEdit)
+	http.HandleFunc("/browse", handlers.RequireSession(handlers.ServeBrowsePage))
+	http.HandleFunc("/goto", handlers.RequireSession(handlers.HandleGoToCard))
+	http.HandleFunc("/create", handlers.RequireSession(handlers.CreateCardPage))
+	http.HandleFunc("/create-card", handlers.RequireSession(handlers.CreateCardHandler))
+	http.HandleFunc("/unlink-card", handlers.RequireSession(handlers.UnlinkCardHandler))
+	http.HandleFunc("/suspend-card", handlers.RequireSession(handlers.SuspendCardHandler))
+	http.HandleFunc("/unsuspend-card", handlers.RequireSession(handlers.UnsuspendCardHandler))
+	http.HandleFunc("/bury-card", handlers.RequireSession(handlers.BuryCardHandler))
+	http.HandleFunc("/reschedule-card", handlers.RequireSession(handlers.RescheduleCardHandler))
+	http.HandleFunc("/reschedule-form", handlers.RequireSession(handlers.ServeRescheduleForm))
+	http.HandleFunc("/confirm-delete-button", handlers.RequireSession(handlers.ServeConfirmDeleteButton))
+	http.HandleFunc("/edit", handlers.RequireSession(handlers.EditCardPage))
+	http.HandleFunc("/edit-card", handlers.RequireSession(handlers.EditCardHandler))
+	http.HandleFunc("/upload-image", handlers.RequireSession(handlers.UploadImageHandler))
+	http.HandleFunc("/settings", handlers.RequireSession(handlers.HandleSettingsPage))
+	http.HandleFunc("/stats", handlers.RequireSession(handlers.ServeStatsPage))
+	http.HandleFunc("/stats/forecast", handlers.RequireSession(handlers.ServeForecastJSON))
+	http.HandleFunc("/tutor", handlers.RequireSession(handlers.ServeTutorPage))
+	http.HandleFunc("/tutor/class", handlers.RequireSession(handlers.ServeClassPage))
+	http.HandleFunc("/tutor/create-class", handlers.RequireSession(handlers.CreateClassHandler))
+	http.HandleFunc("/tutor/delete-class", handlers.RequireSession(handlers.DeleteClassHandler))
+	http.HandleFunc("/tutor/add-member", handlers.RequireSession(handlers.AddClassMemberHandler))
+	http.HandleFunc("/tutor/remove-member", handlers.RequireSession(handlers.RemoveClassMemberHandler))
+	http.HandleFunc("/tutor/assign", handlers.RequireSession(handlers.AssignDeckHandler))
+	http.HandleFunc("/tutor/delete-assignment", handlers.RequireSession(handlers.DeleteAssignmentHandler))
+	http.HandleFunc("/classes/accept", handlers.RequireSession(handlers.AcceptClassHandler))
+	http.HandleFunc("/classes/leave", handlers.RequireSession(handlers.LeaveClassHandler))
+	http.HandleFunc("/confirm-delete-button-edit", handlers.RequireSession(handlers.ServeConfirmDeleteButtonEdit))
+	http.HandleFunc("/auth/oidc/login", handlers.OIDCLoginHandler)
+	http.HandleFunc("/auth/oidc/callback", handlers.OIDCCallbackHandler)
+	http.HandleFunc("/signup", handlers.SignupPage)
+	http.HandleFunc("/perform-signup", handlers.SignupHandler)
 	http.HandleFunc("/forgot-password", handlers.ForgotPasswordPage)
 	http.HandleFunc("/perform-forgot-password", handlers.ForgotPasswordHandler)
 	http.HandleFunc("/password-reset", handlers.PasswordResetPage)
-	http.HandleFunc("/perform-password-reset", handlers.PasswordResetHandler)
+	http.HandleFunc("/perform-password-reset", handlers.RequireSession(handlers.PasswordResetHandler))
 
 	log.Println("Server listening on :8080")
 	http.HandleFunc("/api/auth/confirm", handlers.ConfirmHandler)
 
-	err = http.ListenAndServe(":8080", nil)
+	// Every POST must carry the CSRF token the pages are rendered with
+	err = http.ListenAndServe(":8080", handlers.CSRFProtect(http.DefaultServeMux))
 	if err != nil {
 		log.Fatal("Server error:", err)
 	}
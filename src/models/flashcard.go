@@ -1,5 +1,25 @@
 package models
 
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Content types. Cloze fronts hold {{c1::answer::hint}} deletions, and the
+// back is extra text shown once the answer is revealed. Type answer cards are
+// studied by typing the back, which is checked against what was typed.
+// Multiple choice cards offer the back, the correct option, shuffled in with
+// the back's distractors. Image occlusion fronts cover parts of an image with
+// masks, each tested by its own card, and the back is optional extra text.
+const (
+	ContentRichText       = "rich_text"
+	ContentCloze          = "cloze"
+	ContentTypeAnswer     = "type_answer"
+	ContentMultipleChoice = "multiple_choice"
+	ContentImageOcclusion = "image_occlusion"
+)
+
 type Asset struct {
 	ID   string `json:"id"`
 	Type string `json:"type"`
@@ -13,11 +33,33 @@ type Flashcard struct {
 	Assets    []Asset `json:"assets"`
 	CreatedBy string  `json:"created_by"`
 	Tags      []Tag   `json:"tags"`
+	Ords      []int   `json:"ords"` // the cards the note makes; see CardKey
 }
 
 type Content struct {
-	Type    string `json:"type"`
-	Content string `json:"content"`
+	Type        string     `json:"type"`
+	Content     string     `json:"content"`
+	Distractors []string   `json:"distractors,omitempty"` // wrong options, on a multiple choice back
+	Occlusion   *Occlusion `json:"occlusion,omitempty"`   // on an image occlusion front
+}
+
+// Occlusion is an image asset and the masks over it. HideOthers keeps the
+// masks not being tested hidden too.
+type Occlusion struct {
+	Image      string `json:"image"`
+	Masks      []Mask `json:"masks"`
+	HideOthers bool   `json:"hide_others,omitempty"`
+}
+
+// Mask is a rectangle over an occlusion image, in percent of the image's
+// width and height. Its ID is the ord of the card that tests it.
+type Mask struct {
+	ID    int     `json:"id"`
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	W     float64 `json:"w"`
+	H     float64 `json:"h"`
+	Label string  `json:"label,omitempty"`
 }
 
 type Tag struct {
@@ -30,10 +72,63 @@ type FlashcardTag struct {
 	TagID  int    `json:"tag_id"`
 }
 
+// A note (one Flashcard) can make several cards to study, numbered by ord:
+// one per cloze deletion or occlusion mask, or just ord 0. CardKey names one
+// of them, and is what StudentCard.CardID and ReviewLog.CardID hold: the note
+// ID for ord 0, or "noteID#ord".
+func CardKey(noteID string, ord int) string {
+	if ord == 0 {
+		return noteID
+	}
+	return noteID + "#" + strconv.Itoa(ord)
+}
+
+// OrdReversed is the back to front card of a reversible note. Cloze and
+// image occlusion notes number their cards from 1 instead.
+const OrdReversed = 1
+
+// Reversible reports whether the note also makes a back to front card.
+func (f Flashcard) Reversible() bool {
+	return f.Front.Type != ContentCloze && f.Front.Type != ContentImageOcclusion &&
+		slices.Contains(f.Ords, OrdReversed)
+}
+
+// ValidNoteID reports whether id can be a note's ID. It can't contain #,
+// which separates the ord in a CardKey.
+func ValidNoteID(id string) bool {
+	return id != "" && !strings.ContainsRune(id, '#')
+}
+
+// SplitCardKey undoes CardKey.
+func SplitCardKey(key string) (noteID string, ord int) {
+	i := strings.LastIndexByte(key, '#')
+	if i < 0 {
+		return key, 0
+	}
+	ord, err := strconv.Atoi(key[i+1:])
+	if err != nil {
+		return key, 0
+	}
+	return key[:i], ord
+}
+
+// NoteID is the note a card key belongs to.
+func NoteID(key string) string {
+	noteID, _ := SplitCardKey(key)
+	return noteID
+}
+
 type StudentCard struct {
-	CardID string `json:"card_id"`
-	Status int    `json:"status"`
-	Due    int64  `json:"due"`
+	CardID      string  `json:"card_id"` // a CardKey
+	Status      int     `json:"status"`
+	Due         int64   `json:"due"`
+	Stability   float64 `json:"stability"`
+	Difficulty  float64 `json:"difficulty"`
+	LastReview  int64   `json:"last_review"`
+	Lapses      int     `json:"lapses"`
+	Suspended   bool    `json:"suspended"`
+	Leech       bool    `json:"leech"`
+	BuriedUntil int64   `json:"buried_until"` // hidden from study until this time
 }
 
 type CardDueStats struct {
@@ -41,5 +136,3 @@ type CardDueStats struct {
 	ReviewDue     int
 	NewAvailable  int
 }
-
-const MaxNewCardsPerDay = "20"
@@ -0,0 +1,50 @@
+package models
+
+import "testing"
+
+func TestCardKey(t *testing.T) {
+	tests := []struct {
+		noteID string
+		ord    int
+		key    string
+	}{
+		{"card_1", 0, "card_1"},
+		{"card_1", 1, "card_1#1"},
+		{"card_1", 12, "card_1#12"},
+	}
+	for _, tt := range tests {
+		key := CardKey(tt.noteID, tt.ord)
+		if key != tt.key {
+			t.Errorf("CardKey(%q, %d) = %q, want %q", tt.noteID, tt.ord, key, tt.key)
+		}
+		noteID, ord := SplitCardKey(key)
+		if noteID != tt.noteID || ord != tt.ord {
+			t.Errorf("SplitCardKey(%q) = %q, %d, want %q, %d", key, noteID, ord, tt.noteID, tt.ord)
+		}
+		if NoteID(key) != tt.noteID {
+			t.Errorf("NoteID(%q) = %q, want %q", key, NoteID(key), tt.noteID)
+		}
+	}
+}
+
+func TestSplitCardKeyWithoutOrd(t *testing.T) {
+	for _, key := range []string{"card", "card#", "card#x", "a#b#c"} {
+		if noteID, ord := SplitCardKey(key); noteID != key || ord != 0 {
+			t.Errorf("SplitCardKey(%q) = %q, %d, want the key and 0", key, noteID, ord)
+		}
+	}
+}
+
+func TestValidNoteID(t *testing.T) {
+	tests := map[string]bool{
+		"card_abc_000001": true,
+		"":                false,
+		"card#1":          false,
+		"#":               false,
+	}
+	for id, want := range tests {
+		if got := ValidNoteID(id); got != want {
+			t.Errorf("ValidNoteID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package models
+
+type ReviewLog struct {
+	ID          string `json:"id,omitempty"`
+	StudentID   string `json:"student_id"`
+	CardID      string `json:"card_id"` // a CardKey
+	Rating      int    `json:"rating"`
+	PrevStatus  int    `json:"prev_status"`
+	NewStatus   int    `json:"new_status"`
+	PrevDue     int64  `json:"prev_due"`
+	NewDue      int64  `json:"new_due"`
+	TimeTakenMs int64  `json:"time_taken_ms"`
+	ReviewedAt  int64  `json:"reviewed_at"`
+
+	// Previous state, kept so the answer can be undone
+	PrevStability       float64 `json:"prev_stability"`
+	PrevDifficulty      float64 `json:"prev_difficulty"`
+	PrevLastReview      int64   `json:"prev_last_review"`
+	CountedNewCard      bool    `json:"counted_new_card"`
+	PrevStreakStartTime int64   `json:"prev_streak_start_time"`
+	PrevStreakEndTime   int64   `json:"prev_streak_end_time"`
+	PrevLapses          int     `json:"prev_lapses"`
+	PrevSuspended       bool    `json:"prev_suspended"`
+	PrevLeech           bool    `json:"prev_leech"`
+	// Omitted when empty so PostgREST inserts the column's default
+	BuriedSiblings []BuriedSibling `json:"buried_siblings,omitempty"`
+	// Set when the answer is undone; undone answers stay in the table but
+	// are left out of everything read back
+	UndoneAt int64 `json:"undone_at,omitempty"`
+}
+
+// BuriedSibling is a card an answer buried along with its note's answered
+// card: until when, and until when it was buried before.
+type BuriedSibling struct {
+	CardID          string `json:"card_id"` // a CardKey
+	BuriedUntil     int64  `json:"buried_until"`
+	PrevBuriedUntil int64  `json:"prev_buried_until"`
+}
@@ -0,0 +1,35 @@
+package models
+
+const (
+	DefaultNewCardsPerDay = 20
+	DefaultMaxInProgress  = 5
+
+	DefaultSchedulingProfileName = "default"
+
+	DefaultLeechThreshold = 8
+	LeechActionSuspend    = "suspend" // take the card out of study
+	LeechActionTag        = "tag"     // only flag it, keep studying it
+)
+
+// StudentSettings are the per-student scheduling preferences.
+type StudentSettings struct {
+	StudentID         string `json:"student_id"`
+	NewCardsPerDay    int    `json:"new_cards_per_day"`
+	MaxInProgress     int    `json:"max_in_progress"`
+	DefaultTagFilter  string `json:"default_tag_filter"`
+	DayRolloverHour   int    `json:"day_rollover_hour"` // UK hour at which a new study day starts
+	SchedulingProfile string `json:"scheduling_profile"`
+	LeechThreshold    int    `json:"leech_threshold"` // lapses before a card becomes a leech
+	LeechAction       string `json:"leech_action"`
+}
+
+func DefaultStudentSettings(studentID string) StudentSettings {
+	return StudentSettings{
+		StudentID:         studentID,
+		NewCardsPerDay:    DefaultNewCardsPerDay,
+		MaxInProgress:     DefaultMaxInProgress,
+		SchedulingProfile: DefaultSchedulingProfileName,
+		LeechThreshold:    DefaultLeechThreshold,
+		LeechAction:       LeechActionSuspend,
+	}
+}
@@ -0,0 +1,44 @@
+package models
+
+// Tutor is a user who can run classes. Tutors are added from the control panel.
+type Tutor struct {
+	UserID      string `json:"user_id"`
+	DisplayName string `json:"display_name"`
+}
+
+type Class struct {
+	ID      string `json:"id,omitempty"`
+	TutorID string `json:"tutor_id"`
+	Name    string `json:"name"`
+}
+
+// ClassMember enrols a student, by student_id, in a class. Until the student
+// accepts, AcceptedAt is 0 and the tutor can't see their progress.
+type ClassMember struct {
+	ClassID    string `json:"class_id"`
+	StudentID  string `json:"student_id"`
+	CreatedAt  int64  `json:"created_at,omitempty"`
+	AcceptedAt int64  `json:"accepted_at,omitempty"`
+}
+
+// StudentClass is a class as one of its students, or a student invited to
+// it, sees it.
+type StudentClass struct {
+	ClassID    string
+	ClassName  string
+	TutorName  string
+	AcceptedAt int64
+}
+
+// Assignment is a deck a tutor has assigned to a class or to one student;
+// exactly one of ClassID and StudentID is set.
+type Assignment struct {
+	ID        string   `json:"id,omitempty"`
+	TutorID   string   `json:"tutor_id"`
+	ClassID   string   `json:"class_id,omitempty"`
+	StudentID string   `json:"student_id,omitempty"`
+	Title     string   `json:"title"`
+	Tags      []string `json:"tags"`
+	CardIDs   []string `json:"card_ids"`
+	LearnBy   string   `json:"learn_by,omitempty"` // YYYY-MM-DD study day, empty for no deadline
+}
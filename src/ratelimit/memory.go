@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many attempts there are between removing expired keys.
+const sweepEvery = 1000
+
+// Memory keeps attempts in the process; they are lost on restart and not
+// shared between servers.
+type Memory struct {
+	mu       sync.Mutex
+	entries  map[string]memoryEntry
+	attempts int
+}
+
+type memoryEntry struct {
+	Attempts
+	expires time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{entries: map[string]memoryEntry{}}
+}
+
+func (m *Memory) Attempt(ctx context.Context, key string, now time.Time, policy Policy) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.attempts++
+	if m.attempts%sweepEvery == 0 {
+		for k, e := range m.entries {
+			if now.After(e.expires) {
+				delete(m.entries, k)
+			}
+		}
+	}
+
+	e := m.entries[key]
+	if now.After(e.expires) {
+		e = memoryEntry{}
+	}
+	if wait := policy.Wait(e.Attempts, now); wait > 0 {
+		return wait, nil
+	}
+	e.Count++
+	e.Last = now
+	e.expires = now.Add(policy.Window)
+	m.entries[key] = e
+	return 0, nil
+}
+
+func (m *Memory) Refund(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+	if e.Count--; e.Count <= 0 {
+		delete(m.entries, key)
+		return nil
+	}
+	m.entries[key] = e
+	return nil
+}
+
+func (m *Memory) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
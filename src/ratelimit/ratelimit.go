@@ -0,0 +1,96 @@
+// Package ratelimit slows down repeated attempts at something, such as
+// signing in, with exponential backoff and then a temporary lockout. Counts
+// are kept in a Store; NewMemory keeps them in the process, and a shared
+// store can implement the same interface when there is more than one server.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Attempts is the count for one key since it was last reset or forgotten.
+type Attempts struct {
+	Count int
+	Last  time.Time
+}
+
+type Store interface {
+	// Attempt counts an attempt at key at now, unless policy says to wait
+	// after the attempts before it. Then it returns how long and the attempt
+	// is not counted. The check and the count are one step, so attempts made
+	// at the same time cannot all pass the same check. A key's attempts are
+	// forgotten policy.Window after the last one.
+	Attempt(ctx context.Context, key string, now time.Time, policy Policy) (time.Duration, error)
+	// Refund takes back one counted attempt, for one that did not fail.
+	Refund(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy is how long to wait after a number of attempts: nothing for the
+// first Free, then BaseDelay doubling each time up to MaxDelay, and Lockout
+// from LockoutAfter on. Attempts are forgotten Window after the last one,
+// which should be at least Lockout.
+type Policy struct {
+	Free         int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockoutAfter int
+	Lockout      time.Duration
+	Window       time.Duration
+}
+
+// Delay is how long after the last of count attempts the next is allowed.
+func (p Policy) Delay(count int) time.Duration {
+	switch {
+	case count >= p.LockoutAfter:
+		return p.Lockout
+	case count < p.Free:
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.Free; i < count && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// Wait is how long after attempts until the next is allowed at now, 0 if it
+// is allowed now.
+func (p Policy) Wait(attempts Attempts, now time.Time) time.Duration {
+	if attempts.Count == 0 || now.Sub(attempts.Last) > p.Window {
+		return 0
+	}
+	return max(attempts.Last.Add(p.Delay(attempts.Count)).Sub(now), 0)
+}
+
+// Limiter applies a Policy to the keys under one prefix, e.g. "login:ip:".
+type Limiter struct {
+	store  Store
+	prefix string
+	policy Policy
+}
+
+func New(store Store, prefix string, policy Policy) *Limiter {
+	return &Limiter{store: store, prefix: prefix, policy: policy}
+}
+
+// Attempt counts an attempt for key if it is allowed now, and otherwise
+// returns how long until it is. An attempt that turns out not to have failed,
+// e.g. a successful sign in, can be taken back with Refund or Reset.
+func (l *Limiter) Attempt(ctx context.Context, key string, now time.Time) (time.Duration, error) {
+	return l.store.Attempt(ctx, l.prefix+key, now, l.policy)
+}
+
+// Refund takes back one attempt for key.
+func (l *Limiter) Refund(ctx context.Context, key string) error {
+	return l.store.Refund(ctx, l.prefix+key)
+}
+
+// Reset forgets the attempts for key, e.g. after a successful sign in.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.store.Reset(ctx, l.prefix+key)
+}
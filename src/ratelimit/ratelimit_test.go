@@ -0,0 +1,223 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	Free:         3,
+	BaseDelay:    time.Second,
+	MaxDelay:     10 * time.Second,
+	LockoutAfter: 8,
+	Lockout:      15 * time.Minute,
+	Window:       time.Hour,
+}
+
+// clock is a time that tests move on by hand.
+type clock struct{ now time.Time }
+
+func newClock() *clock { return &clock{now: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)} }
+
+func (c *clock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestPolicyDelay(t *testing.T) {
+	tests := []struct {
+		count int
+		want  time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{6, 8 * time.Second},
+		{7, 10 * time.Second}, // capped at MaxDelay
+		{8, 15 * time.Minute}, // locked out
+		{50, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := testPolicy.Delay(tt.count); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyDelayDoesNotOverflow(t *testing.T) {
+	p := Policy{Free: 0, BaseDelay: time.Second, MaxDelay: time.Hour, LockoutAfter: 1 << 30, Lockout: 2 * time.Hour}
+	if got := p.Delay(1 << 20); got != time.Hour {
+		t.Errorf("Delay = %v, want %v", got, time.Hour)
+	}
+}
+
+// attempt makes an attempt for key and checks the wait it is given, 0 for
+// allowed.
+func attempt(t *testing.T, l *Limiter, key string, now time.Time, want time.Duration) {
+	t.Helper()
+	got, err := l.Attempt(context.Background(), key, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Attempt(%q) = %v, want %v", key, got, want)
+	}
+}
+
+// fill makes n allowed attempts for key, MaxDelay apart.
+func fill(t *testing.T, l *Limiter, key string, c *clock, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			c.advance(testPolicy.MaxDelay)
+		}
+		attempt(t, l, key, c.now, 0)
+	}
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	c := newClock()
+	l := New(NewMemory(), "login:", testPolicy)
+
+	for i := 0; i < testPolicy.Free; i++ {
+		attempt(t, l, "ada", c.now, 0)
+	}
+
+	// The third attempt starts the backoff, and blocked attempts aren't
+	// counted
+	attempt(t, l, "ada", c.now, time.Second)
+	c.advance(400 * time.Millisecond)
+	attempt(t, l, "ada", c.now, 600*time.Millisecond)
+	c.advance(600 * time.Millisecond)
+	attempt(t, l, "ada", c.now, 0)
+
+	attempt(t, l, "ada", c.now, 2*time.Second)
+	c.advance(2 * time.Second)
+	attempt(t, l, "ada", c.now, 0)
+
+	// Others aren't held up
+	attempt(t, l, "bob", c.now, 0)
+}
+
+func TestLimiterLockout(t *testing.T) {
+	c := newClock()
+	l := New(NewMemory(), "login:", testPolicy)
+
+	fill(t, l, "ada", c, testPolicy.LockoutAfter)
+	attempt(t, l, "ada", c.now, testPolicy.Lockout)
+
+	c.advance(testPolicy.Lockout - time.Minute)
+	attempt(t, l, "ada", c.now, time.Minute)
+
+	// After the lockout an attempt is allowed, but the count stands, so the
+	// next is locked out again
+	c.advance(time.Minute)
+	attempt(t, l, "ada", c.now, 0)
+	attempt(t, l, "ada", c.now, testPolicy.Lockout)
+}
+
+func TestLimiterForgets(t *testing.T) {
+	c := newClock()
+	l := New(NewMemory(), "login:", testPolicy)
+
+	fill(t, l, "ada", c, testPolicy.LockoutAfter)
+
+	// Attempts are forgotten a Window after the last one, so the count
+	// starts again
+	c.advance(testPolicy.Window + time.Second)
+	for i := 0; i < testPolicy.Free; i++ {
+		attempt(t, l, "ada", c.now, 0)
+	}
+}
+
+func TestLimiterRefund(t *testing.T) {
+	ctx := context.Background()
+	c := newClock()
+	l := New(NewMemory(), "login:", testPolicy)
+
+	for i := 0; i < testPolicy.Free; i++ {
+		attempt(t, l, "ada", c.now, 0)
+	}
+	if err := l.Refund(ctx, "ada"); err != nil {
+		t.Fatal(err)
+	}
+	attempt(t, l, "ada", c.now, 0)
+	attempt(t, l, "ada", c.now, time.Second)
+
+	// Refunding a key with no attempts does nothing
+	if err := l.Refund(ctx, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	attempt(t, l, "bob", c.now, 0)
+}
+
+func TestLimiterReset(t *testing.T) {
+	ctx := context.Background()
+	c := newClock()
+	store := NewMemory()
+	byEmail := New(store, "login:email:", testPolicy)
+	byIP := New(store, "login:ip:", testPolicy)
+
+	fill(t, byEmail, "ada", c, testPolicy.LockoutAfter)
+	for i := 0; i < testPolicy.LockoutAfter; i++ {
+		// At the same time, so only the first Free are counted
+		byIP.Attempt(ctx, "ada", c.now)
+	}
+	if err := byEmail.Reset(ctx, "ada"); err != nil {
+		t.Fatal(err)
+	}
+
+	attempt(t, byEmail, "ada", c.now, 0)
+	// The same key under another prefix is kept
+	attempt(t, byIP, "ada", c.now, time.Second)
+}
+
+// Attempts made at once can't all get past the check before any is counted.
+func TestLimiterConcurrentAttempts(t *testing.T) {
+	c := newClock()
+	l := New(NewMemory(), "login:", testPolicy)
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if wait, err := l.Attempt(context.Background(), "ada", c.now); err == nil && wait == 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := int(allowed.Load()); got != testPolicy.Free {
+		t.Errorf("%d attempts allowed, want %d", got, testPolicy.Free)
+	}
+}
+
+func TestMemoryExpiry(t *testing.T) {
+	ctx := context.Background()
+	c := newClock()
+	m := NewMemory()
+	policy := Policy{Free: 10, BaseDelay: time.Second, MaxDelay: time.Second, LockoutAfter: 20, Lockout: time.Minute, Window: time.Minute}
+
+	m.Attempt(ctx, "k", c.now, policy)
+	c.advance(30 * time.Second)
+	m.Attempt(ctx, "k", c.now, policy)
+	if e := m.entries["k"]; e.Count != 2 || !e.Last.Equal(c.now) {
+		t.Errorf("entry = %+v, want 2 attempts, the last now", e.Attempts)
+	}
+
+	// The window runs from the last attempt
+	c.advance(time.Minute)
+	m.Attempt(ctx, "k", c.now, policy)
+	if e := m.entries["k"]; e.Count != 3 {
+		t.Errorf("attempts at the window's end = %d, want 3", e.Count)
+	}
+	c.advance(time.Minute + time.Second)
+	m.Attempt(ctx, "k", c.now, policy)
+	if e := m.entries["k"]; e.Count != 1 {
+		t.Errorf("attempts after the window = %d, want 1", e.Count)
+	}
+}
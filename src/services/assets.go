@@ -1,12 +1,8 @@
 package services
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"html/template"
-	"net/http"
-	"os"
 	"regexp"
 	"strings"
 
@@ -15,7 +11,9 @@ import (
 
 var assetPattern = regexp.MustCompile(`asset://([a-zA-Z0-9/_\-\.]+)(?:\|([0-9]+x[0-9]+|[0-9]{1,3}%|))?(?:\|([a-z]+))?`)
 
-func ResolveAssetsInContent(content string, assets []models.Asset, accessToken string) string {
+// ResolveAssetsInContent replaces asset://id|size|align references to the
+// card's images with <img> tags, loading each from the link urlFor gives.
+func ResolveAssetsInContent(content string, assets []models.Asset, urlFor func(path string) (string, error)) string {
 	return assetPattern.ReplaceAllStringFunc(content, func(m string) string {
 		match := assetPattern.FindStringSubmatch(m)
 		if len(match) < 2 {
@@ -34,7 +32,7 @@ func ResolveAssetsInContent(content string, assets []models.Asset, accessToken s
 
 		for _, asset := range assets {
 			if asset.ID == assetID && asset.Type == "image" {
-				signedURL, err := GenerateSignedURL(accessToken, assetID)
+				signedURL, err := urlFor(assetID)
 				if err != nil {
 					return `<em>Image unavailable</em>`
 				}
@@ -72,45 +70,3 @@ func ResolveAssetsInContent(content string, assets []models.Asset, accessToken s
 		return m
 	})
 }
-
-func GenerateSignedURL(accessToken, path string) (string, error) {
-	apiURL := fmt.Sprintf(
-		"%s/storage/v1/object/sign/flashcard-assets/%s",
-		os.Getenv("NEXT_PUBLIC_SUPABASE_URL"),
-		path,
-	)
-
-	expiry := 3600 // URL valid for 1 hour
-
-	body := map[string]interface{}{
-		"expiresIn": expiry,
-	}
-	jsonBody, _ := json.Marshal(body)
-
-	req, err := http.NewRequest("POST", apiURL, bytes.NewReader(jsonBody))
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("apikey", os.Getenv("NEXT_PUBLIC_SUPABASE_ANON_KEY"))
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("failed to generate signed URL: status %d", resp.StatusCode)
-	}
-
-	var result struct {
-		SignedURL string `json:"signedURL"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
-	}
-
-	return os.Getenv("NEXT_PUBLIC_SUPABASE_URL") + "/storage/v1" + result.SignedURL, nil
-}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/utils"
+)
+
+// ResolveAssignmentCards picks the official cards for a deck: those carrying
+// every one of the tags (if any are given), plus the listed card IDs. Unknown
+// or unofficial card IDs are an error.
+func ResolveAssignmentCards(allCards map[string]models.Flashcard, tags, cardIDs []string) ([]string, error) {
+	selected := map[string]bool{}
+	if len(tags) > 0 {
+		for id, card := range allCards {
+			if card.CreatedBy != "" {
+				continue
+			}
+			has := map[string]bool{}
+			for _, tag := range card.Tags {
+				has[tag.Name] = true
+			}
+			matches := true
+			for _, t := range tags {
+				matches = matches && has[t]
+			}
+			if matches {
+				selected[id] = true
+			}
+		}
+	}
+	for _, id := range cardIDs {
+		card, ok := allCards[id]
+		if !ok || card.CreatedBy != "" {
+			return nil, fmt.Errorf("unknown card %q", id)
+		}
+		selected[id] = true
+	}
+
+	ids := make([]string, 0, len(selected))
+	for id := range selected {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// AssignmentPlan is what a student's assignments mean for today's study.
+type AssignmentPlan struct {
+	Today        string            // current study day
+	LearnBy      map[string]string // note ID -> earliest learn-by day, for notes with a deadline
+	Unlearnt     map[string]bool   // note IDs with a deadline that still have new cards
+	NewCardQuota int               // new cards to introduce today to meet every deadline
+}
+
+// Overdue reports whether the card belongs to an assignment whose learn-by
+// day has passed while its note still has cards to introduce. Once they are
+// all introduced the note is studied like any other.
+func (p AssignmentPlan) Overdue(cardID string) bool {
+	noteID := models.NoteID(cardID)
+	day, ok := p.LearnBy[noteID]
+	return ok && day < p.Today && p.Unlearnt[noteID]
+}
+
+// PlanAssignments works out the deadlines for the student's cards and how
+// many new cards a day are needed to meet them. introducedToday holds the
+// cards first answered today, so the quota stays put as they are learnt.
+//
+// The quota is the smallest steady rate that meets every deadline: for each
+// deadline, the new cards due by then divided by the study days left (today
+// included). Overdue cards all count towards today.
+func PlanAssignments(assignments []models.Assignment, cards []models.StudentCard, introducedToday map[string]bool, now int64, rolloverHour int, profile *SchedulingProfile) AssignmentPlan {
+	plan := AssignmentPlan{
+		Today:    utils.StudyDay(now, rolloverHour),
+		LearnBy:  map[string]string{},
+		Unlearnt: map[string]bool{},
+	}
+
+	for _, a := range assignments {
+		if a.LearnBy == "" {
+			continue
+		}
+		for _, id := range a.CardIDs {
+			if day, ok := plan.LearnBy[id]; !ok || a.LearnBy < day {
+				plan.LearnBy[id] = a.LearnBy
+			}
+		}
+	}
+
+	// New cards still to introduce, counted by deadline
+	remaining := map[string]int{}
+	for _, c := range cards {
+		day, ok := plan.LearnBy[models.NoteID(c.CardID)]
+		if !ok || c.Suspended {
+			continue
+		}
+		if profile.IsNew(c.Status) {
+			plan.Unlearnt[models.NoteID(c.CardID)] = true
+		}
+		if profile.IsNew(c.Status) || introducedToday[c.CardID] {
+			remaining[max(day, plan.Today)]++
+		}
+	}
+
+	days := make([]string, 0, len(remaining))
+	for day := range remaining {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	today := studyDate(now, rolloverHour)
+	total := 0
+	for _, day := range days {
+		total += remaining[day]
+		deadline := today
+		if d, err := time.Parse("2006-01-02", day); err == nil {
+			deadline = d
+		}
+		daysLeft := int(deadline.Sub(today).Hours()/24) + 1
+		plan.NewCardQuota = max(plan.NewCardQuota, (total+daysLeft-1)/daysLeft)
+	}
+	return plan
+}
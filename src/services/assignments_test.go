@@ -0,0 +1,47 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abstract-tutoring/models"
+)
+
+func TestAssignmentPlanOverdue(t *testing.T) {
+	now := time.Date(2030, 1, 10, 12, 0, 0, 0, time.UTC).Unix()
+	assignments := []models.Assignment{
+		{LearnBy: "2030-01-09", CardIDs: []string{"late", "learnt", "capital"}},
+		{LearnBy: "2030-01-20", CardIDs: []string{"ahead"}},
+		{CardIDs: []string{"open"}},
+	}
+	cards := []models.StudentCard{
+		{CardID: "late", Status: 0},
+		{CardID: "learnt", Status: 5},
+		{CardID: "capital", Status: 5},
+		{CardID: "capital#1", Status: 0},
+		{CardID: "ahead", Status: 0},
+		{CardID: "open", Status: 0},
+	}
+	plan := PlanAssignments(assignments, cards, nil, now, 4, DefaultSchedulingProfile())
+
+	for cardID, want := range map[string]bool{
+		"late":      true,
+		"learnt":    false, // every card introduced, so it waits its turn
+		"capital":   true,  // the reversed card is still new
+		"capital#1": true,
+		"ahead":     false,
+		"open":      false,
+		"unknown":   false,
+	} {
+		if got := plan.Overdue(cardID); got != want {
+			t.Errorf("Overdue(%q) = %v, want %v", cardID, got, want)
+		}
+	}
+
+	// Introducing the last new card ends the note's priority
+	cards[3].Status = 1
+	plan = PlanAssignments(assignments, cards, map[string]bool{"capital#1": true}, now, 4, DefaultSchedulingProfile())
+	if plan.Overdue("capital") || plan.Overdue("capital#1") {
+		t.Error("capital still overdue with all its cards introduced")
+	}
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Cloze deletions are written {{c1::answer}} or {{c1::answer::hint}}, and
+// each number makes its own card. Braces in the answer are matched, so LaTeX
+// such as {{c1::\frac{1}{2}}} works, and a deletion inside $...$, $$...$$,
+// \(...\) or \[...\] is rendered as LaTeX for MathJax. Deletions can be
+// nested: {{c1::a {{c2::b}}}} blanks all of "a b" on card 1 and just "b" on
+// card 2.
+
+var clozeOpening = regexp.MustCompile(`^\{\{c([0-9]+)::`)
+
+type clozeDeletion struct {
+	start, end int // content[start:end] is the whole {{cN::...}}
+	ord        int
+	answer     string
+	hint       string
+	inMath     bool
+}
+
+// ClozeOrds returns the deletion numbers used in content, in order.
+func ClozeOrds(content string) []int {
+	seen := map[int]bool{}
+	var ords []int
+	var collect func(content string)
+	collect = func(content string) {
+		for _, d := range parseCloze(content, false) {
+			if !seen[d.ord] {
+				seen[d.ord] = true
+				ords = append(ords, d.ord)
+			}
+			collect(d.answer)
+		}
+	}
+	collect(content)
+	sort.Ints(ords)
+	return ords
+}
+
+// RenderCloze blanks the deletions numbered ord, showing their hints, or
+// reveals them highlighted. Other deletions just show their answers.
+func RenderCloze(content string, ord int, reveal bool) string {
+	return renderCloze(content, ord, reveal, false)
+}
+
+func renderCloze(content string, ord int, reveal, inMath bool) string {
+	var b strings.Builder
+	last := 0
+	for _, d := range parseCloze(content, inMath) {
+		b.WriteString(content[last:d.start])
+		b.WriteString(d.render(ord, reveal))
+		last = d.end
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
+
+func (d clozeDeletion) render(ord int, reveal bool) string {
+	if d.ord != ord {
+		return renderCloze(d.answer, ord, reveal, d.inMath)
+	}
+	// Deletions nested in this one are part of its answer. Ord 0 is never
+	// a deletion's, so they show their answers.
+	answer := renderCloze(d.answer, 0, false, d.inMath)
+	if d.inMath {
+		if reveal {
+			return `\textcolor{royalblue}{` + answer + `}`
+		}
+		blank := `\ldots`
+		if d.hint != "" {
+			blank = `\text{` + d.hint + `}`
+		}
+		return `\textcolor{royalblue}{[` + blank + `]}`
+	}
+	if reveal {
+		return `<span class="font-bold text-blue-600">` + answer + `</span>`
+	}
+	blank := "…"
+	if d.hint != "" {
+		blank = d.hint
+	}
+	return `<span class="font-bold text-blue-600">[` + blank + `]</span>`
+}
+
+// parseCloze finds the deletions in content, noting which are inside maths.
+// inMath says content is itself inside maths, as a nested deletion's answer
+// can be. Deletions nested in those found are left in their answers.
+func parseCloze(content string, inMath bool) []clozeDeletion {
+	var deletions []clozeDeletion
+	mathEnd := "" // the delimiter that closes the maths we are in, if any
+	for i := 0; i < len(content); {
+		if d, ok := parseDeletion(content, i); ok {
+			d.inMath = inMath || mathEnd != ""
+			deletions = append(deletions, d)
+			i = d.end
+			continue
+		}
+
+		rest := content[i:]
+		switch {
+		case mathEnd != "" && strings.HasPrefix(rest, mathEnd):
+			i += len(mathEnd)
+			mathEnd = ""
+		case mathEnd == "" && strings.HasPrefix(rest, "$$"):
+			mathEnd = "$$"
+			i += 2
+		case mathEnd == "" && strings.HasPrefix(rest, `\(`):
+			mathEnd = `\)`
+			i += 2
+		case mathEnd == "" && strings.HasPrefix(rest, `\[`):
+			mathEnd = `\]`
+			i += 2
+		case mathEnd == "" && rest[0] == '$':
+			mathEnd = "$"
+			i++
+		case rest[0] == '\\' && len(rest) > 1:
+			i += 2 // an escaped character, such as \$
+		default:
+			i++
+		}
+	}
+	return deletions
+}
+
+// parseDeletion reads the deletion starting at content[start], if there is
+// one. The answer runs to the first "}}" outside any braces it opens, and
+// the hint starts at the first "::" outside braces.
+func parseDeletion(content string, start int) (clozeDeletion, bool) {
+	if !strings.HasPrefix(content[start:], "{{c") {
+		return clozeDeletion{}, false
+	}
+	m := clozeOpening.FindStringSubmatch(content[start:])
+	if m == nil {
+		return clozeDeletion{}, false
+	}
+	ord, err := strconv.Atoi(m[1])
+	if err != nil || ord < 1 {
+		return clozeDeletion{}, false
+	}
+
+	body := start + len(m[0])
+	depth, hintAt := 0, -1
+	for i := body; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++ // escaped, so never a brace or separator
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if !strings.HasPrefix(content[i:], "}}") {
+				continue
+			}
+			d := clozeDeletion{start: start, end: i + 2, ord: ord, answer: content[body:i]}
+			if hintAt >= 0 {
+				d.answer, d.hint = content[body:hintAt], content[hintAt+2:i]
+			}
+			return d, true
+		case ':':
+			if depth == 0 && hintAt < 0 && strings.HasPrefix(content[i:], "::") {
+				hintAt = i
+				i++
+			}
+		}
+	}
+	return clozeDeletion{}, false
+}
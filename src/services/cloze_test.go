@@ -0,0 +1,94 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCloze(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []clozeDeletion
+	}{
+		{"none", "No deletions {here}", nil},
+		{"one", "Paris is in {{c1::France}}.",
+			[]clozeDeletion{{start: 12, end: 26, ord: 1, answer: "France"}}},
+		{"hint", "{{c2::Paris::capital}}",
+			[]clozeDeletion{{start: 0, end: 22, ord: 2, answer: "Paris", hint: "capital"}}},
+		{"hint with ::", "{{c1::a::b::c}}",
+			[]clozeDeletion{{start: 0, end: 15, ord: 1, answer: "a", hint: "b::c"}}},
+		{"repeated", "{{c1::a}} and {{c1::b}}",
+			[]clozeDeletion{{start: 0, end: 9, ord: 1, answer: "a"}, {start: 14, end: 23, ord: 1, answer: "b"}}},
+		{"nested", "{{c1::a {{c2::b}} c}}",
+			[]clozeDeletion{{start: 0, end: 21, ord: 1, answer: "a {{c2::b}} c"}}},
+		{"nested with hints", "{{c1::a {{c2::b::x}}::y}}",
+			[]clozeDeletion{{start: 0, end: 25, ord: 1, answer: "a {{c2::b::x}}", hint: "y"}}},
+		{"braces in answer", `{{c1::\frac{1}{2}}}`,
+			[]clozeDeletion{{start: 0, end: 19, ord: 1, answer: `\frac{1}{2}`}}},
+		{"in maths", "$x = {{c1::2}}$ and {{c2::y}}",
+			[]clozeDeletion{{start: 5, end: 14, ord: 1, answer: "2", inMath: true}, {start: 20, end: 29, ord: 2, answer: "y"}}},
+		{"escaped dollar", `\$5 is {{c1::cheap}}`,
+			[]clozeDeletion{{start: 7, end: 20, ord: 1, answer: "cheap"}}},
+		{"unclosed", "{{c1::open", nil},
+		{"ord 0", "{{c0::zero}}", nil},
+		{"no number", "{{c::x}}", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCloze(tt.content, false); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCloze(%q) = %+v, want %+v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClozeOrds(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []int
+	}{
+		{"plain", nil},
+		{"{{c2::b}} {{c1::a}}", []int{1, 2}},
+		{"{{c1::a}} {{c1::b}}", []int{1}},
+		{"{{c1::a {{c3::b {{c2::c}}}}}}", []int{1, 2, 3}},
+		{"{{c1::a::hint}} {{c10::b}}", []int{1, 10}},
+	}
+	for _, tt := range tests {
+		if got := ClozeOrds(tt.content); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ClozeOrds(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestRenderCloze(t *testing.T) {
+	const (
+		open  = `<span class="font-bold text-blue-600">`
+		close = `</span>`
+	)
+	tests := []struct {
+		name    string
+		content string
+		ord     int
+		reveal  bool
+		want    string
+	}{
+		{"blank", "{{c1::a}} {{c2::b}}", 1, false, open + "[…]" + close + " b"},
+		{"reveal", "{{c1::a}} {{c2::b}}", 1, true, open + "a" + close + " b"},
+		{"hint", "{{c1::a::letter}}", 1, false, open + "[letter]" + close},
+		{"repeated", "{{c1::a}} {{c1::b}}", 1, false, open + "[…]" + close + " " + open + "[…]" + close},
+		{"nested outer", "{{c1::a {{c2::b}}}}", 1, false, open + "[…]" + close},
+		{"nested outer revealed", "{{c1::a {{c2::b}}}}", 1, true, open + "a b" + close},
+		{"nested inner", "{{c1::a {{c2::b}}}}", 2, false, "a " + open + "[…]" + close},
+		{"nested inner revealed", "{{c1::a {{c2::b::hint}}}}", 2, true, "a " + open + "b" + close},
+		{"maths", "$x = {{c1::2::n}}$", 1, false, `$x = \textcolor{royalblue}{[\text{n}]}$`},
+		{"nested in maths", "${{c1::x {{c2::y}}}}$", 2, true, `$x \textcolor{royalblue}{y}$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderCloze(tt.content, tt.ord, tt.reveal); got != tt.want {
+				t.Errorf("RenderCloze(%q, %d, %v) = %q, want %q", tt.content, tt.ord, tt.reveal, got, tt.want)
+			}
+		})
+	}
+}
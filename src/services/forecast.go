@@ -0,0 +1,64 @@
+package services
+
+import (
+	"time"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/utils"
+)
+
+// ForecastDay is the number of cards that fall due on one study day.
+type ForecastDay struct {
+	Date     string `json:"date"` // YYYY-MM-DD, UK study day
+	Review   int    `json:"review"`
+	Learning int    `json:"learning"`
+}
+
+func (d ForecastDay) Total() int {
+	return d.Review + d.Learning
+}
+
+// Forecast buckets the student's started cards by the study day they fall due
+// on, for the given number of days starting today. Overdue cards count towards
+// today. New, suspended and out-of-range cards are left out; buried cards are
+// counted on the day they come back.
+func Forecast(cards []models.StudentCard, now int64, days, rolloverHour int, profile *SchedulingProfile) []ForecastDay {
+	if days < 1 {
+		return nil
+	}
+
+	today := studyDate(now, rolloverHour)
+	forecast := make([]ForecastDay, days)
+	for i := range forecast {
+		forecast[i].Date = today.AddDate(0, 0, i).Format("2006-01-02")
+	}
+
+	for _, c := range cards {
+		if c.Suspended || profile.IsNew(c.Status) {
+			continue
+		}
+
+		due := max(c.Due, c.BuriedUntil)
+		index := 0
+		if due > now {
+			index = int(studyDate(due, rolloverHour).Sub(today).Hours() / 24)
+		}
+		if index >= days {
+			continue
+		}
+
+		if profile.IsLearning(c.Status) {
+			forecast[index].Learning++
+		} else {
+			forecast[index].Review++
+		}
+	}
+	return forecast
+}
+
+// studyDate is the study day containing unixSeconds as a UTC midnight, so
+// whole days can be counted without DST getting in the way.
+func studyDate(unixSeconds int64, rolloverHour int) time.Time {
+	t, _ := time.Parse("2006-01-02", utils.StudyDay(unixSeconds, rolloverHour))
+	return t
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abstract-tutoring/models"
+)
+
+func TestForecast(t *testing.T) {
+	at := func(value string) int64 {
+		tm, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm.Unix()
+	}
+	winter := at("2030-01-10T12:00:00Z")
+	summer := at("2030-07-10T12:00:00Z") // 13:00 BST
+
+	tests := []struct {
+		name     string
+		now      int64
+		card     models.StudentCard
+		review   []int // per day, from today
+		learning []int
+	}{
+		{"overdue counts today", winter,
+			models.StudentCard{Status: 5, Due: at("2030-01-01T09:00:00Z")}, []int{1, 0, 0}, []int{0, 0, 0}},
+		{"learning card", winter,
+			models.StudentCard{Status: 2, Due: at("2030-01-10T12:10:00Z")}, []int{0, 0, 0}, []int{1, 0, 0}},
+		{"before the rollover is still today", winter,
+			models.StudentCard{Status: 5, Due: at("2030-01-11T03:59:00Z")}, []int{1, 0, 0}, []int{0, 0, 0}},
+		{"from the rollover is tomorrow", winter,
+			models.StudentCard{Status: 5, Due: at("2030-01-11T04:00:00Z")}, []int{0, 1, 0}, []int{0, 0, 0}},
+		{"rollover in UK summer time", summer,
+			models.StudentCard{Status: 5, Due: at("2030-07-11T02:59:00Z")}, []int{1, 0, 0}, []int{0, 0, 0}},
+		{"after the rollover in UK summer time", summer,
+			models.StudentCard{Status: 5, Due: at("2030-07-11T03:00:00Z")}, []int{0, 1, 0}, []int{0, 0, 0}},
+		{"beyond the range", winter,
+			models.StudentCard{Status: 5, Due: at("2030-01-13T12:00:00Z")}, []int{0, 0, 0}, []int{0, 0, 0}},
+		{"new", winter,
+			models.StudentCard{Status: 0, Due: at("2030-01-10T09:00:00Z")}, []int{0, 0, 0}, []int{0, 0, 0}},
+		{"suspended", winter,
+			models.StudentCard{Status: 5, Due: at("2030-01-10T09:00:00Z"), Suspended: true}, []int{0, 0, 0}, []int{0, 0, 0}},
+		{"buried counts when it comes back", winter,
+			models.StudentCard{Status: 5, Due: at("2030-01-10T09:00:00Z"), BuriedUntil: at("2030-01-12T04:00:00Z")},
+			[]int{0, 0, 1}, []int{0, 0, 0}},
+		{"buried past the range", winter,
+			models.StudentCard{Status: 2, Due: at("2030-01-10T09:00:00Z"), BuriedUntil: at("2030-01-14T04:00:00Z")},
+			[]int{0, 0, 0}, []int{0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forecast := Forecast([]models.StudentCard{tt.card}, tt.now, 3, 4, DefaultSchedulingProfile())
+			if len(forecast) != 3 {
+				t.Fatalf("forecast has %d days, want 3", len(forecast))
+			}
+			var review, learning []int
+			for _, day := range forecast {
+				review = append(review, day.Review)
+				learning = append(learning, day.Learning)
+			}
+			if !reflect.DeepEqual(review, tt.review) || !reflect.DeepEqual(learning, tt.learning) {
+				t.Errorf("review %v, learning %v; want %v, %v", review, learning, tt.review, tt.learning)
+			}
+		})
+	}
+}
+
+func TestForecastDates(t *testing.T) {
+	// 02:00 on the 10th is still the 9th's study day
+	now := time.Date(2030, 1, 10, 2, 0, 0, 0, time.UTC).Unix()
+	forecast := Forecast(nil, now, 3, 4, DefaultSchedulingProfile())
+	var dates []string
+	for _, day := range forecast {
+		dates = append(dates, day.Date)
+	}
+	if want := []string{"2030-01-09", "2030-01-10", "2030-01-11"}; !reflect.DeepEqual(dates, want) {
+		t.Errorf("dates = %v, want %v", dates, want)
+	}
+	if forecast := Forecast(nil, now, 0, 4, DefaultSchedulingProfile()); forecast != nil {
+		t.Errorf("Forecast for no days = %v, want nil", forecast)
+	}
+}
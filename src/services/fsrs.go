@@ -0,0 +1,251 @@
+package services
+
+import (
+	"math"
+
+	"github.com/abstract-tutoring/models"
+)
+
+// Default FSRS-5 parameters.
+var DefaultFSRSWeights = [19]float64{
+	0.40255, 1.18385, 3.173, 15.69105, 7.1949,
+	0.5345, 1.4604, 0.0046, 1.54575, 0.1192,
+	1.01925, 1.9395, 0.11, 0.29605, 2.2698,
+	0.2315, 2.9898, 0.51655, 0.6621,
+}
+
+const (
+	fsrsDecay        = -0.5
+	fsrsFactor       = 19.0 / 81.0
+	fsrsMinStability = 0.01
+)
+
+// FSRSScheduler implements the Free Spaced Repetition Scheduler (FSRS-5).
+//
+// Statuses are described by fsrsProfile: 0 is new, 1-2 are the learning
+// steps, 3 is relearning after a lapse and 4-6 are review cards, banded by
+// interval (under a week, under a month, longer).
+type FSRSScheduler struct {
+	Weights          [19]float64
+	DesiredRetention float64
+	MaximumInterval  int     // days
+	LearningSteps    []int64 // seconds, at most two (statuses 1 and 2)
+	RelearningSteps  []int64 // seconds, only the first is used (status 3)
+	DueOffset        int64   // seconds taken off review intervals, as the ladder does
+}
+
+func NewFSRSScheduler() *FSRSScheduler {
+	return &FSRSScheduler{
+		Weights:          DefaultFSRSWeights,
+		DesiredRetention: 0.9,
+		MaximumInterval:  36500,
+		LearningSteps:    []int64{1 * 60, 10 * 60},
+		RelearningSteps:  []int64{10 * 60},
+		DueOffset:        4 * 3600,
+	}
+}
+
+// fsrsProfile lays out FSRS's statuses as a profile so they are told apart
+// like a ladder's: the relearning status counts as a third learning step and
+// each interval band as a review level. Its durations are the default steps
+// and band limits; FSRS never schedules from them.
+var fsrsProfile = mustCompileProfile(&SchedulingProfile{
+	Name:               "fsrs",
+	LearningSteps:      []Duration{1 * 60, 10 * 60, 10 * 60},
+	GraduatingInterval: 1 * 86400,
+	EasyInterval:       1 * 86400,
+	ReviewLevels: []ReviewLevel{
+		{Good: 1 * 86400, Easy: 7 * 86400},
+		{Good: 7 * 86400, Easy: 30 * 86400},
+		{Good: 30 * 86400, Easy: 30 * 86400},
+	},
+	DueOffset: 4 * 3600,
+})
+
+func (f *FSRSScheduler) Profile() *SchedulingProfile {
+	return fsrsProfile
+}
+
+func (f *FSRSScheduler) Next(card models.StudentCard, rating int, now int64) (models.StudentCard, error) {
+	if rating < RatingAgain || rating > RatingEasy {
+		return card, ErrInvalidTransition
+	}
+	// Statuses above 6 come from a ladder with more review levels; they are
+	// review cards here too and land back in the 4-6 bands
+	if card.Status < 0 {
+		return card, ErrInvalidTransition
+	}
+
+	if card.Status == 0 {
+		card.Stability = f.initStability(rating)
+		card.Difficulty = f.initDifficulty(rating)
+	} else {
+		if card.Stability <= 0 {
+			// Scheduled before FSRS was switched on: seed a memory state.
+			card = f.seed(card, now)
+		}
+
+		elapsed := float64(now-card.LastReview) / 86400
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		r := f.retrievability(elapsed, card.Stability)
+
+		switch {
+		case elapsed < 1:
+			card.Stability = f.shortTermStability(card.Stability, rating)
+		case rating == RatingAgain:
+			card.Stability = f.forgetStability(card.Difficulty, card.Stability, r)
+		default:
+			card.Stability = f.recallStability(card.Difficulty, card.Stability, r, rating)
+		}
+		card.Difficulty = f.nextDifficulty(card.Difficulty, rating)
+	}
+	card.LastReview = now
+
+	switch card.Status {
+	case 0:
+		return f.step(card, rating, 0, f.LearningSteps, 1, now), nil
+	case 1, 2:
+		return f.step(card, rating, card.Status-1, f.LearningSteps, 1, now), nil
+	case 3:
+		return f.step(card, rating, 0, f.RelearningSteps[:min(1, len(f.RelearningSteps))], 3, now), nil
+	default:
+		if rating == RatingAgain && len(f.RelearningSteps) > 0 {
+			card.Status = 3
+			card.Due = now + f.RelearningSteps[0]
+			return card, nil
+		}
+		return f.review(card, now), nil
+	}
+}
+
+// step moves a card through short-term (re)learning steps. base is the
+// status used for the first step.
+func (f *FSRSScheduler) step(card models.StudentCard, rating, step int, steps []int64, base int, now int64) models.StudentCard {
+	if len(steps) == 0 {
+		return f.review(card, now)
+	}
+	if step >= len(steps) {
+		step = len(steps) - 1
+	}
+
+	switch rating {
+	case RatingAgain:
+		card.Status = base
+		card.Due = now + steps[0]
+	case RatingHard:
+		delay := steps[step]
+		if step == 0 && len(steps) > 1 {
+			delay = (steps[0] + steps[1]) / 2
+		} else if step == 0 {
+			delay = steps[0] * 3 / 2
+		}
+		card.Status = base + step
+		card.Due = now + delay
+	case RatingGood:
+		if step+1 >= len(steps) {
+			return f.review(card, now)
+		}
+		card.Status = base + step + 1
+		card.Due = now + steps[step+1]
+	default:
+		return f.review(card, now)
+	}
+	return card
+}
+
+func (f *FSRSScheduler) review(card models.StudentCard, now int64) models.StudentCard {
+	days := f.nextInterval(card.Stability)
+
+	switch {
+	case days < 7:
+		card.Status = 4
+	case days < 30:
+		card.Status = 5
+	default:
+		card.Status = 6
+	}
+	card.Due = now + int64(days)*86400 - f.DueOffset
+	return card
+}
+
+func (f *FSRSScheduler) seed(card models.StudentCard, now int64) models.StudentCard {
+	card.Difficulty = f.initDifficulty(RatingGood)
+	card.Stability = f.Weights[2]
+	if card.LastReview > 0 && card.Due > card.LastReview {
+		card.Stability = math.Max(card.Stability, float64(card.Due-card.LastReview)/86400)
+	}
+	if card.LastReview <= 0 {
+		card.LastReview = now - int64(card.Stability*86400)
+	}
+	return card
+}
+
+func (f *FSRSScheduler) retrievability(elapsedDays, stability float64) float64 {
+	return math.Pow(1+fsrsFactor*elapsedDays/stability, fsrsDecay)
+}
+
+func (f *FSRSScheduler) nextInterval(stability float64) int {
+	days := stability / fsrsFactor * (math.Pow(f.DesiredRetention, 1/fsrsDecay) - 1)
+	interval := int(math.Round(days))
+	if interval < 1 {
+		interval = 1
+	}
+	if f.MaximumInterval > 0 && interval > f.MaximumInterval {
+		interval = f.MaximumInterval
+	}
+	return interval
+}
+
+func (f *FSRSScheduler) initStability(rating int) float64 {
+	return math.Max(f.Weights[rating-1], fsrsMinStability)
+}
+
+func (f *FSRSScheduler) initDifficulty(rating int) float64 {
+	w := f.Weights
+	return clampDifficulty(w[4] - math.Exp(w[5]*float64(rating-1)) + 1)
+}
+
+func (f *FSRSScheduler) nextDifficulty(difficulty float64, rating int) float64 {
+	w := f.Weights
+	delta := -w[6] * float64(rating-3)
+	damped := difficulty + delta*(10-difficulty)/9
+	// mean reversion towards the initial difficulty of an "Easy" first answer
+	return clampDifficulty(w[7]*f.initDifficulty(RatingEasy) + (1-w[7])*damped)
+}
+
+func (f *FSRSScheduler) shortTermStability(stability float64, rating int) float64 {
+	w := f.Weights
+	increase := math.Exp(w[17] * (float64(rating) - 3 + w[18]))
+	if rating >= RatingGood {
+		increase = math.Max(increase, 1)
+	}
+	return math.Max(stability*increase, fsrsMinStability)
+}
+
+func (f *FSRSScheduler) recallStability(difficulty, stability, r float64, rating int) float64 {
+	w := f.Weights
+	hardPenalty := 1.0
+	if rating == RatingHard {
+		hardPenalty = w[15]
+	}
+	easyBonus := 1.0
+	if rating == RatingEasy {
+		easyBonus = w[16]
+	}
+	growth := math.Exp(w[8]) * (11 - difficulty) * math.Pow(stability, -w[9]) *
+		(math.Exp(w[10]*(1-r)) - 1) * hardPenalty * easyBonus
+	return math.Max(stability*(1+growth), fsrsMinStability)
+}
+
+func (f *FSRSScheduler) forgetStability(difficulty, stability, r float64) float64 {
+	w := f.Weights
+	long := w[11] * math.Pow(difficulty, -w[12]) * (math.Pow(stability+1, w[13]) - 1) * math.Exp(w[14]*(1-r))
+	short := stability / math.Exp(w[17]*w[18])
+	return math.Max(math.Min(long, short), fsrsMinStability)
+}
+
+func clampDifficulty(d float64) float64 {
+	return math.Min(math.Max(d, 1), 10)
+}
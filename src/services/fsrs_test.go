@@ -0,0 +1,216 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"github.com/abstract-tutoring/models"
+)
+
+const (
+	fsrsTestNow = 1_700_000_000
+	day         = 86400
+)
+
+// The expected values come from the FSRS-5 formulas with the default
+// weights, worked out separately. A review interval at 90% retention is
+// the stability rounded to whole days.
+func TestFSRSNext(t *testing.T) {
+	f := NewFSRSScheduler()
+	offset := f.DueOffset
+
+	tests := []struct {
+		name       string
+		card       models.StudentCard
+		rating     int
+		stability  float64
+		difficulty float64
+		status     int
+		due        int64 // seconds after now
+	}{
+		// New cards start from the weights; Easy skips the learning steps
+		{"new again", models.StudentCard{}, RatingAgain, 0.40255, 7.1949, 1, 60},
+		{"new hard", models.StudentCard{}, RatingHard, 1.18385, 6.488305, 1, 330},
+		{"new good", models.StudentCard{}, RatingGood, 3.173, 5.282434, 2, 600},
+		{"new easy", models.StudentCard{}, RatingEasy, 15.69105, 3.224502, 5, 16*day - offset},
+
+		// On the last learning step, ten minutes after a first Good, so the
+		// short-term stability applies
+		{"learning again", learningCard(), RatingAgain, 1.589764, 6.796933, 1, 60},
+		{"learning hard", learningCard(), RatingHard, 2.664817, 6.034950, 2, 600},
+		{"learning good", learningCard(), RatingGood, 4.466858, 5.272968, 4, 4*day - offset},
+		{"learning easy", learningCard(), RatingEasy, 7.487502, 4.510986, 5, 7*day - offset},
+
+		// Reviewed when due, at exactly 90% retrievability
+		{"review again", reviewCard(10, 5, 10), RatingAgain, 2.107696, 6.607035, 3, 600},
+		{"review hard", reviewCard(10, 5, 10), RatingHard, 15.313912, 5.799434, 5, 15*day - offset},
+		{"review good", reviewCard(10, 5, 10), RatingGood, 32.954264, 4.991833, 6, 33*day - offset},
+		{"review easy", reviewCard(10, 5, 10), RatingEasy, 78.628658, 4.184232, 6, 79*day - offset},
+
+		// Reviewed late, so recall counts for more and forgetting for less
+		{"late review again", reviewCard(40, 8, 60), RatingAgain, 4.244527, 8.624114, 3, 600},
+		{"late review hard", reviewCard(40, 8, 60), RatingHard, 52.870530, 8.301073, 6, 53*day - offset},
+		{"late review good", reviewCard(40, 8, 60), RatingGood, 95.596240, 7.978033, 6, 96*day - offset},
+		{"late review easy", reviewCard(40, 8, 60), RatingEasy, 206.221638, 7.654992, 6, 206*day - offset},
+
+		// Relearning after a lapse, on the same day
+		{"relearning again", relearningCard(), RatingAgain, 1.002057, 7.951754, 3, 600},
+		{"relearning hard", relearningCard(), RatingHard, 1.679683, 7.467193, 3, 900},
+		{"relearning good", relearningCard(), RatingGood, 2.815542, 6.982633, 4, 3*day - offset},
+		{"relearning easy", relearningCard(), RatingEasy, 4.719510, 6.498072, 4, 5*day - offset},
+
+		// Scheduled by the ladder before FSRS was switched on
+		{"ladder card good", models.StudentCard{Status: 4, LastReview: fsrsTestNow - 2*day, Due: fsrsTestNow},
+			RatingGood, 8.384375, 5.272968, 5, 8*day - offset},
+		{"ladder card again", models.StudentCard{Status: 4, LastReview: fsrsTestNow - 2*day, Due: fsrsTestNow},
+			RatingAgain, 0.989038, 6.796933, 3, 600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, err := f.Next(tt.card, tt.rating, fsrsTestNow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !near(next.Stability, tt.stability) {
+				t.Errorf("stability = %.6f, want %.6f", next.Stability, tt.stability)
+			}
+			if !near(next.Difficulty, tt.difficulty) {
+				t.Errorf("difficulty = %.6f, want %.6f", next.Difficulty, tt.difficulty)
+			}
+			if next.Status != tt.status || next.Due != fsrsTestNow+tt.due {
+				t.Errorf("status %d due in %ds, want status %d due in %ds", next.Status, next.Due-fsrsTestNow, tt.status, tt.due)
+			}
+			if next.LastReview != fsrsTestNow {
+				t.Errorf("LastReview = %d, want now", next.LastReview)
+			}
+		})
+	}
+}
+
+func learningCard() models.StudentCard {
+	return models.StudentCard{Status: 2, Stability: 3.173, Difficulty: 5.282434, LastReview: fsrsTestNow - 600}
+}
+
+func reviewCard(stability, difficulty float64, elapsedDays int64) models.StudentCard {
+	return models.StudentCard{Status: 5, Stability: stability, Difficulty: difficulty, LastReview: fsrsTestNow - elapsedDays*day}
+}
+
+func relearningCard() models.StudentCard {
+	return models.StudentCard{Status: 3, Stability: 2, Difficulty: 7, LastReview: fsrsTestNow - 864}
+}
+
+func near(got, want float64) bool {
+	return math.Abs(got-want) <= 1e-5*math.Max(1, math.Abs(want))
+}
+
+func TestFSRSRetrievability(t *testing.T) {
+	f := NewFSRSScheduler()
+	tests := []struct {
+		elapsed, stability, want float64
+	}{
+		{0, 10, 1},
+		{10, 10, 0.9}, // stability is the days until 90%
+		{60, 40, 0.860073},
+		{2, 3.173, 0.933377},
+	}
+	for _, tt := range tests {
+		if got := f.retrievability(tt.elapsed, tt.stability); !near(got, tt.want) {
+			t.Errorf("retrievability(%v, %v) = %.6f, want %.6f", tt.elapsed, tt.stability, got, tt.want)
+		}
+	}
+}
+
+func TestFSRSNextInterval(t *testing.T) {
+	f := NewFSRSScheduler()
+	tests := []struct {
+		stability float64
+		retention float64
+		want      int
+	}{
+		{10, 0.9, 10},
+		{10.4, 0.9, 10},
+		{0.2, 0.9, 1}, // at least a day
+		{1e6, 0.9, 36500},
+		{10, 0.8, 24},
+		{10, 0.95, 5},
+	}
+	for _, tt := range tests {
+		f.DesiredRetention = tt.retention
+		if got := f.nextInterval(tt.stability); got != tt.want {
+			t.Errorf("nextInterval(%v) at %v retention = %d, want %d", tt.stability, tt.retention, got, tt.want)
+		}
+	}
+}
+
+func TestFSRSDifficultyStaysInRange(t *testing.T) {
+	f := NewFSRSScheduler()
+	d := f.initDifficulty(RatingAgain)
+	for i := 0; i < 50; i++ {
+		d = f.nextDifficulty(d, RatingAgain)
+	}
+	if d > 10 || d < 9.9 {
+		t.Errorf("difficulty after many Agains = %v, want just under 10", d)
+	}
+	for i := 0; i < 200; i++ {
+		d = f.nextDifficulty(d, RatingEasy)
+	}
+	if d < 1 || d > f.initDifficulty(RatingEasy) {
+		t.Errorf("difficulty after many Easys = %v, want between 1 and %v", d, f.initDifficulty(RatingEasy))
+	}
+}
+
+func TestFSRSInvalid(t *testing.T) {
+	f := NewFSRSScheduler()
+	card := models.StudentCard{Status: 4, Stability: 5, Difficulty: 5, LastReview: fsrsTestNow - day}
+	for _, c := range []struct{ status, rating int }{{4, 0}, {4, 5}, {-1, RatingGood}} {
+		card.Status = c.status
+		if next, err := f.Next(card, c.rating, fsrsTestNow); err != ErrInvalidTransition || next != card {
+			t.Errorf("Next(status %d, rating %d) = %+v, %v; want the card and ErrInvalidTransition", c.status, c.rating, next, err)
+		}
+	}
+}
+
+// A status from a ladder with more levels is a review card.
+func TestFSRSLongerLadderStatus(t *testing.T) {
+	f := NewFSRSScheduler()
+	card := models.StudentCard{Status: 9, Stability: 40, Difficulty: 5, LastReview: fsrsTestNow - 40*day}
+	if next, err := f.Next(card, RatingGood, fsrsTestNow); err != nil || next.Status != 6 {
+		t.Errorf("Next(status 9, Good) = %+v, %v; want a review over a month", next, err)
+	}
+	if next, err := f.Next(card, RatingAgain, fsrsTestNow); err != nil || next.Status != 3 {
+		t.Errorf("Next(status 9, Again) = %+v, %v; want relearning", next, err)
+	}
+}
+
+// The profile tells FSRS's statuses apart, relearning included, and covers
+// every status Next hands out.
+func TestFSRSProfile(t *testing.T) {
+	f := NewFSRSScheduler()
+	p := f.Profile()
+	for status, want := range []string{"new", "learning", "learning", "learning", "review", "review", "review"} {
+		got := "review"
+		if p.IsNew(status) {
+			got = "new"
+		} else if p.IsLearning(status) {
+			got = "learning"
+		} else if !p.IsReview(status) {
+			got = "none"
+		}
+		if got != want {
+			t.Errorf("status %d is %s, want %s", status, got, want)
+		}
+	}
+
+	card := models.StudentCard{}
+	now := int64(fsrsTestNow)
+	for _, rating := range []int{RatingGood, RatingGood, RatingEasy, RatingGood, RatingAgain, RatingHard, RatingGood, RatingEasy} {
+		next, err := f.Next(card, rating, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !p.IsLearning(next.Status) && !p.IsReview(next.Status) || next.Status > len(p.LearningSteps)+len(p.ReviewLevels) {
+			t.Errorf("Next gave status %d, outside the profile", next.Status)
+		}
+		card, now = next, next.Due
+	}
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // decoders for image.Decode
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxImageBytes is the largest image that can be uploaded.
+const MaxImageBytes = 10 << 20
+
+// Images wider or taller than this are scaled down to fit.
+const maxImageSide = 2000
+
+// Images with more pixels than this aren't decoded at all, so a small file
+// can't claim a huge image.
+const maxImagePixels = 50_000_000
+
+var ErrUnsupportedImage = errors.New("images must be JPEG, PNG, GIF or WebP")
+
+// imageTypes are the upload types accepted, by sniffed content type.
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// PrepareImage checks an uploaded image, scales it down if it is very large
+// and encodes it again, which drops EXIF and any other metadata. A JPEG is
+// turned the way its EXIF orientation says first, and stays a JPEG; other
+// images become PNGs, GIFs keeping only their first frame. It returns the
+// new image with its content type and file extension.
+func PrepareImage(data []byte) (out []byte, contentType, ext string, err error) {
+	if len(data) > MaxImageBytes {
+		return nil, "", "", fmt.Errorf("images can be up to %d MB", MaxImageBytes>>20)
+	}
+	sniffed := http.DetectContentType(data)
+	if !imageTypes[sniffed] {
+		return nil, "", "", ErrUnsupportedImage
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", "", ErrUnsupportedImage
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, "", "", fmt.Errorf("images can be up to %d megapixels", maxImagePixels/1_000_000)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", "", ErrUnsupportedImage
+	}
+
+	img = fitImage(img, maxImageSide)
+	var buf bytes.Buffer
+	if sniffed == "image/jpeg" {
+		img = orientImage(img, jpegOrientation(data))
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+		contentType, ext = "image/jpeg", ".jpg"
+	} else {
+		err = png.Encode(&buf, img)
+		contentType, ext = "image/png", ".png"
+	}
+	if err != nil {
+		return nil, "", "", err
+	}
+	return buf.Bytes(), contentType, ext, nil
+}
+
+// fitImage scales img down, keeping its shape, so neither side is longer
+// than maxSide.
+func fitImage(img image.Image, maxSide int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSide && h <= maxSide {
+		return img
+	}
+	if w >= h {
+		w, h = maxSide, max(1, h*maxSide/w)
+	} else {
+		w, h = max(1, w*maxSide/h), maxSide
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// orientImage turns and flips img as EXIF orientation o (2 to 8) says, so
+// it shows the right way up once the EXIF is gone.
+func orientImage(img image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2: // mirror
+				dx, dy = w-1-x, y
+			case 3: // turn half way round
+				dx, dy = w-1-x, h-1-y
+			case 4: // flip
+				dx, dy = x, h-1-y
+			case 5: // mirror across the diagonal
+				dx, dy = y, x
+			case 6: // turn a quarter clockwise
+				dx, dy = h-1-y, x
+			case 7: // mirror across the other diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // turn a quarter anticlockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation of a JPEG, or 1 if it has
+// none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || size < 2 || i+2+size > len(data) {
+			return 1 // the image data starts, or the header is broken
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of EXIF's
+// TIFF structure.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// withOrientation puts an EXIF segment with the orientation tag, and a
+// camera make to be stripped, just after a JPEG's start marker.
+func withOrientation(jpg []byte, orientation uint16) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 2)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112) // orientation
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)      // SHORT
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x010F) // make
+	tiff = binary.LittleEndian.AppendUint16(tiff, 2)      // ASCII
+	tiff = binary.LittleEndian.AppendUint32(tiff, 4)
+	tiff = append(tiff, "Cam\x00"...)
+	tiff = append(tiff, 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func TestPrepareImageJPEG(t *testing.T) {
+	// Wide, with the left half red, as a camera held on its side saves it
+	src := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			c := color.RGBA{0, 0, 255, 255}
+			if x < 20 {
+				c = color.RGBA{255, 0, 0, 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := withOrientation(buf.Bytes(), 6)
+	if jpegOrientation(data) != 6 {
+		t.Fatalf("jpegOrientation = %d, want 6", jpegOrientation(data))
+	}
+
+	out, contentType, ext, err := PrepareImage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "image/jpeg" || ext != ".jpg" {
+		t.Errorf("type = %s %s, want a JPEG", contentType, ext)
+	}
+	if bytes.Contains(out, []byte("Exif")) || bytes.Contains(out, []byte("Cam")) {
+		t.Error("the EXIF data was kept")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Turned a quarter clockwise, so it's tall with red at the top
+	if b := img.Bounds(); b.Dx() != 20 || b.Dy() != 40 {
+		t.Fatalf("size = %dx%d, want 20x40", b.Dx(), b.Dy())
+	}
+	if r, _, _, _ := img.At(10, 5).RGBA(); r < 0xC000 {
+		t.Errorf("top = %v, want red", img.At(10, 5))
+	}
+}
+
+func TestPrepareImageResize(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 3000, 1000))); err != nil {
+		t.Fatal(err)
+	}
+	out, contentType, ext, err := PrepareImage(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "image/png" || ext != ".png" {
+		t.Errorf("type = %s %s, want a PNG", contentType, ext)
+	}
+	config, err := png.DecodeConfig(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Width != 2000 || config.Height != 666 {
+		t.Errorf("size = %dx%d, want 2000x666", config.Width, config.Height)
+	}
+}
+
+func TestPrepareImageRejects(t *testing.T) {
+	var pngHeader bytes.Buffer
+	png.Encode(&pngHeader, image.NewGray(image.Rect(0, 0, 1, 1)))
+
+	for name, data := range map[string][]byte{
+		"text":      []byte("hello"),
+		"svg":       []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`),
+		"truncated": pngHeader.Bytes()[:20],
+		"too big":   make([]byte, MaxImageBytes+1),
+	} {
+		if _, _, _, err := PrepareImage(data); err == nil {
+			t.Errorf("%s: PrepareImage accepted it", name)
+		}
+	}
+}
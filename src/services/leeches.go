@@ -0,0 +1,25 @@
+package services
+
+import "github.com/abstract-tutoring/models"
+
+// RecordLapse counts an Again on a review card, one the student had
+// learned, and marks the card as a leech once its lapses reach the student's threshold.
+// Leeches are suspended unless the student only wants them flagged.
+func RecordLapse(prev, next models.StudentCard, rating int, settings models.StudentSettings, profile *SchedulingProfile) models.StudentCard {
+	// Forgetting a card still being learnt, or relearnt after a lapse, is
+	// not another lapse
+	if rating != RatingAgain || !profile.IsReview(prev.Status) {
+		return next
+	}
+
+	next.Lapses = prev.Lapses + 1
+	if next.Leech || settings.LeechThreshold <= 0 || next.Lapses < settings.LeechThreshold {
+		return next
+	}
+
+	next.Leech = true
+	if settings.LeechAction != models.LeechActionTag {
+		next.Suspended = true
+	}
+	return next
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/abstract-tutoring/models"
+)
+
+func TestRecordLapse(t *testing.T) {
+	profile := DefaultSchedulingProfile()
+	settings := models.DefaultStudentSettings("ada")
+	learning, review := 1, len(profile.LearningSteps)+1
+
+	tests := []struct {
+		name   string
+		status int
+		rating int
+		want   int // lapses after
+	}{
+		{"again on a review card", review, RatingAgain, 3},
+		{"again on a new card", 0, RatingAgain, 2},
+		{"again on a learning card", learning, RatingAgain, 2},
+		{"good on a review card", review, RatingGood, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := models.StudentCard{Status: tt.status, Lapses: 2}
+			got := RecordLapse(prev, prev, tt.rating, settings, profile)
+			if got.Lapses != tt.want {
+				t.Errorf("lapses = %d, want %d", got.Lapses, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordLapseLeech(t *testing.T) {
+	profile := DefaultSchedulingProfile()
+	review := models.StudentCard{Status: len(profile.LearningSteps) + 1, Lapses: models.DefaultLeechThreshold - 1}
+
+	settings := models.DefaultStudentSettings("ada")
+	if got := RecordLapse(review, review, RatingAgain, settings, profile); !got.Leech || !got.Suspended {
+		t.Errorf("card = %+v, want a suspended leech", got)
+	}
+	settings.LeechAction = models.LeechActionTag
+	if got := RecordLapse(review, review, RatingAgain, settings, profile); !got.Leech || got.Suspended {
+		t.Errorf("card = %+v, want a leech still studied", got)
+	}
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/abstract-tutoring/models"
+)
+
+// Choice is one option of a multiple choice card. Value is what picking it
+// posts: the option as written, so the page says nothing about which option
+// is correct beyond what the learner can read.
+type Choice struct {
+	Value   string
+	Content string
+}
+
+// ShuffleChoices gives the options of a multiple choice card in a new random
+// order each time.
+func ShuffleChoices(card models.Flashcard) []Choice {
+	choices := make([]Choice, 0, 1+len(card.Back.Distractors))
+	choices = append(choices, Choice{Value: card.Back.Content, Content: card.Back.Content})
+	for _, d := range card.Back.Distractors {
+		choices = append(choices, Choice{Value: d, Content: d})
+	}
+	rand.Shuffle(len(choices), func(i, j int) {
+		choices[i], choices[j] = choices[j], choices[i]
+	})
+	return choices
+}
+
+// ChoiceRating grades a pick from ShuffleChoices by comparing it with the
+// card's options: Good for the correct option and Bad for a distractor.
+// Options are told apart as ValidateChoices does, ignoring case and the
+// space around them.
+func ChoiceRating(card models.Flashcard, picked string) (int, error) {
+	key := choiceKey(picked)
+	if key == choiceKey(card.Back.Content) {
+		return RatingGood, nil
+	}
+	for _, d := range card.Back.Distractors {
+		if key == choiceKey(d) {
+			return RatingAgain, nil
+		}
+	}
+	return 0, fmt.Errorf("card %s has no option %q", card.ID, picked)
+}
+
+func choiceKey(option string) string {
+	return strings.ToLower(strings.TrimSpace(option))
+}
+
+// ValidateChoices checks the options of a multiple choice card: a correct
+// option, at least one distractor, and no option given twice.
+func ValidateChoices(back models.Content) error {
+	if strings.TrimSpace(back.Content) == "" {
+		return fmt.Errorf("the correct option is missing")
+	}
+	if len(back.Distractors) == 0 {
+		return fmt.Errorf("at least one wrong option is needed")
+	}
+	seen := map[string]bool{choiceKey(back.Content): true}
+	for _, d := range back.Distractors {
+		key := choiceKey(d)
+		if key == "" {
+			return fmt.Errorf("a wrong option is blank")
+		}
+		if seen[key] {
+			return fmt.Errorf("option %q is given twice", strings.TrimSpace(d))
+		}
+		seen[key] = true
+	}
+	return nil
+}
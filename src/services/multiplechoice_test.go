@@ -0,0 +1,70 @@
+package services
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/abstract-tutoring/models"
+)
+
+var distributions = models.Flashcard{
+	ID:    "distributions",
+	Front: models.Content{Type: models.ContentMultipleChoice, Content: "Successes in n trials"},
+	Back: models.Content{Type: models.ContentMultipleChoice, Content: "Binomial",
+		Distractors: []string{"Normal", "Poisson"}},
+}
+
+func TestShuffleChoices(t *testing.T) {
+	choices := ShuffleChoices(distributions)
+	sort.Slice(choices, func(i, j int) bool { return choices[i].Value < choices[j].Value })
+	want := []Choice{{"Binomial", "Binomial"}, {"Normal", "Normal"}, {"Poisson", "Poisson"}}
+	if len(choices) != len(want) {
+		t.Fatalf("choices = %+v, want %+v in any order", choices, want)
+	}
+	for i := range want {
+		if choices[i] != want[i] {
+			t.Errorf("choices = %+v, want %+v in any order", choices, want)
+			break
+		}
+	}
+}
+
+func TestChoiceRating(t *testing.T) {
+	for picked, want := range map[string]int{
+		"Binomial":   RatingGood,
+		" binomial ": RatingGood,
+		"Normal":     RatingAgain,
+		"POISSON":    RatingAgain,
+	} {
+		if got, err := ChoiceRating(distributions, picked); err != nil || got != want {
+			t.Errorf("ChoiceRating(%q) = %d, %v; want %d", picked, got, err, want)
+		}
+	}
+	for _, picked := range []string{"", "0", "Uniform"} {
+		if _, err := ChoiceRating(distributions, picked); err == nil {
+			t.Errorf("ChoiceRating(%q) gave no error", picked)
+		}
+	}
+}
+
+func TestValidateChoices(t *testing.T) {
+	tests := []struct {
+		name  string
+		back  models.Content
+		valid bool
+	}{
+		{"valid", distributions.Back, true},
+		{"no correct option", models.Content{Content: " ", Distractors: []string{"a"}}, false},
+		{"no distractors", models.Content{Content: "a"}, false},
+		{"blank distractor", models.Content{Content: "a", Distractors: []string{"b", ""}}, false},
+		{"distractor is the answer", models.Content{Content: "Paris", Distractors: []string{" paris"}}, false},
+		{"repeated distractor", models.Content{Content: "a", Distractors: []string{"b", "B"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateChoices(tt.back); (err == nil) != tt.valid {
+				t.Errorf("ValidateChoices(%+v) = %v, want valid %v", tt.back, err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abstract-tutoring/models"
+)
+
+// assetID is what an asset:// reference can name; see assetPattern.
+var assetID = regexp.MustCompile(`^[a-zA-Z0-9/_\-\.]+$`)
+
+// OcclusionOrds lists the cards an image occlusion front makes, one per mask.
+func OcclusionOrds(o *models.Occlusion) []int {
+	if o == nil {
+		return nil
+	}
+	ords := make([]int, 0, len(o.Masks))
+	for _, m := range o.Masks {
+		ords = append(ords, m.ID)
+	}
+	sort.Ints(ords)
+	return ords
+}
+
+// ValidateOcclusion checks an image occlusion front: the image must be one
+// of the card's image assets, and each mask needs its own ID from 1 and must
+// lie on the image.
+func ValidateOcclusion(o *models.Occlusion, assets []models.Asset) error {
+	if o == nil || o.Image == "" {
+		return fmt.Errorf("no image chosen")
+	}
+	found := false
+	for _, a := range assets {
+		if a.ID == o.Image && a.Type == "image" {
+			found = true
+			break
+		}
+	}
+	if !found || !assetID.MatchString(o.Image) {
+		return fmt.Errorf("image %q is not one of the card's images", o.Image)
+	}
+	if len(o.Masks) == 0 {
+		return fmt.Errorf("no masks drawn")
+	}
+	seen := map[int]bool{}
+	for _, m := range o.Masks {
+		if m.ID < 1 || seen[m.ID] {
+			return fmt.Errorf("mask IDs must be different numbers from 1")
+		}
+		seen[m.ID] = true
+		if m.X < 0 || m.Y < 0 || m.W <= 0 || m.H <= 0 || m.X+m.W > 100 || m.Y+m.H > 100 {
+			return fmt.Errorf("mask %d is not on the image", m.ID)
+		}
+	}
+	return nil
+}
+
+// RenderOcclusion draws the image with masks over it for the card with the
+// given ord, as an asset:// reference for ResolveAssetsInContent. The card's
+// own mask covers its area on the front and is outlined on the back, with
+// its label below the image. The other masks are drawn only if HideOthers
+// is set.
+func RenderOcclusion(o *models.Occlusion, ord int, revealed bool) string {
+	if o == nil || !assetID.MatchString(o.Image) {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(`<div class="mathjax_ignore" style="position: relative; display: inline-block; max-width: 100%; line-height: 0;">`)
+	b.WriteString("asset://" + o.Image)
+	label := ""
+	for _, m := range o.Masks {
+		var style string
+		switch {
+		case m.ID == ord && revealed:
+			style = "border: 3px solid #16a34a;"
+			label = m.Label
+		case m.ID == ord:
+			style = "background: #f97316; border: 2px solid #c2410c;"
+		case o.HideOthers:
+			style = "background: #9ca3af; border: 2px solid #4b5563;"
+		default:
+			continue
+		}
+		fmt.Fprintf(&b, `<div style="position: absolute; left: %s%%; top: %s%%; width: %s%%; height: %s%%; %s"></div>`,
+			percent(m.X), percent(m.Y), percent(m.W), percent(m.H), style)
+	}
+	b.WriteString(`</div>`)
+	if label != "" {
+		b.WriteString(`<p class="font-semibold mt-2">` + html.EscapeString(label) + `</p>`)
+	}
+	return b.String()
+}
+
+func percent(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
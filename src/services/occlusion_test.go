@@ -0,0 +1,88 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abstract-tutoring/models"
+)
+
+var mapAssets = []models.Asset{{ID: "map.jpg", Type: "image", Alt: "Map"}}
+
+func mapOcclusion() *models.Occlusion {
+	return &models.Occlusion{
+		Image: "map.jpg",
+		Masks: []models.Mask{
+			{ID: 2, X: 50, Y: 50, W: 10, H: 10, Label: "Heathrow"},
+			{ID: 1, X: 0, Y: 0, W: 25.5, H: 10, Label: "<b>Camborne</b>"},
+		},
+	}
+}
+
+func TestOcclusionOrds(t *testing.T) {
+	if got, want := OcclusionOrds(mapOcclusion()), []int{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OcclusionOrds = %v, want %v", got, want)
+	}
+	if got := OcclusionOrds(nil); len(got) != 0 {
+		t.Errorf("OcclusionOrds(nil) = %v, want none", got)
+	}
+}
+
+func TestValidateOcclusion(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(o *models.Occlusion)
+		valid bool
+	}{
+		{"valid", func(o *models.Occlusion) {}, true},
+		{"no image", func(o *models.Occlusion) { o.Image = "" }, false},
+		{"image not an asset", func(o *models.Occlusion) { o.Image = "other.jpg" }, false},
+		{"no masks", func(o *models.Occlusion) { o.Masks = nil }, false},
+		{"repeated ID", func(o *models.Occlusion) { o.Masks[1].ID = 2 }, false},
+		{"ID 0", func(o *models.Occlusion) { o.Masks[1].ID = 0 }, false},
+		{"off the image", func(o *models.Occlusion) { o.Masks[0].X = 95 }, false},
+		{"no area", func(o *models.Occlusion) { o.Masks[0].W = 0 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := mapOcclusion()
+			tt.edit(o)
+			if err := ValidateOcclusion(o, mapAssets); (err == nil) != tt.valid {
+				t.Errorf("ValidateOcclusion = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+	if err := ValidateOcclusion(mapOcclusion(), []models.Asset{{ID: "map.jpg", Type: "video"}}); err == nil {
+		t.Error("ValidateOcclusion accepted an asset that isn't an image")
+	}
+}
+
+func TestRenderOcclusion(t *testing.T) {
+	card := models.Flashcard{
+		Front:  models.Content{Type: models.ContentImageOcclusion, Content: "Name the station", Occlusion: mapOcclusion()},
+		Back:   models.Content{Type: models.ContentImageOcclusion},
+		Assets: mapAssets,
+	}
+	masks := func(s string) int { return strings.Count(s, "position: absolute") }
+
+	front, back := RenderCardSides(card, 1)
+	if !strings.HasPrefix(front, "Name the station\n\n") || !strings.Contains(front, "asset://map.jpg") {
+		t.Errorf("front = %q, want the prompt then the image", front)
+	}
+	if masks(front) != 1 || !strings.Contains(front, "left: 0%; top: 0%; width: 25.5%; height: 10%; background") {
+		t.Errorf("front = %q, want only mask 1 covering its area", front)
+	}
+	if masks(back) != 1 || !strings.Contains(back, "border: 3px solid") {
+		t.Errorf("back = %q, want only mask 1, outlined", back)
+	}
+	if !strings.Contains(back, "&lt;b&gt;Camborne&lt;/b&gt;") || strings.Contains(back, "Heathrow") {
+		t.Errorf("back = %q, want just mask 1's label, escaped", back)
+	}
+
+	card.Front.Occlusion.HideOthers = true
+	front, back = RenderCardSides(card, 2)
+	if masks(front) != 2 || masks(back) != 2 {
+		t.Errorf("with the others hidden, front = %q and back = %q, want both masks on each", front, back)
+	}
+}
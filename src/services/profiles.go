@@ -0,0 +1,299 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abstract-tutoring/models"
+)
+
+// Duration is a number of seconds. In profile files it is written as
+// "90s", "10m", "1h" or "2d", or as a plain number of seconds.
+type Duration int64
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var secs int64
+	if err := json.Unmarshal(b, &secs); err == nil {
+		*d = Duration(secs)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string or a number of seconds")
+	}
+	parsed, err := parseProfileDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func parseProfileDuration(s string) (Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.New("empty duration")
+	}
+	units := map[byte]int64{'s': 1, 'm': 60, 'h': 3600, 'd': 86400}
+	unit, ok := units[s[len(s)-1]]
+	if !ok {
+		return 0, fmt.Errorf("duration %q needs a unit (s, m, h or d)", s)
+	}
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return Duration(n * unit), nil
+}
+
+// ReviewLevel is one rung of the review ladder: where Good and Easy send a
+// card that is currently on it.
+type ReviewLevel struct {
+	Good Duration `json:"good"`
+	Easy Duration `json:"easy"`
+}
+
+// SchedulingProfile describes a ladder scheduler declaratively. The card
+// statuses are generated from it: 0 is new, 1..N are the learning steps and
+// N+1..N+M are the review levels.
+//
+// The rules reproduce the original fixed ladder:
+//   - Again always goes back to the first learning step.
+//   - Hard moves one learning step on (review cards drop to the last step)
+//     and comes back after the second step's delay.
+//   - Good on a learning step skips a step, graduating once it runs out;
+//     on a review level it stays put for that level's Good interval.
+//   - Easy graduates straight away (after EasyInterval from the last step);
+//     on a review level it climbs one level for that level's Easy interval.
+//
+// DueOffset is taken off every interval of a day or more, so a card due
+// "tomorrow" is due in the morning rather than at the time it was answered.
+type SchedulingProfile struct {
+	Name               string        `json:"name"`
+	LearningSteps      []Duration    `json:"learning_steps"`
+	GraduatingInterval Duration      `json:"graduating_interval"`
+	EasyInterval       Duration      `json:"easy_interval"`
+	ReviewLevels       []ReviewLevel `json:"review_levels"`
+	DueOffset          Duration      `json:"due_offset"`
+
+	transitions [][4]transition // indexed by status, then rating-1
+}
+
+type transition struct {
+	status int
+	delay  int64
+}
+
+const DefaultProfileName = models.DefaultSchedulingProfileName
+
+var defaultProfile = mustCompileProfile(&SchedulingProfile{
+	Name:               DefaultProfileName,
+	LearningSteps:      []Duration{2 * 60, 5 * 60, 10 * 60},
+	GraduatingInterval: 1 * 86400,
+	EasyInterval:       2 * 86400,
+	ReviewLevels: []ReviewLevel{
+		{Good: 2 * 86400, Easy: 3 * 86400},
+		{Good: 5 * 86400, Easy: 14 * 86400},
+		{Good: 31 * 86400, Easy: 62 * 86400},
+	},
+	DueOffset: 4 * 3600,
+})
+
+var schedulingProfiles = map[string]*SchedulingProfile{DefaultProfileName: defaultProfile}
+
+// DefaultSchedulingProfile is the original 2m/5m/10m steps and 1/2/5/14/31/62-day ladder.
+func DefaultSchedulingProfile() *SchedulingProfile {
+	return defaultProfile
+}
+
+func mustCompileProfile(p *SchedulingProfile) *SchedulingProfile {
+	if err := p.Validate(); err != nil {
+		panic(err)
+	}
+	p.compile()
+	return p
+}
+
+// Validate reports the first problem that would make the profile unusable.
+func (p *SchedulingProfile) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("scheduling profile needs a name")
+	}
+	if len(p.LearningSteps) == 0 {
+		return fmt.Errorf("profile %q: at least one learning step is required", p.Name)
+	}
+	for i, step := range p.LearningSteps {
+		if step <= 0 {
+			return fmt.Errorf("profile %q: learning step %d must be positive", p.Name, i+1)
+		}
+	}
+	if p.DueOffset < 0 {
+		return fmt.Errorf("profile %q: due_offset cannot be negative", p.Name)
+	}
+	if p.GraduatingInterval <= p.DueOffset {
+		return fmt.Errorf("profile %q: graduating_interval must be longer than due_offset", p.Name)
+	}
+	if p.EasyInterval < p.GraduatingInterval {
+		return fmt.Errorf("profile %q: easy_interval cannot be shorter than graduating_interval", p.Name)
+	}
+	if len(p.ReviewLevels) == 0 {
+		return fmt.Errorf("profile %q: at least one review level is required", p.Name)
+	}
+	for i, level := range p.ReviewLevels {
+		if level.Good <= p.DueOffset {
+			return fmt.Errorf("profile %q: review level %d good interval must be longer than due_offset", p.Name, i+1)
+		}
+		if level.Easy < level.Good {
+			return fmt.Errorf("profile %q: review level %d easy interval cannot be shorter than good", p.Name, i+1)
+		}
+	}
+	return nil
+}
+
+// compile generates the transition table for every status.
+func (p *SchedulingProfile) compile() {
+	n := len(p.LearningSteps)
+	m := len(p.ReviewLevels)
+	step := func(i int) int64 { return int64(p.LearningSteps[min(i, n-1)]) }
+	offset := int64(p.DueOffset)
+	again := transition{1, step(0)}
+	hardDelay := step(1)
+	graduate := transition{n + 1, int64(p.GraduatingInterval) - offset}
+
+	p.transitions = make([][4]transition, 1+n+m)
+
+	p.transitions[0] = [4]transition{
+		again,
+		{1, step(1)},
+		{1, step(2)},
+		graduate,
+	}
+
+	for i := 1; i <= n; i++ {
+		good := graduate
+		if i+2 <= n {
+			good = transition{i + 2, step(i + 1)}
+		}
+		easy := graduate
+		if i == n {
+			easy = transition{n + 1, int64(p.EasyInterval) - offset}
+		}
+		p.transitions[i] = [4]transition{
+			again,
+			{min(i+1, n), hardDelay},
+			good,
+			easy,
+		}
+	}
+
+	for j := 1; j <= m; j++ {
+		level := p.ReviewLevels[j-1]
+		p.transitions[n+j] = [4]transition{
+			again,
+			{n, hardDelay},
+			{n + j, int64(level.Good) - offset},
+			{n + min(j+1, m), int64(level.Easy) - offset},
+		}
+	}
+}
+
+// Next returns the status a card moves to and how many seconds until it is due.
+// Statuses past the end of the profile (left over from a longer profile) are
+// treated as the top review level.
+func (p *SchedulingProfile) Next(status, rating int) (int, int64, error) {
+	if rating < RatingAgain || rating > RatingEasy || status < 0 {
+		return -1, -1, ErrInvalidTransition
+	}
+	// Switching profile remaps statuses, but a status saved before that (or
+	// by a longer profile since removed) can still be past the end
+	status = min(status, len(p.transitions)-1)
+	t := p.transitions[status][rating-1]
+	return t.status, t.delay, nil
+}
+
+func (p *SchedulingProfile) IsNew(status int) bool {
+	return status == 0
+}
+
+func (p *SchedulingProfile) IsLearning(status int) bool {
+	return status >= 1 && status <= len(p.LearningSteps)
+}
+
+func (p *SchedulingProfile) IsReview(status int) bool {
+	return status > len(p.LearningSteps)
+}
+
+// RemapStatus moves a status from one profile's layout to another's, keeping
+// the card's place as near as it can: learning step i becomes step
+// min(i, N) and review level j becomes level min(j, M) of the new profile.
+func RemapStatus(status int, from, to *SchedulingProfile) int {
+	switch {
+	case from.IsNew(status) || status < 0:
+		return 0
+	case from.IsLearning(status):
+		return min(status, len(to.LearningSteps))
+	default:
+		level := min(status-len(from.LearningSteps), len(from.ReviewLevels))
+		return len(to.LearningSteps) + min(level, len(to.ReviewLevels))
+	}
+}
+
+// LoadSchedulingProfiles adds the profiles in a JSON file (an array of
+// profiles) to the built-in default. An empty path loads nothing.
+func LoadSchedulingProfiles(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read scheduling profiles: %w", err)
+	}
+
+	var loaded []*SchedulingProfile
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("failed to parse scheduling profiles: %w", err)
+	}
+
+	for _, p := range loaded {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		if _, exists := schedulingProfiles[p.Name]; exists {
+			return fmt.Errorf("duplicate scheduling profile %q", p.Name)
+		}
+		p.compile()
+		schedulingProfiles[p.Name] = p
+	}
+	return nil
+}
+
+// SchedulingProfileByName falls back to the default profile for unknown names,
+// e.g. a profile that has since been removed from the file.
+func SchedulingProfileByName(name string) *SchedulingProfile {
+	if p, ok := schedulingProfiles[name]; ok {
+		return p
+	}
+	return defaultProfile
+}
+
+func SchedulingProfileExists(name string) bool {
+	_, ok := schedulingProfiles[name]
+	return ok
+}
+
+// SchedulingProfileNames lists the available profiles, default first.
+func SchedulingProfileNames() []string {
+	names := make([]string, 0, len(schedulingProfiles))
+	for name := range schedulingProfiles {
+		if name != DefaultProfileName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{DefaultProfileName}, names...)
+}
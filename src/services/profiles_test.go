@@ -0,0 +1,299 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abstract-tutoring/models"
+)
+
+// oldLadder is the fixed table LookupNext used before profiles, by status
+// then rating-1. The default profile must give the same schedule.
+var oldLadder = [7][4]transition{
+	{{1, 2 * 60}, {1, 5 * 60}, {1, 10 * 60}, {4, 20 * 3600}},
+	{{1, 2 * 60}, {2, 5 * 60}, {3, 10 * 60}, {4, 20 * 3600}},
+	{{1, 2 * 60}, {3, 5 * 60}, {4, 20 * 3600}, {4, 20 * 3600}},
+	{{1, 2 * 60}, {3, 5 * 60}, {4, (1*24 - 4) * 3600}, {4, (2*24 - 4) * 3600}},
+	{{1, 2 * 60}, {3, 5 * 60}, {4, (2*24 - 4) * 3600}, {5, (3*24 - 4) * 3600}},
+	{{1, 2 * 60}, {3, 5 * 60}, {5, (5*24 - 4) * 3600}, {6, (14*24 - 4) * 3600}},
+	{{1, 2 * 60}, {3, 5 * 60}, {6, (31*24 - 4) * 3600}, {6, (62*24 - 4) * 3600}},
+}
+
+func TestDefaultProfileMatchesOldLadder(t *testing.T) {
+	p := DefaultSchedulingProfile()
+	for status, row := range oldLadder {
+		for i, want := range row {
+			rating := i + 1
+			gotStatus, gotDelay, err := p.Next(status, rating)
+			if err != nil {
+				t.Fatalf("Next(%d, %d): %v", status, rating, err)
+			}
+			if gotStatus != want.status || gotDelay != want.delay {
+				t.Errorf("Next(%d, %d) = %d, %d; want %d, %d", status, rating, gotStatus, gotDelay, want.status, want.delay)
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		status                  int
+		isNew, learning, review bool
+	}{
+		{0, true, false, false},
+		{1, false, true, false},
+		{3, false, true, false},
+		{4, false, false, true},
+		{6, false, false, true},
+	} {
+		if p.IsNew(tt.status) != tt.isNew || p.IsLearning(tt.status) != tt.learning || p.IsReview(tt.status) != tt.review {
+			t.Errorf("status %d: new %v, learning %v, review %v; want %v, %v, %v", tt.status,
+				p.IsNew(tt.status), p.IsLearning(tt.status), p.IsReview(tt.status), tt.isNew, tt.learning, tt.review)
+		}
+	}
+}
+
+func TestProfileNext(t *testing.T) {
+	p := DefaultSchedulingProfile()
+
+	// Statuses left over from a longer profile act as the top level
+	top, _, _ := p.Next(6, RatingGood)
+	if status, delay, err := p.Next(9, RatingGood); err != nil || status != top || delay != (31*24-4)*3600 {
+		t.Errorf("Next(9, Good) = %d, %d, %v; want the top level", status, delay, err)
+	}
+
+	for _, c := range []struct{ status, rating int }{{0, 0}, {0, 5}, {-1, RatingGood}} {
+		if _, _, err := p.Next(c.status, c.rating); err != ErrInvalidTransition {
+			t.Errorf("Next(%d, %d) err = %v, want ErrInvalidTransition", c.status, c.rating, err)
+		}
+	}
+}
+
+func TestRemapStatus(t *testing.T) {
+	long := DefaultSchedulingProfile() // 3 steps, 3 levels
+	short := mustCompileProfile(&SchedulingProfile{
+		Name:               "short",
+		LearningSteps:      []Duration{60},
+		GraduatingInterval: 86400,
+		EasyInterval:       86400,
+		ReviewLevels:       []ReviewLevel{{Good: 2 * 86400, Easy: 4 * 86400}, {Good: 7 * 86400, Easy: 14 * 86400}},
+	})
+
+	for _, tt := range []struct {
+		from, to     *SchedulingProfile
+		status, want int
+	}{
+		{long, short, 0, 0},
+		{long, short, 1, 1},
+		{long, short, 3, 1}, // last step becomes the only step
+		{long, short, 4, 2}, // first review level
+		{long, short, 5, 3},
+		{long, short, 6, 3}, // top level becomes the new top level
+		{long, short, 9, 3}, // already past the end
+		{short, long, 1, 1},
+		{short, long, 2, 4},
+		{short, long, 3, 5},
+		{long, long, 5, 5},
+	} {
+		if got := RemapStatus(tt.status, tt.from, tt.to); got != tt.want {
+			t.Errorf("RemapStatus(%d, %s, %s) = %d, want %d", tt.status, tt.from.Name, tt.to.Name, got, tt.want)
+		}
+	}
+}
+
+func TestCompileProfile(t *testing.T) {
+	const day = 86400
+	tests := []struct {
+		name    string
+		profile SchedulingProfile
+		want    [][4]transition
+	}{
+		{
+			name: "two steps, two levels",
+			profile: SchedulingProfile{
+				Name:               "short",
+				LearningSteps:      []Duration{60, 600},
+				GraduatingInterval: day,
+				EasyInterval:       3 * day,
+				ReviewLevels:       []ReviewLevel{{Good: 4 * day, Easy: 7 * day}, {Good: 10 * day, Easy: 20 * day}},
+				DueOffset:          3600,
+			},
+			want: [][4]transition{
+				// new: Hard and Good both land on the first step
+				{{1, 60}, {1, 600}, {1, 600}, {3, day - 3600}},
+				// step 1: Good has no step to skip to, so it graduates
+				{{1, 60}, {2, 600}, {3, day - 3600}, {3, day - 3600}},
+				// step 2, the last: Easy graduates after the easy interval
+				{{1, 60}, {2, 600}, {3, day - 3600}, {3, 3*day - 3600}},
+				// review levels: Hard drops to the last step, Easy climbs
+				{{1, 60}, {2, 600}, {3, 4*day - 3600}, {4, 7*day - 3600}},
+				{{1, 60}, {2, 600}, {4, 10*day - 3600}, {4, 20*day - 3600}},
+			},
+		},
+		{
+			name: "one step, no offset",
+			profile: SchedulingProfile{
+				Name:               "single",
+				LearningSteps:      []Duration{300},
+				GraduatingInterval: day,
+				EasyInterval:       day,
+				ReviewLevels:       []ReviewLevel{{Good: 2 * day, Easy: 2 * day}},
+			},
+			want: [][4]transition{
+				{{1, 300}, {1, 300}, {1, 300}, {2, day}},
+				{{1, 300}, {1, 300}, {2, day}, {2, day}},
+				{{1, 300}, {1, 300}, {2, 2 * day}, {2, 2 * day}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.profile
+			if err := p.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			p.compile()
+			if !reflect.DeepEqual(p.transitions, tt.want) {
+				t.Errorf("transitions =\n%v\nwant\n%v", p.transitions, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	valid := func() SchedulingProfile {
+		return SchedulingProfile{
+			Name:               "valid",
+			LearningSteps:      []Duration{60},
+			GraduatingInterval: 86400,
+			EasyInterval:       2 * 86400,
+			ReviewLevels:       []ReviewLevel{{Good: 2 * 86400, Easy: 3 * 86400}},
+			DueOffset:          3600,
+		}
+	}
+	if p := valid(); p.Validate() != nil {
+		t.Fatalf("valid profile rejected: %v", p.Validate())
+	}
+
+	tests := []struct {
+		name   string
+		change func(p *SchedulingProfile)
+		want   string
+	}{
+		{"no name", func(p *SchedulingProfile) { p.Name = " " }, "needs a name"},
+		{"no steps", func(p *SchedulingProfile) { p.LearningSteps = nil }, "at least one learning step"},
+		{"zero step", func(p *SchedulingProfile) { p.LearningSteps = []Duration{60, 0} }, "learning step 2 must be positive"},
+		{"negative offset", func(p *SchedulingProfile) { p.DueOffset = -1 }, "due_offset cannot be negative"},
+		{"graduating within offset", func(p *SchedulingProfile) { p.GraduatingInterval = 3600 }, "graduating_interval must be longer"},
+		{"easy shorter than graduating", func(p *SchedulingProfile) { p.EasyInterval = 3 * 3600 }, "easy_interval cannot be shorter"},
+		{"no levels", func(p *SchedulingProfile) { p.ReviewLevels = nil }, "at least one review level"},
+		{"level good within offset", func(p *SchedulingProfile) { p.ReviewLevels[0].Good = 60 }, "review level 1 good interval"},
+		{"level easy shorter than good", func(p *SchedulingProfile) { p.ReviewLevels[0].Easy = 86400 }, "review level 1 easy interval"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.change(&p)
+			err := p.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDurationUnmarshal(t *testing.T) {
+	tests := map[string]Duration{
+		`90`:     90,
+		`"90s"`:  90,
+		`"10m"`:  600,
+		`"1h"`:   3600,
+		`"2d"`:   2 * 86400,
+		`" 5m "`: 300,
+	}
+	for input, want := range tests {
+		var d Duration
+		if err := json.Unmarshal([]byte(input), &d); err != nil || d != want {
+			t.Errorf("unmarshal %s = %d, %v; want %d", input, d, err, want)
+		}
+	}
+
+	for _, input := range []string{`"10"`, `"10w"`, `""`, `"m"`, `true`} {
+		var d Duration
+		if err := json.Unmarshal([]byte(input), &d); err == nil {
+			t.Errorf("unmarshal %s = %d, want an error", input, d)
+		}
+	}
+}
+
+func TestLoadSchedulingProfiles(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "profiles.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	t.Cleanup(func() {
+		delete(schedulingProfiles, "exam")
+		delete(schedulingProfiles, "cram")
+	})
+
+	err := LoadSchedulingProfiles(write(`[
+		{"name": "exam", "learning_steps": ["1m", "10m"], "graduating_interval": "1d",
+		 "easy_interval": "3d", "review_levels": [{"good": "3d", "easy": "7d"}]},
+		{"name": "cram", "learning_steps": [30], "graduating_interval": "12h",
+		 "easy_interval": "1d", "review_levels": [{"good": "1d", "easy": "1d"}]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exam := SchedulingProfileByName("exam")
+	if status, delay, _ := exam.Next(0, RatingEasy); exam.Name != "exam" || status != 3 || delay != 86400 {
+		t.Errorf("exam Next(0, Easy) = %d, %d; want 3, 86400", status, delay)
+	}
+	if got, want := SchedulingProfileNames(), []string{DefaultProfileName, "cram", "exam"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SchedulingProfileNames() = %v, want %v", got, want)
+	}
+	if SchedulingProfileByName("removed") != DefaultSchedulingProfile() {
+		t.Error("an unknown profile doesn't fall back to the default")
+	}
+
+	for name, content := range map[string]string{
+		"duplicate": `[{"name": "exam", "learning_steps": ["1m"], "graduating_interval": "1d",
+			"easy_interval": "1d", "review_levels": [{"good": "2d", "easy": "2d"}]}]`,
+		"default": `[{"name": "` + models.DefaultSchedulingProfileName + `", "learning_steps": ["1m"],
+			"graduating_interval": "1d", "easy_interval": "1d", "review_levels": [{"good": "2d", "easy": "2d"}]}]`,
+		"invalid":   `[{"name": "bad", "learning_steps": []}]`,
+		"bad json":  `{"name": "bad"}`,
+		"bad units": `[{"name": "bad", "learning_steps": ["1y"]}]`,
+	} {
+		if err := LoadSchedulingProfiles(write(content)); err == nil {
+			t.Errorf("%s: loaded, want an error", name)
+		}
+	}
+	if SchedulingProfileExists("bad") {
+		t.Error("an invalid profile was added")
+	}
+}
+
+func TestLadderSchedulerNext(t *testing.T) {
+	s := NewLadderScheduler(DefaultSchedulingProfile())
+	card := models.StudentCard{CardID: "card", Status: 4, Due: 100, Stability: 3}
+
+	next, err := s.Next(card, RatingEasy, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.StudentCard{CardID: "card", Status: 5, Due: 1000 + (3*24-4)*3600, LastReview: 1000, Stability: 3}
+	if next != want {
+		t.Errorf("Next = %+v, want %+v", next, want)
+	}
+
+	if next, err := s.Next(card, 7, 1000); err == nil || next != card {
+		t.Errorf("Next with rating 7 = %+v, %v; want the card unchanged and an error", next, err)
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/abstract-tutoring/models"
+)
+
+const (
+	RatingAgain = 1
+	RatingHard  = 2
+	RatingGood  = 3
+	RatingEasy  = 4
+)
+
+var ErrInvalidTransition = errors.New("invalid transition")
+
+// Scheduler decides where a card goes after the student rates it.
+// Next must not have side effects: it is also used to preview the
+// due time behind each rating button.
+type Scheduler interface {
+	Next(card models.StudentCard, rating int, now int64) (models.StudentCard, error)
+	// Profile describes the statuses Next hands out, so callers can tell
+	// new, learning and review cards apart.
+	Profile() *SchedulingProfile
+}
+
+// LadderScheduler walks the fixed steps and intervals of a SchedulingProfile.
+type LadderScheduler struct {
+	profile *SchedulingProfile
+}
+
+func NewLadderScheduler(profile *SchedulingProfile) LadderScheduler {
+	return LadderScheduler{profile: profile}
+}
+
+func (l LadderScheduler) Next(card models.StudentCard, rating int, now int64) (models.StudentCard, error) {
+	newStatus, dueSeconds, err := l.profile.Next(card.Status, rating)
+	if err != nil {
+		return card, err
+	}
+
+	card.Status = newStatus
+	card.Due = now + dueSeconds
+	card.LastReview = now
+	return card, nil
+}
+
+func (l LadderScheduler) Profile() *SchedulingProfile {
+	return l.profile
+}
+
+// SchedulerFor picks the scheduler named by SCHEDULER ("ladder" or "fsrs").
+// The ladder follows the given profile; FSRS computes its own intervals.
+func SchedulerFor(profile *SchedulingProfile) Scheduler {
+	if FSRSEnabled() {
+		return NewFSRSScheduler()
+	}
+	return NewLadderScheduler(profile)
+}
+
+// FSRSEnabled reports whether SCHEDULER picks FSRS, in which case students'
+// scheduling profiles are not used.
+func FSRSEnabled() bool {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("SCHEDULER"))) == "fsrs"
+}
@@ -5,140 +5,79 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
-	"strconv"
 	"time"
 
 	"github.com/abstract-tutoring/models"
 	"github.com/abstract-tutoring/utils"
 )
 
-func LookupNext(currentStatus int, buttonPressed string) (int, int) {
-	switch currentStatus {
-	case 0:
-		switch buttonPressed {
-		case "1":
-			return 1, 2 * 60
-		case "2":
-			return 1, 5 * 60
-		case "3":
-			return 1, 10 * 60
-		case "4":
-			return 4, 20 * 3600
-		}
-	case 1:
-		switch buttonPressed {
-		case "1":
-			return 1, 2 * 60
-		case "2":
-			return 2, 5 * 60
-		case "3":
-			return 3, 10 * 60
-		case "4":
-			return 4, 20 * 3600
-		}
-	case 2:
-		switch buttonPressed {
-		case "1":
-			return 1, 2 * 60
-		case "2":
-			return 3, 5 * 60
-		case "3":
-			return 4, 20 * 3600
-		case "4":
-			return 4, 20 * 3600
-		}
-	case 3:
-		switch buttonPressed {
-		case "1":
-			return 1, 2 * 60
-		case "2":
-			return 3, 5 * 60
-		case "3":
-			return 4, (1*24 - 4) * 3600
-		case "4":
-			return 4, (2*24 - 4) * 3600
-		}
-	case 4:
-		switch buttonPressed {
-		case "1":
-			return 1, 2 * 60
-		case "2":
-			return 3, 5 * 60
-		case "3":
-			return 4, (2*24 - 4) * 3600
-		case "4":
-			return 5, (3*24 - 4) * 3600
-		}
-	case 5:
-		switch buttonPressed {
-		case "1":
-			return 1, 2 * 60
-		case "2":
-			return 3, 5 * 60
-		case "3":
-			return 5, (5*24 - 4) * 3600
-		case "4":
-			return 6, (14*24 - 4) * 3600
-		}
-	case 6:
-		switch buttonPressed {
-		case "1":
-			return 1, 2 * 60
-		case "2":
-			return 3, 5 * 60
-		case "3":
-			return 6, (31*24 - 4) * 3600
-		case "4":
-			return 6, (62*24 - 4) * 3600
-		}
-	}
-	// fallback if no valid transition
-	return -1, -1
-}
-
 func PickNextCard(
 	reviewAheadOffset int64,
 	cards []models.StudentCard,
 	numNewCardsToday int,
-	maxNewCardsToday string,
+	settings models.StudentSettings,
+	profile *SchedulingProfile,
 	allCards map[string]models.Flashcard,
 	allowedTags map[string]bool,
+	plan AssignmentPlan,
 ) (string, bool, error) {
 
-	now := time.Now().Unix() + reviewAheadOffset
+	realNow := time.Now().Unix()
+	now := realNow + reviewAheadOffset
 
 	var newCardsDue, inProgressCards, inProgressCardsDue, reviewCardsDue []models.StudentCard
 
 	for _, card := range cards {
-		fullCard, ok := allCards[card.CardID]
-		if !ok || !CardMatchesTags(fullCard, allowedTags) {
+		fullCard, ok := allCards[models.NoteID(card.CardID)]
+		if !ok || IsExcludedFromStudy(card, realNow) || !CardMatchesTags(fullCard, allowedTags) {
 			continue
 		}
 
-		if card.Status == 1 || card.Status == 2 || card.Status == 3 {
+		if profile.IsLearning(card.Status) {
 			inProgressCards = append(inProgressCards, card)
 		}
 		if card.Due > now {
 			continue
 		}
-		switch card.Status {
-		case 0:
+		switch {
+		case profile.IsNew(card.Status):
 			newCardsDue = append(newCardsDue, card)
-		case 1, 2, 3:
+		case profile.IsLearning(card.Status):
 			inProgressCardsDue = append(inProgressCardsDue, card)
-		case 4, 5, 6:
+		case profile.IsReview(card.Status):
 			reviewCardsDue = append(reviewCardsDue, card)
 		}
 	}
 
-	var options [][]models.StudentCard
-	categoryFlags := []bool{false, false, false}
+	// Assignments can raise the daily limit to meet their deadlines
+	newCardsAllowed := numNewCardsToday < max(settings.NewCardsPerDay, plan.NewCardQuota) &&
+		len(inProgressCardsDue) < settings.MaxInProgress && len(newCardsDue) > 0
 
-	i, err := strconv.Atoi(maxNewCardsToday)
-	if err != nil {
-		return "", false, errors.New("invalid maxNewCardsToday value")
+	// Cards from overdue assignments go before anything else
+	var overdue []models.StudentCard
+	for _, group := range [][]models.StudentCard{reviewCardsDue, inProgressCardsDue} {
+		for _, card := range group {
+			if plan.Overdue(card.CardID) {
+				overdue = append(overdue, card)
+			}
+		}
+	}
+	if len(overdue) > 0 {
+		soonest, err := getSoonestCard(overdue)
+		if err != nil {
+			return "", false, err
+		}
+		return soonest.CardID, false, nil
+	}
+	if newCardsAllowed {
+		if next, ok := pickAssignedNewCard(newCardsDue, plan); ok && plan.Overdue(next.CardID) {
+			return next.CardID, true, nil
+		}
 	}
 
+	var options [][]models.StudentCard
+	categoryFlags := []bool{false, false, false}
+
 	if len(reviewCardsDue) > 0 {
 		options = append(options, reviewCardsDue)
 		categoryFlags[0] = true
@@ -147,7 +86,7 @@ func PickNextCard(
 		options = append(options, inProgressCardsDue)
 		categoryFlags[1] = true
 	}
-	if numNewCardsToday < i && len(inProgressCardsDue) < 5 && len(newCardsDue) > 0 {
+	if newCardsAllowed {
 		options = append(options, newCardsDue)
 		categoryFlags[2] = true
 	}
@@ -169,6 +108,13 @@ func PickNextCard(
 	selectedCategory := options[selectedIndex]
 	selectedIsNew := categoryFlags[2] && (selectedIndex == len(options)-1)
 
+	// Introduce assigned cards before the rest, closest deadline first
+	if selectedIsNew {
+		if next, ok := pickAssignedNewCard(selectedCategory, plan); ok {
+			return next.CardID, true, nil
+		}
+	}
+
 	soonest, err := getSoonestCard(selectedCategory)
 	if err != nil {
 		return "", false, err
@@ -177,6 +123,47 @@ func PickNextCard(
 	return soonest.CardID, selectedIsNew, nil
 }
 
+// IsExcludedFromStudy reports whether a card is suspended or still buried.
+func IsExcludedFromStudy(card models.StudentCard, now int64) bool {
+	return card.Suspended || card.BuriedUntil > now
+}
+
+// SiblingsToBury returns the other cards from the answered card's note that
+// would come up before nextDayStart. Burying them keeps a note's cards, such
+// as the two directions of a reversible card, off the same study day.
+func SiblingsToBury(cards []models.StudentCard, answeredID string, nextDayStart int64) []string {
+	noteID := models.NoteID(answeredID)
+	var siblings []string
+	for _, c := range cards {
+		if c.CardID == answeredID || models.NoteID(c.CardID) != noteID {
+			continue
+		}
+		if c.Suspended || c.BuriedUntil >= nextDayStart || c.Due >= nextDayStart {
+			continue
+		}
+		siblings = append(siblings, c.CardID)
+	}
+	return siblings
+}
+
+// pickAssignedNewCard returns the new card with the earliest learn-by day, if
+// any of them has one.
+func pickAssignedNewCard(newCards []models.StudentCard, plan AssignmentPlan) (models.StudentCard, bool) {
+	var picked models.StudentCard
+	pickedDay := ""
+	for _, c := range newCards {
+		day, ok := plan.LearnBy[models.NoteID(c.CardID)]
+		if !ok {
+			continue
+		}
+		if pickedDay == "" || day < pickedDay || (day == pickedDay && c.Due < picked.Due) {
+			picked = c
+			pickedDay = day
+		}
+	}
+	return picked, pickedDay != ""
+}
+
 func getSoonestCard(cards []models.StudentCard) (models.StudentCard, error) {
 	if len(cards) == 0 {
 		return models.StudentCard{}, errors.New("no cards available")
@@ -192,7 +179,7 @@ func getSoonestCard(cards []models.StudentCard) (models.StudentCard, error) {
 	return soonest, nil
 }
 
-func FormatDueTime(seconds int, nextStatus int) string {
+func FormatDueTime(seconds int, nextStatus int, profile *SchedulingProfile) string {
 	absDelta := seconds
 	if absDelta < 0 {
 		absDelta = -absDelta
@@ -208,38 +195,39 @@ func FormatDueTime(seconds int, nextStatus int) string {
 	default:
 		timeStr = fmt.Sprintf("%d d", int(math.Round(float64(absDelta)/86400)))
 	}
-	if nextStatus >= 0 && nextStatus <= 3 {
+	if profile.IsNew(nextStatus) || profile.IsLearning(nextStatus) {
 		timeStr = "<" + timeStr
 	}
 	return timeStr
 }
 
-func MapStatusToLabel(status int) string {
-	switch status {
-	case 0:
+func MapStatusToLabel(status int, profile *SchedulingProfile) string {
+	switch {
+	case profile.IsNew(status):
 		return "New"
-	case 1, 2, 3:
+	case profile.IsLearning(status):
 		return "InProgress"
-	case 4, 5, 6:
+	case profile.IsReview(status):
 		return "Review"
 	default:
 		return ""
 	}
 }
 
-func GetCurrentStreak(streakStartTime, streakEndTime int64) (int, string) {
-	endDay := utils.UnixToUKTime(streakEndTime).Format("2006-01-02")
+func GetCurrentStreak(streakStartTime, streakEndTime int64, rolloverHour int) (int, string) {
+	endDay := utils.StudyDay(streakEndTime, rolloverHour)
 
 	nowUnix := time.Now().UTC().Unix()
 	yesterdayUnix := nowUnix - 24*3600
-	yesterdayDay := utils.UnixToUKTime(yesterdayUnix).Format("2006-01-02")
+	yesterdayDay := utils.StudyDay(yesterdayUnix, rolloverHour)
 
 	if endDay < yesterdayDay {
 		return 0, "💀"
 	}
 
-	startTime := utils.UnixToUKTime(streakStartTime)
-	endTime := utils.UnixToUKTime(streakEndTime)
+	rollover := int64(rolloverHour) * 3600
+	startTime := utils.UnixToUKTime(streakStartTime - rollover)
+	endTime := utils.UnixToUKTime(streakEndTime - rollover)
 	days := int(endTime.Sub(startTime).Hours()/24) + 1
 	if days < 1 {
 		days = 1
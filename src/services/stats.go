@@ -0,0 +1,250 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/abstract-tutoring/models"
+)
+
+// HeatmapDay is the number of answers given on one study day. Level (0-4)
+// buckets the count relative to the busiest day, for shading.
+type HeatmapDay struct {
+	Date  string // empty for padding before the first day
+	Count int
+	Level int
+}
+
+// ReviewHeatmap counts answers per study day over the given number of days up
+// to today, grouped into Monday-first weeks.
+func ReviewHeatmap(logs []models.ReviewLog, now int64, days, rolloverHour int) [][]HeatmapDay {
+	if days < 1 {
+		return nil
+	}
+
+	today := studyDate(now, rolloverHour)
+	first := today.AddDate(0, 0, -(days - 1))
+
+	counts := map[string]int{}
+	for _, l := range logs {
+		counts[studyDate(l.ReviewedAt, rolloverHour).Format("2006-01-02")]++
+	}
+
+	busiest := 0
+	for _, c := range counts {
+		busiest = max(busiest, c)
+	}
+
+	var weeks [][]HeatmapDay
+	var week []HeatmapDay
+	// Pad the first week so every column starts on a Monday
+	for i := 0; i < (int(first.Weekday())+6)%7; i++ {
+		week = append(week, HeatmapDay{})
+	}
+	for d := first; !d.After(today); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		day := HeatmapDay{Date: date, Count: counts[date]}
+		if day.Count > 0 {
+			day.Level = 1 + (day.Count-1)*4/busiest
+		}
+		week = append(week, day)
+		if len(week) == 7 {
+			weeks = append(weeks, week)
+			week = nil
+		}
+	}
+	if len(week) > 0 {
+		weeks = append(weeks, week)
+	}
+	return weeks
+}
+
+// RetentionRow is how many answers on already-started cards were remembered
+// (anything but Again).
+type RetentionRow struct {
+	Label   string
+	Reviews int
+	Passed  int
+}
+
+func (r RetentionRow) Percent() int {
+	if r.Reviews == 0 {
+		return 0
+	}
+	return r.Passed * 100 / r.Reviews
+}
+
+// isRetentionAnswer leaves out first answers on new cards, which say nothing
+// about memory.
+func isRetentionAnswer(l models.ReviewLog, profile *SchedulingProfile) bool {
+	return !profile.IsNew(l.PrevStatus)
+}
+
+// RetentionByDay is the true retention for each of the given number of study
+// days up to today, most recent first.
+func RetentionByDay(logs []models.ReviewLog, now int64, days, rolloverHour int, profile *SchedulingProfile) []RetentionRow {
+	today := studyDate(now, rolloverHour)
+	rows := make([]RetentionRow, days)
+	for i := range rows {
+		rows[i].Label = today.AddDate(0, 0, -i).Format("2006-01-02")
+	}
+
+	for _, l := range logs {
+		if !isRetentionAnswer(l, profile) {
+			continue
+		}
+		index := int(today.Sub(studyDate(l.ReviewedAt, rolloverHour)).Hours() / 24)
+		if index < 0 || index >= days {
+			continue
+		}
+		rows[index].Reviews++
+		if l.Rating != RatingAgain {
+			rows[index].Passed++
+		}
+	}
+	return rows
+}
+
+// RetentionByBand is the true retention split by the band the card was in
+// when it was answered: in progress, then each review level.
+func RetentionByBand(logs []models.ReviewLog, profile *SchedulingProfile) []RetentionRow {
+	rows := []RetentionRow{{Label: "In Progress"}}
+	for i := range profile.ReviewLevels {
+		rows = append(rows, RetentionRow{Label: fmt.Sprintf("Review %d", i+1)})
+	}
+
+	for _, l := range logs {
+		if !isRetentionAnswer(l, profile) {
+			continue
+		}
+		index := 0
+		if profile.IsReview(l.PrevStatus) {
+			index = min(l.PrevStatus-len(profile.LearningSteps), len(rows)-1)
+		}
+		rows[index].Reviews++
+		if l.Rating != RatingAgain {
+			rows[index].Passed++
+		}
+	}
+	return rows
+}
+
+// StatusCount is how many of the student's cards are in one status.
+type StatusCount struct {
+	Status int
+	Label  string
+	Count  int
+}
+
+// StatusDistribution counts cards in each status of the profile. Suspended
+// cards are counted separately, under status -1.
+func StatusDistribution(cards []models.StudentCard, profile *SchedulingProfile) []StatusCount {
+	steps := len(profile.LearningSteps)
+	counts := []StatusCount{{Status: 0, Label: "New"}}
+	for i := 1; i <= steps; i++ {
+		counts = append(counts, StatusCount{Status: i, Label: fmt.Sprintf("Step %d", i)})
+	}
+	for j := 1; j <= len(profile.ReviewLevels); j++ {
+		counts = append(counts, StatusCount{Status: steps + j, Label: fmt.Sprintf("Review %d", j)})
+	}
+	suspended := StatusCount{Status: -1, Label: "Suspended"}
+
+	for _, c := range cards {
+		if c.Suspended {
+			suspended.Count++
+			continue
+		}
+		counts[min(c.Status, len(counts)-1)].Count++
+	}
+	return append(counts, suspended)
+}
+
+// TagMastery is the share of a tag's cards that have graduated to review.
+type TagMastery struct {
+	Tag      string
+	Cards    int
+	Mastered int
+}
+
+func (t TagMastery) Percent() int {
+	if t.Cards == 0 {
+		return 0
+	}
+	return t.Mastered * 100 / t.Cards
+}
+
+func TagMasteryStats(cards []models.StudentCard, allCards map[string]models.Flashcard, profile *SchedulingProfile) []TagMastery {
+	byTag := map[string]*TagMastery{}
+	for _, c := range cards {
+		card, ok := allCards[models.NoteID(c.CardID)]
+		if !ok {
+			continue
+		}
+		for _, tag := range card.Tags {
+			m, ok := byTag[tag.Name]
+			if !ok {
+				m = &TagMastery{Tag: tag.Name}
+				byTag[tag.Name] = m
+			}
+			m.Cards++
+			if profile.IsReview(c.Status) {
+				m.Mastered++
+			}
+		}
+	}
+
+	stats := make([]TagMastery, 0, len(byTag))
+	for _, m := range byTag {
+		stats = append(stats, *m)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Tag < stats[j].Tag
+	})
+	return stats
+}
+
+// StudentProgress is the summary a tutor sees for each student in a class.
+type StudentProgress struct {
+	StudentID    string
+	Cards        int
+	New          int
+	InProgress   int
+	Mastered     int // in review
+	Suspended    int
+	Due          models.CardDueStats
+	Answers      int          // answers in the logs passed in
+	Retention    RetentionRow // over the same logs
+	LastReviewed int64        // latest answer in the logs, 0 if none
+}
+
+func SummariseProgress(studentID string, cards []models.StudentCard, logs []models.ReviewLog, now int64, profile *SchedulingProfile) StudentProgress {
+	p := StudentProgress{
+		StudentID: studentID,
+		Cards:     len(cards),
+		Due:       CountDueCards(cards, now, profile),
+		Answers:   len(logs),
+	}
+	for _, c := range cards {
+		switch {
+		case c.Suspended:
+			p.Suspended++
+		case profile.IsNew(c.Status):
+			p.New++
+		case profile.IsLearning(c.Status):
+			p.InProgress++
+		default:
+			p.Mastered++
+		}
+	}
+	for _, l := range logs {
+		p.LastReviewed = max(p.LastReviewed, l.ReviewedAt)
+		if !isRetentionAnswer(l, profile) {
+			continue
+		}
+		p.Retention.Reviews++
+		if l.Rating != RatingAgain {
+			p.Retention.Passed++
+		}
+	}
+	return p
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abstract-tutoring/models"
+)
+
+// statsNow is midday on Thursday 10 January 2030, when UK time is UTC.
+var statsNow = time.Date(2030, 1, 10, 12, 0, 0, 0, time.UTC).Unix()
+
+func answeredAt(value string, prevStatus, rating int) models.ReviewLog {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return models.ReviewLog{ReviewedAt: t.Unix(), PrevStatus: prevStatus, Rating: rating}
+}
+
+func TestReviewHeatmap(t *testing.T) {
+	tests := []struct {
+		name   string
+		logs   []models.ReviewLog
+		days   int
+		counts [][]int // per week, -1 for padding
+		levels [][]int
+	}{
+		{
+			name:   "no answers",
+			days:   7,
+			counts: [][]int{{-1, -1, -1, -1, 0, 0, 0}, {0, 0, 0, 0}},
+			levels: [][]int{{0, 0, 0, 0, 0, 0, 0}, {0, 0, 0, 0}},
+		},
+		{
+			name: "shaded by the busiest day",
+			logs: []models.ReviewLog{
+				answeredAt("2030-01-10T09:00:00Z", 0, RatingGood),
+				answeredAt("2030-01-10T10:00:00Z", 0, RatingGood),
+				answeredAt("2030-01-10T11:00:00Z", 0, RatingGood),
+				answeredAt("2030-01-10T11:30:00Z", 0, RatingGood),
+				answeredAt("2030-01-08T03:00:00Z", 0, RatingGood), // before the rollover, so the 7th
+				answeredAt("2029-12-01T12:00:00Z", 0, RatingGood), // out of range
+			},
+			days:   7,
+			counts: [][]int{{-1, -1, -1, -1, 0, 0, 0}, {1, 0, 0, 4}},
+			levels: [][]int{{0, 0, 0, 0, 0, 0, 0}, {1, 0, 0, 4}},
+		},
+		{
+			name:   "starting on a Monday",
+			days:   4,
+			counts: [][]int{{0, 0, 0, 0}},
+			levels: [][]int{{0, 0, 0, 0}},
+		},
+		{name: "no days"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var counts, levels [][]int
+			for _, week := range ReviewHeatmap(tt.logs, statsNow, tt.days, 4) {
+				var c, l []int
+				for _, day := range week {
+					if day.Date == "" {
+						c = append(c, -1)
+					} else {
+						c = append(c, day.Count)
+					}
+					l = append(l, day.Level)
+				}
+				counts, levels = append(counts, c), append(levels, l)
+			}
+			if !reflect.DeepEqual(counts, tt.counts) || !reflect.DeepEqual(levels, tt.levels) {
+				t.Errorf("counts %v, levels %v; want %v, %v", counts, levels, tt.counts, tt.levels)
+			}
+		})
+	}
+}
+
+func TestRetentionByDay(t *testing.T) {
+	tests := []struct {
+		name string
+		logs []models.ReviewLog
+		want []RetentionRow
+	}{
+		{
+			name: "no answers",
+			want: []RetentionRow{{Label: "2030-01-10"}, {Label: "2030-01-09"}, {Label: "2030-01-08"}},
+		},
+		{
+			name: "answers by day",
+			logs: []models.ReviewLog{
+				answeredAt("2030-01-10T09:00:00Z", 4, RatingGood),
+				answeredAt("2030-01-10T10:00:00Z", 2, RatingAgain),
+				answeredAt("2030-01-10T03:00:00Z", 5, RatingHard),  // before the rollover, so the 9th
+				answeredAt("2030-01-08T12:00:00Z", 0, RatingAgain), // first sight of a new card
+				answeredAt("2030-01-07T12:00:00Z", 5, RatingGood),  // out of range
+			},
+			want: []RetentionRow{
+				{Label: "2030-01-10", Reviews: 2, Passed: 1},
+				{Label: "2030-01-09", Reviews: 1, Passed: 1},
+				{Label: "2030-01-08"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RetentionByDay(tt.logs, statsNow, 3, 4, DefaultSchedulingProfile())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RetentionByDay = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetentionByBand(t *testing.T) {
+	tests := []struct {
+		name string
+		logs []models.ReviewLog
+		want []RetentionRow
+	}{
+		{
+			name: "no answers",
+			want: []RetentionRow{{Label: "In Progress"}, {Label: "Review 1"}, {Label: "Review 2"}, {Label: "Review 3"}},
+		},
+		{
+			name: "answers by band",
+			logs: []models.ReviewLog{
+				answeredAt("2030-01-10T09:00:00Z", 0, RatingGood),
+				answeredAt("2030-01-10T09:00:00Z", 1, RatingAgain),
+				answeredAt("2030-01-10T09:00:00Z", 3, RatingGood),
+				answeredAt("2030-01-10T09:00:00Z", 4, RatingEasy),
+				answeredAt("2030-01-10T09:00:00Z", 6, RatingAgain),
+				answeredAt("2030-01-10T09:00:00Z", 9, RatingGood), // past the profile's levels
+			},
+			want: []RetentionRow{
+				{Label: "In Progress", Reviews: 2, Passed: 1},
+				{Label: "Review 1", Reviews: 1, Passed: 1},
+				{Label: "Review 2"},
+				{Label: "Review 3", Reviews: 2, Passed: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RetentionByBand(tt.logs, DefaultSchedulingProfile())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RetentionByBand = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		name string
+		got  int
+		want int
+	}{
+		{"no reviews", RetentionRow{}.Percent(), 0},
+		{"retention", RetentionRow{Reviews: 3, Passed: 2}.Percent(), 66},
+		{"no cards", TagMastery{}.Percent(), 0},
+		{"mastery", TagMastery{Cards: 4, Mastered: 1}.Percent(), 25},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: Percent = %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestStatusDistribution(t *testing.T) {
+	labels := []string{"New", "Step 1", "Step 2", "Step 3", "Review 1", "Review 2", "Review 3", "Suspended"}
+	tests := []struct {
+		name  string
+		cards []models.StudentCard
+		want  []int // counts, in the order of labels
+	}{
+		{"no cards", nil, []int{0, 0, 0, 0, 0, 0, 0, 0}},
+		{
+			"cards by status",
+			[]models.StudentCard{
+				{Status: 0}, {Status: 0}, {Status: 2}, {Status: 4}, {Status: 6},
+				{Status: 9},                  // past the profile's levels
+				{Status: 5, Suspended: true}, // counted only as suspended
+			},
+			[]int{2, 0, 1, 0, 1, 0, 2, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotLabels []string
+			var got []int
+			for _, c := range StatusDistribution(tt.cards, DefaultSchedulingProfile()) {
+				gotLabels = append(gotLabels, c.Label)
+				got = append(got, c.Count)
+			}
+			if !reflect.DeepEqual(gotLabels, labels) || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("StatusDistribution = %v %v, want %v %v", gotLabels, got, labels, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagMasteryStats(t *testing.T) {
+	tagged := func(names ...string) models.Flashcard {
+		var card models.Flashcard
+		for _, name := range names {
+			card.Tags = append(card.Tags, models.Tag{Name: name})
+		}
+		return card
+	}
+	allCards := map[string]models.Flashcard{
+		"capital": tagged("geography", "europe"),
+		"river":   tagged("geography"),
+		"sum":     tagged("maths"),
+		"plain":   tagged(),
+	}
+
+	tests := []struct {
+		name  string
+		cards []models.StudentCard
+		want  []TagMastery
+	}{
+		{"no cards", nil, []TagMastery{}},
+		{
+			"by tag",
+			[]models.StudentCard{
+				{CardID: "capital", Status: 5},
+				{CardID: "capital#1", Status: 2}, // the reversed card counts too
+				{CardID: "river", Status: 0},
+				{CardID: "sum", Status: 4},
+				{CardID: "plain", Status: 5},
+				{CardID: "deleted", Status: 5},
+			},
+			[]TagMastery{
+				{Tag: "europe", Cards: 2, Mastered: 1},
+				{Tag: "geography", Cards: 3, Mastered: 1},
+				{Tag: "maths", Cards: 1, Mastered: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TagMasteryStats(tt.cards, allCards, DefaultSchedulingProfile())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TagMasteryStats = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"html"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// A number rounded to fewer digits than the other answer must still be within
+// this fraction of the expected answer, so 3.142 is accepted for 3.14159 but
+// 3 is not.
+const answerTolerance = 0.005
+
+// Answers whose normalised forms are at least this similar, but not equal,
+// suggest "Okay" rather than "Bad".
+const closeAnswerSimilarity = 0.8
+
+// Diffs longer than this (typed runes times expected runes) are not worked
+// out; the answers are just shown as they are.
+const maxDiffCells = 1_000_000
+
+// AnswerCheck is the result of comparing a typed answer with the expected
+// one. Typed marks the characters that are not in the answer, and Expected
+// the characters that were missed.
+type AnswerCheck struct {
+	Typed           []DiffPart
+	Expected        []DiffPart
+	Correct         bool
+	SuggestedRating int
+}
+
+type DiffPart struct {
+	Text    string
+	Changed bool
+}
+
+// ExpectedAnswer is the text a typed answer is compared against: the side
+// shown on the back, as plain text.
+func ExpectedAnswer(card models.Flashcard, ord int) string {
+	answer := card.Back.Content
+	if ord == models.OrdReversed {
+		answer = card.Front.Content
+	}
+	return collapseSpace(html.UnescapeString(bluemonday.StrictPolicy().Sanitize(answer)))
+}
+
+// CheckAnswer compares a typed answer with the expected one, ignoring case,
+// extra whitespace and simple LaTeX markup, and allowing numbers to be
+// rounded (see numbersMatch). Spaces are ignored altogether if the expected answer is LaTeX.
+// It suggests Good for a correct answer, Okay for a close one and Bad
+// otherwise.
+func CheckAnswer(typed, expected string) AnswerCheck {
+	typed, expected = collapseSpace(typed), collapseSpace(expected)
+	t, e := normaliseAnswer(typed), normaliseAnswer(expected)
+
+	check := AnswerCheck{SuggestedRating: RatingAgain}
+	if strings.ContainsAny(expected, `$\`) {
+		// For maths, spaces don't matter and the LaTeX source is no help in
+		// the diff, so compare and show the normalised forms
+		t, e = strings.ReplaceAll(t, " ", ""), strings.ReplaceAll(e, " ", "")
+		check.Typed, check.Expected = diffAnswers(t, e)
+	} else {
+		check.Typed, check.Expected = diffAnswers(typed, expected)
+	}
+
+	switch {
+	case t == "":
+	case t == e || numbersMatch(t, e):
+		check.Correct = true
+		check.SuggestedRating = RatingGood
+	case similarity(t, e) >= closeAnswerSimilarity:
+		check.SuggestedRating = RatingHard
+	}
+	return check
+}
+
+var (
+	latexFrac      = regexp.MustCompile(`\\[dt]?frac\{([^{}]*)\}\{([^{}]*)\}`)
+	latexSpacing   = regexp.MustCompile(`\\[,;:! ]|\\left|\\right|\\displaystyle`)
+	latexCommand   = regexp.MustCompile(`\\([a-z]+)`)
+	singleInParens = regexp.MustCompile(`\(([\p{L}\p{N}.]+)\)`)
+	spaceAroundOp  = regexp.MustCompile(`\s*([^\p{L}\p{N}\s])\s*`)
+)
+
+// normaliseAnswer reduces an answer to a form where equivalent answers are
+// equal: lower case, no maths delimiters, \frac{a}{b} as a/b, \cdot and
+// \times as *, braces as brackets, brackets around single terms dropped and
+// no spaces around symbols.
+func normaliseAnswer(s string) string {
+	s = strings.ToLower(s)
+	for _, delim := range []string{"$", `\(`, `\)`, `\[`, `\]`} {
+		s = strings.ReplaceAll(s, delim, "")
+	}
+	s = latexSpacing.ReplaceAllString(s, "")
+	s = latexFrac.ReplaceAllStringFunc(s, func(m string) string {
+		parts := latexFrac.FindStringSubmatch(m)
+		return bracketTerm(parts[1]) + "/" + bracketTerm(parts[2])
+	})
+	s = strings.NewReplacer(`\cdot`, "*", `\times`, "*", "×", "*", "{", "(", "}", ")").Replace(s)
+	s = latexCommand.ReplaceAllString(s, "$1")
+	s = singleInParens.ReplaceAllString(s, "$1")
+	s = spaceAroundOp.ReplaceAllString(s, "$1")
+	return collapseSpace(s)
+}
+
+// bracketTerm wraps an expression in brackets unless it is a single term.
+func bracketTerm(s string) string {
+	s = strings.TrimSpace(s)
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' {
+			return "(" + s + ")"
+		}
+	}
+	return s
+}
+
+// numbersMatch reports whether both answers are numbers, or fractions of
+// numbers, that are equal once rounded to the less precise one's last digit:
+// within half a unit of it, and within answerTolerance. So 3.142 matches
+// 3.14159, but 1070 doesn't match 1066 nor 2009 match 2000.
+func numbersMatch(typed, expected string) bool {
+	t, tUnit, ok := parseNumber(typed)
+	if !ok {
+		return false
+	}
+	e, eUnit, ok := parseNumber(expected)
+	if !ok {
+		return false
+	}
+	if e == 0 {
+		return math.Abs(t) < 1e-9
+	}
+	tolerance := math.Min(max(tUnit, eUnit)/2, answerTolerance*math.Abs(e))
+	// Allow for the decimal digits not being exact in binary
+	return math.Abs(t-e) <= tolerance+1e-9*math.Abs(e)
+}
+
+// parseNumber also returns the unit of the number's last given digit, 0.01
+// for 1.25; fractions are exact, with a unit of 0.
+func parseNumber(s string) (value, unit float64, ok bool) {
+	if num, den, found := strings.Cut(s, "/"); found {
+		n, _, ok1 := parseDecimal(num)
+		d, _, ok2 := parseDecimal(den)
+		if !ok1 || !ok2 || d == 0 {
+			return 0, 0, false
+		}
+		return n / d, 0, true
+	}
+	return parseDecimal(s)
+}
+
+var thousandsGroups = regexp.MustCompile(`^[+-]?\d{1,3}(,\d{3})+(\.\d+)?$`)
+
+// parseDecimal reads commas as thousands separators only where they group
+// the digits in threes, as in 1,000. Otherwise one comma is a decimal
+// comma, so 1,5 is 1.5 and not 15.
+func parseDecimal(s string) (value, unit float64, ok bool) {
+	if thousandsGroups.MatchString(s) {
+		s = strings.ReplaceAll(s, ",", "")
+	} else if strings.Count(s, ",") == 1 && !strings.Contains(s, ".") {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, 0, false
+	}
+
+	mantissa, exponent := strings.ToLower(s), 0
+	if m, e, found := strings.Cut(mantissa, "e"); found {
+		if exponent, err = strconv.Atoi(e); err != nil {
+			return 0, 0, false
+		}
+		mantissa = m
+	}
+	if _, decimals, found := strings.Cut(mantissa, "."); found {
+		exponent -= len(decimals)
+	}
+	return f, math.Pow10(exponent), true
+}
+
+// similarity is 1 for equal strings and 0 for strings with nothing in
+// common, from the longest common subsequence of their characters.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra)+len(rb) == 0 || len(ra)*len(rb) > maxDiffCells {
+		return 0
+	}
+	return 2 * float64(len(commonSubsequence(ra, rb))) / float64(len(ra)+len(rb))
+}
+
+// diffAnswers marks the characters of typed that are not in expected, and
+// the characters of expected that are not in typed, ignoring case.
+func diffAnswers(typed, expected string) (typedParts, expectedParts []DiffPart) {
+	rt, re := []rune(typed), []rune(expected)
+	if len(rt)*len(re) > maxDiffCells {
+		return []DiffPart{{Text: typed, Changed: true}}, []DiffPart{{Text: expected, Changed: true}}
+	}
+	common := commonSubsequence(rt, re)
+	return markUnmatched(rt, common, 0), markUnmatched(re, common, 1)
+}
+
+// markUnmatched splits runes into runs of matched and unmatched characters,
+// taking the matches from side (0 or 1) of common.
+func markUnmatched(runes []rune, common [][2]int, side int) []DiffPart {
+	matched := make([]bool, len(runes))
+	for _, pair := range common {
+		matched[pair[side]] = true
+	}
+	var parts []DiffPart
+	for i, r := range runes {
+		changed := !matched[i]
+		if n := len(parts); n > 0 && parts[n-1].Changed == changed {
+			parts[n-1].Text += string(r)
+			continue
+		}
+		parts = append(parts, DiffPart{Text: string(r), Changed: changed})
+	}
+	return parts
+}
+
+// commonSubsequence returns the index pairs of a longest common subsequence
+// of a and b, comparing case-insensitively.
+func commonSubsequence(a, b []rune) [][2]int {
+	// lengths[i][j] is the length for a[i:] and b[j:]
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if unicode.ToLower(a[i]) == unicode.ToLower(b[j]) {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	var pairs [][2]int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case unicode.ToLower(a[i]) == unicode.ToLower(b[j]):
+			pairs = append(pairs, [2]int{i, j})
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return pairs
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
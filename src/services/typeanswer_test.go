@@ -0,0 +1,101 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/abstract-tutoring/models"
+)
+
+func TestCheckAnswer(t *testing.T) {
+	tests := []struct {
+		name     string
+		typed    string
+		expected string
+		correct  bool
+		rating   int
+	}{
+		{"exact", "Paris", "Paris", true, RatingGood},
+		{"case", "pARIS", "Paris", true, RatingGood},
+		{"whitespace", "  New \t York\n", "New York", true, RatingGood},
+		{"space around punctuation", "red , green", "red, green", true, RatingGood},
+		{"space around operators", "x+1 = 2", "x + 1 = 2", true, RatingGood},
+		{"missing punctuation is close", "Paris", "Paris.", false, RatingHard},
+		{"typo is close", "Pariss", "Paris", false, RatingHard},
+		{"wrong", "London", "Paris", false, RatingAgain},
+		{"blank", "   ", "Paris", false, RatingAgain},
+		{"number within tolerance", "3.142", "3.14159", true, RatingGood},
+		{"number outside tolerance", "3.2", "3.14159", false, RatingAgain},
+		{"rounded too far", "3", "3.14159", false, RatingAgain},
+		{"rounded to the expected digits", "2.718", "2.72", true, RatingGood},
+		{"whole numbers are exact", "1070", "1066", false, RatingAgain},
+		{"trailing zeros are exact", "2009", "2000", false, RatingAgain},
+		{"more digits than expected", "2000.4", "2000", true, RatingGood},
+		{"thousands separator", "1,000", "1000", true, RatingGood},
+		{"thousands groups", "1234567", "1,234,567.5", true, RatingGood},
+		{"decimal comma", "1,5", "1.5", true, RatingGood},
+		{"decimal comma expected", "1.5", "1,5", true, RatingGood},
+		{"decimal comma isn't dropped", "15", "1,5", false, RatingHard},
+		{"comma list isn't a number", "123", "1,2,3", false, RatingAgain},
+		{"fraction as decimal", "0.5", "1/2", true, RatingGood},
+		{"zero", "0", "0.0", true, RatingGood},
+		{"LaTeX fraction", "1/2", `$\frac{1}{2}$`, true, RatingGood},
+		{"LaTeX fraction of terms", "(x+1)/2", `$\frac{x + 1}{2}$`, true, RatingGood},
+		{"LaTeX spaces ignored", "2 x", `$2x$`, true, RatingGood},
+		{"LaTeX times", "2*3", `$2 \times 3$`, true, RatingGood},
+		{"LaTeX cdot", "a*b", `\(a \cdot b\)`, true, RatingGood},
+		{"LaTeX brackets around a term", "x^2", `$x^{2}$`, true, RatingGood},
+		{"LaTeX spacing commands", "ab", `$a\,b$`, true, RatingGood},
+		{"LaTeX close", "x^2+1", `$x^{2} + 2$`, false, RatingHard},
+		{"LaTeX wrong", "x^3", `$x^{2}$`, false, RatingAgain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := CheckAnswer(tt.typed, tt.expected)
+			if check.Correct != tt.correct || check.SuggestedRating != tt.rating {
+				t.Errorf("CheckAnswer(%q, %q) = correct %v, rating %d; want %v, %d",
+					tt.typed, tt.expected, check.Correct, check.SuggestedRating, tt.correct, tt.rating)
+			}
+		})
+	}
+}
+
+func TestCheckAnswerDiff(t *testing.T) {
+	check := CheckAnswer("Pariss", "paris")
+	wantTyped := []DiffPart{{Text: "Paris"}, {Text: "s", Changed: true}}
+	wantExpected := []DiffPart{{Text: "paris"}}
+	if !equalParts(check.Typed, wantTyped) || !equalParts(check.Expected, wantExpected) {
+		t.Errorf("diff = %+v, %+v; want %+v, %+v", check.Typed, check.Expected, wantTyped, wantExpected)
+	}
+
+	check = CheckAnswer("cat", "cart")
+	wantTyped = []DiffPart{{Text: "cat"}}
+	wantExpected = []DiffPart{{Text: "ca"}, {Text: "r", Changed: true}, {Text: "t"}}
+	if !equalParts(check.Typed, wantTyped) || !equalParts(check.Expected, wantExpected) {
+		t.Errorf("diff = %+v, %+v; want %+v, %+v", check.Typed, check.Expected, wantTyped, wantExpected)
+	}
+}
+
+func TestExpectedAnswer(t *testing.T) {
+	card := models.Flashcard{
+		Front: models.Content{Content: "<b>Capital</b> of France"},
+		Back:  models.Content{Content: "<p>Paris &amp;\n  Île-de-France</p>"},
+	}
+	if got, want := ExpectedAnswer(card, 0), "Paris & Île-de-France"; got != want {
+		t.Errorf("ExpectedAnswer(card, 0) = %q, want %q", got, want)
+	}
+	if got, want := ExpectedAnswer(card, models.OrdReversed), "Capital of France"; got != want {
+		t.Errorf("ExpectedAnswer(card, reversed) = %q, want %q", got, want)
+	}
+}
+
+func equalParts(a, b []DiffPart) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
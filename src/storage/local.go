@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/abstract-tutoring/auth"
+)
+
+// Local keeps files under a directory and serves them under a URL prefix.
+// Like the Supabase bucket's policies, users may only write to their own
+// folder but any signed-in user may load any file, so main should mount it
+// behind the session check.
+type Local struct {
+	dir       string
+	prefix    string
+	jwtSecret []byte
+}
+
+// NewLocal keeps files under dir, served at the URL prefix, e.g. "/assets/".
+// Access tokens are checked with jwtSecret, as by store.NewPostgres.
+func NewLocal(dir, prefix, jwtSecret string) *Local {
+	return &Local{dir: dir, prefix: prefix, jwtSecret: []byte(jwtSecret)}
+}
+
+func (l *Local) Put(ctx context.Context, accessToken, path, contentType string, data []byte) error {
+	if !ValidPath(path) {
+		return ErrInvalidPath
+	}
+	userID, err := auth.ParseAccessToken(l.jwtSecret, accessToken, time.Now())
+	if err != nil {
+		return err
+	}
+	if folder, _, ok := strings.Cut(path, "/"); !ok || folder != userID {
+		return ErrNotOwner
+	}
+	name := filepath.Join(l.dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// Written beside the file and linked into place, so a half-written file
+	// is never served and an existing one is never replaced
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Link(tmp.Name(), name)
+}
+
+func (l *Local) URL(ctx context.Context, accessToken, path string) (string, error) {
+	if !ValidPath(path) {
+		return "", ErrInvalidPath
+	}
+	return l.prefix + path, nil
+}
+
+// ServeHTTP serves the file the path after the prefix names.
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, ok := strings.CutPrefix(r.URL.Path, l.prefix)
+	if !ok || !ValidPath(path) {
+		http.NotFound(w, r)
+		return
+	}
+	name := filepath.Join(l.dir, filepath.FromSlash(path))
+	if info, err := os.Stat(name); err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeFile(w, r, name)
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abstract-tutoring/auth"
+)
+
+func TestValidPath(t *testing.T) {
+	for path, want := range map[string]bool{
+		"user/photo.jpg": true,
+		"photo.jpg":      true,
+		"":               false,
+		"/photo.jpg":     false,
+		"user//photo":    false,
+		"user/../photo":  false,
+		"./photo.jpg":    false,
+		"user/photo 1":   false,
+		`user\photo`:     false,
+	} {
+		if got := ValidPath(path); got != want {
+			t.Errorf("ValidPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	local := NewLocal(dir, "/assets/", "secret")
+	ctx := context.Background()
+	adaToken, err := auth.SignAccessToken([]byte("secret"), "ada", time.Now(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := local.Put(ctx, adaToken, "ada/photo.png", "image/png", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Put(ctx, adaToken, "ada/photo.png", "image/png", []byte("second")); err == nil {
+		t.Error("Put replaced an existing file")
+	}
+	if err := local.Put(ctx, adaToken, "../photo.png", "image/png", []byte("outside")); err != ErrInvalidPath {
+		t.Errorf("Put outside the directory: err = %v, want ErrInvalidPath", err)
+	}
+	for _, path := range []string{"bob/photo.png", "ada", "adam/photo.png"} {
+		if err := local.Put(ctx, adaToken, path, "image/png", []byte("png")); err != ErrNotOwner {
+			t.Errorf("Put %s: err = %v, want ErrNotOwner", path, err)
+		}
+	}
+	forged, _ := auth.SignAccessToken([]byte("other"), "ada", time.Now(), time.Hour)
+	if err := local.Put(ctx, forged, "ada/forged.png", "image/png", []byte("png")); err != auth.ErrInvalidToken {
+		t.Errorf("Put with a forged token: err = %v, want ErrInvalidToken", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "ada", "photo.png"))
+	if err != nil || string(data) != "first" {
+		t.Errorf("file = %q, %v; want the first upload", data, err)
+	}
+
+	url, err := local.URL(ctx, "", "ada/photo.png")
+	if err != nil || url != "/assets/ada/photo.png" {
+		t.Fatalf("URL = %q, %v", url, err)
+	}
+	w := httptest.NewRecorder()
+	local.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	if w.Code != http.StatusOK || w.Body.String() != "first" {
+		t.Errorf("GET %s: status %d, body %q", url, w.Code, w.Body)
+	}
+	if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+	}
+
+	for _, target := range []string{"/assets/ada", "/assets/ada/missing.png", "/assets/ada/../ada/photo.png", "/other/ada/photo.png"} {
+		w := httptest.NewRecorder()
+		local.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status %d, want not found", target, w.Code)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Package storage keeps card images. Bucket is implemented by NewSupabase,
+// which uses a Supabase Storage bucket, and NewLocal, which keeps the files
+// in a directory and serves them itself so the app can run without Supabase.
+package storage
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidPath = errors.New("invalid file path")
+	ErrNotOwner    = errors.New("file path is outside the user's folder")
+)
+
+type Bucket interface {
+	// Put stores a new file at the path, as the user the access token is
+	// for. The path's first folder must be that user's ID. It fails if there
+	// is a file there already.
+	Put(ctx context.Context, accessToken, path, contentType string, data []byte) error
+	// URL gives a link the browser can load the file from for the next
+	// hour or so.
+	URL(ctx context.Context, accessToken, path string) (string, error)
+}
+
+// pathPattern is what an asset:// reference in card content can name.
+var pathPattern = regexp.MustCompile(`^[a-zA-Z0-9/_\-\.]+$`)
+
+// ValidPath reports whether p can name a file: relative, with no empty, "."
+// or ".." parts, and only the characters an asset:// reference allows.
+func ValidPath(p string) bool {
+	if !pathPattern.MatchString(p) {
+		return false
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
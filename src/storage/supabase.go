@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// signedURLSeconds is how long a signed URL works for.
+const signedURLSeconds = 3600
+
+// supabase is a Supabase Storage bucket under /storage/v1. Requests are made
+// as the signed-in user, so the bucket's policies decide what they may do.
+type supabase struct {
+	baseURL string
+	apiKey  string
+	bucket  string
+	client  *http.Client
+}
+
+// NewSupabase uses the bucket in the Supabase project at baseURL with its
+// anon key.
+func NewSupabase(baseURL, apiKey, bucket string) Bucket {
+	return &supabase{baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey, bucket: bucket, client: http.DefaultClient}
+}
+
+func (s *supabase) Put(ctx context.Context, accessToken, path, contentType string, data []byte) error {
+	if !ValidPath(path) {
+		return ErrInvalidPath
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.objectURL("object", path), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return s.do(req, accessToken, nil)
+}
+
+func (s *supabase) URL(ctx context.Context, accessToken, path string) (string, error) {
+	if !ValidPath(path) {
+		return "", ErrInvalidPath
+	}
+	body, _ := json.Marshal(map[string]interface{}{"expiresIn": signedURLSeconds})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.objectURL("object/sign", path), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var result struct {
+		SignedURL string `json:"signedURL"`
+	}
+	if err := s.do(req, accessToken, &result); err != nil {
+		return "", err
+	}
+	return s.baseURL + "/storage/v1" + result.SignedURL, nil
+}
+
+func (s *supabase) objectURL(endpoint, path string) string {
+	return fmt.Sprintf("%s/storage/v1/%s/%s/%s", s.baseURL, endpoint, s.bucket, path)
+}
+
+// do sends the request as the user and decodes the response into out if not
+// nil.
+func (s *supabase) do(req *http.Request, accessToken string, out interface{}) error {
+	req.Header.Set("apikey", s.apiKey)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("storage: %s %s: status %d: %s", req.Method, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSupabase(t *testing.T) {
+	var stored string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("apikey") != "anon" || r.Header.Get("Authorization") != "Bearer ada-token" {
+			http.Error(w, `{"message":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/storage/v1/object/flashcard-assets/ada/photo.png":
+			if r.Header.Get("Content-Type") != "image/png" {
+				t.Errorf("Content-Type = %q, want image/png", r.Header.Get("Content-Type"))
+			}
+			if stored != "" {
+				http.Error(w, `{"message":"The resource already exists"}`, http.StatusBadRequest)
+				return
+			}
+			data, _ := io.ReadAll(r.Body)
+			stored = string(data)
+		case "/storage/v1/object/sign/flashcard-assets/ada/photo.png":
+			var body map[string]int
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["expiresIn"] != signedURLSeconds {
+				t.Errorf("expiresIn = %d, want %d", body["expiresIn"], signedURLSeconds)
+			}
+			json.NewEncoder(w).Encode(map[string]string{"signedURL": "/object/sign/flashcard-assets/ada/photo.png?token=t"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	bucket := NewSupabase(server.URL+"/", "anon", "flashcard-assets")
+	ctx := context.Background()
+	if err := bucket.Put(ctx, "ada-token", "ada/photo.png", "image/png", []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+	if stored != "png" {
+		t.Errorf("stored %q, want the upload", stored)
+	}
+	if err := bucket.Put(ctx, "ada-token", "ada/photo.png", "image/png", []byte("again")); err == nil {
+		t.Error("Put replaced an existing file")
+	}
+	if err := bucket.Put(ctx, "bob-token", "ada/other.png", "image/png", []byte("png")); err == nil {
+		t.Error("Put succeeded when the bucket refused it")
+	}
+	if err := bucket.Put(ctx, "ada-token", "ada/../x.png", "image/png", nil); err != ErrInvalidPath {
+		t.Errorf("Put with .. in the path: err = %v, want ErrInvalidPath", err)
+	}
+
+	url, err := bucket.URL(ctx, "ada-token", "ada/photo.png")
+	if want := server.URL + "/storage/v1/object/sign/flashcard-assets/ada/photo.png?token=t"; err != nil || url != want {
+		t.Errorf("URL = %q, %v; want %q", url, err, want)
+	}
+}
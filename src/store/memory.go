@@ -0,0 +1,681 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/utils"
+)
+
+// Memory is an in-memory backend for tests. It ignores access tokens, so
+// there is no row level security: every caller sees everything.
+type Memory struct {
+	mu sync.Mutex
+
+	nextID       int
+	students     map[string]*memoryStudent // by user ID
+	settings     map[string]models.StudentSettings
+	studentCards map[string]map[string]models.StudentCard // student ID, then card key
+	cards        map[string]models.Flashcard
+	defaultCards map[string]bool
+	tags         []models.Tag
+	reviewLogs   []models.ReviewLog
+	tutors       map[string]models.Tutor
+	classes      map[string]models.Class
+	members      []models.ClassMember
+	assignments  []models.Assignment
+}
+
+type memoryStudent struct {
+	studentID string
+	newCards  NewCardCount
+	streak    Streak
+	// Set by Create, as AddStudent's students are set up like the control
+	// panel's
+	defaultCardsPending bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		students:     map[string]*memoryStudent{},
+		settings:     map[string]models.StudentSettings{},
+		studentCards: map[string]map[string]models.StudentCard{},
+		cards:        map[string]models.Flashcard{},
+		defaultCards: map[string]bool{},
+		tutors:       map[string]models.Tutor{},
+		classes:      map[string]models.Class{},
+	}
+}
+
+func (m *Memory) For(accessToken string) Stores {
+	return Stores{
+		Students:     memoryStudents{m},
+		StudentCards: memoryStudentCards{m},
+		Cards:        memoryCards{m},
+		ReviewLogs:   memoryReviewLogs{m},
+		Classes:      memoryClasses{m},
+	}
+}
+
+// AddStudent maps a user to a new student, as signing up does.
+func (m *Memory) AddStudent(userID, studentID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.students[userID] = &memoryStudent{studentID: studentID}
+	m.studentCards[studentID] = map[string]models.StudentCard{}
+}
+
+// AddTutor gives a user the tutor role, as the control panel does.
+func (m *Memory) AddTutor(tutor models.Tutor) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tutors[tutor.UserID] = tutor
+}
+
+// AddOfficialCard adds a card with no owner, as the control panel does.
+// Default cards are given to every new student.
+func (m *Memory) AddOfficialCard(card models.Flashcard, isDefault bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	card.CreatedBy = ""
+	card.Ords = noteOrds(card.Ords)
+	m.cards[card.ID] = card
+	m.defaultCards[card.ID] = isDefault
+}
+
+// newID must be called with mu held.
+func (m *Memory) newID() string {
+	m.nextID++
+	return fmt.Sprintf("mem_%06d", m.nextID)
+}
+
+// studentExists must be called with mu held.
+func (m *Memory) studentExists(studentID string) bool {
+	_, ok := m.studentCards[studentID]
+	return ok
+}
+
+type memoryStudents struct{ m *Memory }
+
+func (s memoryStudents) StudentID(ctx context.Context, userID string) (string, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if st, ok := s.m.students[userID]; ok {
+		return st.studentID, nil
+	}
+	return "", nil
+}
+
+func (s memoryStudents) Create(ctx context.Context, userID, studentID string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if st, ok := s.m.students[userID]; ok {
+		return fmt.Errorf("user already has student %q", st.studentID)
+	}
+	if s.m.studentExists(studentID) {
+		return ErrStudentIDTaken
+	}
+	s.m.students[userID] = &memoryStudent{studentID: studentID, defaultCardsPending: true}
+	s.m.studentCards[studentID] = map[string]models.StudentCard{}
+	return nil
+}
+
+func (s memoryStudents) DefaultCardsLinked(ctx context.Context, userID string) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	st, ok := s.m.students[userID]
+	if !ok {
+		return false, ErrNotFound
+	}
+	return !st.defaultCardsPending, nil
+}
+
+func (s memoryStudents) SetDefaultCardsLinked(ctx context.Context, userID string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	st, ok := s.m.students[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	st.defaultCardsPending = false
+	return nil
+}
+
+func (s memoryStudents) NewCardCount(ctx context.Context, userID string) (NewCardCount, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	st, ok := s.m.students[userID]
+	if !ok {
+		return NewCardCount{}, ErrNotFound
+	}
+	return st.newCards, nil
+}
+
+func (s memoryStudents) SetNewCardCount(ctx context.Context, userID string, count NewCardCount) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	st, ok := s.m.students[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	st.newCards = count
+	return nil
+}
+
+func (s memoryStudents) Streak(ctx context.Context, userID string) (Streak, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	st, ok := s.m.students[userID]
+	if !ok {
+		return Streak{}, ErrNotFound
+	}
+	return st.streak, nil
+}
+
+func (s memoryStudents) SetStreak(ctx context.Context, userID string, streak Streak) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	st, ok := s.m.students[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	st.streak = streak
+	return nil
+}
+
+func (s memoryStudents) Settings(ctx context.Context, studentID string) (models.StudentSettings, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if settings, ok := s.m.settings[studentID]; ok {
+		return settings, nil
+	}
+	return models.DefaultStudentSettings(studentID), nil
+}
+
+func (s memoryStudents) SaveSettings(ctx context.Context, settings models.StudentSettings) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if !s.m.studentExists(settings.StudentID) {
+		return ErrStudentNotFound
+	}
+	s.m.settings[settings.StudentID] = settings
+	return nil
+}
+
+type memoryStudentCards struct{ m *Memory }
+
+func (s memoryStudentCards) List(ctx context.Context, studentID string) ([]models.StudentCard, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	cards := make([]models.StudentCard, 0, len(s.m.studentCards[studentID]))
+	for _, c := range s.m.studentCards[studentID] {
+		cards = append(cards, c)
+	}
+	sort.Slice(cards, func(i, j int) bool {
+		return utils.LexicalCardIDLess(cards[i].CardID, cards[j].CardID)
+	})
+	return cards, nil
+}
+
+func (s memoryStudentCards) Get(ctx context.Context, studentID, cardID string) (models.StudentCard, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	c, ok := s.m.studentCards[studentID][cardID]
+	if !ok {
+		return models.StudentCard{}, ErrNotFound
+	}
+	return c, nil
+}
+
+// Update goes through JSON so fields are named by column, as with PostgREST.
+func (s memoryStudentCards) Update(ctx context.Context, studentID, cardID string, fields map[string]interface{}) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	c, ok := s.m.studentCards[studentID][cardID]
+	if !ok {
+		return nil // PATCH matching no rows is not an error
+	}
+
+	b, _ := json.Marshal(c)
+	row := map[string]interface{}{}
+	json.Unmarshal(b, &row)
+	for k, v := range fields {
+		if _, ok := row[k]; !ok {
+			return fmt.Errorf("unknown students_cards column %q", k)
+		}
+		row[k] = v
+	}
+	b, _ = json.Marshal(row)
+	var updated models.StudentCard
+	if err := json.Unmarshal(b, &updated); err != nil {
+		return err
+	}
+	s.m.studentCards[studentID][cardID] = updated
+	return nil
+}
+
+func (s memoryStudentCards) Link(ctx context.Context, studentID string, noteIDs []string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if !s.m.studentExists(studentID) {
+		return ErrStudentNotFound
+	}
+	for _, id := range noteIDs {
+		if _, ok := s.m.cards[id]; !ok {
+			return fmt.Errorf("unknown card %q", id)
+		}
+	}
+	now := time.Now().Unix()
+	for _, id := range noteIDs {
+		for _, ord := range noteOrds(s.m.cards[id].Ords) {
+			key := models.CardKey(id, ord)
+			if _, ok := s.m.studentCards[studentID][key]; !ok {
+				s.m.studentCards[studentID][key] = models.StudentCard{CardID: key, Due: now}
+			}
+		}
+	}
+	return nil
+}
+
+func (s memoryStudentCards) Unlink(ctx context.Context, studentID, cardID string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	delete(s.m.studentCards[studentID], cardID)
+	return nil
+}
+
+type memoryCards struct{ m *Memory }
+
+func (s memoryCards) All(ctx context.Context) (map[string]models.Flashcard, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	cards := make(map[string]models.Flashcard, len(s.m.cards))
+	for id, c := range s.m.cards {
+		cards[id] = c
+	}
+	return cards, nil
+}
+
+func (s memoryCards) Get(ctx context.Context, cardID string) (models.Flashcard, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	c, ok := s.m.cards[cardID]
+	if !ok {
+		return models.Flashcard{}, ErrNotFound
+	}
+	c.Tags = nil // Get does not load tags
+	return c, nil
+}
+
+func (s memoryCards) IDsCreatedBy(ctx context.Context, userID string) ([]string, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var ids []string
+	for id, c := range s.m.cards {
+		if c.CreatedBy == userID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s memoryCards) DefaultIDs(ctx context.Context) ([]string, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var ids []string
+	for id, isDefault := range s.m.defaultCards {
+		if isDefault && s.m.cards[id].CreatedBy == "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s memoryCards) Insert(ctx context.Context, card models.Flashcard) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if _, ok := s.m.cards[card.ID]; ok {
+		return fmt.Errorf("card %q already exists", card.ID)
+	}
+	card.Tags = nil
+	card.Ords = noteOrds(card.Ords)
+	s.m.cards[card.ID] = card
+	return nil
+}
+
+func (s memoryCards) UpdateContent(ctx context.Context, cardID string, front, back models.Content, ords []int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	c, ok := s.m.cards[cardID]
+	if !ok {
+		return nil
+	}
+	c.Front, c.Back, c.Ords = front, back, noteOrds(ords)
+	s.m.cards[cardID] = c
+	return nil
+}
+
+func (s memoryCards) AppendAsset(ctx context.Context, cardID string, asset models.Asset) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	c, ok := s.m.cards[cardID]
+	if !ok {
+		return nil
+	}
+	c.Assets = append(append([]models.Asset{}, c.Assets...), asset)
+	s.m.cards[cardID] = c
+	return nil
+}
+
+func (s memoryCards) Tags(ctx context.Context, cardID string) ([]models.Tag, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	return append([]models.Tag{}, s.m.cards[cardID].Tags...), nil
+}
+
+func (s memoryCards) SetTags(ctx context.Context, cardID string, names []string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	c, ok := s.m.cards[cardID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	c.Tags = nil
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		c.Tags = append(c.Tags, s.m.tag(name))
+	}
+	s.m.cards[cardID] = c
+	return nil
+}
+
+// tag returns the named tag, creating it if needed. It must be called with
+// mu held.
+func (m *Memory) tag(name string) models.Tag {
+	for _, t := range m.tags {
+		if t.Name == name {
+			return t
+		}
+	}
+	t := models.Tag{ID: len(m.tags) + 1, Name: name}
+	m.tags = append(m.tags, t)
+	return t
+}
+
+type memoryReviewLogs struct{ m *Memory }
+
+func (s memoryReviewLogs) Insert(ctx context.Context, entry models.ReviewLog) (string, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	entry.ID = s.m.newID()
+	s.m.reviewLogs = append(s.m.reviewLogs, entry)
+	return entry.ID, nil
+}
+
+func (s memoryReviewLogs) Get(ctx context.Context, studentID, logID string) (models.ReviewLog, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, l := range s.m.reviewLogs {
+		if l.ID == logID && l.StudentID == studentID && l.UndoneAt == 0 {
+			return l, nil
+		}
+	}
+	return models.ReviewLog{}, ErrNotFound
+}
+
+func (s memoryReviewLogs) MarkUndone(ctx context.Context, studentID, logID string, at int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for i, l := range s.m.reviewLogs {
+		if l.ID == logID && l.StudentID == studentID && l.UndoneAt == 0 {
+			s.m.reviewLogs[i].UndoneAt = at
+		}
+	}
+	return nil
+}
+
+func (s memoryReviewLogs) Since(ctx context.Context, studentID string, since int64) ([]models.ReviewLog, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var logs []models.ReviewLog
+	for _, l := range s.m.reviewLogs {
+		if l.StudentID == studentID && l.ReviewedAt >= since && l.UndoneAt == 0 {
+			logs = append(logs, l)
+		}
+	}
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logs[i].ReviewedAt < logs[j].ReviewedAt
+	})
+	return logs, nil
+}
+
+func (s memoryReviewLogs) IntroducedSince(ctx context.Context, studentID string, since int64) (map[string]bool, error) {
+	logs, err := s.Since(ctx, studentID, since)
+	if err != nil {
+		return nil, err
+	}
+	introduced := map[string]bool{}
+	for _, l := range logs {
+		if l.PrevStatus == 0 {
+			introduced[l.CardID] = true
+		}
+	}
+	return introduced, nil
+}
+
+type memoryClasses struct{ m *Memory }
+
+func (s memoryClasses) Tutor(ctx context.Context, userID string) (models.Tutor, bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	t, ok := s.m.tutors[userID]
+	return t, ok, nil
+}
+
+func (s memoryClasses) Classes(ctx context.Context, tutorID string) ([]models.Class, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var classes []models.Class
+	for _, c := range s.m.classes {
+		if c.TutorID == tutorID {
+			classes = append(classes, c)
+		}
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		return classes[i].Name < classes[j].Name
+	})
+	return classes, nil
+}
+
+func (s memoryClasses) Class(ctx context.Context, classID string) (models.Class, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	c, ok := s.m.classes[classID]
+	if !ok {
+		return models.Class{}, ErrNotFound
+	}
+	return c, nil
+}
+
+func (s memoryClasses) CreateClass(ctx context.Context, tutorID, name string) (models.Class, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if _, ok := s.m.tutors[tutorID]; !ok {
+		return models.Class{}, fmt.Errorf("%q is not a tutor", tutorID)
+	}
+	if strings.TrimSpace(name) == "" {
+		return models.Class{}, fmt.Errorf("class name is required")
+	}
+	c := models.Class{ID: s.m.newID(), TutorID: tutorID, Name: name}
+	s.m.classes[c.ID] = c
+	return c, nil
+}
+
+func (s memoryClasses) DeleteClass(ctx context.Context, classID string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	delete(s.m.classes, classID)
+
+	// Cascade, as the foreign keys do
+	members := s.m.members[:0]
+	for _, mem := range s.m.members {
+		if mem.ClassID != classID {
+			members = append(members, mem)
+		}
+	}
+	s.m.members = members
+	assignments := s.m.assignments[:0]
+	for _, a := range s.m.assignments {
+		if a.ClassID != classID {
+			assignments = append(assignments, a)
+		}
+	}
+	s.m.assignments = assignments
+	return nil
+}
+
+func (s memoryClasses) Members(ctx context.Context, classID string) ([]models.ClassMember, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var members []models.ClassMember
+	for _, mem := range s.m.members {
+		if mem.ClassID == classID {
+			members = append(members, mem)
+		}
+	}
+	return members, nil
+}
+
+func (s memoryClasses) AddMember(ctx context.Context, classID, studentID string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if !s.m.studentExists(studentID) {
+		return ErrStudentNotFound
+	}
+	for _, mem := range s.m.members {
+		if mem.ClassID == classID && mem.StudentID == studentID {
+			return nil
+		}
+	}
+	s.m.members = append(s.m.members, models.ClassMember{ClassID: classID, StudentID: studentID, CreatedAt: time.Now().Unix()})
+	return nil
+}
+
+func (s memoryClasses) AcceptMember(ctx context.Context, classID, studentID string, at int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for i, mem := range s.m.members {
+		if mem.ClassID == classID && mem.StudentID == studentID && mem.AcceptedAt == 0 {
+			s.m.members[i].AcceptedAt = at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s memoryClasses) RemoveMember(ctx context.Context, classID, studentID string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	members := s.m.members[:0]
+	for _, mem := range s.m.members {
+		if mem.ClassID != classID || mem.StudentID != studentID {
+			members = append(members, mem)
+		}
+	}
+	s.m.members = members
+	return nil
+}
+
+func (s memoryClasses) StudentClasses(ctx context.Context, studentID string) ([]models.StudentClass, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var classes []models.StudentClass
+	for _, mem := range s.m.members {
+		if mem.StudentID != studentID {
+			continue
+		}
+		c := s.m.classes[mem.ClassID]
+		classes = append(classes, models.StudentClass{
+			ClassID:    c.ID,
+			ClassName:  c.Name,
+			TutorName:  s.m.tutors[c.TutorID].DisplayName,
+			AcceptedAt: mem.AcceptedAt,
+		})
+	}
+	return classes, nil
+}
+
+func (s memoryClasses) ClassAssignments(ctx context.Context, classID string, studentIDs []string) ([]models.Assignment, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	students := map[string]bool{}
+	for _, id := range studentIDs {
+		students[id] = true
+	}
+
+	var assignments []models.Assignment
+	// Newest first
+	for i := len(s.m.assignments) - 1; i >= 0; i-- {
+		a := s.m.assignments[i]
+		if a.ClassID == classID || (a.StudentID != "" && students[a.StudentID]) {
+			assignments = append(assignments, a)
+		}
+	}
+	return assignments, nil
+}
+
+func (s memoryClasses) StudentAssignments(ctx context.Context, studentID string) ([]models.Assignment, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	classes := map[string]bool{}
+	for _, mem := range s.m.members {
+		if mem.StudentID == studentID && mem.AcceptedAt != 0 {
+			classes[mem.ClassID] = true
+		}
+	}
+
+	var assignments []models.Assignment
+	for _, a := range s.m.assignments {
+		if a.StudentID == studentID || (a.ClassID != "" && classes[a.ClassID]) {
+			assignments = append(assignments, a)
+		}
+	}
+	return assignments, nil
+}
+
+func (s memoryClasses) CreateAssignment(ctx context.Context, assignment models.Assignment) (models.Assignment, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if (assignment.ClassID == "") == (assignment.StudentID == "") {
+		return models.Assignment{}, fmt.Errorf("assignment needs exactly one of class_id and student_id")
+	}
+	assignment.ID = s.m.newID()
+	s.m.assignments = append(s.m.assignments, assignment)
+	return assignment, nil
+}
+
+func (s memoryClasses) DeleteAssignment(ctx context.Context, assignmentID string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	assignments := s.m.assignments[:0]
+	for _, a := range s.m.assignments {
+		if a.ID != assignmentID {
+			assignments = append(assignments, a)
+		}
+	}
+	s.m.assignments = assignments
+	return nil
+}
@@ -0,0 +1,360 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/abstract-tutoring/models"
+)
+
+// newTestMemory has one student, ada, and two official notes: "capital",
+// which is reversible and a default, and "extra".
+func newTestMemory(t *testing.T) (*Memory, Stores) {
+	t.Helper()
+	m := NewMemory()
+	m.AddStudent("ada-user", "ada")
+	m.AddOfficialCard(models.Flashcard{ID: "capital", Ords: []int{0, models.OrdReversed}}, true)
+	m.AddOfficialCard(models.Flashcard{ID: "extra"}, false)
+	return m, m.For("")
+}
+
+func cardIDs(t *testing.T, stores Stores, studentID string) []string {
+	t.Helper()
+	cards, err := stores.StudentCards.List(context.Background(), studentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, c := range cards {
+		ids = append(ids, c.CardID)
+	}
+	return ids
+}
+
+func TestMemoryCreateStudent(t *testing.T) {
+	ctx := context.Background()
+	_, stores := newTestMemory(t)
+	students := stores.Students
+
+	if err := students.Create(ctx, "bob-user", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := students.StudentID(ctx, "bob-user"); err != nil || id != "bob" {
+		t.Errorf("StudentID = %q, %v; want bob", id, err)
+	}
+	if id, err := students.StudentID(ctx, "nobody"); err != nil || id != "" {
+		t.Errorf("StudentID for a user with no student = %q, %v; want \"\"", id, err)
+	}
+
+	if err := students.Create(ctx, "cy-user", "bob"); !errors.Is(err, ErrStudentIDTaken) {
+		t.Errorf("Create with a taken ID = %v, want ErrStudentIDTaken", err)
+	}
+	if err := students.Create(ctx, "bob-user", "bob2"); err == nil {
+		t.Error("Create for a user who has a student succeeded")
+	}
+
+	// New students wait for the default cards; AddStudent's already have them
+	if linked, err := students.DefaultCardsLinked(ctx, "bob-user"); err != nil || linked {
+		t.Errorf("DefaultCardsLinked after Create = %v, %v; want false", linked, err)
+	}
+	if err := students.SetDefaultCardsLinked(ctx, "bob-user"); err != nil {
+		t.Fatal(err)
+	}
+	if linked, err := students.DefaultCardsLinked(ctx, "bob-user"); err != nil || !linked {
+		t.Errorf("DefaultCardsLinked after setting = %v, %v; want true", linked, err)
+	}
+	if linked, err := students.DefaultCardsLinked(ctx, "ada-user"); err != nil || !linked {
+		t.Errorf("DefaultCardsLinked for AddStudent = %v, %v; want true", linked, err)
+	}
+	if _, err := students.DefaultCardsLinked(ctx, "nobody"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DefaultCardsLinked for no student = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryLink(t *testing.T) {
+	ctx := context.Background()
+	_, stores := newTestMemory(t)
+	cards := stores.StudentCards
+
+	if err := cards.Link(ctx, "ada", []string{"capital"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cardIDs(t, stores, "ada"), []string{"capital", "capital#1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cards = %v, want %v", got, want)
+	}
+
+	// Linking again keeps the progress
+	if err := cards.Update(ctx, "ada", "capital", map[string]interface{}{"status": 5, "lapses": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cards.Link(ctx, "ada", []string{"capital", "extra"}); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := cards.Get(ctx, "ada", "capital"); c.Status != 5 || c.Lapses != 2 {
+		t.Errorf("card after linking again = %+v, want its progress kept", c)
+	}
+	if got, want := cardIDs(t, stores, "ada"), []string{"capital", "capital#1", "extra"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cards = %v, want %v", got, want)
+	}
+
+	if err := cards.Link(ctx, "nobody", []string{"capital"}); !errors.Is(err, ErrStudentNotFound) {
+		t.Errorf("Link for an unknown student = %v, want ErrStudentNotFound", err)
+	}
+	if err := cards.Link(ctx, "ada", []string{"extra", "missing"}); err == nil {
+		t.Error("Link with an unknown note succeeded")
+	}
+
+	if err := cards.Unlink(ctx, "ada", "capital#1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cardIDs(t, stores, "ada"), []string{"capital", "extra"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cards after Unlink = %v, want %v", got, want)
+	}
+}
+
+func TestMemoryUpdate(t *testing.T) {
+	ctx := context.Background()
+	_, stores := newTestMemory(t)
+	cards := stores.StudentCards
+	if err := cards.Link(ctx, "ada", []string{"extra"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := cards.Update(ctx, "ada", "extra", map[string]interface{}{"suspended": true, "buried_until": 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := cards.Get(ctx, "ada", "extra"); !c.Suspended || c.BuriedUntil != 100 {
+		t.Errorf("card = %+v, want it suspended and buried", c)
+	}
+
+	if err := cards.Update(ctx, "ada", "extra", map[string]interface{}{"Suspended": false}); err == nil {
+		t.Error("Update with a field name rather than a column succeeded")
+	}
+	// As with a PATCH that matches no rows
+	if err := cards.Update(ctx, "ada", "missing", map[string]interface{}{"suspended": true}); err != nil {
+		t.Errorf("Update of a card the student doesn't have = %v, want nil", err)
+	}
+	if _, err := cards.Get(ctx, "ada", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after updating a missing card = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryAppendAsset(t *testing.T) {
+	ctx := context.Background()
+	_, stores := newTestMemory(t)
+
+	// Uploads at once each add their own image
+	var wg sync.WaitGroup
+	for _, id := range []string{"ada/a.png", "ada/b.png", "ada/c.png"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := stores.Cards.AppendAsset(ctx, "extra", models.Asset{ID: id, Type: "image"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	card, err := stores.Cards.Get(ctx, "extra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(card.Assets) != 3 {
+		t.Errorf("assets = %+v, want all three", card.Assets)
+	}
+}
+
+func TestMemoryDefaultIDs(t *testing.T) {
+	ctx := context.Background()
+	_, stores := newTestMemory(t)
+
+	// A student's own card is never a default
+	err := stores.Cards.Insert(ctx, models.Flashcard{ID: "mine", CreatedBy: "ada-user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := stores.Cards.DefaultIDs(ctx); err != nil || !reflect.DeepEqual(ids, []string{"capital"}) {
+		t.Errorf("DefaultIDs = %v, %v; want [capital]", ids, err)
+	}
+	if ids, err := stores.Cards.IDsCreatedBy(ctx, "ada-user"); err != nil || !reflect.DeepEqual(ids, []string{"mine"}) {
+		t.Errorf("IDsCreatedBy = %v, %v; want [mine]", ids, err)
+	}
+	if err := stores.Cards.Insert(ctx, models.Flashcard{ID: "mine"}); err == nil {
+		t.Error("inserting a card twice succeeded")
+	}
+}
+
+func TestMemoryReviewLogs(t *testing.T) {
+	ctx := context.Background()
+	m, stores := newTestMemory(t)
+	m.AddStudent("bob-user", "bob")
+	logs := stores.ReviewLogs
+
+	first, err := logs.Insert(ctx, models.ReviewLog{StudentID: "ada", CardID: "capital", ReviewedAt: 200, PrevStatus: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := logs.Insert(ctx, models.ReviewLog{StudentID: "ada", CardID: "capital", ReviewedAt: 100, PrevStatus: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := logs.Insert(ctx, models.ReviewLog{StudentID: "bob", CardID: "extra", ReviewedAt: 150}); err != nil {
+		t.Fatal(err)
+	}
+
+	since, err := logs.Since(ctx, "ada", 0)
+	if err != nil || len(since) != 2 || since[0].ReviewedAt != 100 || since[1].ID != first {
+		t.Errorf("Since = %+v, %v; want ada's two, oldest first", since, err)
+	}
+	if introduced, err := logs.IntroducedSince(ctx, "ada", 0); err != nil || !reflect.DeepEqual(introduced, map[string]bool{"capital": true}) {
+		t.Errorf("IntroducedSince = %v, %v; want capital", introduced, err)
+	}
+
+	// Logs are only found through their own student
+	if _, err := logs.Get(ctx, "bob", first); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get by another student = %v, want ErrNotFound", err)
+	}
+	if err := logs.MarkUndone(ctx, "bob", first, 300); err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := logs.Get(ctx, "ada", first); err != nil || entry.CardID != "capital" {
+		t.Errorf("Get after another student's MarkUndone = %+v, %v; want it kept", entry, err)
+	}
+	if err := logs.MarkUndone(ctx, "ada", first, 300); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := logs.Get(ctx, "ada", first); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after MarkUndone = %v, want ErrNotFound", err)
+	}
+	// Undone answers stay in the history but aren't read back
+	if len(m.reviewLogs) != 3 {
+		t.Errorf("%d review logs kept, want all 3", len(m.reviewLogs))
+	}
+	if since, err := logs.Since(ctx, "ada", 0); err != nil || len(since) != 1 || since[0].ID == first {
+		t.Errorf("Since after MarkUndone = %+v, %v; want only the other answer", since, err)
+	}
+	if introduced, err := logs.IntroducedSince(ctx, "ada", 0); err != nil || len(introduced) != 0 {
+		t.Errorf("IntroducedSince after MarkUndone = %v, %v; want none", introduced, err)
+	}
+}
+
+func TestMemoryClasses(t *testing.T) {
+	ctx := context.Background()
+	m, stores := newTestMemory(t)
+	m.AddStudent("bob-user", "bob")
+	m.AddTutor(models.Tutor{UserID: "tess-user", DisplayName: "Tess"})
+	classes := stores.Classes
+
+	if _, ok, err := classes.Tutor(ctx, "ada-user"); err != nil || ok {
+		t.Errorf("Tutor for a student = %v, %v; want not a tutor", ok, err)
+	}
+	if _, err := classes.CreateClass(ctx, "ada-user", "Mine"); err == nil {
+		t.Error("a student created a class")
+	}
+	if _, err := classes.CreateClass(ctx, "tess-user", " "); err == nil {
+		t.Error("created a class with no name")
+	}
+
+	class, err := classes.CreateClass(ctx, "tess-user", "Year 9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := classes.CreateClass(ctx, "tess-user", "Year 10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := classes.Classes(ctx, "tess-user"); len(got) != 2 || got[0].ID != other.ID {
+		t.Errorf("Classes = %+v, want both, by name", got)
+	}
+
+	for _, id := range []string{"ada", "bob", "ada"} {
+		if err := classes.AddMember(ctx, class.ID, id); err != nil {
+			t.Fatalf("AddMember(%s): %v", id, err)
+		}
+	}
+	if err := classes.AddMember(ctx, class.ID, "nobody"); !errors.Is(err, ErrStudentNotFound) {
+		t.Errorf("AddMember for an unknown student = %v, want ErrStudentNotFound", err)
+	}
+	if err := classes.AddMember(ctx, other.ID, "ada"); err != nil {
+		t.Fatal(err)
+	}
+	if members, _ := classes.Members(ctx, class.ID); len(members) != 2 || members[0].StudentID != "ada" || members[1].StudentID != "bob" {
+		t.Errorf("Members = %+v, want ada then bob", members)
+	}
+
+	if _, err := classes.CreateAssignment(ctx, models.Assignment{TutorID: "tess-user", Title: "None"}); err == nil {
+		t.Error("created an assignment for nobody")
+	}
+	if _, err := classes.CreateAssignment(ctx, models.Assignment{TutorID: "tess-user", ClassID: class.ID, StudentID: "ada"}); err == nil {
+		t.Error("created an assignment for a class and a student at once")
+	}
+	toClass, err := classes.CreateAssignment(ctx, models.Assignment{TutorID: "tess-user", ClassID: class.ID, Title: "Class"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	toBob, err := classes.CreateAssignment(ctx, models.Assignment{TutorID: "tess-user", StudentID: "bob", Title: "Bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := classes.ClassAssignments(ctx, class.ID, []string{"bob"}); len(got) != 2 || got[0].ID != toBob.ID || got[1].ID != toClass.ID {
+		t.Errorf("ClassAssignments = %+v, want bob's then the class's", got)
+	}
+
+	// The class's decks reach its students once they accept
+	if got, _ := classes.StudentAssignments(ctx, "ada"); len(got) != 0 {
+		t.Errorf("ada's assignments before accepting = %+v, want none", got)
+	}
+	if err := classes.AcceptMember(ctx, class.ID, "nobody", 100); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AcceptMember without an invitation = %v, want ErrNotFound", err)
+	}
+	for _, id := range []string{"ada", "bob"} {
+		if err := classes.AcceptMember(ctx, class.ID, id, 100); err != nil {
+			t.Fatalf("AcceptMember(%s): %v", id, err)
+		}
+	}
+	if err := classes.AcceptMember(ctx, class.ID, "ada", 200); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AcceptMember twice = %v, want ErrNotFound", err)
+	}
+	if got, _ := classes.StudentAssignments(ctx, "ada"); len(got) != 1 || got[0].ID != toClass.ID {
+		t.Errorf("ada's assignments = %+v, want the class's", got)
+	}
+	want := []models.StudentClass{
+		{ClassID: class.ID, ClassName: "Year 9", TutorName: "Tess", AcceptedAt: 100},
+		{ClassID: other.ID, ClassName: "Year 10", TutorName: "Tess"},
+	}
+	if got, _ := classes.StudentClasses(ctx, "ada"); !reflect.DeepEqual(got, want) {
+		t.Errorf("StudentClasses = %+v, want %+v", got, want)
+	}
+
+	// Leaving the class drops its assignments, not the student's own
+	if err := classes.RemoveMember(ctx, class.ID, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := classes.StudentAssignments(ctx, "bob"); len(got) != 1 || got[0].ID != toBob.ID {
+		t.Errorf("bob's assignments after leaving = %+v, want only bob's own", got)
+	}
+
+	// Deleting a class takes its members and assignments with it
+	if err := classes.DeleteClass(ctx, class.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := classes.Class(ctx, class.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Class after DeleteClass = %v, want ErrNotFound", err)
+	}
+	if members, _ := classes.Members(ctx, class.ID); len(members) != 0 {
+		t.Errorf("members after DeleteClass = %+v, want none", members)
+	}
+	if members, _ := classes.Members(ctx, other.ID); len(members) != 1 {
+		t.Errorf("other class's members = %+v, want ada kept", members)
+	}
+	if got, _ := classes.StudentAssignments(ctx, "ada"); len(got) != 0 {
+		t.Errorf("ada's assignments after DeleteClass = %+v, want none", got)
+	}
+	if got, _ := classes.StudentAssignments(ctx, "bob"); len(got) != 1 {
+		t.Errorf("bob's assignments after DeleteClass = %+v, want bob's own kept", got)
+	}
+}
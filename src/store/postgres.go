@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/abstract-tutoring/auth"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgres talks to the database directly. There is no RLS in the way (the
+// app connects as the owner), so every query checks the caller itself; the
+// checks mirror the policies in the migrations.
+type postgres struct {
+	pool      *pgxpool.Pool
+	jwtSecret []byte
+}
+
+// NewPostgres uses the schema from the migrations in pool's database. Access
+// tokens are HS256 JWTs, from Supabase or auth.NewLocal, checked with
+// jwtSecret.
+func NewPostgres(pool *pgxpool.Pool, jwtSecret string) Backend {
+	return &postgres{pool: pool, jwtSecret: []byte(jwtSecret)}
+}
+
+func (p *postgres) For(accessToken string) Stores {
+	var authErr error
+	userID, err := auth.ParseAccessToken(p.jwtSecret, accessToken, time.Now())
+	if err != nil {
+		authErr = ErrUnauthorized
+	}
+	c := &pgClient{postgres: p, userID: userID, authErr: authErr}
+	return Stores{
+		Students:     pgStudents{c},
+		StudentCards: pgStudentCards{c},
+		Cards:        pgCards{c},
+		ReviewLogs:   pgReviewLogs{c},
+		Classes:      pgClasses{c},
+	}
+}
+
+type pgClient struct {
+	*postgres
+	userID  string
+	authErr error
+}
+
+// caller is the user making the request. Most queries take the caller as $1,
+// which the conditions below rely on.
+func (c *pgClient) caller() (string, error) {
+	return c.userID, c.authErr
+}
+
+// The policies from the migrations, as SQL conditions on the caller ($1).
+const (
+	// ownStudentIDs is the caller's own student_id.
+	ownStudentIDs = `(select student_id from users_students where user_id = $1)`
+
+	// tutoredStudentIDs are the students who have joined the caller's
+	// classes.
+	tutoredStudentIDs = `(select m.student_id from class_members m join classes c on c.id = m.class_id
+		where c.tutor_id = $1 and m.accepted_at is not null)`
+
+	// officialCardIDs are the cards everyone can read.
+	officialCardIDs = `(select id from cards where created_by is null)`
+
+	// visibleCardTag is the cards_tags policy for reading: the card is one of
+	// the caller's, or the caller is a tutor and the card is official.
+	visibleCardTag = `(exists (
+		select 1 from students_cards sc
+		where sc.card_id = ct.card_id and sc.student_id in ` + ownStudentIDs + `
+	) or (
+		exists (select 1 from tutors where user_id = $1) and ct.card_id in ` + officialCardIDs + `
+	))`
+)
+
+// owns reports whether studentID is the caller's.
+func (c *pgClient) owns(ctx context.Context, uid, studentID string) (bool, error) {
+	var ok bool
+	err := c.pool.QueryRow(ctx, `select exists (select 1 from users_students where user_id = $1 and student_id = $2)`,
+		uid, studentID).Scan(&ok)
+	return ok, err
+}
+
+// tutors reports whether studentID is in one of the caller's classes.
+func (c *pgClient) tutors(ctx context.Context, uid, studentID string) (bool, error) {
+	var ok bool
+	err := c.pool.QueryRow(ctx, `select $2 in `+tutoredStudentIDs, uid, studentID).Scan(&ok)
+	return ok, err
+}
+
+func isPgError(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
@@ -0,0 +1,395 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/utils"
+	"github.com/jackc/pgx/v5"
+)
+
+// pgStudentCardColumns is the students_cards projection read by scanStudentCard.
+const pgStudentCardColumns = "card_id, ord, status, due, stability, difficulty, last_review, lapses, suspended, leech, buried_until"
+
+// studentCardUpdatable are the students_cards columns Update may set.
+var studentCardUpdatable = map[string]bool{
+	"status": true, "due": true, "stability": true, "difficulty": true, "last_review": true,
+	"lapses": true, "suspended": true, "leech": true, "buried_until": true,
+}
+
+type pgStudentCards struct{ c *pgClient }
+
+// List returns the student's cards in card ID order.
+func (s pgStudentCards) List(ctx context.Context, studentID string) ([]models.StudentCard, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.c.pool.Query(ctx, `
+		select `+pgStudentCardColumns+` from students_cards
+		where student_id = $2
+			and (student_id in `+ownStudentIDs+` or student_id in `+tutoredStudentIDs+`)`,
+		uid, studentID)
+	if err != nil {
+		return nil, err
+	}
+	cards, err := pgx.CollectRows(rows, scanStudentCard)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(cards, func(i, j int) bool {
+		return utils.LexicalCardIDLess(cards[i].CardID, cards[j].CardID)
+	})
+	return cards, nil
+}
+
+func (s pgStudentCards) Get(ctx context.Context, studentID, cardID string) (models.StudentCard, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return models.StudentCard{}, err
+	}
+	noteID, ord := models.SplitCardKey(cardID)
+
+	rows, err := s.c.pool.Query(ctx, `
+		select `+pgStudentCardColumns+` from students_cards
+		where student_id = $2 and card_id = $3 and ord = $4
+			and (student_id in `+ownStudentIDs+` or student_id in `+tutoredStudentIDs+`)`,
+		uid, studentID, noteID, ord)
+	if err != nil {
+		return models.StudentCard{}, err
+	}
+	card, err := pgx.CollectOneRow(rows, scanStudentCard)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.StudentCard{}, ErrNotFound
+	}
+	return card, err
+}
+
+func scanStudentCard(row pgx.CollectableRow) (models.StudentCard, error) {
+	var c models.StudentCard
+	var ord int
+	err := row.Scan(&c.CardID, &ord, &c.Status, &c.Due, &c.Stability, &c.Difficulty, &c.LastReview,
+		&c.Lapses, &c.Suspended, &c.Leech, &c.BuriedUntil)
+	c.CardID = models.CardKey(c.CardID, ord)
+	return c, err
+}
+
+func (s pgStudentCards) Update(ctx context.Context, studentID, cardID string, fields map[string]interface{}) error {
+	uid, err := s.c.caller()
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	columns := make([]string, 0, len(fields))
+	for column := range fields {
+		if !studentCardUpdatable[column] {
+			return fmt.Errorf("students_cards has no updatable column %q", column)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	noteID, ord := models.SplitCardKey(cardID)
+	args := []interface{}{uid, studentID, noteID, ord}
+	set := make([]string, 0, len(columns))
+	for _, column := range columns {
+		args = append(args, fields[column])
+		set = append(set, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	_, err = s.c.pool.Exec(ctx, `
+		update students_cards set `+strings.Join(set, ", ")+`
+		where student_id = $2 and card_id = $3 and ord = $4 and student_id in `+ownStudentIDs, args...)
+	return err
+}
+
+// Link lets students link their own and official cards, and tutors link
+// official cards for the students in their classes.
+func (s pgStudentCards) Link(ctx context.Context, studentID string, noteIDs []string) error {
+	uid, err := s.c.caller()
+	if err != nil {
+		return err
+	}
+	if len(noteIDs) == 0 {
+		return nil
+	}
+
+	var exists bool
+	if err := s.c.pool.QueryRow(ctx, `select exists (select 1 from users_students where student_id = $1)`,
+		studentID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrStudentNotFound
+	}
+
+	// allowed is the cards the caller may link for this student
+	var allowed string
+	args := []interface{}{noteIDs}
+	if ok, err := s.c.owns(ctx, uid, studentID); err != nil {
+		return err
+	} else if ok {
+		allowed = `(select id from cards where created_by = $2 or created_by is null)`
+		args = append(args, uid)
+	} else if ok, err := s.c.tutors(ctx, uid, studentID); err != nil {
+		return err
+	} else if ok {
+		allowed = officialCardIDs
+	} else {
+		return ErrForbidden
+	}
+
+	var forbidden bool
+	if err := s.c.pool.QueryRow(ctx, `
+		select exists (select 1 from unnest($1::text[]) as id where id not in `+allowed+`)`,
+		args...).Scan(&forbidden); err != nil {
+		return err
+	}
+	if forbidden {
+		return ErrForbidden
+	}
+
+	_, err = s.c.pool.Exec(ctx, `
+		insert into students_cards (student_id, card_id, ord)
+		select $1, c.id, ord from cards c, unnest(c.ords) as ord
+		where c.id = any($2::text[])
+		on conflict (student_id, card_id, ord) do nothing`, studentID, noteIDs)
+	return err
+}
+
+func (s pgStudentCards) Unlink(ctx context.Context, studentID, cardID string) error {
+	uid, err := s.c.caller()
+	if err != nil {
+		return err
+	}
+
+	noteID, ord := models.SplitCardKey(cardID)
+
+	_, err = s.c.pool.Exec(ctx, `
+		delete from students_cards
+		where student_id = $2 and card_id = $3 and ord = $4 and student_id in `+ownStudentIDs,
+		uid, studentID, noteID, ord)
+	return err
+}
+
+type pgCards struct{ c *pgClient }
+
+// The caller can read their own cards and the official ones.
+const visibleCard = `(created_by = $1 or created_by is null)`
+
+func (s pgCards) All(ctx context.Context) (map[string]models.Flashcard, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.c.pool.Query(ctx, `
+		select id, front, back, assets, coalesce(created_by::text, ''), ords from cards
+		where `+visibleCard, uid)
+	if err != nil {
+		return nil, err
+	}
+	cardList, err := pgx.CollectRows(rows, scanCard)
+	if err != nil {
+		return nil, err
+	}
+
+	cards := make(map[string]models.Flashcard, len(cardList))
+	for _, card := range cardList {
+		cards[card.ID] = card
+	}
+
+	rows, err = s.c.pool.Query(ctx, `
+		select ct.card_id, t.id, t.name
+		from cards_tags ct join tags t on t.id = ct.tag_id
+		where `+visibleCardTag+`
+		order by t.id`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cardID string
+		var tag models.Tag
+		if err := rows.Scan(&cardID, &tag.ID, &tag.Name); err != nil {
+			return nil, err
+		}
+		if card, ok := cards[cardID]; ok {
+			card.Tags = append(card.Tags, tag)
+			cards[cardID] = card
+		}
+	}
+	return cards, rows.Err()
+}
+
+func (s pgCards) Get(ctx context.Context, cardID string) (models.Flashcard, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return models.Flashcard{}, err
+	}
+
+	rows, err := s.c.pool.Query(ctx, `
+		select id, front, back, assets, coalesce(created_by::text, ''), ords from cards
+		where id = $2 and `+visibleCard, uid, cardID)
+	if err != nil {
+		return models.Flashcard{}, err
+	}
+	card, err := pgx.CollectOneRow(rows, scanCard)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Flashcard{}, ErrNotFound
+	}
+	return card, err
+}
+
+func scanCard(row pgx.CollectableRow) (models.Flashcard, error) {
+	var c models.Flashcard
+	err := row.Scan(&c.ID, &c.Front, &c.Back, &c.Assets, &c.CreatedBy, &c.Ords)
+	return c, err
+}
+
+// IDsCreatedBy only finds the caller's own cards.
+func (s pgCards) IDsCreatedBy(ctx context.Context, userID string) ([]string, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return nil, err
+	}
+	if userID != uid {
+		return []string{}, nil
+	}
+
+	rows, err := s.c.pool.Query(ctx, `select id from cards where created_by = $1`, uid)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (s pgCards) DefaultIDs(ctx context.Context) ([]string, error) {
+	if _, err := s.c.caller(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.c.pool.Query(ctx, `select id from cards where created_by is null and is_default order by id`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// Insert only accepts cards created by the caller; official cards come from
+// the control panel.
+func (s pgCards) Insert(ctx context.Context, card models.Flashcard) error {
+	uid, err := s.c.caller()
+	if err != nil {
+		return err
+	}
+	if card.CreatedBy != uid {
+		return ErrForbidden
+	}
+
+	assets := card.Assets
+	if assets == nil {
+		assets = []models.Asset{}
+	}
+	_, err = s.c.pool.Exec(ctx, `
+		insert into cards (id, front, back, assets, created_by, ords)
+		values ($2, $3, $4, $5, $1, $6)`, uid, card.ID, card.Front, card.Back, assets, noteOrds(card.Ords))
+	return err
+}
+
+func (s pgCards) UpdateContent(ctx context.Context, cardID string, front, back models.Content, ords []int) error {
+	uid, err := s.c.caller()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.c.pool.Exec(ctx, `
+		update cards set front = $3, back = $4, ords = $5
+		where id = $2 and created_by = $1`,
+		uid, cardID, front, back, noteOrds(ords))
+	return err
+}
+
+func (s pgCards) AppendAsset(ctx context.Context, cardID string, asset models.Asset) error {
+	uid, err := s.c.caller()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.c.pool.Exec(ctx, `
+		update cards set assets = coalesce(assets, '[]'::jsonb) || jsonb_build_array($3::jsonb)
+		where id = $2 and created_by = $1`,
+		uid, cardID, asset)
+	return err
+}
+
+func (s pgCards) Tags(ctx context.Context, cardID string) ([]models.Tag, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.c.pool.Query(ctx, `
+		select t.id, t.name
+		from cards_tags ct join tags t on t.id = ct.tag_id
+		where ct.card_id = $2 and `+visibleCardTag+`
+		order by t.id`, uid, cardID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Tag, error) {
+		var t models.Tag
+		err := row.Scan(&t.ID, &t.Name)
+		return t, err
+	})
+}
+
+// SetTags needs the card to be one of the caller's student's cards.
+func (s pgCards) SetTags(ctx context.Context, cardID string, names []string) error {
+	uid, err := s.c.caller()
+	if err != nil {
+		return err
+	}
+
+	var linked bool
+	if err := s.c.pool.QueryRow(ctx, `
+		select exists (select 1 from students_cards where card_id = $2 and student_id in `+ownStudentIDs+`)`,
+		uid, cardID).Scan(&linked); err != nil {
+		return err
+	}
+	if !linked {
+		return ErrForbidden
+	}
+
+	return pgx.BeginFunc(ctx, s.c.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `delete from cards_tags where card_id = $1`, cardID); err != nil {
+			return err
+		}
+		for _, name := range names {
+			var tagID int
+			err := tx.QueryRow(ctx, `
+				insert into tags (name) values ($1)
+				on conflict (name) do update set name = excluded.name
+				returning id`, name).Scan(&tagID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, `
+				insert into cards_tags (card_id, tag_id) values ($1, $2)
+				on conflict do nothing`, cardID, tagID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
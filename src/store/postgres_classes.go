@@ -0,0 +1,315 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ownClassIDs are the classes the caller teaches.
+const ownClassIDs = `(select id from classes where tutor_id = $1)`
+
+// assignmentColumns is the assignments projection read by scanAssignment.
+const assignmentColumns = `id::text, tutor_id::text, coalesce(class_id::text, ''), coalesce(student_id, ''),
+	title, tags, card_ids, coalesce(to_char(learn_by, 'YYYY-MM-DD'), '')`
+
+// The caller can read the assignments they made and the ones made to them,
+// directly or through a class they have joined.
+const visibleAssignment = `(tutor_id = $1 or student_id in ` + ownStudentIDs + ` or class_id in (
+	select class_id from class_members where accepted_at is not null and student_id in ` + ownStudentIDs + `
+))`
+
+type pgClasses struct{ c *pgClient }
+
+func (s pgClasses) Tutor(ctx context.Context, userID string) (models.Tutor, bool, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return models.Tutor{}, false, err
+	}
+	if userID != uid {
+		return models.Tutor{}, false, nil
+	}
+
+	tutor := models.Tutor{UserID: uid}
+	err = s.c.pool.QueryRow(ctx, `select display_name from tutors where user_id = $1`, uid).Scan(&tutor.DisplayName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Tutor{}, false, nil
+	}
+	if err != nil {
+		return models.Tutor{}, false, err
+	}
+	return tutor, true, nil
+}
+
+func (s pgClasses) Classes(ctx context.Context, tutorID string) ([]models.Class, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.c.pool.Query(ctx, `
+		select id::text, tutor_id::text, name from classes
+		where tutor_id = $1 and tutor_id::text = $2
+		order by name`, uid, tutorID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanClass)
+}
+
+// Class returns ErrNotFound for other tutors' classes.
+func (s pgClasses) Class(ctx context.Context, classID string) (models.Class, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return models.Class{}, err
+	}
+
+	rows, err := s.c.pool.Query(ctx, `
+		select id::text, tutor_id::text, name from classes
+		where tutor_id = $1 and id::text = $2`, uid, classID)
+	if err != nil {
+		return models.Class{}, err
+	}
+	class, err := pgx.CollectOneRow(rows, scanClass)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Class{}, ErrNotFound
+	}
+	return class, err
+}
+
+func scanClass(row pgx.CollectableRow) (models.Class, error) {
+	var c models.Class
+	err := row.Scan(&c.ID, &c.TutorID, &c.Name)
+	return c, err
+}
+
+func (s pgClasses) CreateClass(ctx context.Context, tutorID, name string) (models.Class, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return models.Class{}, err
+	}
+	if tutorID != uid {
+		return models.Class{}, ErrForbidden
+	}
+
+	rows, err := s.c.pool.Query(ctx, `
+		insert into classes (tutor_id, name) values ($1, $2)
+		returning id::text, tutor_id::text, name`, uid, name)
+	if err != nil {
+		return models.Class{}, err
+	}
+	return pgx.CollectOneRow(rows, scanClass)
+}
+
+func (s pgClasses) DeleteClass(ctx context.Context, classID string) error {
+	uid, err := s.c.caller()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.c.pool.Exec(ctx, `delete from classes where tutor_id = $1 and id::text = $2`, uid, classID)
+	return err
+}
+
+// Members can be read by the class's tutor, and students see their own
+// membership.
+func (s pgClasses) Members(ctx context.Context, classID string) ([]models.ClassMember, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.c.pool.Query(ctx, `
+		select class_id::text, student_id, created_at, coalesce(accepted_at, 0) from class_members
+		where class_id::text = $2
+			and (class_id in `+ownClassIDs+` or student_id in `+ownStudentIDs+`)
+		order by created_at`, uid, classID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.ClassMember, error) {
+		var m models.ClassMember
+		err := row.Scan(&m.ClassID, &m.StudentID, &m.CreatedAt, &m.AcceptedAt)
+		return m, err
+	})
+}
+
+func (s pgClasses) AddMember(ctx context.Context, classID, studentID string) error {
+	uid, err := s.c.caller()
+	if err != nil {
+		return err
+	}
+	if _, err := s.Class(ctx, classID); errors.Is(err, ErrNotFound) {
+		return ErrForbidden
+	} else if err != nil {
+		return err
+	}
+
+	_, err = s.c.pool.Exec(ctx, `
+		insert into class_members (class_id, student_id)
+		select id, $3 from classes where tutor_id = $1 and id::text = $2
+		on conflict (class_id, student_id) do nothing`, uid, classID, studentID)
+	if isPgError(err, "23503") { // foreign key: no such student
+		return ErrStudentNotFound
+	}
+	return err
+}
+
+// AcceptMember only accepts the caller's own invitations.
+func (s pgClasses) AcceptMember(ctx context.Context, classID, studentID string, at int64) error {
+	uid, err := s.c.caller()
+	if err != nil {
+		return err
+	}
+
+	tag, err := s.c.pool.Exec(ctx, `
+		update class_members set accepted_at = $4
+		where class_id::text = $2 and student_id = $3 and accepted_at is null
+			and student_id in `+ownStudentIDs,
+		uid, classID, studentID, at)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RemoveMember lets the class's tutor remove anyone, and students remove
+// themselves.
+func (s pgClasses) RemoveMember(ctx context.Context, classID, studentID string) error {
+	uid, err := s.c.caller()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.c.pool.Exec(ctx, `
+		delete from class_members
+		where class_id::text = $2 and student_id = $3
+			and (class_id in `+ownClassIDs+` or student_id in `+ownStudentIDs+`)`,
+		uid, classID, studentID)
+	return err
+}
+
+func (s pgClasses) StudentClasses(ctx context.Context, studentID string) ([]models.StudentClass, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.c.pool.Query(ctx, `
+		select m.class_id::text, c.name, t.display_name, coalesce(m.accepted_at, 0)
+		from class_members m
+		join classes c on c.id = m.class_id
+		join tutors t on t.user_id = c.tutor_id
+		where m.student_id = $2 and m.student_id in `+ownStudentIDs+`
+		order by m.created_at`, uid, studentID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.StudentClass, error) {
+		var c models.StudentClass
+		err := row.Scan(&c.ClassID, &c.ClassName, &c.TutorName, &c.AcceptedAt)
+		return c, err
+	})
+}
+
+func (s pgClasses) ClassAssignments(ctx context.Context, classID string, studentIDs []string) ([]models.Assignment, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return nil, err
+	}
+	if studentIDs == nil {
+		studentIDs = []string{}
+	}
+
+	rows, err := s.c.pool.Query(ctx, `
+		select `+assignmentColumns+` from assignments
+		where (class_id::text = $2 or student_id = any($3::text[])) and `+visibleAssignment+`
+		order by created_at desc`, uid, classID, studentIDs)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanAssignment)
+}
+
+func (s pgClasses) StudentAssignments(ctx context.Context, studentID string) ([]models.Assignment, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.c.pool.Query(ctx, `
+		select `+assignmentColumns+` from assignments
+		where (student_id = $2 or class_id in (
+			select class_id from class_members where student_id = $2 and accepted_at is not null
+		))
+			and `+visibleAssignment, uid, studentID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanAssignment)
+}
+
+func scanAssignment(row pgx.CollectableRow) (models.Assignment, error) {
+	var a models.Assignment
+	err := row.Scan(&a.ID, &a.TutorID, &a.ClassID, &a.StudentID, &a.Title, &a.Tags, &a.CardIDs, &a.LearnBy)
+	return a, err
+}
+
+// CreateAssignment lets tutors assign to their own classes and to the
+// students in them.
+func (s pgClasses) CreateAssignment(ctx context.Context, assignment models.Assignment) (models.Assignment, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return models.Assignment{}, err
+	}
+	if assignment.TutorID != uid {
+		return models.Assignment{}, ErrForbidden
+	}
+	if assignment.StudentID != "" {
+		if ok, err := s.c.tutors(ctx, uid, assignment.StudentID); err != nil {
+			return models.Assignment{}, err
+		} else if !ok {
+			return models.Assignment{}, ErrForbidden
+		}
+	}
+	if assignment.ClassID != "" {
+		if _, err := s.Class(ctx, assignment.ClassID); errors.Is(err, ErrNotFound) {
+			return models.Assignment{}, ErrForbidden
+		} else if err != nil {
+			return models.Assignment{}, err
+		}
+	}
+
+	// The array columns are not null
+	if assignment.Tags == nil {
+		assignment.Tags = []string{}
+	}
+	if assignment.CardIDs == nil {
+		assignment.CardIDs = []string{}
+	}
+
+	rows, err := s.c.pool.Query(ctx, `
+		insert into assignments (tutor_id, class_id, student_id, title, tags, card_ids, learn_by)
+		values ($1, nullif($2, '')::uuid, nullif($3, ''), $4, $5, $6, nullif($7, '')::date)
+		returning `+assignmentColumns,
+		uid, assignment.ClassID, assignment.StudentID, assignment.Title, assignment.Tags, assignment.CardIDs, assignment.LearnBy)
+	if err != nil {
+		return models.Assignment{}, err
+	}
+	return pgx.CollectOneRow(rows, scanAssignment)
+}
+
+func (s pgClasses) DeleteAssignment(ctx context.Context, assignmentID string) error {
+	uid, err := s.c.caller()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.c.pool.Exec(ctx, `delete from assignments where tutor_id = $1 and id::text = $2`, uid, assignmentID)
+	return err
+}
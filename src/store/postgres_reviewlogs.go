@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// reviewLogColumns is the review_logs projection read by scanReviewLog.
+const reviewLogColumns = `id::text, student_id, card_id, ord, rating, prev_status, new_status, prev_due, new_due,
+	time_taken_ms, reviewed_at, prev_stability, prev_difficulty, prev_last_review, counted_new_card,
+	prev_streak_start_time, prev_streak_end_time, prev_lapses, prev_suspended, prev_leech, buried_siblings`
+
+// The caller can read their own history and their students'.
+const visibleReviewLog = `(student_id in ` + ownStudentIDs + ` or student_id in ` + tutoredStudentIDs + `)`
+
+type pgReviewLogs struct{ c *pgClient }
+
+// Insert only logs answers to the caller's own cards.
+func (s pgReviewLogs) Insert(ctx context.Context, entry models.ReviewLog) (string, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return "", err
+	}
+
+	noteID, ord := models.SplitCardKey(entry.CardID)
+	buriedSiblings := entry.BuriedSiblings
+	if buriedSiblings == nil {
+		buriedSiblings = []models.BuriedSibling{}
+	}
+
+	var id string
+	err = s.c.pool.QueryRow(ctx, `
+		insert into review_logs (student_id, card_id, rating, prev_status, new_status, prev_due, new_due,
+			time_taken_ms, reviewed_at, prev_stability, prev_difficulty, prev_last_review, counted_new_card,
+			prev_streak_start_time, prev_streak_end_time, prev_lapses, prev_suspended, prev_leech, ord, buried_siblings)
+		select $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21
+		where $2 in `+ownStudentIDs+`
+			and exists (select 1 from students_cards where student_id = $2 and card_id = $3 and ord = $20)
+		returning id::text`,
+		uid, entry.StudentID, noteID, entry.Rating, entry.PrevStatus, entry.NewStatus, entry.PrevDue, entry.NewDue,
+		entry.TimeTakenMs, entry.ReviewedAt, entry.PrevStability, entry.PrevDifficulty, entry.PrevLastReview, entry.CountedNewCard,
+		entry.PrevStreakStartTime, entry.PrevStreakEndTime, entry.PrevLapses, entry.PrevSuspended, entry.PrevLeech, ord, buriedSiblings).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrForbidden
+	}
+	return id, err
+}
+
+func (s pgReviewLogs) Get(ctx context.Context, studentID, logID string) (models.ReviewLog, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return models.ReviewLog{}, err
+	}
+
+	rows, err := s.c.pool.Query(ctx, `
+		select `+reviewLogColumns+` from review_logs
+		where id::text = $3 and student_id = $2 and undone_at is null and `+visibleReviewLog,
+		uid, studentID, logID)
+	if err != nil {
+		return models.ReviewLog{}, err
+	}
+	entry, err := pgx.CollectOneRow(rows, scanReviewLog)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ReviewLog{}, ErrNotFound
+	}
+	return entry, err
+}
+
+// MarkUndone only marks the caller's own answers.
+func (s pgReviewLogs) MarkUndone(ctx context.Context, studentID, logID string, at int64) error {
+	uid, err := s.c.caller()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.c.pool.Exec(ctx, `
+		update review_logs set undone_at = $4
+		where id::text = $3 and student_id = $2 and undone_at is null and student_id in `+ownStudentIDs,
+		uid, studentID, logID, at)
+	return err
+}
+
+func (s pgReviewLogs) Since(ctx context.Context, studentID string, since int64) ([]models.ReviewLog, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.c.pool.Query(ctx, `
+		select `+reviewLogColumns+` from review_logs
+		where student_id = $2 and reviewed_at >= $3 and undone_at is null and `+visibleReviewLog+`
+		order by reviewed_at`,
+		uid, studentID, since)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanReviewLog)
+}
+
+func (s pgReviewLogs) IntroducedSince(ctx context.Context, studentID string, since int64) (map[string]bool, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.c.pool.Query(ctx, `
+		select card_id, ord from review_logs
+		where student_id = $2 and prev_status = 0 and reviewed_at >= $3 and undone_at is null and `+visibleReviewLog,
+		uid, studentID, since)
+	if err != nil {
+		return nil, err
+	}
+	cardIDs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (string, error) {
+		var noteID string
+		var ord int
+		err := row.Scan(&noteID, &ord)
+		return models.CardKey(noteID, ord), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	introduced := make(map[string]bool, len(cardIDs))
+	for _, id := range cardIDs {
+		introduced[id] = true
+	}
+	return introduced, nil
+}
+
+func scanReviewLog(row pgx.CollectableRow) (models.ReviewLog, error) {
+	var l models.ReviewLog
+	var ord int
+	err := row.Scan(&l.ID, &l.StudentID, &l.CardID, &ord, &l.Rating, &l.PrevStatus, &l.NewStatus, &l.PrevDue, &l.NewDue,
+		&l.TimeTakenMs, &l.ReviewedAt, &l.PrevStability, &l.PrevDifficulty, &l.PrevLastReview, &l.CountedNewCard,
+		&l.PrevStreakStartTime, &l.PrevStreakEndTime, &l.PrevLapses, &l.PrevSuspended, &l.PrevLeech, &l.BuriedSiblings)
+	l.CardID = models.CardKey(l.CardID, ord)
+	return l, err
+}
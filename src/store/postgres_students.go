@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type pgStudents struct{ c *pgClient }
+
+// The users_students rows are the caller's only; anyone else's reads as
+// missing and writes to it change nothing, as with RLS.
+
+func (s pgStudents) StudentID(ctx context.Context, userID string) (string, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return "", err
+	}
+	if userID != uid {
+		return "", nil
+	}
+
+	var studentID string
+	err = s.c.pool.QueryRow(ctx, `select student_id from users_students where user_id = $1`, uid).Scan(&studentID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return studentID, err
+}
+
+func (s pgStudents) Create(ctx context.Context, userID, studentID string) error {
+	uid, err := s.c.caller()
+	if err != nil {
+		return err
+	}
+	if userID != uid {
+		return ErrForbidden
+	}
+
+	_, err = s.c.pool.Exec(ctx, `
+		insert into users_students (user_id, student_id, default_cards_linked)
+		values ($1, $2, false)`, uid, studentID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "users_students_student_id_key" {
+		return ErrStudentIDTaken
+	}
+	return err
+}
+
+func (s pgStudents) DefaultCardsLinked(ctx context.Context, userID string) (bool, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return false, err
+	}
+	if userID != uid {
+		return false, ErrNotFound
+	}
+
+	var linked bool
+	err = s.c.pool.QueryRow(ctx, `
+		select default_cards_linked from users_students where user_id = $1`, uid).Scan(&linked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	return linked, err
+}
+
+func (s pgStudents) SetDefaultCardsLinked(ctx context.Context, userID string) error {
+	uid, err := s.c.caller()
+	if err != nil || userID != uid {
+		return err
+	}
+
+	_, err = s.c.pool.Exec(ctx, `
+		update users_students set default_cards_linked = true where user_id = $1`, uid)
+	return err
+}
+
+func (s pgStudents) NewCardCount(ctx context.Context, userID string) (NewCardCount, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return NewCardCount{}, err
+	}
+	if userID != uid {
+		return NewCardCount{}, ErrNotFound
+	}
+
+	var count NewCardCount
+	err = s.c.pool.QueryRow(ctx, `
+		select coalesce(num_new_cards_today, 0), coalesce(num_new_cards_today_updated_at, 0)
+		from users_students where user_id = $1`, uid).Scan(&count.Count, &count.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return NewCardCount{}, ErrNotFound
+	}
+	return count, err
+}
+
+func (s pgStudents) SetNewCardCount(ctx context.Context, userID string, count NewCardCount) error {
+	uid, err := s.c.caller()
+	if err != nil || userID != uid {
+		return err
+	}
+
+	_, err = s.c.pool.Exec(ctx, `
+		update users_students
+		set num_new_cards_today = $2, num_new_cards_today_updated_at = $3
+		where user_id = $1`, uid, count.Count, count.UpdatedAt)
+	return err
+}
+
+func (s pgStudents) Streak(ctx context.Context, userID string) (Streak, error) {
+	uid, err := s.c.caller()
+	if err != nil {
+		return Streak{}, err
+	}
+	if userID != uid {
+		return Streak{}, ErrNotFound
+	}
+
+	var streak Streak
+	err = s.c.pool.QueryRow(ctx, `
+		select coalesce(streak_start_time, 0), coalesce(streak_end_time, 0)
+		from users_students where user_id = $1`, uid).Scan(&streak.Start, &streak.End)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Streak{}, ErrNotFound
+	}
+	return streak, err
+}
+
+func (s pgStudents) SetStreak(ctx context.Context, userID string, streak Streak) error {
+	uid, err := s.c.caller()
+	if err != nil || userID != uid {
+		return err
+	}
+
+	_, err = s.c.pool.Exec(ctx, `
+		update users_students set streak_start_time = $2, streak_end_time = $3
+		where user_id = $1`, uid, streak.Start, streak.End)
+	return err
+}
+
+// Settings can be read by the student and by their tutors.
+func (s pgStudents) Settings(ctx context.Context, studentID string) (models.StudentSettings, error) {
+	settings := models.DefaultStudentSettings(studentID)
+	uid, err := s.c.caller()
+	if err != nil {
+		return settings, err
+	}
+
+	err = s.c.pool.QueryRow(ctx, `
+		select new_cards_per_day, max_in_progress, default_tag_filter, day_rollover_hour,
+			scheduling_profile, leech_threshold, leech_action
+		from student_settings
+		where student_id = $2
+			and (student_id in `+ownStudentIDs+` or student_id in `+tutoredStudentIDs+`)`,
+		uid, studentID).Scan(
+		&settings.NewCardsPerDay, &settings.MaxInProgress, &settings.DefaultTagFilter, &settings.DayRolloverHour,
+		&settings.SchedulingProfile, &settings.LeechThreshold, &settings.LeechAction)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.DefaultStudentSettings(studentID), nil
+	}
+	return settings, err
+}
+
+func (s pgStudents) SaveSettings(ctx context.Context, settings models.StudentSettings) error {
+	uid, err := s.c.caller()
+	if err != nil {
+		return err
+	}
+	if ok, err := s.c.owns(ctx, uid, settings.StudentID); err != nil {
+		return err
+	} else if !ok {
+		return ErrForbidden
+	}
+
+	_, err = s.c.pool.Exec(ctx, `
+		insert into student_settings (student_id, new_cards_per_day, max_in_progress, default_tag_filter,
+			day_rollover_hour, scheduling_profile, leech_threshold, leech_action)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)
+		on conflict (student_id) do update set
+			new_cards_per_day = excluded.new_cards_per_day,
+			max_in_progress = excluded.max_in_progress,
+			default_tag_filter = excluded.default_tag_filter,
+			day_rollover_hour = excluded.day_rollover_hour,
+			scheduling_profile = excluded.scheduling_profile,
+			leech_threshold = excluded.leech_threshold,
+			leech_action = excluded.leech_action`,
+		settings.StudentID, settings.NewCardsPerDay, settings.MaxInProgress, settings.DefaultTagFilter,
+		settings.DayRolloverHour, settings.SchedulingProfile, settings.LeechThreshold, settings.LeechAction)
+	return err
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// postgrest is the Supabase PostgREST backend.
+type postgrest struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewPostgREST talks to the PostgREST API under baseURL (the Supabase
+// project URL) with the project's anon key.
+func NewPostgREST(baseURL, apiKey string) Backend {
+	return &postgrest{baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey, client: http.DefaultClient}
+}
+
+func (p *postgrest) For(accessToken string) Stores {
+	c := &restClient{postgrest: p, token: accessToken}
+	return Stores{
+		Students:     restStudents{c},
+		StudentCards: restStudentCards{c},
+		Cards:        restCards{c},
+		ReviewLogs:   restReviewLogs{c},
+		Classes:      restClasses{c},
+	}
+}
+
+type restClient struct {
+	*postgrest
+	token string
+}
+
+// apiError is an error response from PostgREST. Code is the Postgres error
+// code when there is one, e.g. 23503 for a foreign key violation.
+type apiError struct {
+	Status  int
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("postgrest: status %d: %s %s", e.Status, e.Code, e.Message)
+}
+
+func isPostgresError(err error, code string) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.Code == code
+}
+
+// do sends one request to table. Filters go in query so that every value is
+// escaped. body is sent as JSON if not nil, and the response is decoded into
+// out if not nil.
+func (c *restClient) do(ctx context.Context, method, table string, query url.Values, body interface{}, prefer string, out interface{}) error {
+	endpoint := c.baseURL + "/rest/v1/" + table
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s request: %w", table, err)
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("apikey", c.apiKey)
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if prefer != "" {
+		req.Header.Set("Prefer", prefer)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", table, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+	if resp.StatusCode >= 300 {
+		apiErr := &apiError{Status: resp.StatusCode}
+		msg, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(msg, apiErr) != nil {
+			apiErr.Message = string(msg)
+		}
+		return apiErr
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode %s response: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// filter builds the query for a request. Pairs are column and value; each
+// value is matched with eq.
+func filter(pairs ...string) url.Values {
+	q := url.Values{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		q.Set(pairs[i], "eq."+pairs[i+1])
+	}
+	return q
+}
+
+// quote makes a value safe inside PostgREST's in.(...) and or=(...) lists.
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+func inList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = quote(v)
+	}
+	return "in.(" + strings.Join(quoted, ",") + ")"
+}
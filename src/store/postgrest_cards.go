@@ -0,0 +1,280 @@
+package store
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/abstract-tutoring/models"
+	"github.com/abstract-tutoring/utils"
+)
+
+// studentCardColumns is the students_cards projection decoded into restStudentCard.
+const studentCardColumns = "card_id,ord,status,due,stability,difficulty,last_review,lapses,suspended,leech,buried_until"
+
+// restStudentCard is a students_cards row. Its card_id is the note; key
+// gives the card.
+type restStudentCard struct {
+	models.StudentCard
+	Ord int `json:"ord"`
+}
+
+func (c restStudentCard) key() models.StudentCard {
+	c.CardID = models.CardKey(c.CardID, c.Ord)
+	return c.StudentCard
+}
+
+// studentCardFilter matches one of the student's cards by its key.
+func studentCardFilter(studentID, cardID string) url.Values {
+	noteID, ord := models.SplitCardKey(cardID)
+	return filter("student_id", studentID, "card_id", noteID, "ord", strconv.Itoa(ord))
+}
+
+type restStudentCards struct{ c *restClient }
+
+// List returns the student's cards in card ID order.
+func (s restStudentCards) List(ctx context.Context, studentID string) ([]models.StudentCard, error) {
+	q := filter("student_id", studentID)
+	q.Set("select", studentCardColumns)
+
+	var rows []restStudentCard
+	if err := s.c.do(ctx, "GET", "students_cards", q, nil, "", &rows); err != nil {
+		return nil, err
+	}
+
+	cards := make([]models.StudentCard, 0, len(rows))
+	for _, row := range rows {
+		cards = append(cards, row.key())
+	}
+	sort.Slice(cards, func(i, j int) bool {
+		return utils.LexicalCardIDLess(cards[i].CardID, cards[j].CardID)
+	})
+	return cards, nil
+}
+
+func (s restStudentCards) Get(ctx context.Context, studentID, cardID string) (models.StudentCard, error) {
+	q := studentCardFilter(studentID, cardID)
+	q.Set("select", studentCardColumns)
+
+	var rows []restStudentCard
+	if err := s.c.do(ctx, "GET", "students_cards", q, nil, "", &rows); err != nil {
+		return models.StudentCard{}, err
+	}
+	if len(rows) == 0 {
+		return models.StudentCard{}, ErrNotFound
+	}
+	return rows[0].key(), nil
+}
+
+func (s restStudentCards) Update(ctx context.Context, studentID, cardID string, fields map[string]interface{}) error {
+	return s.c.do(ctx, "PATCH", "students_cards", studentCardFilter(studentID, cardID), fields, "", nil)
+}
+
+// Link reads which ords each note makes, then adds a row for each.
+func (s restStudentCards) Link(ctx context.Context, studentID string, noteIDs []string) error {
+	if len(noteIDs) == 0 {
+		return nil
+	}
+
+	var notes []struct {
+		ID   string `json:"id"`
+		Ords []int  `json:"ords"`
+	}
+	q := url.Values{"select": {"id,ords"}, "id": {inList(noteIDs)}}
+	if err := s.c.do(ctx, "GET", "cards", q, nil, "", &notes); err != nil {
+		return err
+	}
+
+	type link struct {
+		StudentID string `json:"student_id"`
+		CardID    string `json:"card_id"`
+		Ord       int    `json:"ord"`
+	}
+	links := make([]link, 0, len(notes))
+	for _, note := range notes {
+		for _, ord := range noteOrds(note.Ords) {
+			links = append(links, link{StudentID: studentID, CardID: note.ID, Ord: ord})
+		}
+	}
+	if len(links) == 0 {
+		return nil
+	}
+
+	q = url.Values{"on_conflict": {"student_id,card_id,ord"}}
+	err := s.c.do(ctx, "POST", "students_cards", q, links, "resolution=ignore-duplicates", nil)
+	if isPostgresError(err, "23503") {
+		return ErrStudentNotFound
+	}
+	return err
+}
+
+func (s restStudentCards) Unlink(ctx context.Context, studentID, cardID string) error {
+	return s.c.do(ctx, "DELETE", "students_cards", studentCardFilter(studentID, cardID), nil, "", nil)
+}
+
+type restCards struct{ c *restClient }
+
+func (s restCards) All(ctx context.Context) (map[string]models.Flashcard, error) {
+	q := url.Values{"select": {"id,front,back,assets,created_by,ords,cards_tags(tags(id,name))"}}
+
+	var cardList []struct {
+		models.Flashcard
+		CardsTags []struct {
+			Tags models.Tag `json:"tags"`
+		} `json:"cards_tags"`
+	}
+	if err := s.c.do(ctx, "GET", "cards", q, nil, "", &cardList); err != nil {
+		return nil, err
+	}
+
+	cards := make(map[string]models.Flashcard, len(cardList))
+	for _, wrapped := range cardList {
+		card := wrapped.Flashcard
+		for _, rel := range wrapped.CardsTags {
+			card.Tags = append(card.Tags, rel.Tags)
+		}
+		cards[card.ID] = card
+	}
+	return cards, nil
+}
+
+func (s restCards) Get(ctx context.Context, cardID string) (models.Flashcard, error) {
+	q := filter("id", cardID)
+	q.Set("select", "id,front,back,assets,created_by,ords")
+
+	var cards []models.Flashcard
+	if err := s.c.do(ctx, "GET", "cards", q, nil, "", &cards); err != nil {
+		return models.Flashcard{}, err
+	}
+	if len(cards) == 0 {
+		return models.Flashcard{}, ErrNotFound
+	}
+	return cards[0], nil
+}
+
+func (s restCards) IDsCreatedBy(ctx context.Context, userID string) ([]string, error) {
+	q := filter("created_by", userID)
+	q.Set("select", "id")
+
+	var rows []struct {
+		ID string `json:"id"`
+	}
+	if err := s.c.do(ctx, "GET", "cards", q, nil, "", &rows); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.ID)
+	}
+	return ids, nil
+}
+
+func (s restCards) DefaultIDs(ctx context.Context) ([]string, error) {
+	q := url.Values{
+		"select":     {"id"},
+		"created_by": {"is.null"},
+		"is_default": {"is.true"},
+		"order":      {"id"},
+	}
+
+	var rows []struct {
+		ID string `json:"id"`
+	}
+	if err := s.c.do(ctx, "GET", "cards", q, nil, "", &rows); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.ID)
+	}
+	return ids, nil
+}
+
+func (s restCards) Insert(ctx context.Context, card models.Flashcard) error {
+	assets := card.Assets
+	if assets == nil {
+		assets = []models.Asset{}
+	}
+	return s.c.do(ctx, "POST", "cards", nil, map[string]interface{}{
+		"id":         card.ID,
+		"front":      card.Front,
+		"back":       card.Back,
+		"assets":     assets,
+		"created_by": card.CreatedBy,
+		"ords":       noteOrds(card.Ords),
+	}, "", nil)
+}
+
+func (s restCards) UpdateContent(ctx context.Context, cardID string, front, back models.Content, ords []int) error {
+	return s.c.do(ctx, "PATCH", "cards", filter("id", cardID), map[string]interface{}{
+		"front": front,
+		"back":  back,
+		"ords":  noteOrds(ords),
+	}, "", nil)
+}
+
+func (s restCards) AppendAsset(ctx context.Context, cardID string, asset models.Asset) error {
+	return s.c.do(ctx, "POST", "rpc/append_card_asset", nil, map[string]interface{}{
+		"card_id": cardID,
+		"asset":   asset,
+	}, "", nil)
+}
+
+func (s restCards) Tags(ctx context.Context, cardID string) ([]models.Tag, error) {
+	q := filter("card_id", cardID)
+	q.Set("select", "tags(id,name)")
+
+	var joined []struct {
+		Tag models.Tag `json:"tags"`
+	}
+	if err := s.c.do(ctx, "GET", "cards_tags", q, nil, "", &joined); err != nil {
+		return nil, err
+	}
+
+	tags := []models.Tag{}
+	for _, j := range joined {
+		tags = append(tags, j.Tag)
+	}
+	return tags, nil
+}
+
+func (s restCards) SetTags(ctx context.Context, cardID string, names []string) error {
+	if err := s.c.do(ctx, "DELETE", "cards_tags", filter("card_id", cardID), nil, "", nil); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		tagID, err := s.upsertTag(ctx, name)
+		if err != nil {
+			return err
+		}
+		link := []models.FlashcardTag{{CardID: cardID, TagID: tagID}}
+		if err := s.c.do(ctx, "POST", "cards_tags", nil, link, "resolution=ignore-duplicates", nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upsertTag returns the ID of the named tag, creating it if needed.
+func (s restCards) upsertTag(ctx context.Context, name string) (int, error) {
+	q := filter("name", name)
+	q.Set("select", "id")
+
+	var found []models.Tag
+	if err := s.c.do(ctx, "GET", "tags", q, nil, "", &found); err == nil && len(found) > 0 {
+		return found[0].ID, nil
+	}
+
+	var inserted []models.Tag
+	err := s.c.do(ctx, "POST", "tags", url.Values{"select": {"id"}},
+		[]map[string]string{{"name": name}}, "return=representation", &inserted)
+	if err != nil {
+		return 0, err
+	}
+	if len(inserted) == 0 {
+		return 0, ErrNotFound
+	}
+	return inserted[0].ID, nil
+}
@@ -0,0 +1,213 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/abstract-tutoring/models"
+)
+
+type restClasses struct{ c *restClient }
+
+func (s restClasses) Tutor(ctx context.Context, userID string) (models.Tutor, bool, error) {
+	q := filter("user_id", userID)
+	q.Set("select", "user_id,display_name")
+
+	var rows []models.Tutor
+	if err := s.c.do(ctx, "GET", "tutors", q, nil, "", &rows); err != nil {
+		return models.Tutor{}, false, err
+	}
+	if len(rows) == 0 {
+		return models.Tutor{}, false, nil
+	}
+	return rows[0], true, nil
+}
+
+func (s restClasses) Classes(ctx context.Context, tutorID string) ([]models.Class, error) {
+	q := filter("tutor_id", tutorID)
+	q.Set("select", "id,tutor_id,name")
+	q.Set("order", "name.asc")
+
+	var classes []models.Class
+	if err := s.c.do(ctx, "GET", "classes", q, nil, "", &classes); err != nil {
+		return nil, err
+	}
+	return classes, nil
+}
+
+// Class returns ErrNotFound for other tutors' classes, which RLS hides from
+// all but the students invited to them.
+func (s restClasses) Class(ctx context.Context, classID string) (models.Class, error) {
+	q := filter("id", classID)
+	q.Set("select", "id,tutor_id,name")
+
+	var classes []models.Class
+	if err := s.c.do(ctx, "GET", "classes", q, nil, "", &classes); err != nil {
+		return models.Class{}, err
+	}
+	if len(classes) == 0 {
+		return models.Class{}, ErrNotFound
+	}
+	return classes[0], nil
+}
+
+func (s restClasses) CreateClass(ctx context.Context, tutorID, name string) (models.Class, error) {
+	var created []models.Class
+	err := s.c.do(ctx, "POST", "classes", nil, models.Class{TutorID: tutorID, Name: name}, "return=representation", &created)
+	if err != nil {
+		return models.Class{}, err
+	}
+	if len(created) == 0 {
+		return models.Class{}, errors.New("unable to read created class")
+	}
+	return created[0], nil
+}
+
+func (s restClasses) DeleteClass(ctx context.Context, classID string) error {
+	return s.c.do(ctx, "DELETE", "classes", filter("id", classID), nil, "", nil)
+}
+
+func (s restClasses) Members(ctx context.Context, classID string) ([]models.ClassMember, error) {
+	q := filter("class_id", classID)
+	q.Set("select", "class_id,student_id,created_at,accepted_at")
+	q.Set("order", "created_at.asc")
+
+	var members []models.ClassMember
+	if err := s.c.do(ctx, "GET", "class_members", q, nil, "", &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (s restClasses) AddMember(ctx context.Context, classID, studentID string) error {
+	err := s.c.do(ctx, "POST", "class_members", nil, models.ClassMember{ClassID: classID, StudentID: studentID}, "", nil)
+	switch {
+	case isPostgresError(err, "23503"): // foreign key: no such student
+		return ErrStudentNotFound
+	case isPostgresError(err, "23505"): // already a member
+		return nil
+	}
+	return err
+}
+
+func (s restClasses) RemoveMember(ctx context.Context, classID, studentID string) error {
+	return s.c.do(ctx, "DELETE", "class_members", filter("class_id", classID, "student_id", studentID), nil, "", nil)
+}
+
+func (s restClasses) AcceptMember(ctx context.Context, classID, studentID string, at int64) error {
+	q := filter("class_id", classID, "student_id", studentID)
+	q.Set("accepted_at", "is.null")
+	q.Set("select", "class_id")
+
+	var accepted []models.ClassMember
+	err := s.c.do(ctx, "PATCH", "class_members", q, map[string]interface{}{"accepted_at": at}, "return=representation", &accepted)
+	if err != nil {
+		return err
+	}
+	if len(accepted) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s restClasses) StudentClasses(ctx context.Context, studentID string) ([]models.StudentClass, error) {
+	q := filter("student_id", studentID)
+	q.Set("select", "class_id,accepted_at,classes(name,tutors(display_name))")
+	q.Set("order", "created_at.asc")
+
+	var rows []struct {
+		ClassID    string `json:"class_id"`
+		AcceptedAt *int64 `json:"accepted_at"`
+		Class      struct {
+			Name  string `json:"name"`
+			Tutor struct {
+				DisplayName string `json:"display_name"`
+			} `json:"tutors"`
+		} `json:"classes"`
+	}
+	if err := s.c.do(ctx, "GET", "class_members", q, nil, "", &rows); err != nil {
+		return nil, err
+	}
+
+	classes := make([]models.StudentClass, 0, len(rows))
+	for _, r := range rows {
+		c := models.StudentClass{ClassID: r.ClassID, ClassName: r.Class.Name, TutorName: r.Class.Tutor.DisplayName}
+		if r.AcceptedAt != nil {
+			c.AcceptedAt = *r.AcceptedAt
+		}
+		classes = append(classes, c)
+	}
+	return classes, nil
+}
+
+func (s restClasses) ClassAssignments(ctx context.Context, classID string, studentIDs []string) ([]models.Assignment, error) {
+	or := "class_id.eq." + quote(classID)
+	if len(studentIDs) > 0 {
+		or += ",student_id." + inList(studentIDs)
+	}
+	q := url.Values{
+		"select": {"*"},
+		"order":  {"created_at.desc"},
+		"or":     {"(" + or + ")"},
+	}
+
+	var assignments []models.Assignment
+	if err := s.c.do(ctx, "GET", "assignments", q, nil, "", &assignments); err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+func (s restClasses) StudentAssignments(ctx context.Context, studentID string) ([]models.Assignment, error) {
+	q := filter("student_id", studentID)
+	q.Set("select", "class_id")
+	q.Set("accepted_at", "not.is.null")
+
+	var memberships []models.ClassMember
+	if err := s.c.do(ctx, "GET", "class_members", q, nil, "", &memberships); err != nil {
+		return nil, err
+	}
+
+	or := "student_id.eq." + quote(studentID)
+	if len(memberships) > 0 {
+		classIDs := make([]string, 0, len(memberships))
+		for _, m := range memberships {
+			classIDs = append(classIDs, m.ClassID)
+		}
+		or += ",class_id." + inList(classIDs)
+	}
+	q = url.Values{
+		"select": {"*"},
+		"or":     {"(" + or + ")"},
+	}
+
+	var assignments []models.Assignment
+	if err := s.c.do(ctx, "GET", "assignments", q, nil, "", &assignments); err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+func (s restClasses) CreateAssignment(ctx context.Context, assignment models.Assignment) (models.Assignment, error) {
+	// The array columns are not null
+	if assignment.Tags == nil {
+		assignment.Tags = []string{}
+	}
+	if assignment.CardIDs == nil {
+		assignment.CardIDs = []string{}
+	}
+
+	var created []models.Assignment
+	if err := s.c.do(ctx, "POST", "assignments", nil, assignment, "return=representation", &created); err != nil {
+		return models.Assignment{}, err
+	}
+	if len(created) == 0 {
+		return models.Assignment{}, errors.New("unable to read created assignment")
+	}
+	return created[0], nil
+}
+
+func (s restClasses) DeleteAssignment(ctx context.Context, assignmentID string) error {
+	return s.c.do(ctx, "DELETE", "assignments", filter("id", assignmentID), nil, "", nil)
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+
+	"github.com/abstract-tutoring/models"
+)
+
+// reviewLogPageSize stays under PostgREST's default max-rows.
+const reviewLogPageSize = 1000
+
+// restReviewLog is a review_logs row. Its card_id is the note, as in
+// students_cards.
+type restReviewLog struct {
+	models.ReviewLog
+	CardID string `json:"card_id"`
+	Ord    int    `json:"ord"`
+}
+
+func toRestReviewLog(entry models.ReviewLog) restReviewLog {
+	noteID, ord := models.SplitCardKey(entry.CardID)
+	return restReviewLog{ReviewLog: entry, CardID: noteID, Ord: ord}
+}
+
+func (l restReviewLog) key() models.ReviewLog {
+	l.ReviewLog.CardID = models.CardKey(l.CardID, l.Ord)
+	return l.ReviewLog
+}
+
+type restReviewLogs struct{ c *restClient }
+
+func (s restReviewLogs) Insert(ctx context.Context, entry models.ReviewLog) (string, error) {
+	var inserted []struct {
+		ID string `json:"id"`
+	}
+	err := s.c.do(ctx, "POST", "review_logs", url.Values{"select": {"id"}}, toRestReviewLog(entry), "return=representation", &inserted)
+	if err != nil {
+		return "", err
+	}
+	if len(inserted) == 0 {
+		return "", errors.New("unable to read inserted review log")
+	}
+	return inserted[0].ID, nil
+}
+
+func (s restReviewLogs) Get(ctx context.Context, studentID, logID string) (models.ReviewLog, error) {
+	q := filter("id", logID, "student_id", studentID)
+	q.Set("select", "*")
+	q.Set("undone_at", "is.null")
+
+	var logs []restReviewLog
+	if err := s.c.do(ctx, "GET", "review_logs", q, nil, "", &logs); err != nil {
+		return models.ReviewLog{}, err
+	}
+	if len(logs) == 0 {
+		return models.ReviewLog{}, ErrNotFound
+	}
+	return logs[0].key(), nil
+}
+
+func (s restReviewLogs) MarkUndone(ctx context.Context, studentID, logID string, at int64) error {
+	q := filter("id", logID, "student_id", studentID)
+	q.Set("undone_at", "is.null")
+	return s.c.do(ctx, "PATCH", "review_logs", q, map[string]interface{}{"undone_at": at}, "", nil)
+}
+
+func (s restReviewLogs) Since(ctx context.Context, studentID string, since int64) ([]models.ReviewLog, error) {
+	var logs []models.ReviewLog
+	for offset := 0; ; offset += reviewLogPageSize {
+		q := filter("student_id", studentID)
+		q.Set("select", "*")
+		q.Set("reviewed_at", "gte."+strconv.FormatInt(since, 10))
+		q.Set("undone_at", "is.null")
+		q.Set("order", "reviewed_at.asc")
+		q.Set("limit", strconv.Itoa(reviewLogPageSize))
+		q.Set("offset", strconv.Itoa(offset))
+
+		var page []restReviewLog
+		if err := s.c.do(ctx, "GET", "review_logs", q, nil, "", &page); err != nil {
+			return nil, err
+		}
+
+		for _, l := range page {
+			logs = append(logs, l.key())
+		}
+		if len(page) < reviewLogPageSize {
+			return logs, nil
+		}
+	}
+}
+
+func (s restReviewLogs) IntroducedSince(ctx context.Context, studentID string, since int64) (map[string]bool, error) {
+	q := filter("student_id", studentID, "prev_status", "0")
+	q.Set("select", "card_id,ord")
+	q.Set("reviewed_at", "gte."+strconv.FormatInt(since, 10))
+	q.Set("undone_at", "is.null")
+
+	var rows []struct {
+		CardID string `json:"card_id"`
+		Ord    int    `json:"ord"`
+	}
+	if err := s.c.do(ctx, "GET", "review_logs", q, nil, "", &rows); err != nil {
+		return nil, err
+	}
+	introduced := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		introduced[models.CardKey(row.CardID, row.Ord)] = true
+	}
+	return introduced, nil
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/abstract-tutoring/models"
+)
+
+type restStudents struct{ c *restClient }
+
+func (s restStudents) StudentID(ctx context.Context, userID string) (string, error) {
+	q := filter("user_id", userID)
+	q.Set("select", "student_id")
+
+	var rows []struct {
+		StudentID string `json:"student_id"`
+	}
+	if err := s.c.do(ctx, "GET", "users_students", q, nil, "", &rows); err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", nil
+	}
+	return rows[0].StudentID, nil
+}
+
+func (s restStudents) Create(ctx context.Context, userID, studentID string) error {
+	err := s.c.do(ctx, "POST", "users_students", nil, map[string]interface{}{
+		"user_id":              userID,
+		"student_id":           studentID,
+		"default_cards_linked": false,
+	}, "", nil)
+	// The other unique key is user_id, which is the primary key
+	if isPostgresError(err, "23505") && strings.Contains(err.(*apiError).Message, "users_students_student_id_key") {
+		return ErrStudentIDTaken
+	}
+	return err
+}
+
+func (s restStudents) DefaultCardsLinked(ctx context.Context, userID string) (bool, error) {
+	q := filter("user_id", userID)
+	q.Set("select", "default_cards_linked")
+
+	var rows []struct {
+		DefaultCardsLinked bool `json:"default_cards_linked"`
+	}
+	if err := s.c.do(ctx, "GET", "users_students", q, nil, "", &rows); err != nil {
+		return false, err
+	}
+	if len(rows) == 0 {
+		return false, ErrNotFound
+	}
+	return rows[0].DefaultCardsLinked, nil
+}
+
+func (s restStudents) SetDefaultCardsLinked(ctx context.Context, userID string) error {
+	return s.c.do(ctx, "PATCH", "users_students", filter("user_id", userID), map[string]interface{}{
+		"default_cards_linked": true,
+	}, "", nil)
+}
+
+func (s restStudents) NewCardCount(ctx context.Context, userID string) (NewCardCount, error) {
+	q := filter("user_id", userID)
+	q.Set("select", "num_new_cards_today,num_new_cards_today_updated_at")
+
+	var rows []struct {
+		NumNewCardsToday          int   `json:"num_new_cards_today"`
+		NumNewCardsTodayUpdatedAt int64 `json:"num_new_cards_today_updated_at"`
+	}
+	if err := s.c.do(ctx, "GET", "users_students", q, nil, "", &rows); err != nil {
+		return NewCardCount{}, err
+	}
+	if len(rows) == 0 {
+		return NewCardCount{}, ErrNotFound
+	}
+	return NewCardCount{Count: rows[0].NumNewCardsToday, UpdatedAt: rows[0].NumNewCardsTodayUpdatedAt}, nil
+}
+
+func (s restStudents) SetNewCardCount(ctx context.Context, userID string, count NewCardCount) error {
+	return s.c.do(ctx, "PATCH", "users_students", filter("user_id", userID), map[string]interface{}{
+		"num_new_cards_today":            count.Count,
+		"num_new_cards_today_updated_at": count.UpdatedAt,
+	}, "", nil)
+}
+
+func (s restStudents) Streak(ctx context.Context, userID string) (Streak, error) {
+	q := filter("user_id", userID)
+	q.Set("select", "streak_start_time,streak_end_time")
+
+	var rows []struct {
+		StreakStartTime int64 `json:"streak_start_time"`
+		StreakEndTime   int64 `json:"streak_end_time"`
+	}
+	if err := s.c.do(ctx, "GET", "users_students", q, nil, "", &rows); err != nil {
+		return Streak{}, err
+	}
+	if len(rows) == 0 {
+		return Streak{}, ErrNotFound
+	}
+	return Streak{Start: rows[0].StreakStartTime, End: rows[0].StreakEndTime}, nil
+}
+
+func (s restStudents) SetStreak(ctx context.Context, userID string, streak Streak) error {
+	return s.c.do(ctx, "PATCH", "users_students", filter("user_id", userID), map[string]interface{}{
+		"streak_start_time": streak.Start,
+		"streak_end_time":   streak.End,
+	}, "", nil)
+}
+
+func (s restStudents) Settings(ctx context.Context, studentID string) (models.StudentSettings, error) {
+	q := filter("student_id", studentID)
+	q.Set("select", "*")
+
+	var rows []models.StudentSettings
+	if err := s.c.do(ctx, "GET", "student_settings", q, nil, "", &rows); err != nil {
+		return models.DefaultStudentSettings(studentID), err
+	}
+	if len(rows) == 0 {
+		return models.DefaultStudentSettings(studentID), nil
+	}
+	return rows[0], nil
+}
+
+func (s restStudents) SaveSettings(ctx context.Context, settings models.StudentSettings) error {
+	q := url.Values{"on_conflict": {"student_id"}}
+	return s.c.do(ctx, "POST", "student_settings", q, settings, "resolution=merge-duplicates", nil)
+}
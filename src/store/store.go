@@ -0,0 +1,172 @@
+// Package store is the data access layer. Handlers depend only on the
+// interfaces here; NewPostgREST talks to Supabase, NewPostgres to the
+// database directly and NewMemory keeps everything in memory for tests.
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/abstract-tutoring/models"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+
+	// ErrUnauthorized means the access token was rejected, usually because it
+	// has expired. The caller can refresh it and try again.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrStudentNotFound is returned when a student_id does not exist.
+	ErrStudentNotFound = errors.New("no student with that ID")
+
+	// ErrStudentIDTaken is returned when creating a student whose ID another
+	// user already has.
+	ErrStudentIDTaken = errors.New("student ID already taken")
+
+	// ErrForbidden is returned by the Postgres backend where row level
+	// security would have rejected a write.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// NewCardCount is how many new cards the student has started on the study
+// day containing UpdatedAt.
+type NewCardCount struct {
+	Count     int
+	UpdatedAt int64
+}
+
+// Streak is the first and last time of the student's current streak.
+type Streak struct {
+	Start int64
+	End   int64
+}
+
+// StudentStore holds the per-user rows: the user to student mapping, the
+// daily new card counter, the streak and the scheduling settings.
+type StudentStore interface {
+	// StudentID returns "" with no error if the user has no student.
+	StudentID(ctx context.Context, userID string) (string, error)
+	// Create maps a user who has no student yet to a new one, which does
+	// not have the default cards until SetDefaultCardsLinked.
+	Create(ctx context.Context, userID, studentID string) error
+	// DefaultCardsLinked reports whether the user's student has been given
+	// the default cards.
+	DefaultCardsLinked(ctx context.Context, userID string) (bool, error)
+	SetDefaultCardsLinked(ctx context.Context, userID string) error
+	NewCardCount(ctx context.Context, userID string) (NewCardCount, error)
+	SetNewCardCount(ctx context.Context, userID string, count NewCardCount) error
+	Streak(ctx context.Context, userID string) (Streak, error)
+	SetStreak(ctx context.Context, userID string, streak Streak) error
+	// Settings returns the defaults if the student has never saved any.
+	Settings(ctx context.Context, studentID string) (models.StudentSettings, error)
+	SaveSettings(ctx context.Context, settings models.StudentSettings) error
+}
+
+// StudentCardStore holds each student's progress on their cards. Cards are
+// named by models.CardKey, except in Link.
+type StudentCardStore interface {
+	List(ctx context.Context, studentID string) ([]models.StudentCard, error)
+	Get(ctx context.Context, studentID, cardID string) (models.StudentCard, error)
+	// Update sets the given students_cards columns on one card.
+	Update(ctx context.Context, studentID, cardID string, fields map[string]interface{}) error
+	// Link gives the student every card the notes make. Cards they already
+	// have keep their progress.
+	Link(ctx context.Context, studentID string, noteIDs []string) error
+	Unlink(ctx context.Context, studentID, cardID string) error
+}
+
+// CardStore holds card content and tags.
+type CardStore interface {
+	// All returns every card the caller can read, with its tags.
+	All(ctx context.Context) (map[string]models.Flashcard, error)
+	Get(ctx context.Context, cardID string) (models.Flashcard, error)
+	IDsCreatedBy(ctx context.Context, userID string) ([]string, error)
+	// DefaultIDs returns the official cards every new student is given.
+	DefaultIDs(ctx context.Context) ([]string, error)
+	Insert(ctx context.Context, card models.Flashcard) error
+	// UpdateContent replaces the card's front and back and the ords it makes.
+	// Students keep the cards they had; call Link and Unlink to match.
+	UpdateContent(ctx context.Context, cardID string, front, back models.Content, ords []int) error
+	// AppendAsset adds an asset to the card's own. It is one write, so
+	// uploads to the same card at once don't lose each other's.
+	AppendAsset(ctx context.Context, cardID string, asset models.Asset) error
+	Tags(ctx context.Context, cardID string) ([]models.Tag, error)
+	// SetTags replaces the card's tags, creating any that do not exist yet.
+	SetTags(ctx context.Context, cardID string, names []string) error
+}
+
+// ReviewLogStore holds the answer history.
+type ReviewLogStore interface {
+	// Insert returns the new log's ID.
+	Insert(ctx context.Context, entry models.ReviewLog) (string, error)
+	// Get, Since and IntroducedSince skip answers that have been undone.
+	Get(ctx context.Context, studentID, logID string) (models.ReviewLog, error)
+	// MarkUndone records that the answer was undone at (unix seconds). The
+	// log is kept, as the history is append-only.
+	MarkUndone(ctx context.Context, studentID, logID string, at int64) error
+	// Since returns the answers from since (unix seconds) onwards, oldest first.
+	Since(ctx context.Context, studentID string, since int64) ([]models.ReviewLog, error)
+	// IntroducedSince returns the cards first answered at or after since.
+	IntroducedSince(ctx context.Context, studentID string, since int64) (map[string]bool, error)
+}
+
+// ClassStore holds tutors, their classes and the decks they assign.
+type ClassStore interface {
+	// Tutor returns ok=false if the user is not a tutor.
+	Tutor(ctx context.Context, userID string) (tutor models.Tutor, ok bool, err error)
+	Classes(ctx context.Context, tutorID string) ([]models.Class, error)
+	Class(ctx context.Context, classID string) (models.Class, error)
+	CreateClass(ctx context.Context, tutorID, name string) (models.Class, error)
+	DeleteClass(ctx context.Context, classID string) error
+	// Members returns the students in the order they were added, including
+	// those yet to accept.
+	Members(ctx context.Context, classID string) ([]models.ClassMember, error)
+	// AddMember invites the student to the class. It returns
+	// ErrStudentNotFound for an unknown student; adding a student twice is
+	// not an error.
+	AddMember(ctx context.Context, classID, studentID string) error
+	// AcceptMember is the student accepting the invitation, after which the
+	// tutor can see their progress. It returns ErrNotFound if there is no
+	// invitation waiting.
+	AcceptMember(ctx context.Context, classID, studentID string, at int64) error
+	// RemoveMember is the tutor removing a student, or the student declining
+	// or leaving.
+	RemoveMember(ctx context.Context, classID, studentID string) error
+	// StudentClasses returns the classes the student is in or invited to, in
+	// the order they were added.
+	StudentClasses(ctx context.Context, studentID string) ([]models.StudentClass, error)
+	// ClassAssignments returns the assignments for the class and for each of
+	// the given students, newest first.
+	ClassAssignments(ctx context.Context, classID string, studentIDs []string) ([]models.Assignment, error)
+	// StudentAssignments returns the assignments made to the student directly
+	// or through any class they have joined.
+	StudentAssignments(ctx context.Context, studentID string) ([]models.Assignment, error)
+	CreateAssignment(ctx context.Context, assignment models.Assignment) (models.Assignment, error)
+	DeleteAssignment(ctx context.Context, assignmentID string) error
+}
+
+// Stores is the set of stores for one caller.
+type Stores struct {
+	Students     StudentStore
+	StudentCards StudentCardStore
+	Cards        CardStore
+	ReviewLogs   ReviewLogStore
+	Classes      ClassStore
+}
+
+// Backend opens the stores for a caller. accessToken is their Supabase
+// access token; row level security, or the Postgres backend's own checks,
+// decides what they can see.
+type Backend interface {
+	For(accessToken string) Stores
+}
+
+// noteOrds is the ords to store for a note. A note that names none makes one
+// card, ord 0.
+func noteOrds(ords []int) []int {
+	if len(ords) == 0 {
+		return []int{0}
+	}
+	return ords
+}
@@ -0,0 +1,13 @@
+package utils
+
+import "strings"
+
+// MaskEmail keeps addresses out of the logs while still telling attempts on
+// different accounts apart, e.g. "a***@example.com".
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return "***"
+	}
+	return email[:1] + "***" + email[at:]
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ClientIP is the address the request came from. Behind a reverse proxy,
+// set TRUST_PROXY=true to use the address the proxy appended to
+// X-Forwarded-For instead of the proxy's own.
+func ClientIP(r *http.Request) string {
+	if trust := os.Getenv("TRUST_PROXY"); strings.EqualFold(trust, "true") || trust == "1" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			hops := strings.Split(forwarded, ",")
+			return strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
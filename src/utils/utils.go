@@ -43,3 +43,31 @@ func UnixToUKTime(unixSeconds int64) time.Time {
     }
     return time.Unix(unixSeconds, 0).In(loc)
 }
+
+// StudyDay is the UK calendar date (YYYY-MM-DD) of the study day containing
+// unixSeconds, where each study day starts at rolloverHour rather than midnight.
+func StudyDay(unixSeconds int64, rolloverHour int) string {
+	return UnixToUKTime(unixSeconds - int64(rolloverHour)*3600).Format("2006-01-02")
+}
+
+// StudyDayStart is the unix time at which the study day for the given UK date
+// (YYYY-MM-DD) begins.
+func StudyDayStart(day string, rolloverHour int) (int64, error) {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		loc = time.UTC
+	}
+	t, err := time.ParseInLocation("2006-01-02", day, loc)
+	if err != nil {
+		return 0, err
+	}
+	return t.Add(time.Duration(rolloverHour) * time.Hour).Unix(), nil
+}
+
+// NextStudyDayStart is the unix time at which the study day after the one
+// containing unixSeconds begins.
+func NextStudyDayStart(unixSeconds int64, rolloverHour int) int64 {
+	today := UnixToUKTime(unixSeconds - int64(rolloverHour)*3600)
+	tomorrow := time.Date(today.Year(), today.Month(), today.Day()+1, rolloverHour, 0, 0, 0, today.Location())
+	return tomorrow.Unix()
+}